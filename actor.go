@@ -0,0 +1,49 @@
+package flowstate
+
+var ActorFlowAnnotation = `flowstate.actor.flow`
+
+// ActorMailbox is the name of signals carrying actor messages, see Send.
+var ActorMailbox = `flowstate.actor.mailbox`
+
+// Spawn binds the actor state to the flow and starts receiving messages, commit nothing else along with it.
+//
+// An actor processes messages one at a time in the order they are sent: the actor flow is executed for every message,
+// see ActorMessage, and must return Receive once the message is processed. An idle actor is parked,
+// it is resumed by Send in the same commit the oldest message is consumed in.
+// An actor that crashed while processing a message is retried by Recoverer with the same message,
+// once recovery attempts are exhausted the message is dropped and the actor receives the next one.
+// The actor stops if its flow parks it instead of returning Receive, pending messages are received once the actor is spawned again.
+func Spawn(stateCtx *StateCtx, flow FlowID) *WaitSignalCommand {
+	stateCtx.Current.SetAnnotation(ActorFlowAnnotation, string(flow))
+	return Receive(stateCtx)
+}
+
+// Receive transits the actor to its flow with the oldest pending message, the actor is parked until a message is sent if there are none.
+func Receive(stateCtx *StateCtx) *WaitSignalCommand {
+	return WaitSignal(stateCtx, ActorMailbox, FlowID(stateCtx.Current.Annotations[ActorFlowAnnotation]))
+}
+
+// Send puts the message into the mailbox of the actor with the given ID, the message is durable once the command is done.
+func Send(id StateID, payload string) *SignalCommand {
+	return Signal(id, ActorMailbox, payload)
+}
+
+// ActorMessage returns the message the actor is processing.
+func ActorMessage(state State) (payload string, ok bool) {
+	name, payload, ok := ReceivedSignal(state)
+	if !ok || name != ActorMailbox {
+		return ``, false
+	}
+
+	return payload, true
+}
+
+// actorRecoveryExhaustedCommand returns a command that drops the message of an actor that exhausted recovery attempts
+// and receives the next one. It returns nil if the state is not an actor.
+func actorRecoveryExhaustedCommand(stateCtx *StateCtx) Command {
+	if stateCtx.Current.Annotations[ActorFlowAnnotation] == `` {
+		return nil
+	}
+
+	return Receive(stateCtx)
+}
@@ -0,0 +1,135 @@
+//go:build goexperiment.synctest
+
+package flowstate_test
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"sync"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/makasim/flowstate"
+	"github.com/makasim/flowstate/memdriver"
+	"github.com/thejerf/slogassert"
+)
+
+func TestActor(t *testing.T) {
+	f := func(before, after []string, exp []string) {
+		t.Helper()
+
+		synctest.Test(t, func(t *testing.T) {
+			lh := slogassert.New(t, slog.LevelDebug, nil)
+			l := slog.New(slogassert.New(t, slog.LevelDebug, lh))
+
+			actMux := &sync.Mutex{}
+			act := make([]string, 0)
+
+			d := memdriver.New(l)
+			fr := &flowstate.DefaultFlowRegistry{}
+			mustSetFlow(fr, `actor`, flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+				payload, ok := flowstate.ActorMessage(stateCtx.Current)
+				if !ok {
+					t.Errorf("actor %s has no message", stateCtx.Current.ID)
+				}
+				attempt := flowstate.RecoveryAttempt(stateCtx.Current)
+
+				actMux.Lock()
+				act = append(act, fmt.Sprintf("%s:%d", payload, attempt))
+				actMux.Unlock()
+
+				switch {
+				case payload == `poison`:
+					return flowstate.Noop(), nil
+				case payload == `crash` && attempt == 0:
+					return flowstate.Noop(), nil
+				}
+
+				time.Sleep(time.Second * 10)
+				return flowstate.Receive(stateCtx), nil
+			}))
+
+			e, err := flowstate.NewEngine(d, fr, l)
+			if err != nil {
+				t.Fatalf("failed to create engine: %v", err)
+			}
+			defer func() {
+				if err := e.Shutdown(context.Background()); err != nil {
+					t.Fatalf("failed to shutdown engine: %v", err)
+				}
+			}()
+
+			r, err := flowstate.NewRecoverer(e, l)
+			if err != nil {
+				t.Fatalf("failed to create recoverer: %v", err)
+			}
+			defer func() {
+				if err := r.Shutdown(context.Background()); err != nil {
+					t.Fatalf("failed to shutdown recoverer: %v", err)
+				}
+			}()
+
+			send := func(payloads []string) {
+				for _, payload := range payloads {
+					if err := e.Do(flowstate.Send(`anActor`, payload)); err != nil {
+						t.Fatalf("failed to send message: %v", err)
+					}
+					time.Sleep(time.Second)
+				}
+			}
+
+			send(before)
+
+			actorStateCtx := &flowstate.StateCtx{
+				Current: flowstate.State{
+					ID: `anActor`,
+				},
+			}
+			if err := e.Do(flowstate.Spawn(actorStateCtx, `actor`)); err != nil {
+				t.Fatalf("failed to spawn actor: %v", err)
+			}
+
+			send(after)
+
+			time.Sleep(time.Hour)
+			synctest.Wait()
+
+			actMux.Lock()
+			defer actMux.Unlock()
+			if !reflect.DeepEqual(exp, act) {
+				t.Fatalf("expected %v, got %v", exp, act)
+			}
+		})
+	}
+
+	// messages processed in order
+	f(
+		[]string{`m0`, `m1`},
+		[]string{`m2`, `m3`, `m4`},
+		[]string{`m0:0`, `m1:0`, `m2:0`, `m3:0`, `m4:0`},
+	)
+
+	// idle actor resumed
+	f(
+		nil,
+		[]string{`m0`},
+		[]string{`m0:0`},
+	)
+
+	// crashed actor restarted
+	f(
+		nil,
+		[]string{`crash`, `m1`},
+		[]string{`crash:0`, `crash:1`, `m1:0`},
+	)
+
+	// poison message dropped
+	f(
+		nil,
+		[]string{`poison`, `m1`},
+		[]string{`poison:0`, `poison:1`, `poison:2`, `poison:3`, `m1:0`},
+	)
+}
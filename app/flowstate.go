@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
@@ -16,6 +17,7 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/makasim/flowstate"
 	"github.com/makasim/flowstate/badgerdriver"
+	"github.com/makasim/flowstate/flowgraph"
 	"github.com/makasim/flowstate/memdriver"
 	"github.com/makasim/flowstate/netdriver"
 	"github.com/makasim/flowstate/netflow"
@@ -32,7 +34,8 @@ func main() {
 	go handleSignals(cancel)
 
 	cfg := config{
-		Driver: "memdriver",
+		Driver:        "memdriver",
+		DelayerShards: 1,
 		BadgerDriver: badgerDriverConfig{
 			Path: "badgerdb",
 		},
@@ -49,6 +52,18 @@ func main() {
 	if os.Getenv("FLOWSTATE_PGDRIVER_CONN_STRING") != "" {
 		cfg.PostgresDriver.ConnString = os.Getenv("FLOWSTATE_PGDRIVER_CONN_STRING")
 	}
+	if os.Getenv("FLOWSTATE_DELAYER_SHARDS") != "" {
+		shards, err := strconv.Atoi(os.Getenv("FLOWSTATE_DELAYER_SHARDS"))
+		if err != nil {
+			log.Printf("ERROR: parse FLOWSTATE_DELAYER_SHARDS: %v", err)
+			os.Exit(1)
+		}
+		cfg.DelayerShards = shards
+	}
+
+	if os.Getenv("FLOWSTATE_GRAPH") != "" {
+		cfg.Graph = os.Getenv("FLOWSTATE_GRAPH") == `true`
+	}
 
 	if err := newApp(cfg).Run(ctx); err != nil {
 		log.Printf("ERROR: %v", err)
@@ -82,6 +97,10 @@ type config struct {
 	Driver         string
 	BadgerDriver   badgerDriverConfig
 	PostgresDriver postgresDriverConfig
+	// DelayerShards must be the same for all app instances sharing the driver.
+	DelayerShards int
+	// Graph mounts the flowgraph handler at /graph, it scans the state history and is not authenticated.
+	Graph bool
 }
 
 type app struct {
@@ -151,7 +170,7 @@ func (a *app) Run(ctx context.Context) error {
 		return fmt.Errorf("recoverer: new: %w", err)
 	}
 
-	dlr, err := flowstate.NewDelayer(e, a.l)
+	dlr, err := flowstate.NewShardedDelayer(e, a.cfg.DelayerShards, a.l)
 	if err != nil {
 		return fmt.Errorf("delayer: new: %w", err)
 	}
@@ -173,6 +192,13 @@ func (a *app) Run(ctx context.Context) error {
 			if netflow.HandleExecute(rw, r, e) {
 				return
 			}
+			if a.cfg.Graph && flowgraph.HandleGraph(rw, r, e) {
+				return
+			}
+			if r.URL.Path == `/metrics` {
+				e.Metrics().ServeHTTP(rw, r)
+				return
+			}
 
 			uiH.ServeHTTP(rw, r)
 		})), &http2.Server{}),
@@ -231,20 +231,100 @@ func (d *Driver) Delay(cmd *flowstate.DelayCommand) error {
 		if err := setDelayedOffsetIndex(txn, delayedState); err != nil {
 			return fmt.Errorf("set delayed offset index: %w", err)
 		}
+		if err := setDelayedStateIDIndex(txn, delayedState); err != nil {
+			return fmt.Errorf("set delayed state id index: %w", err)
+		}
 
 		return nil
 	})
 }
 
+func (d *Driver) CancelDelay(cmd *flowstate.CancelDelayCommand) error {
+	getOffset, commitOffset := d.delayedOffsetSeq.nextWithCommit()
+	defer commitOffset()
+
+	var result []flowstate.DelayedState
+	if err := d.db.Update(func(txn *badger.Txn) error {
+		cancelled, err := getDelayedStatesByID(txn, cmd.StateCtx.Current.ID)
+		if err != nil {
+			return fmt.Errorf("get delayed states by id: %w", err)
+		}
+
+		now := time.Now()
+		for _, delayedState := range cancelled {
+			// delayed states already due are fired by the delayer, so they are neither cancelled nor reported
+			if !delayedState.ExecuteAt.After(now) {
+				continue
+			}
+
+			if err := deleteDelayedState(txn, delayedState); err != nil {
+				return fmt.Errorf("delete delayed state: %w", err)
+			}
+
+			// tombstones are not indexed by the state id, so they are never cancelled
+			tombstoneOffset, err := getOffset()
+			if err != nil {
+				return fmt.Errorf("get next sequence: %w", err)
+			}
+			tombstone := cmd.Tombstone(delayedState, now)
+			tombstone.Offset = tombstoneOffset
+
+			if err := setDelayedState(txn, tombstone); err != nil {
+				return fmt.Errorf("set delayed state tombstone: %w", err)
+			}
+			if err := setDelayedOffsetIndex(txn, tombstone); err != nil {
+				return fmt.Errorf("set delayed offset index tombstone: %w", err)
+			}
+
+			if cmd.RescheduleAt.IsZero() {
+				result = append(result, delayedState)
+				continue
+			}
+
+			nextDelayedState, ok := cmd.Rescheduled(delayedState, now)
+			if !ok {
+				continue
+			}
+
+			nextOffset, err := getOffset()
+			if err != nil {
+				return fmt.Errorf("get next sequence: %w", err)
+			}
+			nextDelayedState.Offset = nextOffset
+
+			if err := setDelayedState(txn, nextDelayedState); err != nil {
+				return fmt.Errorf("set delayed state: %w", err)
+			}
+			if err := setDelayedOffsetIndex(txn, nextDelayedState); err != nil {
+				return fmt.Errorf("set delayed offset index: %w", err)
+			}
+			if err := setDelayedStateIDIndex(txn, nextDelayedState); err != nil {
+				return fmt.Errorf("set delayed state id index: %w", err)
+			}
+
+			result = append(result, nextDelayedState)
+		}
+
+		return nil
+	}); err != nil {
+		return fmt.Errorf("cancel delay: %w", err)
+	}
+
+	cmd.Result = result
+
+	return nil
+}
+
 func (d *Driver) GetDelayedStates(cmd *flowstate.GetDelayedStatesCommand) error {
 	res := &flowstate.GetDelayedStatesResult{}
 
 	if err := d.db.View(func(txn *badger.Txn) error {
 		untilOffset := d.delayedOffsetSeq.maxViewable()
 
-		prefix := delayedStatePrefix(cmd.Since)
+		prefix := delayedStatePrefix()
 		seekPrefix := delayedStateKey(cmd.Since.Unix(), cmd.Offset)
-		if cmd.Offset > 0 || cmd.Since.IsZero() {
+		offsetIndex := cmd.Offset > 0 || cmd.Since.IsZero()
+		if offsetIndex {
 			prefix = delayedOffsetPrefix()
 			seekPrefix = delayedOffsetKey(cmd.Offset)
 		}
@@ -262,17 +342,8 @@ func (d *Driver) GetDelayedStates(cmd *flowstate.GetDelayedStatesCommand) error
 		it.Seek(seekPrefix)
 
 		for ; it.Valid(); it.Next() {
-			delayedState := flowstate.DelayedState{}
-			if err := it.Item().Value(func(delayedStateKey []byte) error {
-				item, err := txn.Get(delayedStateKey)
-				if err != nil {
-					return fmt.Errorf("get delayed state: %w", err)
-				}
-
-				return item.Value(func(d []byte) error {
-					return flowstate.UnmarshalDelayedState(d, &delayedState)
-				})
-			}); err != nil {
+			delayedState, err := getDelayedState(txn, it.Item(), offsetIndex)
+			if err != nil {
 				return err
 			}
 
@@ -280,11 +351,20 @@ func (d *Driver) GetDelayedStates(cmd *flowstate.GetDelayedStatesCommand) error
 				continue
 			}
 			if delayedState.ExecuteAt.Unix() > cmd.Until.Unix() {
+				if offsetIndex {
+					continue
+				}
 				break
 			}
 			if delayedState.Offset > untilOffset {
+				if !offsetIndex {
+					continue
+				}
 				break
 			}
+			if !cmd.InShard(delayedState.State.ID) {
+				continue
+			}
 
 			if len(res.States) >= cmd.Limit {
 				res.More = true
@@ -362,7 +442,8 @@ func (d *Driver) Commit(cmd *flowstate.CommitCommand) error {
 					return fmt.Errorf("set committed at index: %w", err)
 				}
 
-				commitedState.CopyToCtx(stateCtx)
+				commitedState.CopyTo(&stateCtx.Current)
+				stateCtx.Committed = commitedState.CopyTo(&flowstate.State{})
 				stateCtx.Transitions = stateCtx.Transitions[:0]
 			}
 
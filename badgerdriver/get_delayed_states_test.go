@@ -0,0 +1,174 @@
+package badgerdriver
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/makasim/flowstate"
+)
+
+func TestGetDelayedStates(t *testing.T) {
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLoggingLevel(2))
+	if err != nil {
+		t.Fatalf("failed to open badger db: %v", err)
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Fatalf("failed to close db: %v", err)
+		}
+	}()
+
+	d, err := New(db)
+	if err != nil {
+		t.Fatalf("failed to create driver: %v", err)
+	}
+	defer func() {
+		if err := d.Shutdown(context.Background()); err != nil {
+			t.Fatalf("failed to shutdown commiter: %v", err)
+		}
+	}()
+
+	// delayed states are due in the future, so they are still pending when cancelled
+	now := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	// delayed in a different order than they are due, spread across several seconds
+	storeTestDelayedState(t, d, `aStateID1`, now.Add(time.Second*3))
+	storeTestDelayedState(t, d, `aStateID2`, now.Add(time.Second))
+	storeTestDelayedState(t, d, `aStateID3`, now.Add(time.Second*2))
+	storeTestDelayedState(t, d, `aStateID4`, now.Add(time.Second))
+	storeTestDelayedState(t, d, `aStateID5`, now.Add(time.Minute))
+
+	f := func(cmd *flowstate.GetDelayedStatesCommand, expIDs []flowstate.StateID, expMore bool) {
+		t.Helper()
+
+		if err := d.GetDelayedStates(cmd); err != nil {
+			t.Fatalf("failed to get delayed states: %v", err)
+		}
+
+		var actIDs []flowstate.StateID
+		for _, delayedState := range cmd.Result.States {
+			actIDs = append(actIDs, delayedState.State.ID)
+		}
+
+		if !reflect.DeepEqual(expIDs, actIDs) {
+			t.Fatalf("expected delayed states %v, got %v", expIDs, actIDs)
+		}
+		if cmd.Result.More != expMore {
+			t.Fatalf("expected more %v, got %v", expMore, cmd.Result.More)
+		}
+	}
+
+	// since index, ordered by execute at across seconds
+	f(flowstate.GetDelayedStates(now, now.Add(time.Second*3), 0), []flowstate.StateID{
+		`aStateID2`, `aStateID4`, `aStateID3`, `aStateID1`,
+	}, false)
+	// since is exclusive
+	f(flowstate.GetDelayedStates(now.Add(time.Second), now.Add(time.Second*3), 0), []flowstate.StateID{
+		`aStateID3`, `aStateID1`,
+	}, false)
+	// until is inclusive
+	f(flowstate.GetDelayedStates(now, now.Add(time.Second*2), 0), []flowstate.StateID{
+		`aStateID2`, `aStateID4`, `aStateID3`,
+	}, false)
+
+	// since index with limit
+	limitCmd := flowstate.GetDelayedStates(now, now.Add(time.Hour), 0)
+	limitCmd.Limit = 2
+	f(limitCmd, []flowstate.StateID{`aStateID2`, `aStateID4`}, true)
+
+	// zero since reads the offset index, ordered by offset
+	f(flowstate.GetDelayedStates(time.Time{}, now.Add(time.Hour), 0), []flowstate.StateID{
+		`aStateID1`, `aStateID2`, `aStateID3`, `aStateID4`, `aStateID5`,
+	}, false)
+	// offset reads the offset index from the offset
+	f(flowstate.GetDelayedStates(now, now.Add(time.Hour), 3), []flowstate.StateID{
+		`aStateID3`, `aStateID4`, `aStateID5`,
+	}, false)
+
+	// offset index skips delayed states after until
+	f(flowstate.GetDelayedStates(now, now.Add(time.Second*2), 1), []flowstate.StateID{
+		`aStateID2`, `aStateID3`, `aStateID4`,
+	}, false)
+
+	// offset index with limit
+	limitCmd = flowstate.GetDelayedStates(now, now.Add(time.Hour), 2)
+	limitCmd.Limit = 2
+	f(limitCmd, []flowstate.StateID{`aStateID2`, `aStateID3`}, true)
+
+	// shard filters delayed states by the state id hash before the limit is applied, in both indexes
+	f(flowstate.GetDelayedStates(now, now.Add(time.Hour), 0).WithShard(0, 2), []flowstate.StateID{
+		`aStateID4`,
+	}, false)
+	shardCmd := flowstate.GetDelayedStates(now, now.Add(time.Hour), 0).WithShard(1, 2)
+	shardCmd.Limit = 2
+	f(shardCmd, []flowstate.StateID{`aStateID2`, `aStateID3`}, true)
+	f(flowstate.GetDelayedStates(time.Time{}, now.Add(time.Hour), 0).WithShard(1, 2), []flowstate.StateID{
+		`aStateID1`, `aStateID2`, `aStateID3`, `aStateID5`,
+	}, false)
+
+	// cancelled delayed states are not returned by both indexes, a tombstone is added to the end of the log
+	if err := d.CancelDelay(flowstate.CancelDelay(&flowstate.StateCtx{
+		Current: flowstate.State{ID: `aStateID4`},
+	})); err != nil {
+		t.Fatalf("failed to cancel delay: %v", err)
+	}
+
+	f(flowstate.GetDelayedStates(now, now.Add(time.Second*3), 0), []flowstate.StateID{
+		`aStateID2`, `aStateID3`, `aStateID1`,
+	}, false)
+
+	tombstoneCmd := flowstate.GetDelayedStates(time.Time{}, now.Add(time.Hour), 2)
+	f(tombstoneCmd, []flowstate.StateID{
+		`aStateID2`, `aStateID3`, `aStateID5`, `aStateID4`,
+	}, false)
+	if _, ok := flowstate.DelayTombstone(tombstoneCmd.Result.States[2]); ok {
+		t.Fatalf("expected delayed state %v not to be a tombstone", tombstoneCmd.Result.States[2])
+	}
+	cancelledOffset, ok := flowstate.DelayTombstone(tombstoneCmd.Result.States[3])
+	if !ok {
+		t.Fatalf("expected delayed state %v to be a tombstone", tombstoneCmd.Result.States[3])
+	}
+	if cancelledOffset != 4 {
+		t.Fatalf("expected cancelled offset 4, got %d", cancelledOffset)
+	}
+
+	// tombstones are not cancelled
+	cancelCmd := flowstate.CancelDelay(&flowstate.StateCtx{
+		Current: flowstate.State{ID: `aStateID4`},
+	})
+	if err := d.CancelDelay(cancelCmd); err != nil {
+		t.Fatalf("failed to cancel delay: %v", err)
+	}
+	if len(cancelCmd.Result) != 0 {
+		t.Fatalf("expected nothing cancelled, got %v", cancelCmd.Result)
+	}
+
+	// delayed states already due are not cancelled
+	storeTestDelayedState(t, d, `aStateID6`, time.Now().Add(-time.Minute))
+	cancelCmd = flowstate.CancelDelay(&flowstate.StateCtx{
+		Current: flowstate.State{ID: `aStateID6`},
+	})
+	if err := d.CancelDelay(cancelCmd); err != nil {
+		t.Fatalf("failed to cancel delay: %v", err)
+	}
+	if len(cancelCmd.Result) != 0 {
+		t.Fatalf("expected nothing cancelled, got %v", cancelCmd.Result)
+	}
+}
+
+func storeTestDelayedState(t *testing.T, d *Driver, id flowstate.StateID, executeAt time.Time) {
+	t.Helper()
+
+	cmd := flowstate.DelayUntil(&flowstate.StateCtx{
+		Current: flowstate.State{ID: id},
+	}, `aFlowID`, executeAt)
+	if err := cmd.Prepare(); err != nil {
+		t.Fatalf("failed to prepare delay: %v", err)
+	}
+	if err := d.Delay(cmd); err != nil {
+		t.Fatalf("failed to delay: %v", err)
+	}
+}
@@ -202,8 +202,32 @@ func delayedStateKey(executeAt, offset int64) []byte {
 	return []byte(fmt.Sprintf(`flowstate.delayed.states.%020d.%020d`, executeAt, offset))
 }
 
-func delayedStatePrefix(since time.Time) []byte {
-	return []byte(fmt.Sprintf(`flowstate.delayed.states.%020d.`, since.Unix()))
+func delayedStatePrefix() []byte {
+	return []byte(`flowstate.delayed.states.`)
+}
+
+// getDelayedState decodes a delayed state from an item of the delayed states keyspace.
+// Items of the offset index hold a key of the delayed state instead of the delayed state itself.
+func getDelayedState(txn *badger.Txn, item *badger.Item, offsetIndex bool) (flowstate.DelayedState, error) {
+	delayedState := flowstate.DelayedState{}
+	if err := item.Value(func(val []byte) error {
+		if !offsetIndex {
+			return flowstate.UnmarshalDelayedState(val, &delayedState)
+		}
+
+		stateItem, err := txn.Get(val)
+		if err != nil {
+			return fmt.Errorf("get delayed state: %w", err)
+		}
+
+		return stateItem.Value(func(d []byte) error {
+			return flowstate.UnmarshalDelayedState(d, &delayedState)
+		})
+	}); err != nil {
+		return flowstate.DelayedState{}, err
+	}
+
+	return delayedState, nil
 }
 
 func setDelayedOffsetIndex(txn *badger.Txn, delayedState flowstate.DelayedState) error {
@@ -220,3 +244,54 @@ func delayedOffsetKey(offset int64) []byte {
 func delayedOffsetPrefix() []byte {
 	return []byte(`flowstate.index.delayed_status_offset.`)
 }
+
+func setDelayedStateIDIndex(txn *badger.Txn, delayedState flowstate.DelayedState) error {
+	return txn.Set(
+		delayedStateIDKey(delayedState.State.ID, delayedState.Offset),
+		delayedStateKey(delayedState.ExecuteAt.Unix(), delayedState.Offset),
+	)
+}
+
+func getDelayedStatesByID(txn *badger.Txn, id flowstate.StateID) ([]flowstate.DelayedState, error) {
+	prefix := delayedStateIDPrefix(id)
+	it := txn.NewIterator(badger.IteratorOptions{
+		PrefetchSize: 100,
+		Prefix:       prefix,
+	})
+	defer it.Close()
+
+	var delayedStates []flowstate.DelayedState
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		delayedState, err := getDelayedState(txn, it.Item(), true)
+		if err != nil {
+			return nil, err
+		}
+
+		// the prefix also matches ids starting with the id followed by a dot
+		if delayedState.State.ID != id {
+			continue
+		}
+
+		delayedStates = append(delayedStates, delayedState)
+	}
+
+	return delayedStates, nil
+}
+
+func deleteDelayedState(txn *badger.Txn, delayedState flowstate.DelayedState) error {
+	if err := txn.Delete(delayedStateKey(delayedState.ExecuteAt.Unix(), delayedState.Offset)); err != nil {
+		return err
+	}
+	if err := txn.Delete(delayedOffsetKey(delayedState.Offset)); err != nil {
+		return err
+	}
+	return txn.Delete(delayedStateIDKey(delayedState.State.ID, delayedState.Offset))
+}
+
+func delayedStateIDKey(id flowstate.StateID, offset int64) []byte {
+	return []byte(fmt.Sprintf(`flowstate.index.delayed_state_id.%s.%020d`, id, offset))
+}
+
+func delayedStateIDPrefix(id flowstate.StateID) []byte {
+	return []byte(fmt.Sprintf(`flowstate.index.delayed_state_id.%s.`, id))
+}
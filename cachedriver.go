@@ -23,6 +23,10 @@ type cacheDriver struct {
 	maxRev    int64 // maximum revision available in the log
 	log       []State
 	committed []State
+
+	headSyncedAt time.Time
+	hits         *metricVec
+	misses       *metricVec
 }
 
 func NewCacheDriver(d Driver, maxSize int, l *slog.Logger) Driver {
@@ -56,7 +60,7 @@ func (d *cacheDriver) appendStateLocked(s *State) {
 	}
 
 	pos := d.idx % len(d.log)
-	s.CopyTo(&d.log[pos])
+	d.log[pos] = s.CopyTo(&State{})
 
 	d.maxRev = s.Rev
 
@@ -74,13 +78,43 @@ func (d *cacheDriver) appendStateLocked(s *State) {
 	}
 }
 
+// instrument registers cache metrics in m.
+func (d *cacheDriver) instrument(m *Metrics) {
+	d.hits = m.counter(`flowstate_cache_hits_total`, `Number of reads served from the cache log.`, `op`)
+	d.misses = m.counter(`flowstate_cache_misses_total`, `Number of reads passed to the underlying driver.`, `op`)
+
+	headRev := m.gauge(`flowstate_cache_head_rev`, `The latest revision in the cache log.`)
+	headLag := m.gauge(`flowstate_cache_head_lag_seconds`, `Time since the cache log was last in sync with the underlying driver head.`)
+	m.collect(func() {
+		d.m.Lock()
+		maxRev, headSyncedAt := d.maxRev, d.headSyncedAt
+		d.m.Unlock()
+
+		headRev.set(float64(maxRev))
+		if !headSyncedAt.IsZero() {
+			headLag.set(time.Since(headSyncedAt).Seconds())
+		}
+	})
+}
+
+func (d *cacheDriver) markHeadSynced() {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	d.headSyncedAt = time.Now()
+}
+
 func (d *cacheDriver) Init(e *Engine) error {
 	return d.d.Init(e)
 }
 
 func (d *cacheDriver) GetStateByID(cmd *GetStateByIDCommand) error {
-	if cmd.Rev != 0 && d.getStateByIDFromLog(cmd) {
-		return nil
+	if cmd.Rev != 0 {
+		if d.getStateByIDFromLog(cmd) {
+			d.hits.inc(`get_state_by_id`)
+			return nil
+		}
+		d.misses.inc(`get_state_by_id`)
 	}
 
 	return d.d.GetStateByID(cmd)
@@ -119,8 +153,10 @@ func (d *cacheDriver) GetStateByLabels(cmd *GetStateByLabelsCommand) error {
 
 func (d *cacheDriver) GetStates(cmd *GetStatesCommand) error {
 	if _, _, found := d.getStatesFromLog(cmd); found {
+		d.hits.inc(`get_states`)
 		return nil
 	}
+	d.misses.inc(`get_states`)
 
 	if err := d.d.GetStates(cmd); err != nil {
 		return err
@@ -181,6 +217,10 @@ func (d *cacheDriver) Delay(cmd *DelayCommand) error {
 	return d.d.Delay(cmd)
 }
 
+func (d *cacheDriver) CancelDelay(cmd *CancelDelayCommand) error {
+	return d.d.CancelDelay(cmd)
+}
+
 func (d *cacheDriver) Commit(cmd *CommitCommand) error {
 	if err := d.commitRevMismatch(cmd); err != nil {
 		return err
@@ -298,6 +338,7 @@ func (d *cacheDriver) getHead(refreshDur, refreshErrDur time.Duration, closeCh c
 
 			getRes := getCmd.MustResult()
 			if len(getRes.States) == 0 {
+				d.markHeadSynced()
 				waitT := time.NewTimer(refreshDur)
 				select {
 				case <-waitT.C:
@@ -350,6 +391,7 @@ func (d *cacheDriver) getHead(refreshDur, refreshErrDur time.Duration, closeCh c
 			}
 		}
 
+		d.markHeadSynced()
 		waitT := time.NewTimer(refreshDur)
 		select {
 		case <-waitT.C:
@@ -0,0 +1,245 @@
+package flowstate
+
+import (
+	"fmt"
+)
+
+var CallParentAnnotation = `flowstate.call.parent`
+var CallChildAnnotation = `flowstate.call.child`
+var CallResumeAnnotation = `flowstate.call.resume`
+var CallReturnedAnnotation = `flowstate.call.returned`
+
+// Call parks the parent state and transits the child state to the given flow in a single commit.
+// The parent waits until the child returns, see Return; it resumes with the flow it was parked in unless WithResume is set.
+//
+// The link is stored in annotations: the child state keeps the parent ID in CallParentAnnotation,
+// the parked parent transition keeps the child ID in CallChildAnnotation and the flow to resume in CallResumeAnnotation.
+// Once committed, the child is executed in the same session if Call is returned by a flow, or in a new one otherwise.
+func Call(parent, child *StateCtx, to FlowID) *CallCommand {
+	return &CallCommand{
+		StateCtx:      parent,
+		ChildStateCtx: child,
+		To:            to,
+	}
+}
+
+type CallCommand struct {
+	command
+	StateCtx      *StateCtx
+	ChildStateCtx *StateCtx
+	To            FlowID
+	Resume        FlowID
+
+	sync bool
+}
+
+func (cmd *CallCommand) sessID() int64 {
+	return cmd.StateCtx.sessID
+}
+
+func (cmd *CallCommand) setSync() {
+	cmd.sync = true
+}
+
+func (cmd *CallCommand) do(e *Engine) error {
+	return e.doCall(cmd)
+}
+
+func (cmd *CallCommand) next() *StateCtx {
+	return cmd.ChildStateCtx
+}
+
+// WithResume sets a flow the parent state transits to once the child returns.
+func (cmd *CallCommand) WithResume(to FlowID) *CallCommand {
+	cmd.Resume = to
+	return cmd
+}
+
+func (cmd *CallCommand) Prepare() (*CommitCommand, error) {
+	if cmd.StateCtx == nil || cmd.StateCtx.Current.ID == `` {
+		return nil, fmt.Errorf("parent state id empty")
+	}
+	if cmd.ChildStateCtx == nil || cmd.ChildStateCtx.Current.ID == `` {
+		return nil, fmt.Errorf("child state id empty")
+	}
+	if cmd.StateCtx.Current.ID == cmd.ChildStateCtx.Current.ID {
+		return nil, fmt.Errorf("state cannot call itself")
+	}
+	if cmd.To == `` {
+		return nil, fmt.Errorf("child flow id empty")
+	}
+
+	resume := cmd.Resume
+	if resume == `` {
+		resume = cmd.StateCtx.Current.Transition.To
+	}
+	if resume == `` {
+		return nil, fmt.Errorf("parent resume flow id empty")
+	}
+
+	cmd.ChildStateCtx.Current.SetAnnotation(CallParentAnnotation, string(cmd.StateCtx.Current.ID))
+
+	return Commit(
+		Park(cmd.StateCtx).
+			WithAnnotation(CallChildAnnotation, string(cmd.ChildStateCtx.Current.ID)).
+			WithAnnotation(CallResumeAnnotation, string(resume)).
+			skipStateMachineCheck(),
+		Transit(cmd.ChildStateCtx, cmd.To),
+	), nil
+}
+
+// Return parks the child state and resumes its parent in a single commit.
+// Annotations set by WithAnnotation are the call result, they are set to the parent transition along with CallReturnedAnnotation.
+// The child state is unlinked from the parent, its park transition keeps the parent ID in CallReturnedAnnotation.
+//
+// A forked state returns the same way, see Fork; the annotations are set to its own park transition as the parent is resumed by several states.
+// A called or forked state that parks from a flow is returned by the engine automatically, Park annotations become the result.
+// If the commit conflicts, the child state is left unparked so the Recoverer retries its flow and the return is repeated.
+func Return(child *StateCtx) *ReturnCommand {
+	return &ReturnCommand{
+		StateCtx: child,
+	}
+}
+
+type ReturnCommand struct {
+	command
+	StateCtx    *StateCtx
+	Annotations map[string]string
+
+	// ParentStateCtx is set to the resumed parent state once the command is done.
+	ParentStateCtx *StateCtx
+
+	sync bool
+}
+
+func (cmd *ReturnCommand) sessID() int64 {
+	return cmd.StateCtx.sessID
+}
+
+func (cmd *ReturnCommand) setSync() {
+	cmd.sync = true
+}
+
+func (cmd *ReturnCommand) do(e *Engine) error {
+	return e.doReturn(cmd)
+}
+
+func (cmd *ReturnCommand) next() *StateCtx {
+	return cmd.ParentStateCtx
+}
+
+func (cmd *ReturnCommand) WithAnnotation(name, value string) *ReturnCommand {
+	if cmd.Annotations == nil {
+		cmd.Annotations = make(map[string]string)
+	}
+
+	cmd.Annotations[name] = value
+	return cmd
+}
+
+func (cmd *ReturnCommand) WithAnnotations(annotations map[string]string) *ReturnCommand {
+	for k, v := range annotations {
+		cmd.WithAnnotation(k, v)
+	}
+	return cmd
+}
+
+// Prepare builds the commit from the latest parent state, it fails if the parent is not waiting for the child.
+func (cmd *ReturnCommand) Prepare(parentStateCtx *StateCtx) (*CommitCommand, error) {
+	childID := string(cmd.StateCtx.Current.ID)
+	if parentStateCtx.Current.Transition.Annotations[CallChildAnnotation] != childID {
+		return nil, fmt.Errorf("parent state %s is not waiting for %s", parentStateCtx.Current.ID, childID)
+	}
+
+	resume := FlowID(parentStateCtx.Current.Transition.Annotations[CallResumeAnnotation])
+	if resume == `` {
+		return nil, fmt.Errorf("parent state %s resume flow id empty", parentStateCtx.Current.ID)
+	}
+
+	cmd.ParentStateCtx = parentStateCtx
+	delete(cmd.StateCtx.Current.Annotations, CallParentAnnotation)
+
+	return Commit(
+		Park(cmd.StateCtx).WithAnnotation(CallReturnedAnnotation, string(parentStateCtx.Current.ID)),
+		Transit(parentStateCtx, resume).
+			WithAnnotations(cmd.Annotations).
+			WithAnnotation(CallReturnedAnnotation, childID).
+			skipStateMachineCheck(),
+	), nil
+}
+
+// CallParent returns the ID of the state that called the state or an empty string if the state was not called.
+func CallParent(state State) StateID {
+	return StateID(state.Annotations[CallParentAnnotation])
+}
+
+// Returned returns the ID of the child state the parent state was resumed by or an empty string if the state was not resumed.
+func Returned(state State) StateID {
+	return StateID(state.Transition.Annotations[CallReturnedAnnotation])
+}
+
+func (e *Engine) doCall(cmd *CallCommand) error {
+	commitCmd, err := cmd.Prepare()
+	if err != nil {
+		return err
+	}
+	if err := e.doCmd(commitCmd); err != nil {
+		return err
+	}
+
+	if !cmd.sync {
+		e.goExecute(cmd.ChildStateCtx)
+	}
+
+	return nil
+}
+
+func (e *Engine) doReturn(cmd *ReturnCommand) error {
+	if parentID := ForkParent(cmd.StateCtx.Current); parentID != `` {
+		return e.doForkReturn(cmd, parentID)
+	}
+
+	parentID := CallParent(cmd.StateCtx.Current)
+	if parentID == `` {
+		return fmt.Errorf("state %s was not called", cmd.StateCtx.Current.ID)
+	}
+
+	parentStateCtx := &StateCtx{}
+	if err := e.doCmd(GetStateByID(parentStateCtx, parentID, 0)); err != nil {
+		return fmt.Errorf("get parent state: %w", err)
+	}
+
+	commitCmd, err := cmd.Prepare(parentStateCtx)
+	if err != nil {
+		return err
+	}
+	if err := e.doCmd(commitCmd); err != nil {
+		return err
+	}
+
+	if !cmd.sync {
+		e.goExecute(cmd.ParentStateCtx)
+	}
+
+	return nil
+}
+
+// autoReturn replaces a park of a called or forked state returned by a flow with a return to the parent.
+func autoReturn(cmd0 Command) Command {
+	if commitCmd, ok := cmd0.(*CommitCommand); ok && len(commitCmd.Commands) == 1 {
+		cmd0 = commitCmd.Commands[0]
+	}
+
+	parkCmd, ok := cmd0.(*ParkCommand)
+	if !ok || parkCmd.Annotations[CallReturnedAnnotation] != `` {
+		return nil
+	}
+	if CallParent(parkCmd.StateCtx.Current) == `` && ForkParent(parkCmd.StateCtx.Current) == `` {
+		return nil
+	}
+	if parkCmd.Annotations[DeadlineExceededAnnotation] != `` {
+		return nil
+	}
+
+	return Return(parkCmd.StateCtx).WithAnnotations(parkCmd.Annotations)
+}
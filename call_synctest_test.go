@@ -0,0 +1,99 @@
+//go:build goexperiment.synctest
+
+package flowstate_test
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/makasim/flowstate"
+	"github.com/makasim/flowstate/memdriver"
+)
+
+func TestCall_ReturnAfterChildRecovered(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		l := slog.New(slog.DiscardHandler)
+
+		d := memdriver.New(l)
+		fr := &flowstate.DefaultFlowRegistry{}
+
+		var resumed bool
+		mustSetFlow(fr, `parent`, flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+			if flowstate.Returned(stateCtx.Current) != `` {
+				resumed = stateCtx.Current.Transition.Annotations[`result`] == `ok`
+				return flowstate.Commit(flowstate.Park(stateCtx)), nil
+			}
+
+			childStateCtx := &flowstate.StateCtx{
+				Current: flowstate.State{
+					ID: `aChildID`,
+				},
+			}
+			return flowstate.Call(stateCtx, childStateCtx, `child`), nil
+		}))
+
+		var attempts int
+		mustSetFlow(fr, `child`, flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+			attempts++
+			if attempts == 1 {
+				return nil, fmt.Errorf("child failed")
+			}
+
+			return flowstate.Return(stateCtx).WithAnnotation(`result`, `ok`), nil
+		}))
+
+		e, err := flowstate.NewEngine(d, fr, l)
+		if err != nil {
+			t.Fatalf("failed to create engine: %v", err)
+		}
+
+		r, err := flowstate.NewRecoverer(e, l)
+		if err != nil {
+			t.Fatalf("failed to create recoverer: %v", err)
+		}
+
+		stateCtx := &flowstate.StateCtx{
+			Current: flowstate.State{
+				ID: `aParentID`,
+			},
+		}
+		if err := e.Do(flowstate.Commit(flowstate.Transit(stateCtx, `parent`))); err != nil {
+			t.Fatalf("failed to commit: %v", err)
+		}
+		if err := e.Execute(stateCtx); err == nil {
+			t.Fatalf("expected child flow error")
+		}
+		synctest.Wait()
+
+		time.Sleep(time.Hour)
+		synctest.Wait()
+
+		if err := r.Shutdown(context.Background()); err != nil {
+			t.Fatalf("failed to shutdown recoverer: %v", err)
+		}
+		if err := e.Shutdown(context.Background()); err != nil {
+			t.Fatalf("failed to shutdown engine: %v", err)
+		}
+
+		if attempts != 2 {
+			t.Errorf("expected child executed twice; got %d", attempts)
+		}
+		if !resumed {
+			t.Errorf("expected parent resumed with child result")
+		}
+
+		for _, id := range []flowstate.StateID{`aParentID`, `aChildID`} {
+			foundStateCtx := &flowstate.StateCtx{}
+			if err := d.GetStateByID(flowstate.GetStateByID(foundStateCtx, id, 0)); err != nil {
+				t.Fatalf("failed to get state: %v", err)
+			}
+			if !flowstate.Parked(foundStateCtx.Current) {
+				t.Errorf("expected state %s parked", id)
+			}
+		}
+	})
+}
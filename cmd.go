@@ -12,6 +12,8 @@ var _ Command = &ParkCommand{}
 
 var _ Command = &DelayCommand{}
 
+var _ Command = &CancelDelayCommand{}
+
 var _ Command = &NoopCommand{}
 
 var _ Command = &StackCommand{}
@@ -34,10 +36,40 @@ var _ Command = &StoreDataCommand{}
 
 var _ Command = &GetDataCommand{}
 
+var _ engineCommand = &CallCommand{}
+
+var _ engineCommand = &ReturnCommand{}
+
+var _ engineCommand = &ForkCommand{}
+
+var _ engineCommand = &JoinCommand{}
+
+var _ engineCommand = &SignalCommand{}
+
+var _ engineCommand = &WaitSignalCommand{}
+
+var _ engineCommand = &AcquireCommand{}
+
+var _ engineCommand = &ReleaseCommand{}
+
+var _ engineCommand = &RateLimitCommand{}
+
 type Command interface {
 	cmd()
 }
 
+// engineCommand is implemented by commands the engine does itself rather than the driver, such as Call, Fork or WaitSignal.
+// They pass the execution from one state to another, so they are not allowed inside a commit.
+type engineCommand interface {
+	Command
+	sessID() int64
+	// setSync marks the command returned by a flow step, the execution then goes on in the same goroutine.
+	setSync()
+	do(e *Engine) error
+	// next returns the state the execution goes on with, nil ends the execution.
+	next() *StateCtx
+}
+
 type command struct {
 }
 
@@ -72,6 +104,8 @@ type ParkCommand struct {
 	command
 	StateCtx    *StateCtx
 	Annotations map[string]string
+
+	skipStateMachine bool
 }
 
 func (cmd *ParkCommand) CommittableStateCtx() *StateCtx {
@@ -94,6 +128,12 @@ func (cmd *ParkCommand) WithAnnotations(annotations map[string]string) *ParkComm
 	return cmd
 }
 
+// skipStateMachineCheck marks a park built by the engine to hold a state waiting for something, state machines do not check it.
+func (cmd *ParkCommand) skipStateMachineCheck() *ParkCommand {
+	cmd.skipStateMachine = true
+	return cmd
+}
+
 func (cmd *ParkCommand) Do() error {
 	cmd.StateCtx.Transitions = append(cmd.StateCtx.Transitions, cmd.StateCtx.Current.Transition)
 
@@ -269,6 +309,8 @@ type TransitCommand struct {
 	StateCtx    *StateCtx
 	Annotations map[string]string
 	To          FlowID
+
+	skipStateMachine bool
 }
 
 func (cmd *TransitCommand) CommittableStateCtx() *StateCtx {
@@ -291,6 +333,22 @@ func (cmd *TransitCommand) WithAnnotations(annotations map[string]string) *Trans
 	return cmd
 }
 
+// WithDeadline sets a deadline for the execution of the next transition.
+func (cmd *TransitCommand) WithDeadline(deadline time.Time) *TransitCommand {
+	return cmd.WithAnnotation(TransitionDeadlineAnnotation, deadline.UTC().Format(time.RFC3339Nano))
+}
+
+// WithTimeout is a shortcut for WithDeadline(time.Now().Add(timeout)).
+func (cmd *TransitCommand) WithTimeout(timeout time.Duration) *TransitCommand {
+	return cmd.WithDeadline(time.Now().Add(timeout))
+}
+
+// skipStateMachineCheck marks a transit built by the engine to resume a state, state machines do not check it.
+func (cmd *TransitCommand) skipStateMachineCheck() *TransitCommand {
+	cmd.skipStateMachine = true
+	return cmd
+}
+
 func (cmd *TransitCommand) Do() error {
 	if cmd.To == "" {
 		return fmt.Errorf("flow id empty")
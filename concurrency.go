@@ -0,0 +1,324 @@
+package flowstate
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// ConcurrencyLimits bounds the number of flow executions the engine runs at once, zero means no limit.
+//
+// A slot is taken for every execution step, from the flow call until the returned command is done,
+// so an execution transiting from one flow to another counts against the limits of the flow it is currently in.
+// Steps exceeding any of the limits wait for a slot in the order they arrived.
+// A flow must not execute another state synchronously with Engine.Execute while holding a slot, it may deadlock; use the Execute command instead.
+type ConcurrencyLimits struct {
+	// Global limits execution steps of all flows.
+	Global int
+	// Flows limits execution steps per flow.
+	Flows map[FlowID]int
+	// Labels limits execution steps per value of the label, for example, per tenant.
+	// States without the label are not limited by it.
+	Labels map[string]int
+
+	// MaxSubmitted limits executions started with Engine.Submit and not finished yet, Submit blocks once the limit is reached.
+	MaxSubmitted int
+}
+
+// SetConcurrencyLimits sets the limits for execution steps started after the call.
+func (e *Engine) SetConcurrencyLimits(limits ConcurrencyLimits) {
+	e.limiter.setLimits(limits)
+}
+
+// Execution is a handle of the execution started with Engine.Submit.
+type Execution struct {
+	StateCtx *StateCtx
+
+	doneCh chan struct{}
+	err    error
+}
+
+// Done returns a channel closed once the execution is finished.
+func (ex *Execution) Done() <-chan struct{} {
+	return ex.doneCh
+}
+
+// Wait waits for the execution to finish and returns its error.
+func (ex *Execution) Wait(ctx context.Context) error {
+	select {
+	case <-ex.doneCh:
+		return ex.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Submit executes the state on a separate goroutine and returns a handle to wait on.
+// It blocks while ConcurrencyLimits.MaxSubmitted executions are in progress until one of them finishes,
+// the ctx is done or the engine is stopped. The ctx is not used once the execution is started, except for its values.
+func (e *Engine) Submit(ctx context.Context, stateCtx *StateCtx) (*Execution, error) {
+	if stateCtx.Current.ID == `` {
+		return nil, fmt.Errorf(`state id empty`)
+	}
+
+	if err := e.limiter.admit(ctx, e.doneCh); err != nil {
+		return nil, err
+	}
+
+	return e.submitAdmitted(ctx, stateCtx), nil
+}
+
+// submitAdmitted starts the execution admitted by admit or tryAdmit.
+func (e *Engine) submitAdmitted(ctx context.Context, stateCtx *StateCtx) *Execution {
+	ex := &Execution{
+		StateCtx: stateCtx,
+		doneCh:   make(chan struct{}),
+	}
+
+	execCtx := context.WithoutCancel(ctx)
+	go func() {
+		defer close(ex.doneCh)
+		defer e.limiter.unadmit()
+
+		ex.err = e.ExecuteContext(execCtx, stateCtx)
+	}()
+
+	return ex
+}
+
+type concurrencyLimiter struct {
+	mux       sync.Mutex
+	limits    ConcurrencyLimits
+	slots     map[string]int
+	running   int
+	waiters   []*slotWaiter
+	submitted int
+	admitChs  []chan struct{}
+
+	waitingGauge   *metricVec
+	runningGauge   *metricVec
+	submittedGauge *metricVec
+}
+
+type slotWaiter struct {
+	slots   []slot
+	readyCh chan struct{}
+}
+
+type slot struct {
+	key   string
+	limit int
+}
+
+func newConcurrencyLimiter(m *Metrics) *concurrencyLimiter {
+	return &concurrencyLimiter{
+		slots: make(map[string]int),
+
+		waitingGauge:   m.gauge(`flowstate_engine_execution_steps_waiting`, `Number of execution steps waiting for a concurrency slot.`),
+		runningGauge:   m.gauge(`flowstate_engine_execution_steps_running`, `Number of execution steps holding a concurrency slot.`),
+		submittedGauge: m.gauge(`flowstate_engine_submitted_executions`, `Number of executions started with Submit and not finished yet.`),
+	}
+}
+
+func (cl *concurrencyLimiter) setLimits(limits ConcurrencyLimits) {
+	cl.mux.Lock()
+	defer cl.mux.Unlock()
+
+	cl.limits = limits
+	cl.grantLocked()
+	cl.admitLocked()
+}
+
+// acquire takes slots for an execution step of the state, it blocks until all the slots are available or the ctx is done.
+func (cl *concurrencyLimiter) acquire(ctx context.Context, state State) (func(), error) {
+	cl.mux.Lock()
+	slots := cl.slotsLocked(state)
+	if len(slots) == 0 {
+		cl.mux.Unlock()
+		return func() {}, nil
+	}
+	if cl.availableLocked(slots) {
+		cl.takeLocked(slots)
+		cl.mux.Unlock()
+		return func() { cl.release(slots) }, nil
+	}
+
+	w := &slotWaiter{
+		slots:   slots,
+		readyCh: make(chan struct{}),
+	}
+	cl.waiters = append(cl.waiters, w)
+	cl.waitingGauge.set(float64(len(cl.waiters)))
+	cl.mux.Unlock()
+
+	select {
+	case <-w.readyCh:
+		return func() { cl.release(slots) }, nil
+	case <-ctx.Done():
+		cl.mux.Lock()
+		defer cl.mux.Unlock()
+
+		select {
+		case <-w.readyCh:
+			// granted concurrently
+			cl.releaseLocked(slots)
+		default:
+			cl.waiters = slices.DeleteFunc(cl.waiters, func(w0 *slotWaiter) bool { return w0 == w })
+			cl.waitingGauge.set(float64(len(cl.waiters)))
+		}
+
+		return nil, ctx.Err()
+	}
+}
+
+func (cl *concurrencyLimiter) release(slots []slot) {
+	cl.mux.Lock()
+	defer cl.mux.Unlock()
+
+	cl.releaseLocked(slots)
+}
+
+func (cl *concurrencyLimiter) releaseLocked(slots []slot) {
+	for _, s := range slots {
+		cl.slots[s.key]--
+		if cl.slots[s.key] <= 0 {
+			delete(cl.slots, s.key)
+		}
+	}
+	cl.running--
+	cl.runningGauge.set(float64(cl.running))
+
+	cl.grantLocked()
+}
+
+// grantLocked hands slots over to waiters in the order they arrived, a waiter blocked by a busy slot does not block waiters behind it.
+func (cl *concurrencyLimiter) grantLocked() {
+	if len(cl.waiters) == 0 {
+		return
+	}
+
+	waiters := cl.waiters[:0]
+	for _, w := range cl.waiters {
+		if !cl.availableLocked(w.slots) {
+			waiters = append(waiters, w)
+			continue
+		}
+
+		cl.takeLocked(w.slots)
+		close(w.readyCh)
+	}
+	clear(cl.waiters[len(waiters):])
+	cl.waiters = waiters
+	cl.waitingGauge.set(float64(len(cl.waiters)))
+}
+
+func (cl *concurrencyLimiter) slotsLocked(state State) []slot {
+	var slots []slot
+	if cl.limits.Global > 0 {
+		slots = append(slots, slot{key: `global`, limit: cl.limits.Global})
+	}
+	if limit := cl.limits.Flows[state.Transition.To]; limit > 0 {
+		slots = append(slots, slot{key: `flow:` + string(state.Transition.To), limit: limit})
+	}
+	for label, limit := range cl.limits.Labels {
+		if v := state.Labels[label]; v != `` && limit > 0 {
+			slots = append(slots, slot{key: `label:` + label + `=` + v, limit: limit})
+		}
+	}
+
+	return slots
+}
+
+func (cl *concurrencyLimiter) availableLocked(slots []slot) bool {
+	for _, s := range slots {
+		if cl.slots[s.key] >= s.limit {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (cl *concurrencyLimiter) takeLocked(slots []slot) {
+	for _, s := range slots {
+		cl.slots[s.key]++
+	}
+	cl.running++
+	cl.runningGauge.set(float64(cl.running))
+}
+
+// admit counts a submitted execution in, it blocks while ConcurrencyLimits.MaxSubmitted executions are in progress.
+func (cl *concurrencyLimiter) admit(ctx context.Context, doneCh <-chan struct{}) error {
+	cl.mux.Lock()
+	if len(cl.admitChs) == 0 && (cl.limits.MaxSubmitted <= 0 || cl.submitted < cl.limits.MaxSubmitted) {
+		cl.submitted++
+		cl.submittedGauge.set(float64(cl.submitted))
+		cl.mux.Unlock()
+		return nil
+	}
+
+	admitCh := make(chan struct{})
+	cl.admitChs = append(cl.admitChs, admitCh)
+	cl.mux.Unlock()
+
+	var err error
+	select {
+	case <-admitCh:
+		return nil
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-doneCh:
+		err = fmt.Errorf("engine stopped")
+	}
+
+	cl.mux.Lock()
+	defer cl.mux.Unlock()
+
+	select {
+	case <-admitCh:
+		// admitted concurrently
+		cl.unadmitLocked()
+	default:
+		cl.admitChs = slices.DeleteFunc(cl.admitChs, func(ch chan struct{}) bool { return ch == admitCh })
+	}
+
+	return err
+}
+
+// tryAdmit counts a submitted execution in without blocking, it returns false once ConcurrencyLimits.MaxSubmitted executions are in progress.
+// Background components admit an execution before committing the state, so they do not block on the limit with the state committed;
+// the admitted execution is started with Engine.submitAdmitted or given back with unadmit.
+func (cl *concurrencyLimiter) tryAdmit() bool {
+	cl.mux.Lock()
+	defer cl.mux.Unlock()
+
+	if len(cl.admitChs) > 0 || (cl.limits.MaxSubmitted > 0 && cl.submitted >= cl.limits.MaxSubmitted) {
+		return false
+	}
+
+	cl.submitted++
+	cl.submittedGauge.set(float64(cl.submitted))
+	return true
+}
+
+func (cl *concurrencyLimiter) unadmit() {
+	cl.mux.Lock()
+	defer cl.mux.Unlock()
+
+	cl.unadmitLocked()
+}
+
+func (cl *concurrencyLimiter) unadmitLocked() {
+	cl.submitted--
+	cl.admitLocked()
+}
+
+func (cl *concurrencyLimiter) admitLocked() {
+	for len(cl.admitChs) > 0 && (cl.limits.MaxSubmitted <= 0 || cl.submitted < cl.limits.MaxSubmitted) {
+		close(cl.admitChs[0])
+		cl.admitChs = cl.admitChs[1:]
+		cl.submitted++
+	}
+	cl.submittedGauge.set(float64(cl.submitted))
+}
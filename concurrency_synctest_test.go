@@ -0,0 +1,215 @@
+//go:build goexperiment.synctest
+
+package flowstate_test
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"reflect"
+	"sync"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/makasim/flowstate"
+	"github.com/makasim/flowstate/memdriver"
+	"github.com/thejerf/slogassert"
+)
+
+func TestConcurrencyLimits(t *testing.T) {
+	f := func(limits flowstate.ConcurrencyLimits, states []flowstate.State, expMax map[string]int, expElapsed time.Duration) {
+		t.Helper()
+
+		synctest.Test(t, func(t *testing.T) {
+			lh := slogassert.New(t, slog.LevelDebug, nil)
+			l := slog.New(slogassert.New(t, slog.LevelDebug, lh))
+
+			actMux := &sync.Mutex{}
+			curr := make(map[string]int)
+			actMax := make(map[string]int)
+			track := func(state flowstate.State, delta int) {
+				actMux.Lock()
+				defer actMux.Unlock()
+
+				keys := []string{`all`, `flow:` + string(state.Transition.To)}
+				if tenant := state.Labels[`tenant`]; tenant != `` {
+					keys = append(keys, `tenant:`+tenant)
+				}
+				for _, key := range keys {
+					curr[key] += delta
+					actMax[key] = max(actMax[key], curr[key])
+				}
+			}
+
+			d := memdriver.New(l)
+			fr := &flowstate.DefaultFlowRegistry{}
+			work := flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+				track(stateCtx.Current, 1)
+				defer track(stateCtx.Current, -1)
+
+				time.Sleep(time.Second * 10)
+				return flowstate.Commit(flowstate.Park(stateCtx)), nil
+			})
+			mustSetFlow(fr, `a`, work)
+			mustSetFlow(fr, `b`, work)
+
+			e, err := flowstate.NewEngine(d, fr, l)
+			if err != nil {
+				t.Fatalf("failed to create engine: %v", err)
+			}
+			defer func() {
+				if err := e.Shutdown(context.Background()); err != nil {
+					t.Fatalf("failed to shutdown engine: %v", err)
+				}
+			}()
+			e.SetConcurrencyLimits(limits)
+
+			start := time.Now()
+			exs := make([]*flowstate.Execution, 0, len(states))
+			for _, state := range states {
+				stateCtx := state.CopyToCtx(&flowstate.StateCtx{})
+				if err := e.Do(flowstate.Transit(stateCtx, state.Transition.To)); err != nil {
+					t.Fatalf("failed to transit: %v", err)
+				}
+
+				ex, err := e.Submit(context.Background(), stateCtx)
+				if err != nil {
+					t.Fatalf("failed to submit: %v", err)
+				}
+				exs = append(exs, ex)
+			}
+
+			for _, ex := range exs {
+				if err := ex.Wait(context.Background()); err != nil {
+					t.Fatalf("execution failed: %v", err)
+				}
+			}
+
+			if elapsed := time.Since(start); elapsed != expElapsed {
+				t.Errorf("expected elapsed %s, got %s", expElapsed, elapsed)
+			}
+
+			actMux.Lock()
+			defer actMux.Unlock()
+			if !reflect.DeepEqual(expMax, actMax) {
+				t.Errorf("expected max %v, got %v", expMax, actMax)
+			}
+		})
+	}
+
+	state := func(id, flow, tenant string) flowstate.State {
+		s := flowstate.State{
+			ID: flowstate.StateID(id),
+			Transition: flowstate.Transition{
+				To: flowstate.FlowID(flow),
+			},
+		}
+		if tenant != `` {
+			s.SetLabel(`tenant`, tenant)
+		}
+		return s
+	}
+
+	// no limits
+	f(
+		flowstate.ConcurrencyLimits{},
+		[]flowstate.State{state(`s0`, `a`, ``), state(`s1`, `a`, ``), state(`s2`, `a`, ``)},
+		map[string]int{`all`: 3, `flow:a`: 3},
+		time.Second*10,
+	)
+
+	// global limit
+	f(
+		flowstate.ConcurrencyLimits{Global: 2},
+		[]flowstate.State{state(`s0`, `a`, ``), state(`s1`, `a`, ``), state(`s2`, `a`, ``), state(`s3`, `a`, ``), state(`s4`, `a`, ``)},
+		map[string]int{`all`: 2, `flow:a`: 2},
+		time.Second*30,
+	)
+
+	// flow limit
+	f(
+		flowstate.ConcurrencyLimits{Flows: map[flowstate.FlowID]int{`a`: 1}},
+		[]flowstate.State{state(`s0`, `a`, ``), state(`s1`, `a`, ``), state(`s2`, `b`, ``), state(`s3`, `b`, ``)},
+		map[string]int{`all`: 3, `flow:a`: 1, `flow:b`: 2},
+		time.Second*20,
+	)
+
+	// label limit
+	f(
+		flowstate.ConcurrencyLimits{Labels: map[string]int{`tenant`: 1}},
+		[]flowstate.State{state(`s0`, `a`, `t0`), state(`s1`, `a`, `t0`), state(`s2`, `a`, `t1`), state(`s3`, `a`, `t1`), state(`s4`, `a`, ``)},
+		map[string]int{`all`: 3, `flow:a`: 3, `tenant:t0`: 1, `tenant:t1`: 1},
+		time.Second*20,
+	)
+}
+
+func TestSubmitBackpressure(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		lh := slogassert.New(t, slog.LevelDebug, nil)
+		l := slog.New(slogassert.New(t, slog.LevelDebug, lh))
+
+		d := memdriver.New(l)
+		fr := &flowstate.DefaultFlowRegistry{}
+		mustSetFlow(fr, `a`, flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+			time.Sleep(time.Second * 10)
+			return flowstate.Commit(flowstate.Park(stateCtx)), nil
+		}))
+
+		e, err := flowstate.NewEngine(d, fr, l)
+		if err != nil {
+			t.Fatalf("failed to create engine: %v", err)
+		}
+		defer func() {
+			if err := e.Shutdown(context.Background()); err != nil {
+				t.Fatalf("failed to shutdown engine: %v", err)
+			}
+		}()
+		e.SetConcurrencyLimits(flowstate.ConcurrencyLimits{Global: 1, MaxSubmitted: 1})
+
+		submit := func(id flowstate.StateID, timeout time.Duration) (*flowstate.Execution, error) {
+			stateCtx := &flowstate.StateCtx{
+				Current: flowstate.State{
+					ID: id,
+				},
+			}
+			if err := e.Do(flowstate.Transit(stateCtx, `a`)); err != nil {
+				t.Fatalf("failed to transit: %v", err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			return e.Submit(ctx, stateCtx)
+		}
+
+		start := time.Now()
+		ex0, err := submit(`s0`, time.Second)
+		if err != nil {
+			t.Fatalf("failed to submit: %v", err)
+		}
+
+		if _, err := submit(`s1`, time.Second); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected deadline exceeded, got %v", err)
+		}
+
+		ex2, err := submit(`s2`, time.Minute)
+		if err != nil {
+			t.Fatalf("failed to submit: %v", err)
+		}
+		if elapsed := time.Since(start); elapsed != time.Second*10 {
+			t.Errorf("expected submit blocked until %s, got %s", time.Second*10, elapsed)
+		}
+		select {
+		case <-ex0.Done():
+		default:
+			t.Errorf("expected first execution done")
+		}
+
+		if err := ex2.Wait(context.Background()); err != nil {
+			t.Fatalf("execution failed: %v", err)
+		}
+		if elapsed := time.Since(start); elapsed != time.Second*20 {
+			t.Errorf("expected elapsed %s, got %s", time.Second*20, elapsed)
+		}
+	})
+}
@@ -0,0 +1,180 @@
+package flowstate
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ConflictFlowAnnotation is set on the transition to the conflict handler flow to the flow which commit has conflicted, see TransitOnConflict.
+var ConflictFlowAnnotation = `flowstate.conflict.flow`
+
+// DefaultConflictMaxRetries is used when ConflictPolicy.MaxRetries is not set.
+const DefaultConflictMaxRetries = 3
+
+type ConflictAction string
+
+const (
+	// ConflictDrop ends the execution, it is the default action.
+	ConflictDrop ConflictAction = `drop`
+	// ConflictRetry refetches the latest state revision and re-runs the flow on it if the state is still in the flow.
+	ConflictRetry ConflictAction = `retry`
+	// ConflictTransit refetches the latest state revision and transits it to the conflict handler flow.
+	ConflictTransit ConflictAction = `transit`
+)
+
+// ConflictPolicy tells the engine what to do once a command returned by a flow fails with ErrRevMismatch.
+type ConflictPolicy struct {
+	Action ConflictAction
+
+	// MaxRetries limits consecutive conflicts of the flow before the execution fails, DefaultConflictMaxRetries if zero.
+	MaxRetries int
+	// Backoff is the delay before the first retry, it is doubled for every next one up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	// To is the conflict handler flow for ConflictTransit.
+	To FlowID
+}
+
+// DropOnConflict ends the execution silently on conflict.
+func DropOnConflict() ConflictPolicy {
+	return ConflictPolicy{Action: ConflictDrop}
+}
+
+// RetryOnConflict re-runs the flow on the latest state revision on conflict, waiting for backoff before the first retry.
+// The flow must be safe to re-run. The retry is dropped if the conflicting commit has moved the state to another flow or parked it.
+// The execution fails with an error wrapping ErrRevMismatch once maxRetries are exhausted.
+func RetryOnConflict(maxRetries int, backoff time.Duration) ConflictPolicy {
+	return ConflictPolicy{
+		Action:     ConflictRetry,
+		MaxRetries: maxRetries,
+		Backoff:    backoff,
+		MaxBackoff: backoff * 32,
+	}
+}
+
+// TransitOnConflict commits the transition of the latest state revision to the handler flow on conflict and executes it.
+// The transition has the conflicted flow in ConflictFlowAnnotation.
+func TransitOnConflict(to FlowID) ConflictPolicy {
+	return ConflictPolicy{
+		Action: ConflictTransit,
+		To:     to,
+	}
+}
+
+// SetConflictPolicy sets the policy for conflicts of commands returned by the flow.
+func (e *Engine) SetConflictPolicy(flowID FlowID, policy ConflictPolicy) error {
+	if flowID == `` {
+		return fmt.Errorf("flow id empty")
+	}
+
+	switch policy.Action {
+	case ConflictDrop, ConflictRetry:
+	case ConflictTransit:
+		if policy.To == `` {
+			return fmt.Errorf("conflict handler flow id empty")
+		}
+	default:
+		return fmt.Errorf("conflict action %q not supported", policy.Action)
+	}
+
+	e.conflictPoliciesMux.Lock()
+	defer e.conflictPoliciesMux.Unlock()
+
+	if e.conflictPolicies == nil {
+		e.conflictPolicies = make(map[FlowID]ConflictPolicy)
+	}
+	e.conflictPolicies[flowID] = policy
+
+	return nil
+}
+
+// Conflicts returns the number of ErrRevMismatch conflicts the execution of the state ran into, including retried ones.
+func (s *StateCtx) Conflicts() int {
+	return s.conflicts
+}
+
+func (e *Engine) conflictPolicy(flowID FlowID) ConflictPolicy {
+	e.conflictPoliciesMux.RLock()
+	defer e.conflictPoliciesMux.RUnlock()
+
+	policy, ok := e.conflictPolicies[flowID]
+	if !ok {
+		return DropOnConflict()
+	}
+	if policy.MaxRetries <= 0 {
+		policy.MaxRetries = DefaultConflictMaxRetries
+	}
+
+	return policy
+}
+
+// resolveConflict applies the conflict policy of the flow, it resets the state ctx to the latest revision and returns true if the execution continues.
+func (e *Engine) resolveConflict(ctx context.Context, stateCtx *StateCtx, flowID FlowID, retries int, conflictErr error) (bool, error) {
+	policy := e.conflictPolicy(flowID)
+	if policy.Action == ConflictDrop {
+		e.conflicts.inc(string(flowID), `dropped`)
+		return false, nil
+	}
+	if retries > policy.MaxRetries {
+		e.conflicts.inc(string(flowID), `exhausted`)
+		return false, fmt.Errorf("flow %s conflict retries exhausted: %d: %w", flowID, policy.MaxRetries, conflictErr)
+	}
+
+	if backoff := conflictBackoff(policy, retries); backoff > 0 {
+		t := time.NewTimer(backoff)
+		defer t.Stop()
+
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+	}
+
+	latestStateCtx := &StateCtx{}
+	if err := e.doCmd(GetStateByID(latestStateCtx, stateCtx.Current.ID, 0)); err != nil {
+		return false, fmt.Errorf("get latest state: %w", err)
+	}
+	stateCtx.Current = latestStateCtx.Current
+	stateCtx.Committed = latestStateCtx.Committed
+	stateCtx.Transitions = stateCtx.Transitions[:0]
+
+	if policy.Action == ConflictTransit {
+		e.conflicts.inc(string(flowID), `transited`)
+		if err := e.doCmd(Commit(Transit(stateCtx, policy.To).WithAnnotation(ConflictFlowAnnotation, string(flowID)))); IsErrRevMismatch(err) {
+			stateCtx.conflicts++
+			return e.resolveConflict(ctx, stateCtx, flowID, retries+1, err)
+		} else if err != nil {
+			return false, fmt.Errorf("commit transit to conflict handler flow %s: %w", policy.To, err)
+		}
+
+		return true, nil
+	}
+
+	// the conflicting commit moved the state to another flow, parked or dead-lettered it, re-running the flow would undo that
+	if stateCtx.Current.Transition.To != flowID {
+		e.conflicts.inc(string(flowID), `dropped`)
+		return false, nil
+	}
+
+	e.conflicts.inc(string(flowID), `retried`)
+	return true, nil
+}
+
+func conflictBackoff(policy ConflictPolicy, retries int) time.Duration {
+	if policy.Backoff <= 0 {
+		return 0
+	}
+
+	backoff := policy.Backoff
+	for i := 1; i < retries; i++ {
+		backoff *= 2
+		if policy.MaxBackoff > 0 && backoff >= policy.MaxBackoff {
+			return policy.MaxBackoff
+		}
+	}
+
+	return backoff
+}
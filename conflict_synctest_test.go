@@ -0,0 +1,144 @@
+//go:build goexperiment.synctest
+
+package flowstate_test
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/makasim/flowstate"
+	"github.com/makasim/flowstate/memdriver"
+	"github.com/thejerf/slogassert"
+)
+
+func TestConflictPolicy(t *testing.T) {
+	// conflictingCommit commits the state behind the back of the execution, it transits the state to the flow or parks it if the flow is empty.
+	type conflictingCommit struct {
+		at time.Duration
+		to flowstate.FlowID
+	}
+
+	f := func(policy *flowstate.ConflictPolicy, conflictingCommits []conflictingCommit, expCounter string, expConflicts, expErrs int, expResolvedFlow string) {
+		t.Helper()
+
+		synctest.Test(t, func(t *testing.T) {
+			lh := slogassert.New(t, slog.LevelDebug, nil)
+			l := slog.New(slogassert.New(t, slog.LevelDebug, lh))
+
+			d := memdriver.New(l)
+			fr := &flowstate.DefaultFlowRegistry{}
+			mustSetFlow(fr, `inc`, flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+				counter, _ := strconv.Atoi(stateCtx.Current.Annotations[`counter`])
+				time.Sleep(time.Second)
+
+				stateCtx.Current.SetAnnotation(`counter`, strconv.Itoa(counter+1))
+				return flowstate.Commit(flowstate.Park(stateCtx)), nil
+			}))
+			mustSetFlow(fr, `resolve`, flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+				stateCtx.Current.SetAnnotation(`resolved`, stateCtx.Current.Transition.Annotations[flowstate.ConflictFlowAnnotation])
+				return flowstate.Commit(flowstate.Park(stateCtx)), nil
+			}))
+
+			e, err := flowstate.NewEngine(d, fr, l)
+			if err != nil {
+				t.Fatalf("failed to create engine: %v", err)
+			}
+			defer func() {
+				if err := e.Shutdown(context.Background()); err != nil {
+					t.Fatalf("failed to shutdown engine: %v", err)
+				}
+			}()
+			if policy != nil {
+				if err := e.SetConflictPolicy(`inc`, *policy); err != nil {
+					t.Fatalf("failed to set conflict policy: %v", err)
+				}
+			}
+
+			stateCtx := &flowstate.StateCtx{
+				Current: flowstate.State{
+					ID: `aTID`,
+				},
+			}
+			if err := e.Do(flowstate.Commit(flowstate.Transit(stateCtx, `inc`))); err != nil {
+				t.Fatalf("failed to commit: %v", err)
+			}
+
+			ex, err := e.Submit(context.Background(), stateCtx.CopyTo(&flowstate.StateCtx{}))
+			if err != nil {
+				t.Fatalf("failed to submit: %v", err)
+			}
+
+			startedAt := time.Now()
+			for _, cc := range conflictingCommits {
+				time.Sleep(time.Until(startedAt.Add(cc.at)))
+
+				conflictingStateCtx := &flowstate.StateCtx{}
+				if err := e.Do(flowstate.GetStateByID(conflictingStateCtx, `aTID`, 0)); err != nil {
+					t.Fatalf("failed to get state: %v", err)
+				}
+
+				var cmd flowstate.Command = flowstate.Park(conflictingStateCtx)
+				if cc.to != `` {
+					cmd = flowstate.Transit(conflictingStateCtx, cc.to)
+				}
+				if err := e.Do(flowstate.Commit(cmd)); err != nil {
+					t.Fatalf("failed to commit conflicting state: %v", err)
+				}
+			}
+
+			var actErrs int
+			if err := ex.Wait(context.Background()); flowstate.IsErrRevMismatch(err) {
+				actErrs++
+			} else if err != nil {
+				t.Fatalf("execution failed: %v", err)
+			}
+
+			latestStateCtx := &flowstate.StateCtx{}
+			if err := e.Do(flowstate.GetStateByID(latestStateCtx, `aTID`, 0)); err != nil {
+				t.Fatalf("failed to get state: %v", err)
+			}
+
+			if act := latestStateCtx.Current.Annotations[`counter`]; act != expCounter {
+				t.Errorf("expected counter %q, got %q", expCounter, act)
+			}
+			if act := latestStateCtx.Current.Annotations[`resolved`]; act != expResolvedFlow {
+				t.Errorf("expected resolved flow %q, got %q", expResolvedFlow, act)
+			}
+			if act := ex.StateCtx.Conflicts(); act != expConflicts {
+				t.Errorf("expected %d conflicts, got %d", expConflicts, act)
+			}
+			if actErrs != expErrs {
+				t.Errorf("expected %d errors, got %d", expErrs, actErrs)
+			}
+		})
+	}
+
+	retry := flowstate.RetryOnConflict(3, time.Second)
+	exhaust := flowstate.RetryOnConflict(1, 0)
+	transit := flowstate.TransitOnConflict(`resolve`)
+
+	// dropped by default
+	f(nil, []conflictingCommit{{time.Millisecond * 500, `inc`}}, ``, 1, 0, ``)
+
+	// retried on latest
+	f(&retry, []conflictingCommit{{time.Millisecond * 500, `inc`}}, `1`, 1, 0, ``)
+
+	// retried until done, the second retry waits for the doubled backoff
+	f(&retry, []conflictingCommit{{time.Millisecond * 500, `inc`}, {time.Millisecond * 2500, `inc`}}, `1`, 2, 0, ``)
+
+	// retries exhausted
+	f(&exhaust, []conflictingCommit{{time.Millisecond * 500, `inc`}, {time.Millisecond * 1500, `inc`}}, ``, 2, 1, ``)
+
+	// retry dropped, the conflicting commit parked the state
+	f(&retry, []conflictingCommit{{time.Millisecond * 500, ``}}, ``, 1, 0, ``)
+
+	// retry dropped, the conflicting commit moved the state to another flow
+	f(&retry, []conflictingCommit{{time.Millisecond * 500, `resolve`}}, ``, 1, 0, ``)
+
+	// transited to conflict handler
+	f(&transit, []conflictingCommit{{time.Millisecond * 500, `inc`}}, ``, 1, 0, `inc`)
+}
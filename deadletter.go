@@ -0,0 +1,154 @@
+package flowstate
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DeadLetterLabel is set on states parked by Recoverer once recovery attempts are exhausted.
+// It is removed once the dead letter is retried or discarded, see RetryDeadLetter and DiscardDeadLetter.
+var DeadLetterLabel = `flowstate.dead_letter`
+var DeadLetterReasonAnnotation = `flowstate.dead_letter.reason`
+var DeadLetterFromAnnotation = `flowstate.dead_letter.from`
+var DeadLetteredAtAnnotation = `flowstate.dead_letter.at`
+var DeadLetterDiscardedAtAnnotation = `flowstate.dead_letter.discarded_at`
+
+// DeadLetterFlowAnnotation holds the flow a state is transited to once recovery attempts are exhausted, see SetDeadLetterFlow.
+var DeadLetterFlowAnnotation = `flowstate.dead_letter.flow`
+
+// SetDeadLetterFlow makes Recoverer transit the state to the flow and execute it once recovery attempts are exhausted,
+// instead of parking it with DeadLetterLabel. The transition has DeadLetterReasonAnnotation and DeadLetterFromAnnotation set.
+func SetDeadLetterFlow(stateCtx *StateCtx, to FlowID) {
+	stateCtx.Current.SetAnnotation(DeadLetterFlowAnnotation, string(to))
+}
+
+// DeadLettered reports whether the state is parked as a dead letter and has not been retried or discarded since.
+func DeadLettered(state State) bool {
+	return Parked(state) &&
+		state.Labels[DeadLetterLabel] != `` &&
+		state.Transition.Annotations[DeadLetterReasonAnnotation] != ``
+}
+
+// deadLetterCommand returns a command that dead-letters the state which exhausted recovery attempts.
+// The failure annotations of the last attempt, if any, are kept on the dead letter transition.
+func deadLetterCommand(stateCtx *StateCtx, reason string) *CommitCommand {
+	annotations := map[string]string{
+		DeadLetterReasonAnnotation: reason,
+		DeadLetterFromAnnotation:   string(stateCtx.Current.Transition.To),
+		DeadLetteredAtAnnotation:   time.Now().UTC().Format(time.RFC3339),
+	}
+	for k, v := range stateCtx.Current.Transition.Annotations {
+		if isFailureAnnotation(k) {
+			annotations[k] = v
+		}
+	}
+
+	if to := FlowID(stateCtx.Current.Annotations[DeadLetterFlowAnnotation]); to != `` {
+		return Commit(Transit(stateCtx, to).WithAnnotations(annotations))
+	}
+
+	stateCtx.Current.SetLabel(DeadLetterLabel, `true`)
+	return Commit(Park(stateCtx).WithAnnotations(annotations))
+}
+
+// GetDeadLetters returns up to limit dead-lettered states committed after sinceRev, more is true if there may be more of them.
+func GetDeadLetters(d Driver, sinceRev int64, limit int) (states []State, more bool, err error) {
+	if limit <= 0 {
+		return nil, false, fmt.Errorf("limit must be greater than 0")
+	}
+
+	it := NewIter(d, GetStatesByLabels(map[string]string{
+		DeadLetterLabel: `true`,
+	}).WithLatestOnly().WithSinceRev(sinceRev))
+	for it.Next() {
+		state := it.State()
+		if !DeadLettered(state) {
+			continue
+		}
+		// a driver may return the last labeled revision of a state retried or discarded since, the label is removed from its latest revision
+		if latestState, err := GetDeadLetter(d, state.ID); errors.Is(err, ErrNotFound) {
+			continue
+		} else if err != nil {
+			return nil, false, err
+		} else if latestState.Rev != state.Rev {
+			continue
+		}
+		if len(states) == limit {
+			return states, true, nil
+		}
+
+		states = append(states, state.CopyTo(&State{}))
+	}
+	if err := it.Err(); err != nil {
+		return nil, false, fmt.Errorf("get dead letters: %w", err)
+	}
+
+	return states, false, nil
+}
+
+// GetDeadLetter returns the latest revision of the dead-lettered state, it returns ErrNotFound if the state is not dead-lettered.
+func GetDeadLetter(d Driver, id StateID) (State, error) {
+	stateCtx := &StateCtx{}
+	getCmd := GetStateByID(stateCtx, id, 0)
+	if err := getCmd.Prepare(); err != nil {
+		return State{}, err
+	}
+	if err := d.GetStateByID(getCmd); err != nil {
+		return State{}, err
+	}
+	if !DeadLettered(stateCtx.Current) {
+		return State{}, fmt.Errorf("state %s not dead-lettered: %w", id, ErrNotFound)
+	}
+
+	return stateCtx.Current, nil
+}
+
+// RetryDeadLetter commits the dead-lettered state back to the flow it failed in with recovery attempts reset and DeadLetterLabel removed.
+// The state is executed by Delayer right away, or by Recoverer once the retry is due if there is no Delayer running.
+//
+// The delay is added after the commit, it cannot be a part of it as the delayed state must hold the committed revision.
+// If the delay fails the state is already retried and the error is returned, Recoverer executes the state once the retry is due.
+func RetryDeadLetter(d Driver, id StateID) (State, error) {
+	state, err := GetDeadLetter(d, id)
+	if err != nil {
+		return State{}, err
+	}
+
+	to := FlowID(state.Transition.Annotations[DeadLetterFromAnnotation])
+	if to == `` {
+		return State{}, fmt.Errorf("dead letter %s from flow empty", id)
+	}
+
+	stateCtx := state.CopyToCtx(&StateCtx{})
+	delete(stateCtx.Current.Labels, DeadLetterLabel)
+	if err := d.Commit(Commit(Transit(stateCtx, to))); err != nil {
+		return State{}, fmt.Errorf("commit dead letter %s transit to %s: %w", id, to, err)
+	}
+
+	delayCmd := Delay(stateCtx, to, 0)
+	if err := delayCmd.Prepare(); err != nil {
+		return State{}, err
+	}
+	if err := d.Delay(delayCmd); err != nil {
+		return State{}, fmt.Errorf("delay retried dead letter %s, Recoverer retries it once due: %w", id, err)
+	}
+
+	return stateCtx.Current, nil
+}
+
+// DiscardDeadLetter commits the dead-lettered state as parked for good with DeadLetterLabel removed, it is no longer returned by GetDeadLetters.
+func DiscardDeadLetter(d Driver, id StateID) (State, error) {
+	state, err := GetDeadLetter(d, id)
+	if err != nil {
+		return State{}, err
+	}
+
+	stateCtx := state.CopyToCtx(&StateCtx{})
+	delete(stateCtx.Current.Labels, DeadLetterLabel)
+	if err := d.Commit(Commit(Park(stateCtx).WithAnnotation(DeadLetterDiscardedAtAnnotation, time.Now().UTC().Format(time.RFC3339)))); err != nil {
+		return State{}, fmt.Errorf("commit dead letter %s discard: %w", id, err)
+	}
+
+	return stateCtx.Current, nil
+}
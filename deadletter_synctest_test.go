@@ -0,0 +1,169 @@
+//go:build goexperiment.synctest
+
+package flowstate_test
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/makasim/flowstate"
+	"github.com/makasim/flowstate/memdriver"
+	"github.com/thejerf/slogassert"
+)
+
+func TestDeadLetter(t *testing.T) {
+	f := func(deadLetterFlow flowstate.FlowID, expRuns []string) {
+		t.Helper()
+
+		synctest.Test(t, func(t *testing.T) {
+			lh := slogassert.New(t, slog.LevelDebug, nil)
+			l := slog.New(slogassert.New(t, slog.LevelDebug, lh))
+
+			healthy := &atomic.Bool{}
+			actMux := &sync.Mutex{}
+			actRuns := make([]string, 0)
+
+			d := memdriver.New(l)
+			fr := &flowstate.DefaultFlowRegistry{}
+			mustSetFlow(fr, `work`, flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+				actMux.Lock()
+				actRuns = append(actRuns, fmt.Sprintf("work:%d", flowstate.RecoveryAttempt(stateCtx.Current)))
+				actMux.Unlock()
+
+				if !healthy.Load() {
+					return nil, fmt.Errorf("service unavailable")
+				}
+				return flowstate.Commit(flowstate.Park(stateCtx)), nil
+			}))
+			mustSetFlow(fr, `handler`, flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+				ts := stateCtx.Current.Transition
+
+				actMux.Lock()
+				actRuns = append(actRuns, fmt.Sprintf("handler:%s:%s:%s", ts.Annotations[flowstate.DeadLetterFromAnnotation], ts.Annotations[flowstate.DeadLetterReasonAnnotation], ts.Annotations[flowstate.FailureErrorAnnotation]))
+				actMux.Unlock()
+
+				return flowstate.Commit(flowstate.Park(stateCtx)), nil
+			}))
+
+			e, err := flowstate.NewEngine(d, fr, l)
+			if err != nil {
+				t.Fatalf("failed to create engine: %v", err)
+			}
+			defer func() {
+				if err := e.Shutdown(context.Background()); err != nil {
+					t.Fatalf("failed to shutdown engine: %v", err)
+				}
+			}()
+
+			r, err := flowstate.NewRecoverer(e, l)
+			if err != nil {
+				t.Fatalf("failed to create recoverer: %v", err)
+			}
+			defer func() {
+				if err := r.Shutdown(context.Background()); err != nil {
+					t.Fatalf("failed to shutdown recoverer: %v", err)
+				}
+			}()
+
+			dlr, err := flowstate.NewDelayer(e, l)
+			if err != nil {
+				t.Fatalf("failed to create delayer: %v", err)
+			}
+			defer func() {
+				if err := dlr.Shutdown(context.Background()); err != nil {
+					t.Fatalf("failed to shutdown delayer: %v", err)
+				}
+			}()
+
+			stateCtx := &flowstate.StateCtx{
+				Current: flowstate.State{
+					ID: `aTID`,
+				},
+			}
+			if deadLetterFlow != `` {
+				flowstate.SetDeadLetterFlow(stateCtx, deadLetterFlow)
+			}
+			if err := e.Do(flowstate.Commit(flowstate.Transit(stateCtx, `work`))); err != nil {
+				t.Fatalf("failed to commit: %v", err)
+			}
+			if err := e.Execute(stateCtx); err == nil {
+				t.Fatalf("expected execution error")
+			}
+
+			time.Sleep(time.Minute * 15)
+			synctest.Wait()
+
+			deadLetters, more, err := flowstate.GetDeadLetters(d, 0, 10)
+			if err != nil {
+				t.Fatalf("failed to get dead letters: %v", err)
+			}
+			if more {
+				t.Errorf("expected no more dead letters")
+			}
+
+			if deadLetterFlow == `` {
+				if len(deadLetters) != 1 {
+					t.Fatalf("expected one dead letter, got %d", len(deadLetters))
+				}
+
+				deadLetter := deadLetters[0]
+				ts := deadLetter.Transition
+				if ts.Annotations[flowstate.DeadLetterReasonAnnotation] != `max recovery attempts 3 reached` {
+					t.Errorf("unexpected reason %q", ts.Annotations[flowstate.DeadLetterReasonAnnotation])
+				}
+				if ts.Annotations[flowstate.DeadLetterFromAnnotation] != `work` {
+					t.Errorf("unexpected from %q", ts.Annotations[flowstate.DeadLetterFromAnnotation])
+				}
+				if failure, _ := flowstate.StateFailure(deadLetter); failure.Error != `service unavailable` || failure.Attempt != 3 {
+					t.Errorf("unexpected failure %+v", failure)
+				}
+
+				healthy.Store(true)
+				if _, err := flowstate.RetryDeadLetter(d, `aTID`); err != nil {
+					t.Fatalf("failed to retry dead letter: %v", err)
+				}
+
+				time.Sleep(time.Minute)
+				synctest.Wait()
+
+				if deadLetters, _, err := flowstate.GetDeadLetters(d, 0, 10); err != nil {
+					t.Fatalf("failed to get dead letters: %v", err)
+				} else if len(deadLetters) != 0 {
+					t.Errorf("expected no dead letters, got %d", len(deadLetters))
+				}
+			} else if len(deadLetters) != 0 {
+				t.Errorf("expected no dead letters, got %d", len(deadLetters))
+			}
+
+			latestStateCtx := &flowstate.StateCtx{}
+			if err := e.Do(flowstate.GetStateByID(latestStateCtx, `aTID`, 0)); err != nil {
+				t.Fatalf("failed to get state: %v", err)
+			}
+			if !flowstate.Parked(latestStateCtx.Current) || flowstate.DeadLettered(latestStateCtx.Current) {
+				t.Errorf("expected state parked and not dead-lettered")
+			}
+			if label := latestStateCtx.Current.Labels[flowstate.DeadLetterLabel]; label != `` {
+				t.Errorf("expected dead letter label removed, got %q", label)
+			}
+
+			actMux.Lock()
+			defer actMux.Unlock()
+			if !reflect.DeepEqual(expRuns, actRuns) {
+				t.Errorf("expected runs %v, got %v", expRuns, actRuns)
+			}
+		})
+	}
+
+	// dead-lettered and retried
+	f(``, []string{`work:0`, `work:1`, `work:2`, `work:3`, `work:0`})
+
+	// transited to dead letter flow
+	f(`handler`, []string{`work:0`, `work:1`, `work:2`, `work:3`, `handler:work:max recovery attempts 3 reached:service unavailable`})
+}
@@ -0,0 +1,111 @@
+package flowstate
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var DeadlineAnnotation = `flowstate.deadline`
+var TransitionDeadlineAnnotation = `flowstate.transition.deadline`
+var DeadlineFlowAnnotation = `flowstate.deadline.flow`
+var DeadlineExceededAnnotation = `flowstate.deadline.exceeded`
+
+var errStateDeadlineExceeded = errors.New(`state deadline exceeded`)
+var errTransitionDeadlineExceeded = errors.New(`transition deadline exceeded`)
+
+// SetDeadline sets a deadline for the state.
+// The deadline applies to every execution of the state until it is cleared or exceeded.
+func SetDeadline(stateCtx *StateCtx, deadline time.Time) {
+	stateCtx.Current.SetAnnotation(DeadlineAnnotation, deadline.UTC().Format(time.RFC3339Nano))
+}
+
+// SetTimeout is a shortcut for SetDeadline(stateCtx, time.Now().Add(timeout)).
+func SetTimeout(stateCtx *StateCtx, timeout time.Duration) {
+	SetDeadline(stateCtx, time.Now().Add(timeout))
+}
+
+// ClearDeadline removes the state deadline set by SetDeadline or SetTimeout.
+func ClearDeadline(stateCtx *StateCtx) {
+	delete(stateCtx.Current.Annotations, DeadlineAnnotation)
+}
+
+// SetDeadlineFlow sets a flow the engine transits the state to once a deadline is exceeded.
+// If the flow is not set the engine parks the state.
+func SetDeadlineFlow(stateCtx *StateCtx, to FlowID) {
+	stateCtx.Current.SetAnnotation(DeadlineFlowAnnotation, string(to))
+}
+
+// DeadlineExceeded reports whether the state was transited or parked by the engine because of an exceeded deadline.
+func DeadlineExceeded(state State) bool {
+	return state.Transition.Annotations[DeadlineExceededAnnotation] != ``
+}
+
+func stateDeadline(state State) (time.Time, bool) {
+	return parseDeadline(state.Annotations[DeadlineAnnotation])
+}
+
+func transitionDeadline(state State) (time.Time, bool) {
+	return parseDeadline(state.Transition.Annotations[TransitionDeadlineAnnotation])
+}
+
+func parseDeadline(deadlineStr string) (time.Time, bool) {
+	if deadlineStr == `` {
+		return time.Time{}, false
+	}
+
+	deadline, err := time.Parse(time.RFC3339Nano, deadlineStr)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return deadline, true
+}
+
+// stepContext derives a context for a single flow execution step.
+// The context ends at the earliest of the parent, the state and the transition deadlines.
+func stepContext(parent context.Context, state State) (context.Context, context.CancelFunc) {
+	var deadline time.Time
+	var cause error
+
+	if d, ok := stateDeadline(state); ok {
+		deadline, cause = d, errStateDeadlineExceeded
+	}
+	if d, ok := transitionDeadline(state); ok && (deadline.IsZero() || d.Before(deadline)) {
+		deadline, cause = d, errTransitionDeadlineExceeded
+	}
+
+	if deadline.IsZero() {
+		return context.WithCancel(parent)
+	}
+
+	return context.WithDeadlineCause(parent, deadline, cause)
+}
+
+// stateDeadlineExceeded reports whether the step context ended because of the state or the transition deadline.
+// The caller context cancellation and deadline abort the execution instead.
+func stateDeadlineExceeded(ctx context.Context) bool {
+	if ctx.Err() == nil {
+		return false
+	}
+
+	cause := context.Cause(ctx)
+	return cause == errStateDeadlineExceeded || cause == errTransitionDeadlineExceeded
+}
+
+// deadlineExceededCommand builds a command committed by the engine instead of a flow command once a deadline is exceeded.
+func deadlineExceededCommand(stateCtx *StateCtx, ctx context.Context) Command {
+	reason := `state`
+	if context.Cause(ctx) == errTransitionDeadlineExceeded {
+		reason = `transition`
+	}
+
+	ClearDeadline(stateCtx)
+
+	to := FlowID(stateCtx.Current.Annotations[DeadlineFlowAnnotation])
+	if to == `` {
+		return Commit(Park(stateCtx).WithAnnotation(DeadlineExceededAnnotation, reason).skipStateMachineCheck())
+	}
+
+	return Commit(Transit(stateCtx, to).WithAnnotation(DeadlineExceededAnnotation, reason).skipStateMachineCheck())
+}
@@ -6,13 +6,20 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
 	"strconv"
+	"sync"
 	"time"
+
+	"github.com/cespare/xxhash/v2"
 )
 
 var DelayUntilAnnotation = `flowstate.delay.until`
 var DelayCommitAnnotation = `flowstate.delay.commit`
 
+// DelayCancelledAnnotation is set on a tombstone delayed state to the offset of the cancelled delayed state, see CancelDelayCommand.Tombstone.
+var DelayCancelledAnnotation = `flowstate.delay.cancelled`
+
 func Delayed(state State) bool {
 	return state.Transition.Annotations[DelayUntilAnnotation] != ``
 }
@@ -22,6 +29,11 @@ func DelayedUntil(state State) time.Time {
 	return until
 }
 
+// Delay executes the state transition to the flow once the duration has passed, see Delayer.
+// The delayed state holds the state revision it is delayed at, and the Delayer commits the transition against that revision.
+// If the state is committed again before the delay is due, the delayed state is dropped and never fired:
+// the state has moved on, so a stale timeout must not override the newer progress. Delay again after such a commit if the delay is still needed.
+// An uncommitted delay, see WithCommit, is not fenced by the state revision and is fired anyway.
 func Delay(stateCtx *StateCtx, to FlowID, dur time.Duration) *DelayCommand {
 	return &DelayCommand{
 		StateCtx:  stateCtx,
@@ -31,6 +43,7 @@ func Delay(stateCtx *StateCtx, to FlowID, dur time.Duration) *DelayCommand {
 	}
 }
 
+// DelayUntil is like Delay but executes the state transition at the given time.
 func DelayUntil(stateCtx *StateCtx, to FlowID, executeAt time.Time) *DelayCommand {
 	return &DelayCommand{
 		StateCtx:  stateCtx,
@@ -102,6 +115,92 @@ func (cmd *DelayCommand) MustResult() DelayedState {
 	return *cmd.Result
 }
 
+// CancelDelay cancels delayed states of the state, so the Delayer does not execute them.
+// It is useful if the state has moved on before the delay is due, for example, a step is completed earlier than a timeout.
+// The command could be committed along with other commands, like Delay.
+func CancelDelay(stateCtx *StateCtx) *CancelDelayCommand {
+	return &CancelDelayCommand{
+		StateCtx: stateCtx,
+	}
+}
+
+// Reschedule moves delayed states of the state, which are not due yet, to the given time.
+func Reschedule(stateCtx *StateCtx, executeAt time.Time) *CancelDelayCommand {
+	return CancelDelay(stateCtx).WithRescheduleAt(executeAt)
+}
+
+type CancelDelayCommand struct {
+	command
+	StateCtx     *StateCtx
+	RescheduleAt time.Time
+
+	// Result contains cancelled delayed states or rescheduled ones, if RescheduleAt is set.
+	Result []DelayedState
+}
+
+func (cmd *CancelDelayCommand) WithRescheduleAt(executeAt time.Time) *CancelDelayCommand {
+	cmd.RescheduleAt = executeAt
+	return cmd
+}
+
+func (cmd *CancelDelayCommand) Prepare() error {
+	if cmd.StateCtx == nil || cmd.StateCtx.Current.ID == `` {
+		return fmt.Errorf("state id empty")
+	}
+
+	cmd.Result = nil
+	return nil
+}
+
+// Rescheduled returns a copy of the cancelled delayed state moved to RescheduleAt.
+// It returns false if the command does not reschedule or the delayed state is already due; such a delayed state is dropped.
+// Drivers must store the returned delayed state with a new offset.
+func (cmd *CancelDelayCommand) Rescheduled(delayedState DelayedState, now time.Time) (DelayedState, bool) {
+	if cmd.RescheduleAt.IsZero() || !delayedState.ExecuteAt.After(now) {
+		return DelayedState{}, false
+	}
+
+	rescheduled := DelayedState{
+		State:     delayedState.State.CopyTo(&State{}),
+		ExecuteAt: cmd.RescheduleAt,
+	}
+	rescheduled.State.Transition.SetAnnotation(DelayUntilAnnotation, cmd.RescheduleAt.Format(time.RFC3339))
+
+	return rescheduled, true
+}
+
+// Tombstone returns a delayed state which marks the cancelled delayed state as cancelled.
+// Drivers must store the tombstone with a new offset along with deleting the cancelled delayed state,
+// so a Delayer that has already loaded the cancelled delayed state drops it on the next read, see DelayTombstone.
+// Tombstones are not cancelled themselves.
+func (cmd *CancelDelayCommand) Tombstone(delayedState DelayedState, now time.Time) DelayedState {
+	tombstone := DelayedState{
+		State: State{
+			ID:  delayedState.State.ID,
+			Rev: delayedState.State.Rev,
+		},
+		ExecuteAt: now,
+	}
+	tombstone.State.Transition.SetAnnotation(DelayCancelledAnnotation, strconv.FormatInt(delayedState.Offset, 10))
+
+	return tombstone
+}
+
+// DelayTombstone reports whether the delayed state is a tombstone and returns the offset of the cancelled delayed state.
+func DelayTombstone(delayedState DelayedState) (int64, bool) {
+	offset0, ok := delayedState.State.Transition.Annotations[DelayCancelledAnnotation]
+	if !ok {
+		return 0, false
+	}
+
+	offset, err := strconv.ParseInt(offset0, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return offset, true
+}
+
 type DelayedState struct {
 	State     State
 	Offset    int64
@@ -125,6 +224,7 @@ func (ds *DelayedState) UnmarshalJSON(data []byte) error {
 const GetDelayedStatesDefaultLimit = 500
 
 type GetDelayedStatesResult struct {
+	// States may include tombstones of cancelled delayed states, see DelayTombstone.
 	States []DelayedState
 	More   bool
 }
@@ -147,10 +247,35 @@ type GetDelayedStatesCommand struct {
 	// Should be used to pagination results.
 	Offset int64
 	Limit  int
+	// Shard and Shards limit the result to delayed states of the shard if Shards is greater than 1, see DelayedStateShard.
+	Shard  int
+	Shards int
 
 	Result *GetDelayedStatesResult
 }
 
+// WithShard limits the result to delayed states of the shard out of the number of shards, see DelayedStateShard.
+func (cmd *GetDelayedStatesCommand) WithShard(shard, shards int) *GetDelayedStatesCommand {
+	cmd.Shard = shard
+	cmd.Shards = shards
+	return cmd
+}
+
+// InShard reports whether delayed states of the state belong to the shard requested by the command.
+// Drivers skip delayed states not in the shard before applying the limit.
+func (cmd *GetDelayedStatesCommand) InShard(id StateID) bool {
+	return cmd.Shards <= 1 || DelayedStateShard(id, cmd.Shards) == cmd.Shard
+}
+
+// DelayedStateShard returns the shard of the delayed log delayed states of the state belong to, it is the state ID hash modulo the number of shards.
+func DelayedStateShard(id StateID, shards int) int {
+	if shards <= 1 {
+		return 0
+	}
+
+	return int(xxhash.Sum64String(string(id)) % uint64(shards))
+}
+
 func (cmd *GetDelayedStatesCommand) MustResult() *GetDelayedStatesResult {
 	if cmd.Result == nil {
 		panic("FATAL: MustResult must be called after successful execution of the command; have you checked for errors?")
@@ -168,61 +293,117 @@ func (cmd *GetDelayedStatesCommand) Prepare() {
 	}
 }
 
+var delayerMetaStateID = StateID(`flowstate.delayer.meta`)
+
+// DelayerMetaLabel is set on the shard meta states of delayers.
+var DelayerMetaLabel = `flowstate.delayer.meta`
+
+// DelayerShardsAnnotation is set on a shard meta state to the number of shards the delayer splits the delayed log into.
+var DelayerShardsAnnotation = `flowstate.delayer.shards`
+
+// DelayerMemberLabel is set on the member states of running delayers, shards are spread evenly across the members.
+// A member state ID is the label followed by a slot number, a delayer takes the first slot with an available lease, so member states are reused
+// and their number is bounded by the number of delayers running at the same time.
+var DelayerMemberLabel = `flowstate.delayer.member`
+
+// Delayer executes delayed states once they are due, see Delay.
+//
+// The delayed log is split into shards by the state ID hash, see NewShardedDelayer.
+// Each shard has its own meta state which stores the shard cursor and the lease, only the delayer holding the lease executes delayed states of the shard.
+// Several delayers could run at the same time, the shards are spread evenly across them and rebalanced once a delayer joins or leaves.
+// A delayer takes over shards of a delayer which shut down or stopped renewing leases, see LeaseDuration, and resumes them from the committed cursor.
+// A delayed state with commit is committed against its revision, so a delayer that has lost the lease, for example after a long pause, cannot execute it twice.
+// Uncommitted delayed states are fired only after the shard meta state is committed, once per tick, so such a delayer cannot execute them either.
 type Delayer struct {
 	e *Engine
 
+	holder         string
+	memberStateCtx *StateCtx
+	shards         []*delayerShard
+
+	heldMux sync.Mutex
+	held    []int
+
+	activeGauge *metricVec
+	shardsGauge *metricVec
+	queueDepth  *metricVec
+	fired       *metricVec
+	lateness    *metricVec
+
+	ctx       context.Context
+	cancel    context.CancelFunc
+	stopCh    chan struct{}
+	stoppedCh chan struct{}
+	l         *slog.Logger
+}
+
+type delayerShard struct {
+	num          int
+	metaStateID  StateID
+	active       bool
 	metaStateCtx *StateCtx
 	offset       int64
 	since        time.Time
-	until        time.Time
-	limit        int
 
 	commitSince  time.Time
 	commitOffset int64
 
 	delayedStates map[int64]DelayedState
-
-	stopCh    chan struct{}
-	stoppedCh chan struct{}
-	l         *slog.Logger
 }
 
+// NewDelayer creates a delayer with a single shard, see NewShardedDelayer.
 func NewDelayer(e *Engine, l *slog.Logger) (*Delayer, error) {
+	return NewShardedDelayer(e, 1, l)
+}
+
+// NewShardedDelayer creates a delayer which splits the delayed log into the number of shards.
+// All delayers sharing the driver must be created with the same number of shards.
+// Changing the number starts new shards from the cursor of the previous number of shards, the min cursor of its shard meta states:
+// committed delayed states the previous shards have executed past that cursor are skipped as the state has moved on, uncommitted ones are executed again.
+func NewShardedDelayer(e *Engine, shards int, l *slog.Logger) (*Delayer, error) {
+	if shards <= 0 {
+		return nil, fmt.Errorf("shards must be greater than 0")
+	}
+
 	d := &Delayer{
 		e: e,
 		l: l,
 
-		delayedStates: make(map[int64]DelayedState),
-		stopCh:        make(chan struct{}),
-		stoppedCh:     make(chan struct{}),
+		holder:    newLeaseHolder(),
+		stopCh:    make(chan struct{}),
+		stoppedCh: make(chan struct{}),
+
+		activeGauge: e.m.gauge(`flowstate_delayer_active`, `Whether the delayer holds at least one shard (1) or in standby (0); delayer is the delayer lease holder.`, `delayer`),
+		shardsGauge: e.m.gauge(`flowstate_delayer_shards`, `Number of delayed log shards held by the delayer.`, `delayer`),
+		queueDepth:  e.m.gauge(`flowstate_delayer_queue_depth`, `Number of delayed states loaded and waiting to be executed.`, `delayer`),
+		fired:       e.m.counter(`flowstate_delayer_fired_total`, `Number of delayed states handed over for execution.`),
+		lateness:    e.m.histogram(`flowstate_delayer_lateness_seconds`, `Time between the delayed state execute at time and the actual execution.`, DefaultLatenessBuckets),
 	}
+	d.ctx, d.cancel = context.WithCancel(context.Background())
 
-	metaStateCtx := &StateCtx{}
-	if err := d.e.Do(GetStateByID(metaStateCtx, `flowstate.delayer.meta`, 0)); errors.Is(err, ErrNotFound) {
-		metaStateCtx.Current = State{
-			ID:  `flowstate.delayer.meta`,
-			Rev: 0,
+	for i := 0; i < shards; i++ {
+		metaStateID := delayerMetaStateID
+		if shards > 1 {
+			metaStateID = StateID(fmt.Sprintf("%s.%d.%d", delayerMetaStateID, shards, i))
 		}
-		setDelayerMetaState(metaStateCtx, time.Unix(0, 0).UTC(), 0)
 
-		if err := d.e.Do(Commit(
-			Park(metaStateCtx),
-		)); IsErrRevMismatch(err) {
-			return nil, fmt.Errorf("another process is already doing delaying; exiting (todo: implement standby mode)")
-		} else if err != nil {
-			return nil, fmt.Errorf("commit meta state: %w", err)
-		}
-	} else if err != nil {
-		return nil, fmt.Errorf("get meta state: %w", err)
+		d.shards = append(d.shards, &delayerShard{
+			num:           i,
+			metaStateID:   metaStateID,
+			delayedStates: make(map[int64]DelayedState),
+		})
 	}
 
-	d.metaStateCtx = metaStateCtx
-	d.commitSince, d.commitOffset = getDelayerMetaState(metaStateCtx)
-	d.since, d.offset = d.commitSince, d.commitOffset
+	if err := d.updateLeases(time.Now()); err != nil {
+		return nil, err
+	}
 
 	go func() {
 		defer close(d.stoppedCh)
 
+		leaseT := time.NewTicker(LeaseRenewInterval)
+		defer leaseT.Stop()
+
 		updateHeadT := time.NewTicker(time.Second * 30)
 		defer updateHeadT.Stop()
 
@@ -232,36 +413,65 @@ func NewDelayer(e *Engine, l *slog.Logger) (*Delayer, error) {
 		updateTailT := time.NewTicker(time.Second)
 		defer updateTailT.Stop()
 
-		commitT := time.NewTicker(time.Minute)
-		defer commitT.Stop()
-
 		for {
 			select {
+			case now := <-leaseT.C:
+				if err := d.updateLeases(now); err != nil {
+					d.l.Error(fmt.Sprintf("update leases: %s; retrying", err))
+				}
 			case now := <-updateHeadT.C:
-				until := now.Add(time.Minute)
-				if _, err := d.queryDelayedStates(d.since, until, 0); err != nil {
-					d.l.Error(fmt.Sprintf("query delayed from %s to %s, offset=%d: %s", d.since, until, 0, err))
+				for _, s := range d.shards {
+					if !s.active {
+						continue
+					}
+
+					until := now.Add(time.Minute)
+					if _, err := d.queryDelayedStates(s, s.since, until, 0); err != nil {
+						d.l.Error(fmt.Sprintf("query delayed from %s to %s, offset=%d, shard=%d: %s", s.since, until, 0, s.num, err))
+					}
+					s.since = until
 				}
-				d.since = until
 			case now := <-updateHeadFreshT.C:
-				var since time.Time
-				if d.offset > 0 {
-					since = now.Add(-time.Hour * 24)
-				}
-				until := now.Add(time.Minute)
-				nextOffset, err := d.queryDelayedStates(since, until, d.offset)
-				if err != nil {
-					d.l.Error(fmt.Sprintf("query delayed from %s to %s, offset=%d: %s", since, until, d.offset, err))
+				for _, s := range d.shards {
+					if !s.active {
+						continue
+					}
+
+					if err := d.updateHeadFresh(s, now); err != nil {
+						d.l.Error(err.Error())
+					}
 				}
-				d.offset = nextOffset
 			case now := <-updateTailT.C:
-				if err := d.updateTail(now); err != nil {
-					d.l.Error(fmt.Sprintf("update tail: %s; retrying", err.Error()))
+				queueDepth := 0
+				for _, s := range d.shards {
+					if !s.active {
+						continue
+					}
+
+					if err := d.updateTail(s, now); err != nil {
+						d.l.Error(fmt.Sprintf("update tail, shard=%d: %s; retrying", s.num, err.Error()))
+					}
+					queueDepth += len(s.delayedStates)
 				}
-			case <-commitT.C:
-				d.maybeCommitMeta()
+				d.queueDepth.set(float64(queueDepth), d.holder)
 			case <-d.stopCh:
-				d.maybeCommitMeta()
+				// leases expire right away, so other delayers take the shards over on their next check
+				now := time.Now()
+				for _, s := range d.shards {
+					if !s.active {
+						continue
+					}
+
+					if err := d.commitMeta(s, now); err != nil {
+						d.l.Error(fmt.Sprintf("release shard %d lease: %s", s.num, err))
+					}
+					d.deactivate(s)
+				}
+				d.updateHeld()
+
+				if err := d.releaseMember(now); err != nil {
+					d.l.Error(fmt.Sprintf("release member state: %s", err))
+				}
 
 				return
 			}
@@ -271,37 +481,350 @@ func NewDelayer(e *Engine, l *slog.Logger) (*Delayer, error) {
 	return d, nil
 }
 
-func (d *Delayer) maybeCommitMeta() {
-	// no delayed states at all, no need to commit
-	if d.commitSince.Equal(time.Unix(0, 0).UTC()) && d.commitOffset == 0 {
-		return
+// Active reports whether the delayer holds at least one shard and executes its delayed states.
+func (d *Delayer) Active() bool {
+	return len(d.Shards()) > 0
+}
+
+// Shards returns numbers of the shards held by the delayer.
+func (d *Delayer) Shards() []int {
+	d.heldMux.Lock()
+	defer d.heldMux.Unlock()
+
+	return slices.Clone(d.held)
+}
+
+// updateLeases renews the member state and the leases of held shards.
+// It releases shards above the fair share, which is the number of shards divided by the number of live members,
+// and takes available shards over up to the fair share.
+func (d *Delayer) updateLeases(now time.Time) error {
+	if err := d.renewMember(now); err != nil {
+		return err
+	}
+
+	members := 0
+	it := d.e.Iter(GetStatesByLabels(map[string]string{
+		DelayerMemberLabel: `true`,
+	}).WithLatestOnly())
+	for it.Next() {
+		if !leaseAvailable(it.State(), now) {
+			members++
+		}
+	}
+	if err := it.Err(); err != nil {
+		return fmt.Errorf("get delayer members: %w", err)
+	}
+	fairShare := (len(d.shards) + max(members, 1) - 1) / max(members, 1)
+
+	held := 0
+	for _, s := range d.shards {
+		if !s.active {
+			continue
+		}
+
+		if held >= fairShare {
+			// release the shard, so a delayer below the fair share takes it over
+			if err := d.commitMeta(s, now); err != nil {
+				return err
+			}
+			if s.active {
+				d.l.Info("delayer: shard released", "holder", d.holder, "shard", s.num)
+				d.deactivate(s)
+			}
+			continue
+		}
+
+		if err := d.commitMeta(s, now.Add(LeaseDuration)); err != nil {
+			return err
+		}
+		if s.active {
+			held++
+		}
+	}
+
+	// delayers start looking for available shards at different positions to reduce contention
+	start := int(xxhash.Sum64String(d.holder) % uint64(len(d.shards)))
+	for i := range d.shards {
+		if held >= fairShare {
+			break
+		}
+
+		s := d.shards[(start+i)%len(d.shards)]
+		if s.active {
+			continue
+		}
+
+		if err := d.acquireShard(s, now); err != nil {
+			return err
+		}
+		if s.active {
+			held++
+		}
+	}
+
+	d.updateHeld()
+
+	return nil
+}
+
+// acquireShard takes the shard lease over if it is available and resumes the shard from the committed cursor.
+func (d *Delayer) acquireShard(s *delayerShard, now time.Time) error {
+	metaStateCtx := &StateCtx{}
+	if err := d.e.Do(GetStateByID(metaStateCtx, s.metaStateID, 0)); errors.Is(err, ErrNotFound) {
+		since, offset, err := d.previousCursor()
+		if err != nil {
+			return fmt.Errorf("get shard %d previous cursor: %w", s.num, err)
+		}
+
+		metaStateCtx.Current = State{
+			ID:  s.metaStateID,
+			Rev: 0,
+		}
+		setDelayerMetaState(metaStateCtx, since, offset)
+	} else if err != nil {
+		return fmt.Errorf("get shard %d meta state: %w", s.num, err)
 	}
 
-	committedSince, committedOffset := getDelayerMetaState(d.metaStateCtx)
-	if d.commitSince.Equal(committedSince) && d.commitOffset == committedOffset {
-		// no changes since last commit, no need to commit
-		return
+	if !leaseAvailable(metaStateCtx.Current, now) {
+		return nil
 	}
 
-	nextMetaState := d.metaStateCtx.CopyTo(&StateCtx{})
-	setDelayerMetaState(nextMetaState, d.commitSince, d.commitOffset)
-	if err := d.e.Do(Commit(Park(nextMetaState))); IsErrRevMismatch(err) {
-		d.l.Warn("another process is already doing delaying; exiting (todo: implement standby mode)")
+	DisableRecovery(metaStateCtx)
+	metaStateCtx.Current.SetLabel(DelayerMetaLabel, `true`)
+	metaStateCtx.Current.SetAnnotation(DelayerShardsAnnotation, strconv.Itoa(len(d.shards)))
+	setLease(metaStateCtx, d.holder, now.Add(LeaseDuration))
+	if err := d.e.Do(Commit(Park(metaStateCtx))); IsErrRevMismatch(err) {
+		// another delayer has taken the lease over
+		return nil
 	} else if err != nil {
-		d.l.Error(fmt.Sprintf("commit meta state: %s", err))
+		return fmt.Errorf("commit shard %d meta state: %w", s.num, err)
 	}
 
-	nextMetaState.CopyTo(d.metaStateCtx)
+	s.active = true
+	s.metaStateCtx = metaStateCtx
+	s.commitSince, s.commitOffset = getDelayerMetaState(metaStateCtx)
+	s.since, s.offset = s.commitSince, s.commitOffset
+	s.delayedStates = make(map[int64]DelayedState)
+	d.l.Info("delayer: shard lease acquired", "holder", d.holder, "shard", s.num)
+
+	return nil
 }
 
-func (d *Delayer) queryDelayedStates(since, until time.Time, offset int64) (int64, error) {
+// previousCursor returns the cursor a new shard starts from when the number of shards has changed.
+// The cursor of a previous number of shards is the min since and offset of its shard meta states, delayed states past it might not be executed by all of them.
+// The previous number of shards which has progressed the furthest wins, the beginning of the delayed log is returned if there is none.
+func (d *Delayer) previousCursor() (time.Time, int64, error) {
+	metaStates := make(map[StateID]State)
+	if len(d.shards) > 1 {
+		// the single shard meta state could be committed before the label was added
+		metaStateCtx := &StateCtx{}
+		if err := d.e.Do(GetStateByID(metaStateCtx, delayerMetaStateID, 0)); err == nil {
+			metaStates[metaStateCtx.Current.ID] = metaStateCtx.Current
+		} else if !errors.Is(err, ErrNotFound) {
+			return time.Time{}, 0, fmt.Errorf("get meta state: %w", err)
+		}
+	}
+
+	it := d.e.Iter(GetStatesByLabels(map[string]string{
+		DelayerMetaLabel: `true`,
+	}).WithLatestOnly())
+	for it.Next() {
+		metaStates[it.State().ID] = it.State()
+	}
+	if err := it.Err(); err != nil {
+		return time.Time{}, 0, fmt.Errorf("get meta states: %w", err)
+	}
+
+	type cursor struct {
+		since      time.Time
+		offset     int64
+		metaStates int
+	}
+	cursors := make(map[int]*cursor)
+	for _, metaState := range metaStates {
+		shards := 1
+		if shards0 := metaState.Annotations[DelayerShardsAnnotation]; shards0 != `` {
+			var err error
+			if shards, err = strconv.Atoi(shards0); err != nil {
+				return time.Time{}, 0, fmt.Errorf("cannot parse %s='%s' into int: %w", DelayerShardsAnnotation, shards0, err)
+			}
+		}
+		if shards == len(d.shards) {
+			continue
+		}
+
+		since, offset := getDelayerMetaState(metaState.CopyToCtx(&StateCtx{}))
+		c, ok := cursors[shards]
+		if !ok {
+			cursors[shards] = &cursor{since: since, offset: offset, metaStates: 1}
+			continue
+		}
+		if since.Before(c.since) {
+			c.since = since
+		}
+		c.offset = min(c.offset, offset)
+		c.metaStates++
+	}
+
+	since, offset := time.Unix(0, 0).UTC(), int64(0)
+	for shards, c := range cursors {
+		// shards which have never been acquired have not executed anything, the cursor is not safe to start from
+		if c.metaStates != shards {
+			continue
+		}
+		if c.offset > offset || (c.offset == offset && c.since.After(since)) {
+			since, offset = c.since, c.offset
+		}
+	}
+
+	return since, offset, nil
+}
+
+// commitMeta commits the shard cursor and extends the lease till expiresAt, the shard is deactivated if another delayer has taken the lease over.
+func (d *Delayer) commitMeta(s *delayerShard, expiresAt time.Time) error {
+	nextMetaStateCtx := s.metaStateCtx.CopyTo(&StateCtx{})
+	setDelayerMetaState(nextMetaStateCtx, s.commitSince, s.commitOffset)
+	setLease(nextMetaStateCtx, d.holder, expiresAt)
+	if err := d.e.Do(Commit(Park(nextMetaStateCtx))); IsErrRevMismatch(err) {
+		d.standby(s)
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("commit shard %d meta state: %w", s.num, err)
+	}
+
+	s.metaStateCtx = nextMetaStateCtx
+
+	return nil
+}
+
+// renewMember extends the member slot lease, a delayer without a slot or which has lost it takes the first available slot over.
+func (d *Delayer) renewMember(now time.Time) error {
+	if d.memberStateCtx != nil {
+		nextMemberStateCtx := d.memberStateCtx.CopyTo(&StateCtx{})
+		setLease(nextMemberStateCtx, d.holder, now.Add(LeaseDuration))
+		if err := d.e.Do(Commit(Park(nextMemberStateCtx))); err == nil {
+			d.memberStateCtx = nextMemberStateCtx
+			return nil
+		} else if !IsErrRevMismatch(err) {
+			return fmt.Errorf("commit member state: %w", err)
+		}
+
+		// the lease has expired and another delayer has taken the slot over
+		d.memberStateCtx = nil
+	}
+
+	for slot := 0; ; slot++ {
+		memberStateCtx := &StateCtx{}
+		memberStateID := StateID(fmt.Sprintf("%s.%d", DelayerMemberLabel, slot))
+		if err := d.e.Do(GetStateByID(memberStateCtx, memberStateID, 0)); errors.Is(err, ErrNotFound) {
+			memberStateCtx.Current = State{
+				ID: memberStateID,
+				Labels: map[string]string{
+					DelayerMemberLabel: `true`,
+				},
+			}
+			DisableRecovery(memberStateCtx)
+		} else if err != nil {
+			return fmt.Errorf("get member state %d: %w", slot, err)
+		}
+
+		if !leaseAvailable(memberStateCtx.Current, now) {
+			continue
+		}
+
+		setLease(memberStateCtx, d.holder, now.Add(LeaseDuration))
+		if err := d.e.Do(Commit(Park(memberStateCtx))); IsErrRevMismatch(err) {
+			// another delayer has taken the slot
+			continue
+		} else if err != nil {
+			return fmt.Errorf("commit member state %d: %w", slot, err)
+		}
+
+		d.memberStateCtx = memberStateCtx
+
+		return nil
+	}
+}
+
+// releaseMember expires the member slot lease right away, so the slot is reused by the next delayer.
+func (d *Delayer) releaseMember(now time.Time) error {
+	if d.memberStateCtx == nil {
+		return nil
+	}
+
+	nextMemberStateCtx := d.memberStateCtx.CopyTo(&StateCtx{})
+	setLease(nextMemberStateCtx, d.holder, now)
+	if err := d.e.Do(Commit(Park(nextMemberStateCtx))); IsErrRevMismatch(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("commit member state: %w", err)
+	}
+
+	d.memberStateCtx = nil
+
+	return nil
+}
+
+func (d *Delayer) standby(s *delayerShard) {
+	d.l.Warn("delayer: shard lease taken over by another delayer; standing by", "holder", d.holder, "shard", s.num)
+	d.deactivate(s)
+	d.updateHeld()
+}
+
+func (d *Delayer) deactivate(s *delayerShard) {
+	s.active = false
+	s.delayedStates = make(map[int64]DelayedState)
+}
+
+func (d *Delayer) updateHeld() {
+	held := make([]int, 0, len(d.shards))
+	for _, s := range d.shards {
+		if s.active {
+			held = append(held, s.num)
+		}
+	}
+
+	d.heldMux.Lock()
+	d.held = held
+	d.heldMux.Unlock()
+
+	d.shardsGauge.set(float64(len(held)), d.holder)
+	if len(held) > 0 {
+		d.activeGauge.set(1, d.holder)
+	} else {
+		d.activeGauge.set(0, d.holder)
+	}
+}
+
+// owns reports whether the delayed state belongs to the shard.
+func (d *Delayer) owns(s *delayerShard, id StateID) bool {
+	return DelayedStateShard(id, len(d.shards)) == s.num
+}
+
+// updateHeadFresh reads delayed states added to the log since the shard offset, including tombstones of cancelled ones.
+func (d *Delayer) updateHeadFresh(s *delayerShard, now time.Time) error {
+	var since time.Time
+	if s.offset > 0 {
+		since = now.Add(-time.Hour * 24)
+	}
+	until := now.Add(time.Minute)
+	nextOffset, err := d.queryDelayedStates(s, since, until, s.offset)
+	if err != nil {
+		return fmt.Errorf("query delayed from %s to %s, offset=%d, shard=%d: %w", since, until, s.offset, s.num, err)
+	}
+	s.offset = nextOffset
+
+	return nil
+}
+
+func (d *Delayer) queryDelayedStates(s *delayerShard, since, until time.Time, offset int64) (int64, error) {
 	nextOffset := offset
 	for {
-		if len(d.delayedStates) > 1000 {
-			return 0, nil
+		if len(s.delayedStates) > 1000 {
+			return nextOffset, nil
 		}
 
-		cmd := GetDelayedStates(since, until, offset)
+		cmd := GetDelayedStates(since, until, nextOffset).WithShard(s.num, len(d.shards))
 		if err := d.e.Do(cmd); err != nil {
 			return 0, fmt.Errorf("get delayed states: %w", err)
 		}
@@ -312,8 +835,18 @@ func (d *Delayer) queryDelayedStates(since, until time.Time, offset int64) (int6
 		}
 
 		for _, state := range res.States {
-			d.delayedStates[state.Offset] = state
 			nextOffset = max(nextOffset, state.Offset)
+			// drivers filter delayed states by shard, yet may return ones they cannot hash, like pg rows stored before the id hash column was added
+			if !d.owns(s, state.State.ID) {
+				continue
+			}
+
+			if cancelledOffset, ok := DelayTombstone(state); ok {
+				delete(s.delayedStates, cancelledOffset)
+				continue
+			}
+
+			s.delayedStates[state.Offset] = state
 		}
 
 		if res.More {
@@ -324,44 +857,96 @@ func (d *Delayer) queryDelayedStates(since, until time.Time, offset int64) (int6
 	}
 }
 
-func (d *Delayer) updateTail(now time.Time) error {
-	commitSince := d.commitSince
-	commitOffset := d.commitOffset
-	for _, delayedState := range d.delayedStates {
+func (d *Delayer) updateTail(s *delayerShard, now time.Time) error {
+	due := false
+	for _, delayedState := range s.delayedStates {
+		if !delayedState.ExecuteAt.After(now) {
+			due = true
+			break
+		}
+	}
+	if !due {
+		return nil
+	}
+
+	// catch up with the log before firing, so tombstones of delayed states cancelled since the last read drop them
+	if err := d.updateHeadFresh(s, now); err != nil {
+		return err
+	}
+
+	commitOffset := s.commitOffset
+	fenced := false
+	for _, delayedState := range s.delayedStates {
 		if delayedState.ExecuteAt.After(now) {
 			continue
 		}
 
+		// the execution is admitted before the commit, so the loop never blocks with the lease renewal waiting behind it;
+		// delayed states left once the engine has too many submitted executions are fired on the next tick, see ConcurrencyLimits.MaxSubmitted
+		if !d.e.limiter.tryAdmit() {
+			break
+		}
+
 		stateCtx := delayedState.State.CopyToCtx(&StateCtx{})
 		commit := stateCtx.Current.Transition.Annotations[DelayCommitAnnotation] != `false`
-		if commit {
-			transitCmd := Transit(stateCtx, stateCtx.Current.Transition.To).
-				WithAnnotations(stateCtx.Current.Transition.Annotations)
 
-			if err := d.e.Do(Commit(transitCmd)); IsErrRevMismatch(err) {
+		if commit {
+			// the commit is fenced by the delayed state revision, a delayer that has lost the lease cannot fire it twice
+			if err := d.e.Do(Commit(Transit(stateCtx, stateCtx.Current.Transition.To).
+				WithAnnotations(stateCtx.Current.Transition.Annotations))); IsErrRevMismatch(err) {
+				d.e.limiter.unadmit()
+
+				// the state has moved on since it was delayed, the delayed state is never fired
+				d.l.Info("delayer: delayed state dropped, state rev mismatch", "shard", s.num, "id", delayedState.State.ID, "rev", delayedState.State.Rev)
+				delete(s.delayedStates, delayedState.Offset)
+				commitOffset = max(commitOffset, delayedState.Offset)
 				continue
 			} else if err != nil {
+				d.e.limiter.unadmit()
 				return fmt.Errorf("commit state ctx: id=%s rev=%d: %w", delayedState.State.ID, delayedState.State.Rev, err)
 			}
+		} else if !fenced {
+			// an uncommitted delayed state is fenced by the shard meta state, it is committed once per tick before the first of them is fired
+			nextMetaStateCtx := s.metaStateCtx.CopyTo(&StateCtx{})
+			if err := d.e.Do(Commit(Park(nextMetaStateCtx))); IsErrRevMismatch(err) {
+				d.e.limiter.unadmit()
+				d.standby(s)
+				return nil
+			} else if err != nil {
+				d.e.limiter.unadmit()
+				return fmt.Errorf("commit meta state: shard=%d: %w", s.num, err)
+			}
+			s.metaStateCtx = nextMetaStateCtx
+			fenced = true
 		}
 
-		delete(d.delayedStates, delayedState.Offset)
+		delete(s.delayedStates, delayedState.Offset)
+		d.fired.inc()
+		d.lateness.observe(now.Sub(delayedState.ExecuteAt).Seconds())
 
-		// TODO: add concurrency control
-		go func() {
-			if err := d.e.Execute(stateCtx); err != nil && !commit {
-				// delayed state is not so we warn about it, if commit recovery would kick in
-				d.l.Warn(fmt.Sprintf("delayed uncommited state execution has failed; id=%s rev=%d: %s", delayedState.State.ID, delayedState.State.Rev, err.Error()))
-			}
-		}()
-
-		if delayedState.ExecuteAt.Before(commitSince) {
-			commitSince = delayedState.ExecuteAt
+		ex := d.e.submitAdmitted(d.ctx, stateCtx)
+		if !commit {
+			go func() {
+				if err := ex.Wait(context.Background()); err != nil {
+					// delayed state is not so we warn about it, if commit recovery would kick in
+					d.l.Warn(fmt.Sprintf("delayed uncommited state execution has failed; id=%s rev=%d: %s", delayedState.State.ID, delayedState.State.Rev, err.Error()))
+				}
+			}()
 		}
+
 		commitOffset = max(commitOffset, delayedState.Offset)
 	}
 
-	d.commitSince, d.commitOffset = commitSince, commitOffset
+	// the since cursor moves up to the delayed log read so far, yet stays before delayed states loaded but not fired,
+	// so a shard resumed from the cursor reads them again instead of reading the delayed log from the beginning
+	commitSince := s.since.Truncate(time.Second)
+	for _, delayedState := range s.delayedStates {
+		if since := delayedState.ExecuteAt.Truncate(time.Second).Add(-time.Second); since.Before(commitSince) {
+			commitSince = since
+		}
+	}
+
+	s.commitSince, s.commitOffset = commitSince, commitOffset
 
 	return nil
 }
@@ -372,9 +957,13 @@ func (d *Delayer) Shutdown(ctx context.Context) error {
 		return fmt.Errorf(`already shutdown`)
 	default:
 		close(d.stopCh)
+		d.cancel()
 
 		select {
 		case <-d.stoppedCh:
+			d.activeGauge.delete(d.holder)
+			d.shardsGauge.delete(d.holder)
+			d.queueDepth.delete(d.holder)
 			return nil
 		case <-ctx.Done():
 			return ctx.Err()
@@ -3,12 +3,15 @@
 package flowstate_test
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"log/slog"
 	"reflect"
+	"regexp"
 	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -234,6 +237,31 @@ func TestDelayer(t *testing.T) {
 			{StateID: `s1`, At: parseTime(`2000-01-01T00:15:00Z`)},
 		},
 	)
+
+	// delayed state cancelled after the delayer has loaded it, shortly before it is due
+	f(
+		[]delayingStateFunc{
+			sleepAndDelay(flowstate.State{ID: `s1`}, time.Minute*11, time.Minute*5),
+			sleepAndDelay(flowstate.State{ID: `s2`}, time.Minute*11, time.Minute*5),
+			sleepAndCancelDelay(flowstate.State{ID: `s1`}, time.Minute*15+time.Second*30, time.Time{}),
+		},
+		[]delayedState{
+			{`s2`, parseTime(`2000-01-01T00:16:00Z`)},
+		},
+	)
+
+	// delayed state rescheduled after the delayer has loaded it, shortly before it is due
+	f(
+		[]delayingStateFunc{
+			sleepAndDelay(flowstate.State{ID: `s1`}, time.Minute*11, time.Minute*5),
+			sleepAndDelay(flowstate.State{ID: `s2`}, time.Minute*11, time.Minute*5),
+			sleepAndCancelDelay(flowstate.State{ID: `s1`}, time.Minute*15+time.Second*30, parseTime(`2000-01-01T00:18:00Z`)),
+		},
+		[]delayedState{
+			{`s1`, parseTime(`2000-01-01T00:18:00Z`)},
+			{`s2`, parseTime(`2000-01-01T00:16:00Z`)},
+		},
+	)
 }
 
 func TestDelayer_Concurrency(t *testing.T) {
@@ -352,6 +380,670 @@ func TestDelayer_Concurrency(t *testing.T) {
 	})
 }
 
+// This test simulates a cluster of two delayers, one active and one standby.
+// The standby delayer takes the lease over once the active one is shut down,
+// the test ensures every delayed state is executed exactly once.
+func TestDelayerActiveStandby(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		lh := slogassert.New(t, slog.LevelDebug, nil)
+		l := slog.New(slogassert.New(t, slog.LevelDebug, lh))
+
+		actMux := &sync.Mutex{}
+		act := make(map[flowstate.StateID]int)
+		d := memdriver.New(l)
+		fr := &flowstate.DefaultFlowRegistry{}
+		mustSetFlow(fr, `delayed`, flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+			actMux.Lock()
+			defer actMux.Unlock()
+			act[stateCtx.Current.ID]++
+
+			return flowstate.Commit(flowstate.Park(stateCtx)), nil
+		}))
+
+		e, err := flowstate.NewEngine(d, fr, l)
+		if err != nil {
+			t.Fatalf("failed to create engine: %v", err)
+		}
+		defer e.Shutdown(context.Background())
+
+		dlr0, err := flowstate.NewDelayer(e, l)
+		if err != nil {
+			t.Fatalf("failed to create delayer 0: %v", err)
+		}
+		dlr1, err := flowstate.NewDelayer(e, l)
+		if err != nil {
+			t.Fatalf("failed to create delayer 1: %v", err)
+		}
+		defer dlr1.Shutdown(context.Background())
+
+		if !dlr0.Active() {
+			t.Fatalf("expected delayer 0 to be active, but it is not")
+		}
+		if dlr1.Active() {
+			t.Fatalf("expected delayer 1 to be standby, but it is active")
+		}
+
+		for i := 0; i < 20; i++ {
+			stateCtx := &flowstate.StateCtx{
+				Current: flowstate.State{
+					ID: flowstate.StateID(`aTID` + strconv.Itoa(i)),
+				},
+			}
+			if err := e.Do(flowstate.Delay(stateCtx, `delayed`, time.Second*30*time.Duration(i+1))); err != nil {
+				t.Fatalf("failed to delay state: %v", err)
+			}
+		}
+
+		time.Sleep(time.Minute * 4)
+
+		// each delayer reports its own gauges
+		activeMetrics := func() []string {
+			buf := &bytes.Buffer{}
+			if err := e.Metrics().Write(buf); err != nil {
+				t.Fatalf("failed to write metrics: %v", err)
+			}
+
+			var values []string
+			for _, line := range strings.Split(buf.String(), "\n") {
+				if strings.HasPrefix(line, `flowstate_delayer_active{delayer=`) {
+					values = append(values, line[strings.LastIndex(line, ` `)+1:])
+				}
+			}
+			sort.Strings(values)
+
+			return values
+		}
+		if act := activeMetrics(); !reflect.DeepEqual([]string{`0`, `1`}, act) {
+			t.Fatalf("expected active and standby delayer gauges, got %v", act)
+		}
+
+		if err := dlr0.Shutdown(context.Background()); err != nil {
+			t.Fatalf("failed to shutdown delayer 0: %v", err)
+		}
+
+		time.Sleep(flowstate.LeaseRenewInterval + time.Second)
+
+		if dlr0.Active() {
+			t.Fatalf("expected delayer 0 to be standby, but it is active")
+		}
+		if !dlr1.Active() {
+			t.Fatalf("expected delayer 1 to be active, but it is not")
+		}
+
+		// the shutdown delayer drops its own gauges only
+		if act := activeMetrics(); !reflect.DeepEqual([]string{`1`}, act) {
+			t.Fatalf("expected one active delayer gauge, got %v", act)
+		}
+
+		time.Sleep(time.Minute * 10)
+		synctest.Wait()
+
+		actMux.Lock()
+		defer actMux.Unlock()
+		if len(act) != 20 {
+			t.Errorf("expected 20 delayed states executed, got %d", len(act))
+		}
+		for id, cnt := range act {
+			if cnt != 1 {
+				t.Errorf("expected delayed state %s executed once, got %d", id, cnt)
+			}
+		}
+	})
+}
+
+// This test simulates a crash of the active delayer and checks the standby delayer takes the lease over once it expires.
+func TestDelayerCrashStandbyBecomeActive(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		lh := slogassert.New(t, slog.LevelDebug, nil)
+		l := slog.New(slogassert.New(t, slog.LevelDebug, lh))
+
+		var delayedCnt atomic.Int64
+		d := memdriver.New(l)
+		fr := &flowstate.DefaultFlowRegistry{}
+		mustSetFlow(fr, `delayed`, flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+			delayedCnt.Add(1)
+			return flowstate.Commit(flowstate.Park(stateCtx)), nil
+		}))
+
+		e, err := flowstate.NewEngine(d, fr, l)
+		if err != nil {
+			t.Fatalf("failed to create engine: %v", err)
+		}
+		defer e.Shutdown(context.Background())
+
+		// simulate a crash of the active delayer
+		// by commit meta state with the lease held by a delayer that does not renew it
+		metaStateCtx := &flowstate.StateCtx{
+			Current: flowstate.State{
+				ID: `flowstate.delayer.meta`,
+				Annotations: map[string]string{
+					`flowstate.delayer.offset`:         `0`,
+					`flowstate.delayer.since`:          time.Unix(0, 0).UTC().Format(time.RFC3339),
+					flowstate.LeaseHolderAnnotation:    `crashed`,
+					flowstate.LeaseExpiresAtAnnotation: time.Now().Add(flowstate.LeaseDuration).UTC().Format(time.RFC3339),
+				},
+			},
+		}
+		if err := e.Do(flowstate.Commit(flowstate.Park(metaStateCtx))); err != nil {
+			t.Fatalf("failed to commit meta state: %v", err)
+		}
+
+		dlr, err := flowstate.NewDelayer(e, l)
+		if err != nil {
+			t.Fatalf("failed to create delayer: %v", err)
+		}
+		defer dlr.Shutdown(context.Background())
+
+		if dlr.Active() {
+			t.Fatalf("expected delayer to be standby, but it is active")
+		}
+
+		stateCtx := &flowstate.StateCtx{
+			Current: flowstate.State{
+				ID: `aTID`,
+			},
+		}
+		if err := e.Do(flowstate.Delay(stateCtx, `delayed`, time.Second*5)); err != nil {
+			t.Fatalf("failed to delay state: %v", err)
+		}
+
+		time.Sleep(time.Second * 10)
+		synctest.Wait()
+		if delayedCnt.Load() != 0 {
+			t.Fatalf("expected delayed state not executed while the lease is held, got %d", delayedCnt.Load())
+		}
+
+		time.Sleep(flowstate.LeaseDuration + flowstate.LeaseRenewInterval)
+		synctest.Wait()
+
+		if !dlr.Active() {
+			t.Fatalf("expected delayer to be active, but it is not")
+		}
+
+		time.Sleep(time.Minute)
+		synctest.Wait()
+
+		if delayedCnt.Load() != 1 {
+			t.Fatalf("expected delayed state executed once, got %d", delayedCnt.Load())
+		}
+	})
+}
+
+// This test checks a delayer which has lost the lease, for example after a long pause, does not execute delayed states.
+func TestDelayerLeaseLostFencing(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		lh := slogassert.New(t, slog.LevelDebug, nil)
+		l := slog.New(slogassert.New(t, slog.LevelDebug, lh))
+
+		var delayedCnt atomic.Int64
+		d := memdriver.New(l)
+		fr := &flowstate.DefaultFlowRegistry{}
+		mustSetFlow(fr, `delayed`, flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+			delayedCnt.Add(1)
+			return flowstate.Commit(flowstate.Park(stateCtx)), nil
+		}))
+
+		e, err := flowstate.NewEngine(d, fr, l)
+		if err != nil {
+			t.Fatalf("failed to create engine: %v", err)
+		}
+		defer e.Shutdown(context.Background())
+
+		dlr, err := flowstate.NewDelayer(e, l)
+		if err != nil {
+			t.Fatalf("failed to create delayer: %v", err)
+		}
+		defer dlr.Shutdown(context.Background())
+
+		if !dlr.Active() {
+			t.Fatalf("expected delayer to be active, but it is not")
+		}
+
+		stateCtx := &flowstate.StateCtx{
+			Current: flowstate.State{
+				ID: `aTID`,
+			},
+		}
+		// commit with delay without commit is not fenced by the state revision
+		if err := e.Do(flowstate.Delay(stateCtx, `delayed`, time.Second*5).WithCommit(false)); err != nil {
+			t.Fatalf("failed to delay state: %v", err)
+		}
+
+		time.Sleep(time.Second * 2)
+		synctest.Wait()
+
+		// another delayer takes the lease over behind the back of the paused one
+		metaStateCtx := &flowstate.StateCtx{}
+		if err := e.Do(flowstate.GetStateByID(metaStateCtx, `flowstate.delayer.meta`, 0)); err != nil {
+			t.Fatalf("failed to get meta state: %v", err)
+		}
+		metaStateCtx.Current.SetAnnotation(flowstate.LeaseHolderAnnotation, `another`)
+		metaStateCtx.Current.SetAnnotation(flowstate.LeaseExpiresAtAnnotation, time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+		if err := e.Do(flowstate.Commit(flowstate.Park(metaStateCtx))); err != nil {
+			t.Fatalf("failed to commit meta state: %v", err)
+		}
+
+		time.Sleep(time.Minute)
+		synctest.Wait()
+
+		if dlr.Active() {
+			t.Fatalf("expected delayer to be standby, but it is active")
+		}
+		if delayedCnt.Load() != 0 {
+			t.Fatalf("expected delayed state not executed, got %d", delayedCnt.Load())
+		}
+	})
+}
+
+// This test ensures a delayed state is dropped once the state has moved on since it was delayed,
+// it is not fired and not retried on later ticks, while a delay made after the newer commit and an uncommitted delay are fired.
+func TestDelayerDropsMovedOnState(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		lh := slogassert.New(t, slog.LevelDebug, nil)
+		l := slog.New(slogassert.New(t, slog.LevelDebug, lh))
+
+		actMux := &sync.Mutex{}
+		var act []string
+		d := memdriver.New(l)
+		fr := &flowstate.DefaultFlowRegistry{}
+		mustSetFlow(fr, `delayed`, flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+			actMux.Lock()
+			defer actMux.Unlock()
+			act = append(act, string(stateCtx.Current.ID))
+
+			return flowstate.Noop(), nil
+		}))
+
+		e, err := flowstate.NewEngine(d, fr, l)
+		if err != nil {
+			t.Fatalf("failed to create engine: %v", err)
+		}
+		defer e.Shutdown(context.Background())
+
+		// delayed at rev 1, committed at rev 2 after the delay
+		stateCtx := &flowstate.StateCtx{
+			Current: flowstate.State{
+				ID: `aTID`,
+			},
+		}
+		if err := e.Do(flowstate.Commit(flowstate.Park(stateCtx))); err != nil {
+			t.Fatalf("failed to commit state: %v", err)
+		}
+		if err := e.Do(flowstate.Delay(stateCtx, `delayed`, time.Minute)); err != nil {
+			t.Fatalf("failed to delay state: %v", err)
+		}
+		if err := e.Do(flowstate.Commit(flowstate.Park(stateCtx))); err != nil {
+			t.Fatalf("failed to commit state: %v", err)
+		}
+
+		// an uncommitted delay is not fenced by the state revision
+		uncommittedStateCtx := &flowstate.StateCtx{
+			Current: flowstate.State{
+				ID: `anotherTID`,
+			},
+		}
+		if err := e.Do(flowstate.Commit(flowstate.Park(uncommittedStateCtx))); err != nil {
+			t.Fatalf("failed to commit state: %v", err)
+		}
+		if err := e.Do(flowstate.Delay(uncommittedStateCtx, `delayed`, time.Minute).WithCommit(false)); err != nil {
+			t.Fatalf("failed to delay state: %v", err)
+		}
+		if err := e.Do(flowstate.Commit(flowstate.Park(uncommittedStateCtx))); err != nil {
+			t.Fatalf("failed to commit state: %v", err)
+		}
+
+		dlr, err := flowstate.NewDelayer(e, l)
+		if err != nil {
+			t.Fatalf("failed to create delayer: %v", err)
+		}
+		defer dlr.Shutdown(context.Background())
+
+		time.Sleep(time.Minute * 2)
+		synctest.Wait()
+
+		actMux.Lock()
+		if !reflect.DeepEqual([]string{`anotherTID`}, act) {
+			t.Fatalf("expected only the uncommitted delayed state executed, got %v", act)
+		}
+		actMux.Unlock()
+
+		buf := &bytes.Buffer{}
+		if err := e.Metrics().Write(buf); err != nil {
+			t.Fatalf("failed to write metrics: %v", err)
+		}
+		// the fire commit conflicted once, the delayed state is not retried on later ticks
+		for _, expMetric := range []string{`flowstate_delayer_queue_depth\{delayer="[0-9a-f]+"\} 0`, `flowstate_engine_commits_total\{result="conflict"\} 1`} {
+			if !regexp.MustCompile(expMetric).MatchString(buf.String()) {
+				t.Errorf("expected metric %s, got %s", expMetric, buf.String())
+			}
+		}
+
+		// a delay made after the newer commit holds the newer revision and is fired
+		if err := e.Do(flowstate.Delay(stateCtx, `delayed`, time.Minute)); err != nil {
+			t.Fatalf("failed to delay state: %v", err)
+		}
+
+		time.Sleep(time.Minute * 2)
+		synctest.Wait()
+
+		actMux.Lock()
+		defer actMux.Unlock()
+		if !reflect.DeepEqual([]string{`anotherTID`, `aTID`}, act) {
+			t.Fatalf("expected the delay made after the commit executed, got %v", act)
+		}
+	})
+}
+
+// This test ensures shards of a delayer created with a different number of shards resume from the cursor of the previous shards,
+// uncommitted delayed states already executed are not executed again.
+func TestDelayerShardsChanged(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		lh := slogassert.New(t, slog.LevelDebug, nil)
+		l := slog.New(slogassert.New(t, slog.LevelDebug, lh))
+
+		actMux := &sync.Mutex{}
+		act := make(map[flowstate.StateID]int)
+		d := memdriver.New(l)
+		fr := &flowstate.DefaultFlowRegistry{}
+		mustSetFlow(fr, `delayed`, flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+			actMux.Lock()
+			defer actMux.Unlock()
+			act[stateCtx.Current.ID]++
+
+			return flowstate.Commit(flowstate.Park(stateCtx)), nil
+		}))
+
+		e, err := flowstate.NewEngine(d, fr, l)
+		if err != nil {
+			t.Fatalf("failed to create engine: %v", err)
+		}
+		defer e.Shutdown(context.Background())
+
+		delayStates := func(from, to int) {
+			t.Helper()
+
+			for i := from; i < to; i++ {
+				stateCtx := &flowstate.StateCtx{
+					Current: flowstate.State{
+						ID: flowstate.StateID(`aTID` + strconv.Itoa(i)),
+					},
+				}
+				if err := e.Do(flowstate.Delay(stateCtx, `delayed`, time.Minute).WithCommit(false)); err != nil {
+					t.Fatalf("failed to delay state: %v", err)
+				}
+			}
+		}
+
+		assertExecutedOnce := func(expCnt int) {
+			t.Helper()
+
+			actMux.Lock()
+			defer actMux.Unlock()
+			if len(act) != expCnt {
+				t.Fatalf("expected %d delayed states executed, got %d", expCnt, len(act))
+			}
+			for id, cnt := range act {
+				if cnt != 1 {
+					t.Fatalf("expected delayed state %s executed once, got %d", id, cnt)
+				}
+			}
+		}
+
+		dlr0, err := flowstate.NewDelayer(e, l)
+		if err != nil {
+			t.Fatalf("failed to create delayer 0: %v", err)
+		}
+
+		delayStates(0, 10)
+		time.Sleep(time.Minute * 2)
+		synctest.Wait()
+		assertExecutedOnce(10)
+
+		if err := dlr0.Shutdown(context.Background()); err != nil {
+			t.Fatalf("failed to shutdown delayer 0: %v", err)
+		}
+
+		dlr1, err := flowstate.NewShardedDelayer(e, 4, l)
+		if err != nil {
+			t.Fatalf("failed to create delayer 1: %v", err)
+		}
+		defer dlr1.Shutdown(context.Background())
+
+		delayStates(10, 20)
+		time.Sleep(time.Minute * 2)
+		synctest.Wait()
+		assertExecutedOnce(20)
+	})
+}
+
+// This test ensures the delayer keeps renewing its lease while the engine has too many submitted executions,
+// delayed states which could not be submitted are fired on later ticks.
+func TestDelayerSubmitLimited(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		lh := slogassert.New(t, slog.LevelDebug, nil)
+		l := slog.New(slogassert.New(t, slog.LevelDebug, lh))
+
+		actMux := &sync.Mutex{}
+		var act []delayedState
+		d := memdriver.New(l)
+		fr := &flowstate.DefaultFlowRegistry{}
+		mustSetFlow(fr, `slow`, flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+			actMux.Lock()
+			act = append(act, delayedState{
+				StateID: stateCtx.Current.ID,
+				At:      time.Now().UTC().Truncate(time.Minute),
+			})
+			actMux.Unlock()
+
+			time.Sleep(time.Minute * 5)
+
+			return flowstate.Commit(flowstate.Park(stateCtx)), nil
+		}))
+
+		e, err := flowstate.NewEngine(d, fr, l)
+		if err != nil {
+			t.Fatalf("failed to create engine: %v", err)
+		}
+		defer e.Shutdown(context.Background())
+		e.SetConcurrencyLimits(flowstate.ConcurrencyLimits{MaxSubmitted: 1})
+
+		for _, id := range []flowstate.StateID{`s1`, `s2`, `s3`} {
+			stateCtx := &flowstate.StateCtx{
+				Current: flowstate.State{
+					ID: id,
+				},
+			}
+			if err := e.Do(flowstate.Delay(stateCtx, `slow`, time.Minute)); err != nil {
+				t.Fatalf("failed to delay state: %v", err)
+			}
+		}
+
+		dlr, err := flowstate.NewDelayer(e, l)
+		if err != nil {
+			t.Fatalf("failed to create delayer: %v", err)
+		}
+		defer dlr.Shutdown(context.Background())
+
+		time.Sleep(time.Minute * 3)
+		synctest.Wait()
+
+		if !dlr.Active() {
+			t.Fatalf("expected delayer to be active, but it is not")
+		}
+		metaStateCtx := &flowstate.StateCtx{}
+		if err := e.Do(flowstate.GetStateByID(metaStateCtx, `flowstate.delayer.meta`, 0)); err != nil {
+			t.Fatalf("failed to get meta state: %v", err)
+		}
+		expiresAt, err := time.Parse(time.RFC3339, metaStateCtx.Current.Annotations[flowstate.LeaseExpiresAtAnnotation])
+		if err != nil {
+			t.Fatalf("failed to parse lease expires at: %v", err)
+		}
+		if !expiresAt.After(time.Now()) {
+			t.Fatalf("expected lease renewed while submit is limited, it expired at %s", expiresAt)
+		}
+
+		time.Sleep(time.Minute * 15)
+		synctest.Wait()
+
+		// delayed states due at the same time are fired in no particular order, one after another finishes
+		expAts := []time.Time{
+			parseTime(`2000-01-01T00:01:00Z`),
+			parseTime(`2000-01-01T00:06:00Z`),
+			parseTime(`2000-01-01T00:11:00Z`),
+		}
+		actMux.Lock()
+		defer actMux.Unlock()
+		actIDs := make(map[flowstate.StateID]struct{})
+		actAts := make([]time.Time, 0, len(act))
+		for _, ds := range act {
+			actIDs[ds.StateID] = struct{}{}
+			actAts = append(actAts, ds.At)
+		}
+		if len(actIDs) != 3 || !reflect.DeepEqual(expAts, actAts) {
+			t.Fatalf("expected delayed states fired at %v, got %v", expAts, act)
+		}
+	})
+}
+
+// This test runs sharded delayers joining and leaving the cluster,
+// it ensures shards are spread evenly and every delayed state is executed exactly once.
+func TestShardedDelayer(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		lh := slogassert.New(t, slog.LevelDebug, nil)
+		l := slog.New(slogassert.New(t, slog.LevelDebug, lh))
+
+		actMux := &sync.Mutex{}
+		act := make(map[flowstate.StateID]int)
+		d := memdriver.New(l)
+		fr := &flowstate.DefaultFlowRegistry{}
+		mustSetFlow(fr, `delayed`, flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+			actMux.Lock()
+			defer actMux.Unlock()
+			act[stateCtx.Current.ID]++
+
+			return flowstate.Commit(flowstate.Park(stateCtx)), nil
+		}))
+
+		e, err := flowstate.NewEngine(d, fr, l)
+		if err != nil {
+			t.Fatalf("failed to create engine: %v", err)
+		}
+		defer e.Shutdown(context.Background())
+
+		assertShards := func(expShards []int, dlrs ...*flowstate.Delayer) {
+			t.Helper()
+
+			actShards := make([]int, 0)
+			held := make(map[int]bool)
+			for _, dlr := range dlrs {
+				shards := dlr.Shards()
+				actShards = append(actShards, len(shards))
+				for _, shard := range shards {
+					if held[shard] {
+						t.Fatalf("expected shard %d held by one delayer", shard)
+					}
+					held[shard] = true
+				}
+			}
+			sort.Ints(actShards)
+			if !reflect.DeepEqual(expShards, actShards) {
+				t.Fatalf("expected shards per delayer %v, got %v", expShards, actShards)
+			}
+		}
+
+		go func() {
+			for i := 0; i < 100; i++ {
+				stateCtx := &flowstate.StateCtx{
+					Current: flowstate.State{
+						ID: flowstate.StateID(`aTID` + strconv.Itoa(i)),
+					},
+				}
+				if err := e.Do(flowstate.Delay(stateCtx, `delayed`, time.Minute)); err != nil {
+					t.Errorf("failed to delay state: %v", err)
+				}
+
+				time.Sleep(time.Second * 6)
+			}
+		}()
+
+		dlr0, err := flowstate.NewShardedDelayer(e, 8, l)
+		if err != nil {
+			t.Fatalf("failed to create delayer 0: %v", err)
+		}
+		assertShards([]int{8}, dlr0)
+
+		time.Sleep(time.Minute)
+
+		dlr1, err := flowstate.NewShardedDelayer(e, 8, l)
+		if err != nil {
+			t.Fatalf("failed to create delayer 1: %v", err)
+		}
+		defer dlr1.Shutdown(context.Background())
+
+		time.Sleep(time.Minute)
+		assertShards([]int{4, 4}, dlr0, dlr1)
+
+		dlr2, err := flowstate.NewShardedDelayer(e, 8, l)
+		if err != nil {
+			t.Fatalf("failed to create delayer 2: %v", err)
+		}
+		defer dlr2.Shutdown(context.Background())
+
+		time.Sleep(time.Minute)
+		assertShards([]int{2, 3, 3}, dlr0, dlr1, dlr2)
+
+		if err := dlr0.Shutdown(context.Background()); err != nil {
+			t.Fatalf("failed to shutdown delayer 0: %v", err)
+		}
+
+		time.Sleep(time.Minute)
+		assertShards([]int{0, 4, 4}, dlr0, dlr1, dlr2)
+
+		// a new delayer reuses the member state released by the shut down one
+		dlr3, err := flowstate.NewShardedDelayer(e, 8, l)
+		if err != nil {
+			t.Fatalf("failed to create delayer 3: %v", err)
+		}
+		defer dlr3.Shutdown(context.Background())
+
+		time.Sleep(time.Minute)
+		assertShards([]int{2, 3, 3}, dlr1, dlr2, dlr3)
+
+		membersCmd := flowstate.GetStatesByLabels(map[string]string{
+			flowstate.DelayerMemberLabel: `true`,
+		}).WithLatestOnly()
+		if err := e.Do(membersCmd); err != nil {
+			t.Fatalf("failed to get member states: %v", err)
+		}
+		actMemberIDs := make(map[flowstate.StateID]bool)
+		for _, state := range membersCmd.MustResult().States {
+			actMemberIDs[state.ID] = true
+		}
+		expMemberIDs := map[flowstate.StateID]bool{
+			`flowstate.delayer.member.0`: true,
+			`flowstate.delayer.member.1`: true,
+			`flowstate.delayer.member.2`: true,
+		}
+		if !reflect.DeepEqual(expMemberIDs, actMemberIDs) {
+			t.Fatalf("expected member states %v, got %v", expMemberIDs, actMemberIDs)
+		}
+
+		time.Sleep(time.Minute * 10)
+		synctest.Wait()
+
+		actMux.Lock()
+		defer actMux.Unlock()
+		if len(act) != 100 {
+			t.Errorf("expected 100 delayed states executed, got %d", len(act))
+		}
+		for id, cnt := range act {
+			if cnt != 1 {
+				t.Errorf("expected delayed state %s executed once, got %d", id, cnt)
+			}
+		}
+	})
+}
+
 func parseTime(s string) time.Time {
 	t, err := time.Parse(time.RFC3339, s)
 	if err != nil {
@@ -374,6 +1066,18 @@ func sleepAndDelay(state flowstate.State, sleepDur, dur time.Duration) delayingS
 	}
 }
 
+func sleepAndCancelDelay(state flowstate.State, sleepDur time.Duration, rescheduleAt time.Time) delayingStateFunc {
+	return func(t *testing.T, e *flowstate.Engine) {
+		stateCtx := state.CopyToCtx(&flowstate.StateCtx{})
+
+		time.Sleep(sleepDur)
+
+		if err := e.Do(flowstate.CancelDelay(stateCtx).WithRescheduleAt(rescheduleAt)); err != nil {
+			t.Fatalf("failed to cancel delay: %v", err)
+		}
+	}
+}
+
 type delayedState struct {
 	StateID flowstate.StateID
 	At      time.Time
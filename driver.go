@@ -13,6 +13,7 @@ type Driver interface {
 	GetStates(cmd *GetStatesCommand) error
 	GetDelayedStates(cmd *GetDelayedStatesCommand) error
 	Delay(cmd *DelayCommand) error
+	CancelDelay(cmd *CancelDelayCommand) error
 	Commit(cmd *CommitCommand) error
 	GetData(cmd *GetDataCommand) error
 	StoreData(cmd *StoreDataCommand) error
@@ -60,8 +61,15 @@ func DoCommitSubCommand(d Driver, cmd0 Command) error {
 			return err
 		}
 		return d.Delay(cmd)
+	case *CancelDelayCommand:
+		if err := cmd.Prepare(); err != nil {
+			return err
+		}
+		return d.CancelDelay(cmd)
 	case *ExecuteCommand:
 		return fmt.Errorf("execute command not allowed inside commit")
+	case engineCommand:
+		return fmt.Errorf("command %T not allowed inside commit", cmd0)
 	case *CommitCommand:
 		return fmt.Errorf("commit command not allowed inside another commit")
 	case *GetStatesCommand:
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -20,6 +21,29 @@ type Engine struct {
 
 	wg     *sync.WaitGroup
 	doneCh chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	interceptorsMux     sync.RWMutex
+	flowInterceptors    []FlowInterceptor
+	commandInterceptors []CommandInterceptor
+
+	conflictPoliciesMux sync.RWMutex
+	conflictPolicies    map[FlowID]ConflictPolicy
+
+	retryPoliciesMux sync.RWMutex
+	retryPolicies    map[FlowID]RetryPolicy
+
+	m                 *Metrics
+	executions        *metricVec
+	executionDuration *metricVec
+	commits           *metricVec
+	commitDuration    *metricVec
+	conflicts         *metricVec
+
+	limiter *concurrencyLimiter
+
+	tracer atomic.Pointer[tracer]
 }
 
 func NewEngine(d Driver, fr FlowRegistry, l *slog.Logger) (*Engine, error) {
@@ -31,6 +55,16 @@ func NewEngine(d Driver, fr FlowRegistry, l *slog.Logger) (*Engine, error) {
 		wg:     &sync.WaitGroup{},
 		doneCh: make(chan struct{}),
 	}
+	e.ctx, e.cancel = context.WithCancel(context.Background())
+
+	e.m = newMetrics()
+	e.executions = e.m.counter(`flowstate_engine_executions_total`, `Number of flow executions.`, `flow`, `result`)
+	e.executionDuration = e.m.histogram(`flowstate_engine_execution_duration_seconds`, `Duration of flow executions.`, DefaultDurationBuckets, `flow`)
+	e.commits = e.m.counter(`flowstate_engine_commits_total`, `Number of commits; result is one of ok, conflict or error.`, `result`)
+	e.commitDuration = e.m.histogram(`flowstate_engine_commit_duration_seconds`, `Duration of commits.`, DefaultDurationBuckets)
+	e.conflicts = e.m.counter(`flowstate_engine_execution_conflicts_total`, `Number of execution conflicts; action is one of dropped, retried, transited or exhausted.`, `flow`, `action`)
+	e.d.instrument(e.m)
+	e.limiter = newConcurrencyLimiter(e.m)
 
 	if err := d.Init(e); err != nil {
 		return nil, fmt.Errorf("driver: init: %w", err)
@@ -48,6 +82,14 @@ func NewEngine(d Driver, fr FlowRegistry, l *slog.Logger) (*Engine, error) {
 }
 
 func (e *Engine) Execute(stateCtx *StateCtx) error {
+	return e.ExecuteContext(context.Background(), stateCtx)
+}
+
+// ExecuteContext executes the state until it is parked, delayed or handed over to another execution.
+// The ctx is exposed to flows through StateCtx together with state and transition deadlines.
+// Once the state or the transition deadline is exceeded the engine commits a timeout transition, see SetDeadlineFlow.
+// Once the ctx is done the execution is aborted and the ctx error is returned, the flow command is not committed.
+func (e *Engine) ExecuteContext(ctx context.Context, stateCtx *StateCtx) (err error) {
 	select {
 	case <-e.doneCh:
 		return fmt.Errorf("engine stopped")
@@ -58,52 +100,87 @@ func (e *Engine) Execute(stateCtx *StateCtx) error {
 
 	sessID := sessIDS.Add(1)
 	stateCtx.sessID = sessID
-	stateCtx.e = e
-	stateCtx.doneCh = e.doneCh
+	stateCtx.conflicts = 0
+	callerStateCtx := stateCtx
 
 	if stateCtx.Current.ID == `` {
 		return fmt.Errorf(`state id empty`)
 	}
 
+	sessSpan := e.tracer.Load().startSession(ctx, stateCtx)
+	defer func() {
+		sessSpan.end(err)
+	}()
+
+	execCtx, execCancel := context.WithCancel(contextWithSpan(ctx, sessSpan))
+	defer execCancel()
+	stopExecCancel := context.AfterFunc(e.ctx, execCancel)
+	defer stopExecCancel()
+
+	var retries int
 	for {
 		select {
 		case <-e.doneCh:
 			return nil
 		default:
 		}
+		if err := execCtx.Err(); err != nil {
+			return err
+		}
 
 		if stateCtx.Current.Transition.To == `` {
 			return fmt.Errorf(`transition to id empty`)
 		}
 
-		f, err := e.fr.Flow(stateCtx.Current.Transition.To)
+		release, err := e.limiter.acquire(execCtx, stateCtx.Current)
 		if err != nil {
 			return err
 		}
 
-		logExecute(stateCtx, e.l)
-		cmd0, err := f.Execute(stateCtx, e)
+		flowID := stateCtx.Current.Transition.To
+		cmd0, err := e.executeStep(execCtx, stateCtx)
 		if err != nil {
+			release()
 			return err
 		}
 
-		if cmd, ok := cmd0.(*ExecuteCommand); ok {
+		if retCmd := autoReturn(cmd0); retCmd != nil {
+			cmd0 = retCmd
+		}
+
+		switch cmd := cmd0.(type) {
+		case *ExecuteCommand:
 			cmd.sync = true
+		case engineCommand:
+			cmd.setSync()
 		}
 
 		conflictErr := &ErrRevMismatch{}
 
-		if err = e.doCmd(cmd0); errors.As(err, conflictErr) {
+		err = e.doCmd(cmd0)
+		release()
+
+		if errors.As(err, conflictErr) {
 			e.l.Info("engine: do conflict",
 				"sess", cmdsSessID(cmd0),
 				"conflict", err.Error(),
 				"id", stateCtx.Current.ID,
 				"rev", stateCtx.Current.Rev,
 			)
-			return nil
+
+			retries++
+			stateCtx.conflicts++
+			if stateCtx != callerStateCtx {
+				callerStateCtx.conflicts++
+			}
+			if resolved, err := e.resolveConflict(execCtx, stateCtx, flowID, retries, err); err != nil || !resolved {
+				return err
+			}
+			continue
 		} else if err != nil {
 			return err
 		}
+		retries = 0
 
 		if nextStateCtx, err := e.continueExecution(cmd0); err != nil {
 			return err
@@ -116,6 +193,77 @@ func (e *Engine) Execute(stateCtx *StateCtx) error {
 	}
 }
 
+func (e *Engine) executeStep(execCtx context.Context, stateCtx *StateCtx) (_ Command, err error) {
+	stepSpan := e.tracer.Load().startChild(execCtx, `flow.execute`)
+	stepSpan.setAttr(`flow`, string(stateCtx.Current.Transition.To))
+	stepSpan.setAttr(`rev`, strconv.FormatInt(stateCtx.Current.Rev, 10))
+	stepSpan.inject(stateCtx)
+	defer func() {
+		stepSpan.end(err)
+	}()
+
+	stepCtx, stepCancel := stepContext(contextWithSpan(execCtx, stepSpan), stateCtx.Current)
+	defer stepCancel()
+
+	// the step context ends with the step, the state keeps its values but must not report the step cancellation.
+	stateCtx.ctx = stepCtx
+	defer func() {
+		stateCtx.ctx = context.WithoutCancel(stepCtx)
+	}()
+
+	if stateDeadlineExceeded(stepCtx) {
+		logExecute(stateCtx, e.l)
+		return deadlineExceededCommand(stateCtx, stepCtx), nil
+	} else if err := stepCtx.Err(); err != nil {
+		return nil, err
+	}
+
+	f, err := e.flow(stateCtx.Current.Transition)
+	if err != nil {
+		return nil, err
+	}
+
+	logExecute(stateCtx, e.l)
+	flowID := string(stateCtx.Current.Transition.To)
+	startedAt := time.Now()
+	cmd0, err := e.executeFlowRecover(f, stateCtx)
+	e.executionDuration.observe(time.Since(startedAt).Seconds(), flowID)
+	if err != nil {
+		e.executions.inc(flowID, `error`)
+	} else {
+		e.executions.inc(flowID, `ok`)
+	}
+	if stateDeadlineExceeded(stepCtx) {
+		e.l.Info("engine: deadline exceeded",
+			"sess", stateCtx.sessID,
+			"id", stateCtx.Current.ID,
+			"rev", stateCtx.Current.Rev,
+			"cause", context.Cause(stepCtx).Error(),
+		)
+		return deadlineExceededCommand(stateCtx, stepCtx), nil
+	} else if ctxErr := stepCtx.Err(); ctxErr != nil {
+		// the caller cancelled the execution or the engine is shutting down, nothing is committed.
+		e.l.Info("engine: execution aborted",
+			"sess", stateCtx.sessID,
+			"id", stateCtx.Current.ID,
+			"rev", stateCtx.Current.Rev,
+			"cause", context.Cause(stepCtx).Error(),
+		)
+		return nil, ctxErr
+	} else if err != nil {
+		e.commitFailure(stateCtx, FlowID(flowID), err)
+		return nil, err
+	}
+
+	return cmd0, nil
+}
+
+// Metrics returns the engine metrics registry.
+// It is an http.Handler that serves metrics in the Prometheus text format.
+func (e *Engine) Metrics() *Metrics {
+	return e.m
+}
+
 func (e *Engine) Iter(cmd *GetStatesCommand) *Iter {
 	return NewIter(e.d, cmd)
 }
@@ -144,6 +292,7 @@ func (e *Engine) Shutdown(ctx context.Context) error {
 		return nil
 	default:
 		close(e.doneCh)
+		e.cancel()
 	}
 
 	waitCh := make(chan struct{})
@@ -166,6 +315,27 @@ func (e *Engine) Shutdown(ctx context.Context) error {
 }
 
 func (e *Engine) doCmd(cmd0 Command) error {
+	e.interceptorsMux.RLock()
+	interceptors := e.commandInterceptors
+	e.interceptorsMux.RUnlock()
+
+	dispatch := e.dispatchCmd
+	if t := e.tracer.Load(); t != nil {
+		dispatch = t.traceDispatch(dispatch)
+	}
+
+	if len(interceptors) == 0 {
+		return dispatch(cmd0)
+	}
+
+	return chainCommandInterceptors(interceptors, dispatch)(cmd0)
+}
+
+func (e *Engine) dispatchCmd(cmd0 Command) error {
+	e.pinFlowVersions(cmd0)
+	if err := e.checkStateMachines(cmd0); err != nil {
+		return err
+	}
 	logCommand("engine: do", cmdsSessID(cmd0), cmd0, e.l)
 
 	switch cmd := cmd0.(type) {
@@ -202,23 +372,10 @@ func (e *Engine) doCmd(cmd0 Command) error {
 			return nil
 		}
 
-		stateCtx := cmd.StateCtx.CopyTo(&StateCtx{})
-		for n, d := range cmd.StateCtx.Datas {
-			stateCtx.SetData(n, d.CopyTo(&Data{}))
-		}
-
-		go func() {
-			if err := e.Execute(stateCtx); err != nil {
-				e.l.Error("execute failed",
-					"sess", stateCtx.sessID,
-					"error", err,
-					"id", stateCtx.Current.ID,
-					"rev", stateCtx.Current.Rev,
-				)
-			}
-		}()
-
+		e.goExecute(cmd.StateCtx)
 		return nil
+	case engineCommand:
+		return cmd.do(e)
 	case *GetStateByIDCommand:
 		if err := cmd.Prepare(); err != nil {
 			return err
@@ -242,6 +399,11 @@ func (e *Engine) doCmd(cmd0 Command) error {
 			return err
 		}
 		return e.d.Delay(cmd)
+	case *CancelDelayCommand:
+		if err := cmd.Prepare(); err != nil {
+			return err
+		}
+		return e.d.CancelDelay(cmd)
 	case *GetDelayedStatesCommand:
 		cmd.Prepare()
 
@@ -265,6 +427,9 @@ func (e *Engine) doCmd(cmd0 Command) error {
 			if _, ok := subCmd.(*ExecuteCommand); ok {
 				return fmt.Errorf("execute command not allowed inside commit")
 			}
+			if _, ok := subCmd.(engineCommand); ok {
+				return fmt.Errorf("command %T not allowed inside commit", subCmd)
+			}
 			if _, ok := subCmd.(*GetDelayedStatesCommand); ok {
 				return fmt.Errorf("get delayed states command not allowed inside commit")
 			}
@@ -273,12 +438,47 @@ func (e *Engine) doCmd(cmd0 Command) error {
 			}
 		}
 
-		return e.d.Commit(cmd)
+		startedAt := time.Now()
+		err := e.d.Commit(cmd)
+		e.commitDuration.observe(time.Since(startedAt).Seconds())
+		switch {
+		case err == nil:
+			e.commits.inc(`ok`)
+		case IsErrRevMismatch(err):
+			e.commits.inc(`conflict`)
+		default:
+			e.commits.inc(`error`)
+		}
+
+		return err
 	default:
 		return fmt.Errorf("command %T not supported", cmd0)
 	}
 }
 
+func (e *Engine) goExecute(src *StateCtx) {
+	stateCtx := src.CopyTo(&StateCtx{})
+	for n, d := range src.Datas {
+		stateCtx.SetData(n, d.CopyTo(&Data{}))
+	}
+
+	ctx := context.Background()
+	if src.ctx != nil {
+		ctx = context.WithoutCancel(src.ctx)
+	}
+
+	go func() {
+		if err := e.ExecuteContext(ctx, stateCtx); err != nil {
+			e.l.Error("execute failed",
+				"sess", stateCtx.sessID,
+				"error", err,
+				"id", stateCtx.Current.ID,
+				"rev", stateCtx.Current.Rev,
+			)
+		}
+	}()
+}
+
 func (e *Engine) continueExecution(cmd0 Command) (*StateCtx, error) {
 	switch cmd := cmd0.(type) {
 	case *CommitCommand:
@@ -289,10 +489,14 @@ func (e *Engine) continueExecution(cmd0 Command) (*StateCtx, error) {
 		return e.continueExecution(cmd.Commands[0])
 	case *ExecuteCommand:
 		return cmd.StateCtx, nil
+	case engineCommand:
+		return cmd.next(), nil
 	case *TransitCommand:
 		return cmd.StateCtx, nil
 	case *DelayCommand:
 		return nil, nil
+	case *CancelDelayCommand:
+		return nil, nil
 	case *ParkCommand:
 		return nil, nil
 	case *NoopCommand:
@@ -317,6 +521,10 @@ func cmdsSessID(cmds ...Command) int64 {
 			if cmd.StateCtx.sessID != 0 {
 				return cmd.StateCtx.sessID
 			}
+		case *CancelDelayCommand:
+			if cmd.StateCtx.sessID != 0 {
+				return cmd.StateCtx.sessID
+			}
 		case *NoopCommand:
 			continue
 		case *StackCommand:
@@ -351,6 +559,10 @@ func cmdsSessID(cmds ...Command) int64 {
 			if cmd.StateCtx.sessID != 0 {
 				return cmd.StateCtx.sessID
 			}
+		case engineCommand:
+			if sid := cmd.sessID(); sid != 0 {
+				return sid
+			}
 		default:
 			panic(fmt.Sprintf("BUG: unknown command type %T", cmd0))
 		}
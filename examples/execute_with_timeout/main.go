@@ -11,47 +11,54 @@ import (
 )
 
 func main() {
-	slog.Default().Info("Example of delayed execute")
+	slog.Default().Info("Example of execute with timeout")
 
 	e, fr, _, tearDown := examples.SetUp()
 	defer tearDown()
 
 	err := fr.SetFlow(`example`, flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, _ *flowstate.Engine) (flowstate.Command, error) {
-		// The condition succeeds if the main execution timed out.
-		// The delayed task wont be executed if the state was completed before the timeout.
-		if flowstate.Delayed(stateCtx.Current) {
-			slog.Default().Info(fmt.Sprintf("executing timeout logic: %s", stateCtx.Current.ID))
-
-			// Put your timeout handling logic here
-			return flowstate.Commit(flowstate.Park(stateCtx)), nil
-		}
-
 		slog.Default().Info(fmt.Sprintf("executing business logic: %s", stateCtx.Current.ID))
 
 		// Put your business logic here
 		// Simulate timeout from time to time
-		time.Sleep(time.Second * time.Duration(8+rand.Intn(6)))
+		select {
+		case <-time.After(time.Second * time.Duration(8+rand.Intn(6))):
+		case <-stateCtx.Done():
+			// The deadline is exceeded, the engine ignores the returned command
+			// and transits the state to the timeout flow.
+			return nil, stateCtx.Err()
+		}
 
 		// Tell the engine that the state is completed
 		return flowstate.Commit(flowstate.Park(stateCtx)), nil
 	}))
 	examples.HandleError(err)
 
+	err = fr.SetFlow(`timeout`, flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, _ *flowstate.Engine) (flowstate.Command, error) {
+		slog.Default().Info(fmt.Sprintf("executing timeout logic: %s", stateCtx.Current.ID))
+
+		// Put your timeout handling logic here
+		return flowstate.Commit(flowstate.Park(stateCtx)), nil
+	}))
+	examples.HandleError(err)
+
 	stateCtx := &flowstate.StateCtx{
 		Current: flowstate.State{
 			ID: `anID`,
 		},
 	}
 
-	// Delay the execution of the state for 1 minute
-	// Delay works like a commit, so it is guaranteed that the state will be executed.
+	// The engine transits the state to the timeout flow once the deadline is exceeded.
+	flowstate.SetDeadlineFlow(stateCtx, `timeout`)
+
+	// The deadline is stored with the state, so it is respected even if the execution is resumed by the recoverer.
 	err = e.Do(
 		flowstate.Commit(
-			flowstate.Delay(stateCtx, `example`, time.Second*10),
+			flowstate.Transit(stateCtx, `example`).WithTimeout(time.Second * 10),
 		),
-		flowstate.Execute(stateCtx),
 	)
 	examples.HandleError(err)
 
-	time.Sleep(time.Second * 15)
+	err = e.Execute(stateCtx)
+	examples.HandleError(err)
 }
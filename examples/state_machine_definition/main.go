@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/makasim/flowstate"
+	"github.com/makasim/flowstate/examples"
+)
+
+// The definition could be loaded from a file.
+var transferDefinition = []byte(`{
+  "name": "transfer",
+  "start": "withdraw",
+  "flows": {
+    "withdraw": {"transit": ["deposit", "failed"], "retry": {"max_attempts": 5, "retry_after": "1m"}},
+    "deposit": {"transit": ["completed", "failed"]},
+    "completed": {"terminal": true},
+    "failed": {"terminal": true}
+  }
+}`)
+
+func main() {
+	slog.Default().Info("Example of a declarative state machine")
+
+	e, fr, _, tearDown := examples.SetUp()
+	defer tearDown()
+
+	sm, err := flowstate.ParseStateMachine(transferDefinition)
+	examples.HandleError(err)
+
+	err = flowstate.LoadStateMachine(fr, sm, map[flowstate.FlowID]flowstate.Flow{
+		`withdraw`: flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, _ *flowstate.Engine) (flowstate.Command, error) {
+			slog.Default().Info(fmt.Sprintf("withdraw: %s", stateCtx.Current.ID))
+			return flowstate.Commit(flowstate.Transit(stateCtx, `deposit`)), nil
+		}),
+		`deposit`: flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+			slog.Default().Info(fmt.Sprintf("deposit: %s", stateCtx.Current.ID))
+
+			// The transition is not in the definition so the engine rejects it.
+			if err := e.Do(flowstate.Commit(flowstate.Transit(stateCtx, `withdraw`))); err != nil {
+				slog.Default().Info(fmt.Sprintf("deposit: %s", err))
+			}
+
+			return flowstate.Commit(flowstate.Transit(stateCtx, `completed`)), nil
+		}),
+		`completed`: flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, _ *flowstate.Engine) (flowstate.Command, error) {
+			slog.Default().Info(fmt.Sprintf("completed: %s", stateCtx.Current.ID))
+			return flowstate.Commit(flowstate.Park(stateCtx)), nil
+		}),
+		`failed`: flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, _ *flowstate.Engine) (flowstate.Command, error) {
+			slog.Default().Info(fmt.Sprintf("failed: %s", stateCtx.Current.ID))
+			return flowstate.Commit(flowstate.Park(stateCtx)), nil
+		}),
+	})
+	examples.HandleError(err)
+
+	stateCtx := &flowstate.StateCtx{
+		Current: flowstate.State{
+			ID: flowstate.StateID(fmt.Sprintf("transfer-%d", time.Now().UnixNano())),
+		},
+	}
+
+	// A state enters the state machine through the start flow.
+	err = e.Do(flowstate.Commit(flowstate.Transit(stateCtx, sm.Start)))
+	examples.HandleError(err)
+
+	err = e.Execute(stateCtx)
+	examples.HandleError(err)
+}
@@ -0,0 +1,178 @@
+package flowstate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"strconv"
+	"time"
+)
+
+var FailureErrorAnnotation = `flowstate.failure.error`
+var FailureStackAnnotation = `flowstate.failure.stack`
+var FailureFlowAnnotation = `flowstate.failure.flow`
+var FailureAttemptAnnotation = `flowstate.failure.attempt`
+var FailurePermanentAnnotation = `flowstate.failure.permanent`
+var FailureClassAnnotation = `flowstate.failure.class`
+var FailedAtAnnotation = `flowstate.failure.at`
+
+// maxFailureStackSize limits the panic stack stored in FailureStackAnnotation.
+const maxFailureStackSize = 8192
+
+// PermanentError marks an error returned by a flow as permanent, see Permanent.
+type PermanentError struct {
+	Err error
+}
+
+// Permanent wraps the error returned by a flow so the engine parks the failed state instead of leaving it to Recoverer.
+func Permanent(err error) error {
+	return &PermanentError{Err: err}
+}
+
+func (err *PermanentError) Error() string {
+	return err.Err.Error()
+}
+
+func (err *PermanentError) Unwrap() error {
+	return err.Err
+}
+
+// IsPermanent reports whether the flow error is marked as permanent.
+func IsPermanent(err error) bool {
+	var permanentErr *PermanentError
+	return errors.As(err, &permanentErr)
+}
+
+// PanicError is returned by Engine.Execute if a flow panics.
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (err *PanicError) Error() string {
+	return fmt.Sprintf("flow panic: %v", err.Value)
+}
+
+// Failure describes why the execution of a state failed, see StateFailure.
+type Failure struct {
+	Error     string
+	Stack     string
+	Flow      FlowID
+	Attempt   int
+	Permanent bool
+	// Class is the error class, see ErrorClass.
+	Class string
+	At    time.Time
+}
+
+// StateFailure returns the failure recorded on the state transition once a flow returned an error or panicked.
+//
+// The engine drops uncommitted changes of the failed state and commits the failure.
+// A state failed with a retryable error keeps its transition, so Recoverer executes it again later.
+// A state failed with a permanent error, see Permanent, is parked.
+// States which have never been committed and flows cancelled with context.Canceled are not recorded.
+func StateFailure(state State) (Failure, bool) {
+	ts := state.Transition
+	if ts.Annotations[FailureErrorAnnotation] == `` {
+		return Failure{}, false
+	}
+
+	attempt, _ := strconv.Atoi(ts.Annotations[FailureAttemptAnnotation])
+	at, _ := time.Parse(time.RFC3339, ts.Annotations[FailedAtAnnotation])
+
+	return Failure{
+		Error:     ts.Annotations[FailureErrorAnnotation],
+		Stack:     ts.Annotations[FailureStackAnnotation],
+		Flow:      FlowID(ts.Annotations[FailureFlowAnnotation]),
+		Attempt:   attempt,
+		Permanent: ts.Annotations[FailurePermanentAnnotation] == `true`,
+		Class:     ts.Annotations[FailureClassAnnotation],
+		At:        at,
+	}, true
+}
+
+func (e *Engine) executeFlowRecover(f Flow, stateCtx *StateCtx) (cmd Command, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = &PanicError{
+				Value: v,
+				Stack: debug.Stack(),
+			}
+		}
+	}()
+
+	return e.executeFlow(f, stateCtx)
+}
+
+func (e *Engine) commitFailure(stateCtx *StateCtx, flowID FlowID, flowErr error) {
+	if stateCtx.Committed.Rev == 0 {
+		return
+	}
+	// the flow has been cancelled or the engine is stopping, it is not a failure of the flow; Recoverer executes the state again.
+	if errors.Is(flowErr, context.Canceled) || e.ctx.Err() != nil {
+		return
+	}
+
+	attempt := RecoveryAttempt(stateCtx.Committed)
+	stateCtx.Current = stateCtx.Committed.CopyTo(&State{})
+	stateCtx.Transitions = stateCtx.Transitions[:0]
+
+	annotations := map[string]string{
+		FailureErrorAnnotation:   flowErr.Error(),
+		FailureFlowAnnotation:    string(flowID),
+		FailureAttemptAnnotation: strconv.Itoa(attempt),
+		FailedAtAnnotation:       time.Now().UTC().Format(time.RFC3339),
+	}
+
+	if class := ErrorClass(flowErr); class != `` {
+		annotations[FailureClassAnnotation] = class
+	}
+
+	var panicErr *PanicError
+	if errors.As(flowErr, &panicErr) {
+		stack := panicErr.Stack
+		if len(stack) > maxFailureStackSize {
+			stack = stack[:maxFailureStackSize]
+		}
+		annotations[FailureStackAnnotation] = string(stack)
+	}
+
+	var cmd Command
+	if IsPermanent(flowErr) {
+		annotations[FailurePermanentAnnotation] = `true`
+		cmd = Park(stateCtx).WithAnnotations(annotations)
+	} else {
+		ts := stateCtx.Current.Transition
+		for k := range ts.Annotations {
+			if isFailureAnnotation(k) {
+				delete(ts.Annotations, k)
+			}
+		}
+		cmd = Transit(stateCtx, ts.To).WithAnnotations(ts.Annotations).WithAnnotations(annotations)
+	}
+
+	if err := e.doCmd(Commit(cmd)); IsErrRevMismatch(err) {
+		e.l.Info("engine: commit failure conflict",
+			"sess", stateCtx.sessID,
+			"id", stateCtx.Current.ID,
+			"rev", stateCtx.Current.Rev,
+		)
+	} else if err != nil {
+		e.l.Error("engine: commit failure failed",
+			"sess", stateCtx.sessID,
+			"error", err,
+			"id", stateCtx.Current.ID,
+			"rev", stateCtx.Current.Rev,
+		)
+	}
+}
+
+func isFailureAnnotation(name string) bool {
+	switch name {
+	case FailureErrorAnnotation, FailureStackAnnotation, FailureFlowAnnotation, FailureAttemptAnnotation, FailurePermanentAnnotation, FailureClassAnnotation, FailedAtAnnotation:
+		return true
+	default:
+		return false
+	}
+}
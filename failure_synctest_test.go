@@ -0,0 +1,169 @@
+//go:build goexperiment.synctest
+
+package flowstate_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/makasim/flowstate"
+	"github.com/makasim/flowstate/memdriver"
+	"github.com/thejerf/slogassert"
+)
+
+func TestStateFailure(t *testing.T) {
+	f := func(fail string, expRuns []int, expFailure flowstate.Failure, expParked bool) {
+		t.Helper()
+
+		synctest.Test(t, func(t *testing.T) {
+			lh := slogassert.New(t, slog.LevelDebug, nil)
+			l := slog.New(slogassert.New(t, slog.LevelDebug, lh))
+
+			actMux := &sync.Mutex{}
+			actRuns := make([]int, 0)
+
+			d := memdriver.New(l)
+			fr := &flowstate.DefaultFlowRegistry{}
+			mustSetFlow(fr, `work`, flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+				attempt := flowstate.RecoveryAttempt(stateCtx.Current)
+
+				actMux.Lock()
+				actRuns = append(actRuns, attempt)
+				actMux.Unlock()
+
+				if attempt > 0 {
+					return flowstate.Commit(flowstate.Park(stateCtx)), nil
+				}
+
+				if fail != `` {
+					stateCtx.Current.SetAnnotation(`uncommitted`, `true`)
+				}
+				switch fail {
+				case `error`:
+					return nil, fmt.Errorf("service unavailable")
+				case `permanent`:
+					return nil, flowstate.Permanent(fmt.Errorf("invalid input"))
+				case `canceled`:
+					return nil, fmt.Errorf("query: %w", context.Canceled)
+				case `panic`:
+					panic("boom")
+				}
+
+				return flowstate.Commit(flowstate.Park(stateCtx)), nil
+			}))
+
+			e, err := flowstate.NewEngine(d, fr, l)
+			if err != nil {
+				t.Fatalf("failed to create engine: %v", err)
+			}
+			defer func() {
+				if err := e.Shutdown(context.Background()); err != nil {
+					t.Fatalf("failed to shutdown engine: %v", err)
+				}
+			}()
+
+			r, err := flowstate.NewRecoverer(e, l)
+			if err != nil {
+				t.Fatalf("failed to create recoverer: %v", err)
+			}
+			defer func() {
+				if err := r.Shutdown(context.Background()); err != nil {
+					t.Fatalf("failed to shutdown recoverer: %v", err)
+				}
+			}()
+
+			stateCtx := &flowstate.StateCtx{
+				Current: flowstate.State{
+					ID: `aTID`,
+				},
+			}
+			if err := e.Do(flowstate.Commit(flowstate.Transit(stateCtx, `work`))); err != nil {
+				t.Fatalf("failed to commit: %v", err)
+			}
+
+			err = e.Execute(stateCtx)
+			var panicErr *flowstate.PanicError
+			switch {
+			case fail == `panic` && !errors.As(err, &panicErr):
+				t.Fatalf("expected panic error, got %v", err)
+			case fail != `panic` && fail != `` && err == nil:
+				t.Fatalf("expected error, got nil")
+			}
+
+			failedStateCtx := &flowstate.StateCtx{}
+			if err := e.Do(flowstate.GetStateByID(failedStateCtx, `aTID`, 0)); err != nil {
+				t.Fatalf("failed to get state: %v", err)
+			}
+			if failedStateCtx.Current.Annotations[`uncommitted`] != `` {
+				t.Errorf("expected uncommitted changes dropped")
+			}
+
+			actFailure, _ := flowstate.StateFailure(failedStateCtx.Current)
+			if fail == `panic` && !strings.Contains(actFailure.Stack, `panic(`) {
+				t.Errorf("expected panic stack recorded, got %q", actFailure.Stack)
+			}
+			actFailure.Stack = ``
+			if actFailure != expFailure {
+				t.Errorf("expected failure %+v, got %+v", expFailure, actFailure)
+			}
+			if act := flowstate.Parked(failedStateCtx.Current); act != expParked {
+				t.Errorf("expected parked %v, got %v", expParked, act)
+			}
+
+			time.Sleep(time.Minute * 5)
+			synctest.Wait()
+
+			latestStateCtx := &flowstate.StateCtx{}
+			if err := e.Do(flowstate.GetStateByID(latestStateCtx, `aTID`, 0)); err != nil {
+				t.Fatalf("failed to get state: %v", err)
+			}
+			if !flowstate.Parked(latestStateCtx.Current) {
+				t.Errorf("expected state parked eventually")
+			}
+
+			actMux.Lock()
+			defer actMux.Unlock()
+			if fmt.Sprint(actRuns) != fmt.Sprint(expRuns) {
+				t.Errorf("expected runs %v, got %v", expRuns, actRuns)
+			}
+		})
+	}
+
+	at := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// succeeded
+	f(``, []int{0}, flowstate.Failure{}, true)
+
+	// retryable error recovered
+	f(`error`, []int{0, 1}, flowstate.Failure{
+		Error: `service unavailable`,
+		Flow:  `work`,
+		At:    at,
+	}, false)
+
+	// permanent error parked
+	f(`permanent`, []int{0}, flowstate.Failure{
+		Error:     `invalid input`,
+		Flow:      `work`,
+		Permanent: true,
+		At:        at,
+	}, true)
+
+	// cancelled error not recorded, recovered
+	f(`canceled`, []int{0, 1}, flowstate.Failure{}, false)
+
+	// panic recovered
+	f(`panic`, []int{0, 1}, flowstate.Failure{
+		Error: `flow panic: boom`,
+		Flow:  `work`,
+		Class: flowstate.PanicErrorClass,
+		At:    at,
+	}, false)
+}
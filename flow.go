@@ -23,11 +23,25 @@ type FlowRegistry interface {
 	UnsetFlow(id FlowID) error
 }
 
+// VersionedFlowRegistry is a FlowRegistry that keeps several versions of a flow.
+// The engine pins transitions to the latest flow version and executes pinned transitions with the matching version, see FlowVersionAnnotation.
+type VersionedFlowRegistry interface {
+	FlowRegistry
+	FlowVersion(id FlowID, version string) (Flow, error)
+	// LatestFlowVersion returns the version new transitions to the flow are pinned to.
+	// It returns an empty string if the flow has no versions.
+	LatestFlowVersion(id FlowID) string
+}
+
 var _ FlowRegistry = (*DefaultFlowRegistry)(nil)
 
+var _ VersionedFlowRegistry = (*DefaultFlowRegistry)(nil)
+
 type DefaultFlowRegistry struct {
-	mux   sync.Mutex
-	flows map[FlowID]Flow
+	mux      sync.Mutex
+	flows    map[FlowID]Flow
+	versions map[FlowID]map[string]Flow
+	latest   map[FlowID]string
 }
 
 func (fr *DefaultFlowRegistry) Flow(id FlowID) (Flow, error) {
@@ -79,5 +93,83 @@ func (fr *DefaultFlowRegistry) UnsetFlow(id FlowID) error {
 	}
 
 	delete(fr.flows, id)
+	delete(fr.versions, id)
+	delete(fr.latest, id)
 	return nil
 }
+
+// SetFlowVersion registers the flow version and makes it the latest one.
+// The latest version is also returned by Flow.
+// States pinned to older versions keep executing them until the versions are unset.
+func (fr *DefaultFlowRegistry) SetFlowVersion(id FlowID, version string, flow Flow) error {
+	if id == "" {
+		return fmt.Errorf("flow id empty")
+	}
+	if version == "" {
+		return fmt.Errorf("flow version empty")
+	}
+
+	fr.mux.Lock()
+	defer fr.mux.Unlock()
+
+	if fr.flows == nil {
+		fr.flows = make(map[FlowID]Flow)
+	}
+	if fr.versions == nil {
+		fr.versions = make(map[FlowID]map[string]Flow)
+	}
+	if fr.latest == nil {
+		fr.latest = make(map[FlowID]string)
+	}
+	if fr.versions[id] == nil {
+		fr.versions[id] = make(map[string]Flow)
+	}
+
+	fr.versions[id][version] = flow
+	fr.latest[id] = version
+	fr.flows[id] = flow
+	return nil
+}
+
+// UnsetFlowVersion removes the flow version, the latest version cannot be removed.
+func (fr *DefaultFlowRegistry) UnsetFlowVersion(id FlowID, version string) error {
+	if id == "" {
+		return fmt.Errorf("flow id empty")
+	}
+
+	fr.mux.Lock()
+	defer fr.mux.Unlock()
+
+	if fr.latest[id] == version {
+		return fmt.Errorf("flow %s version %s is the latest one", id, version)
+	}
+
+	delete(fr.versions[id], version)
+	return nil
+}
+
+func (fr *DefaultFlowRegistry) FlowVersion(id FlowID, version string) (Flow, error) {
+	if version == "" {
+		return fr.Flow(id)
+	}
+	if id == "" {
+		return nil, fmt.Errorf("flow id empty")
+	}
+
+	fr.mux.Lock()
+	defer fr.mux.Unlock()
+
+	f, ok := fr.versions[id][version]
+	if !ok {
+		return nil, fmt.Errorf("%w: version %s", ErrFlowNotFound, version)
+	}
+
+	return f, nil
+}
+
+func (fr *DefaultFlowRegistry) LatestFlowVersion(id FlowID) string {
+	fr.mux.Lock()
+	defer fr.mux.Unlock()
+
+	return fr.latest[id]
+}
@@ -0,0 +1,157 @@
+package flowgraph
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/makasim/flowstate"
+)
+
+// WriteDOT writes the graph in the Graphviz DOT format.
+// Start flows are drawn bold, terminal flows with a double border and delay edges dashed.
+func (g *Graph) WriteDOT(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	bw.WriteString("digraph " + strconv.Quote(graphName(g)) + " {\n")
+	bw.WriteString("  rankdir=LR;\n")
+
+	for _, n := range g.Nodes {
+		attrs := []string{`label=` + strconv.Quote(nodeLabel(n))}
+		if n.Start {
+			attrs = append(attrs, `style=bold`)
+		}
+		if n.Terminal {
+			attrs = append(attrs, `peripheries=2`)
+		}
+
+		bw.WriteString("  " + strconv.Quote(string(n.ID)) + " [" + strings.Join(attrs, ", ") + "];\n")
+	}
+
+	for _, e := range g.Edges {
+		var attrs []string
+		if label := edgeLabel(e); label != `` {
+			attrs = append(attrs, `label=`+strconv.Quote(label))
+		}
+		if e.Kind == `delay` {
+			attrs = append(attrs, `style=dashed`)
+		}
+
+		bw.WriteString("  " + strconv.Quote(string(e.From)) + " -> " + strconv.Quote(string(e.To)))
+		if len(attrs) > 0 {
+			bw.WriteString(" [" + strings.Join(attrs, ", ") + "]")
+		}
+		bw.WriteString(";\n")
+	}
+
+	bw.WriteString("}\n")
+
+	return bw.Flush()
+}
+
+// WriteMermaid writes the graph as a Mermaid flowchart.
+// Start flows are drawn as stadiums, terminal flows as double circles and delay edges dotted.
+func (g *Graph) WriteMermaid(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	if g.Name != `` {
+		bw.WriteString("---\ntitle: " + g.Name + "\n---\n")
+	}
+	bw.WriteString("flowchart LR\n")
+
+	ids := make(map[flowstate.FlowID]string, len(g.Nodes))
+	for i, n := range g.Nodes {
+		id := `n` + strconv.Itoa(i)
+		ids[n.ID] = id
+
+		label := mermaidText(nodeLabel(n))
+		switch {
+		case n.Terminal:
+			bw.WriteString("  " + id + "(((\"" + label + "\")))\n")
+		case n.Start:
+			bw.WriteString("  " + id + "([\"" + label + "\"])\n")
+		default:
+			bw.WriteString("  " + id + "[\"" + label + "\"]\n")
+		}
+	}
+
+	for _, e := range g.Edges {
+		arrow := `-->`
+		if e.Kind == `delay` {
+			arrow = `-.->`
+		}
+
+		bw.WriteString("  " + ids[e.From] + " " + arrow)
+		if label := edgeLabel(e); label != `` {
+			bw.WriteString("|\"" + mermaidText(label) + "\"|")
+		}
+		bw.WriteString(" " + ids[e.To] + "\n")
+	}
+
+	return bw.Flush()
+}
+
+func (g *Graph) DOT() string {
+	b := &strings.Builder{}
+	_ = g.WriteDOT(b)
+	return b.String()
+}
+
+func (g *Graph) Mermaid() string {
+	b := &strings.Builder{}
+	_ = g.WriteMermaid(b)
+	return b.String()
+}
+
+func graphName(g *Graph) string {
+	if g.Name == `` {
+		return `flowstate`
+	}
+
+	return g.Name
+}
+
+func nodeLabel(n Node) string {
+	label := string(n.ID)
+	if n.Count > 0 {
+		label += " (" + strconv.FormatInt(n.Count, 10) + ")"
+	}
+	if n.Parked > 0 {
+		label += " parked: " + strconv.FormatInt(n.Parked, 10)
+	}
+
+	return label
+}
+
+func edgeLabel(e Edge) string {
+	if e.Count == 0 {
+		if e.Kind == `delay` {
+			return `delay`
+		}
+		return ``
+	}
+
+	label := strconv.FormatInt(e.Count, 10)
+	if e.Kind == `delay` {
+		label = `delay ` + label
+	}
+
+	return label + ", avg " + formatDwell(e.AvgDwell)
+}
+
+func formatDwell(d time.Duration) string {
+	switch {
+	case d >= time.Second:
+		return d.Round(time.Second / 10).String()
+	case d >= time.Millisecond:
+		return d.Round(time.Millisecond).String()
+	default:
+		return d.String()
+	}
+}
+
+func mermaidText(s string) string {
+	return strings.ReplaceAll(s, `"`, `#quot;`)
+}
@@ -0,0 +1,231 @@
+// Package flowgraph builds directed graphs of flows from state machine definitions or observed state history
+// and exports them in Graphviz DOT and Mermaid formats.
+package flowgraph
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/makasim/flowstate"
+)
+
+type Graph struct {
+	Name  string `json:"name,omitempty"`
+	Nodes []Node `json:"nodes"`
+	Edges []Edge `json:"edges"`
+}
+
+type Node struct {
+	ID       flowstate.FlowID `json:"id"`
+	Start    bool             `json:"start,omitempty"`
+	Terminal bool             `json:"terminal,omitempty"`
+
+	// Count is the number of observed executions of the flow.
+	Count int64 `json:"count,omitempty"`
+	// Parked is the number of observed parks of states executed by the flow.
+	Parked int64 `json:"parked,omitempty"`
+}
+
+type Edge struct {
+	From flowstate.FlowID `json:"from"`
+	To   flowstate.FlowID `json:"to"`
+	// Kind is either transit or delay.
+	Kind string `json:"kind"`
+
+	// Count is the number of observed transitions.
+	Count int64 `json:"count,omitempty"`
+	// AvgDwell is the average time a state spent in the From flow before it transited to the To flow.
+	AvgDwell time.Duration `json:"avg_dwell,omitempty"`
+}
+
+// FromStateMachine builds a graph of a declared state machine.
+func FromStateMachine(sm *flowstate.StateMachine) *Graph {
+	b := newBuilder()
+	b.name = sm.Name
+
+	for id, f := range sm.Flows {
+		n := b.node(id)
+		n.Start = id == sm.Start
+		n.Terminal = f.Terminal
+
+		for _, to := range f.Transit {
+			b.node(to)
+			b.edge(id, to, `transit`)
+		}
+		for _, to := range f.Delay {
+			b.node(to)
+			b.edge(id, to, `delay`)
+		}
+	}
+
+	return b.build()
+}
+
+// FromStates builds a graph by scanning committed states returned by the command.
+// Revisions of the same state are followed by Transition.To; an edge is added for every pair of consecutive revisions.
+// The command must not be latest only. States with flowstate. prefixed IDs are skipped.
+func FromStates(e *flowstate.Engine, cmd *flowstate.GetStatesCommand) (*Graph, error) {
+	g, _, err := fromStates(e, cmd, 0)
+	return g, err
+}
+
+// fromStates scans at most limit states, zero means no limit. It reports whether the scan stopped at the limit.
+func fromStates(e *flowstate.Engine, cmd *flowstate.GetStatesCommand, limit int) (*Graph, bool, error) {
+	if cmd.LatestOnly {
+		return nil, false, fmt.Errorf("latest only command is not supported, all revisions are required")
+	}
+
+	o := NewObserver()
+
+	var scanned int
+	it := e.Iter(cmd)
+	for it.Next() {
+		if limit > 0 && scanned >= limit {
+			return o.Graph(), true, nil
+		}
+
+		o.Observe(it.State())
+		scanned++
+	}
+	if err := it.Err(); err != nil {
+		return nil, false, fmt.Errorf("iter: %w", err)
+	}
+
+	return o.Graph(), false, nil
+}
+
+// Observer builds a graph from states observed in the revision order, for example from a Watcher.
+type Observer struct {
+	b    *builder
+	last map[flowstate.StateID]flowstate.State
+}
+
+func NewObserver() *Observer {
+	return &Observer{
+		b:    newBuilder(),
+		last: make(map[flowstate.StateID]flowstate.State),
+	}
+}
+
+func (o *Observer) Observe(state flowstate.State) {
+	if strings.HasPrefix(string(state.ID), `flowstate.`) {
+		return
+	}
+
+	prev, ok := o.last[state.ID]
+	o.last[state.ID] = state.CopyTo(&flowstate.State{})
+
+	if state.Transition.To != `` {
+		o.b.node(state.Transition.To).Count++
+	}
+	if !ok || prev.Transition.To == `` {
+		return
+	}
+
+	if state.Transition.To == `` {
+		n := o.b.node(prev.Transition.To)
+		n.Parked++
+		n.Terminal = true
+		return
+	}
+
+	// the Delayer commits delayed transitions with the delay annotations
+	kind := `transit`
+	if flowstate.Delayed(state) {
+		kind = `delay`
+	}
+
+	edge := o.b.edge(prev.Transition.To, state.Transition.To, kind)
+	edge.Count++
+	o.b.addDwell(edge, state.CommittedAt.Sub(prev.CommittedAt))
+}
+
+func (o *Observer) Graph() *Graph {
+	return o.b.build()
+}
+
+type edgeKey struct {
+	from flowstate.FlowID
+	to   flowstate.FlowID
+	kind string
+}
+
+type builder struct {
+	name   string
+	nodes  map[flowstate.FlowID]*Node
+	edges  map[edgeKey]*Edge
+	dwells map[*Edge]time.Duration
+}
+
+func newBuilder() *builder {
+	return &builder{
+		nodes:  make(map[flowstate.FlowID]*Node),
+		edges:  make(map[edgeKey]*Edge),
+		dwells: make(map[*Edge]time.Duration),
+	}
+}
+
+func (b *builder) node(id flowstate.FlowID) *Node {
+	n, ok := b.nodes[id]
+	if !ok {
+		n = &Node{ID: id}
+		b.nodes[id] = n
+	}
+
+	return n
+}
+
+func (b *builder) edge(from, to flowstate.FlowID, kind string) *Edge {
+	key := edgeKey{from: from, to: to, kind: kind}
+	e, ok := b.edges[key]
+	if !ok {
+		e = &Edge{From: from, To: to, Kind: kind}
+		b.edges[key] = e
+	}
+
+	return e
+}
+
+func (b *builder) addDwell(e *Edge, dwell time.Duration) {
+	if dwell < 0 {
+		dwell = 0
+	}
+
+	b.dwells[e] += dwell
+}
+
+func (b *builder) build() *Graph {
+	g := &Graph{
+		Name:  b.name,
+		Nodes: make([]Node, 0, len(b.nodes)),
+		Edges: make([]Edge, 0, len(b.edges)),
+	}
+
+	for _, n := range b.nodes {
+		g.Nodes = append(g.Nodes, *n)
+	}
+	sort.Slice(g.Nodes, func(i, j int) bool {
+		return g.Nodes[i].ID < g.Nodes[j].ID
+	})
+
+	for _, e := range b.edges {
+		edge := *e
+		if edge.Count > 0 {
+			edge.AvgDwell = b.dwells[e] / time.Duration(edge.Count)
+		}
+		g.Edges = append(g.Edges, edge)
+	}
+	sort.Slice(g.Edges, func(i, j int) bool {
+		if g.Edges[i].From != g.Edges[j].From {
+			return g.Edges[i].From < g.Edges[j].From
+		}
+		if g.Edges[i].To != g.Edges[j].To {
+			return g.Edges[i].To < g.Edges[j].To
+		}
+		return g.Edges[i].Kind < g.Edges[j].Kind
+	})
+
+	return g
+}
@@ -0,0 +1,107 @@
+package flowgraph_test
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/makasim/flowstate"
+	"github.com/makasim/flowstate/flowgraph"
+	"github.com/makasim/flowstate/memdriver"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFromStateMachine(t *testing.T) {
+	sm, err := flowstate.ParseStateMachine([]byte(`{
+  "name": "transfer",
+  "start": "withdraw",
+  "flows": {
+    "withdraw": {"transit": ["deposit"], "delay": ["withdraw"]},
+    "deposit": {"transit": ["completed"]},
+    "completed": {"terminal": true}
+  }
+}`))
+	require.NoError(t, err)
+
+	g := flowgraph.FromStateMachine(sm)
+
+	require.Equal(t, `digraph "transfer" {
+  rankdir=LR;
+  "completed" [label="completed", peripheries=2];
+  "deposit" [label="deposit"];
+  "withdraw" [label="withdraw", style=bold];
+  "deposit" -> "completed";
+  "withdraw" -> "deposit";
+  "withdraw" -> "withdraw" [label="delay", style=dashed];
+}
+`, g.DOT())
+
+	require.Equal(t, `---
+title: transfer
+---
+flowchart LR
+  n0((("completed")))
+  n1["deposit"]
+  n2(["withdraw"])
+  n1 --> n0
+  n2 --> n1
+  n2 -.->|"delay"| n2
+`, g.Mermaid())
+}
+
+func TestFromStates(t *testing.T) {
+	l := slog.New(slog.DiscardHandler)
+	d := memdriver.New(l)
+	fr := &flowstate.DefaultFlowRegistry{}
+	e, err := flowstate.NewEngine(d, fr, l)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+		require.NoError(t, e.Shutdown(ctx))
+	})
+
+	require.NoError(t, fr.SetFlow(`first`, flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+		return flowstate.Commit(flowstate.Transit(stateCtx, `second`)), nil
+	})))
+	require.NoError(t, fr.SetFlow(`second`, flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+		return flowstate.Commit(flowstate.Park(stateCtx)), nil
+	})))
+
+	for _, id := range []flowstate.StateID{`aTID`, `anotherTID`} {
+		stateCtx := &flowstate.StateCtx{
+			Current: flowstate.State{
+				ID: id,
+			},
+		}
+		require.NoError(t, e.Do(flowstate.Commit(flowstate.Transit(stateCtx, `first`))))
+		require.NoError(t, e.Execute(stateCtx))
+	}
+
+	g, err := flowgraph.FromStates(e, flowstate.GetStatesByLabels(nil))
+	require.NoError(t, err)
+
+	require.Equal(t, []flowgraph.Node{
+		{ID: `first`, Count: 2},
+		{ID: `second`, Count: 2, Parked: 2, Terminal: true},
+	}, g.Nodes)
+	require.Len(t, g.Edges, 1)
+	require.Equal(t, flowstate.FlowID(`first`), g.Edges[0].From)
+	require.Equal(t, flowstate.FlowID(`second`), g.Edges[0].To)
+	require.Equal(t, `transit`, g.Edges[0].Kind)
+	require.Equal(t, int64(2), g.Edges[0].Count)
+
+	rw := httptest.NewRecorder()
+	require.True(t, flowgraph.HandleGraph(rw, httptest.NewRequest(http.MethodGet, `/graph?format=mermaid`, nil), e))
+	require.Equal(t, http.StatusOK, rw.Code)
+	require.Contains(t, rw.Body.String(), `n0 -->|"2, avg `)
+	require.Empty(t, rw.Header().Get(`X-Flowstate-Graph-Truncated`))
+
+	rw = httptest.NewRecorder()
+	require.True(t, flowgraph.HandleGraph(rw, httptest.NewRequest(http.MethodGet, `/graph?format=json&limit=2`, nil), e))
+	require.Equal(t, http.StatusOK, rw.Code)
+	require.Equal(t, `true`, rw.Header().Get(`X-Flowstate-Graph-Truncated`))
+}
@@ -0,0 +1,105 @@
+package flowgraph
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/makasim/flowstate"
+)
+
+// MaxGraphStates limits the number of state revisions HandleGraph scans per request.
+var MaxGraphStates = 100000
+
+// DefaultGraphWindow is how far back HandleGraph scans states if neither since_rev nor since_time is set.
+var DefaultGraphWindow = time.Hour
+
+// HandleGraph serves a graph observed from the committed states at /graph.
+// The handler does not authenticate requests, it is up to the caller to mount it.
+//
+// Query parameters:
+//   - format: dot (default), mermaid or json;
+//   - since_rev: scan states committed after the revision;
+//   - since_time: scan states committed after the time, RFC3339 formatted, DefaultGraphWindow ago if neither is set;
+//   - limit: scan at most the number of states, capped by MaxGraphStates;
+//   - label.<name>: scan states with the label, can be repeated.
+//
+// Once the scan stops at the limit the X-Flowstate-Graph-Truncated response header is set to true.
+func HandleGraph(rw http.ResponseWriter, r *http.Request, e *flowstate.Engine) bool {
+	if r.URL.Path != `/graph` {
+		return false
+	}
+
+	q := r.URL.Query()
+
+	var labels map[string]string
+	for k, vs := range q {
+		name, ok := strings.CutPrefix(k, `label.`)
+		if !ok || name == `` || len(vs) == 0 {
+			continue
+		}
+
+		if labels == nil {
+			labels = make(map[string]string)
+		}
+		labels[name] = vs[0]
+	}
+
+	limit := MaxGraphStates
+	if limit0 := q.Get(`limit`); limit0 != `` {
+		l, err := strconv.Atoi(limit0)
+		if err != nil || l <= 0 {
+			http.Error(rw, "limit: must be a positive integer", http.StatusBadRequest)
+			return true
+		}
+		limit = min(l, MaxGraphStates)
+	}
+
+	cmd := flowstate.GetStatesByLabels(labels).WithLimit(min(limit, flowstate.GetStatesDefaultLimit*10))
+	if q.Get(`since_rev`) == `` && q.Get(`since_time`) == `` {
+		cmd.WithSinceTime(time.Now().Add(-DefaultGraphWindow))
+	}
+	if sinceRev := q.Get(`since_rev`); sinceRev != `` {
+		rev, err := strconv.ParseInt(sinceRev, 10, 64)
+		if err != nil {
+			http.Error(rw, "since_rev: "+err.Error(), http.StatusBadRequest)
+			return true
+		}
+		cmd.WithSinceRev(rev)
+	}
+	if sinceTime := q.Get(`since_time`); sinceTime != `` {
+		t, err := time.Parse(time.RFC3339, sinceTime)
+		if err != nil {
+			http.Error(rw, "since_time: "+err.Error(), http.StatusBadRequest)
+			return true
+		}
+		cmd.WithSinceTime(t)
+	}
+
+	g, truncated, err := fromStates(e, cmd, limit)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return true
+	}
+	if truncated {
+		rw.Header().Set(`X-Flowstate-Graph-Truncated`, `true`)
+	}
+
+	switch q.Get(`format`) {
+	case ``, `dot`:
+		rw.Header().Set(`Content-Type`, `text/vnd.graphviz; charset=utf-8`)
+		_ = g.WriteDOT(rw)
+	case `mermaid`:
+		rw.Header().Set(`Content-Type`, `text/plain; charset=utf-8`)
+		_ = g.WriteMermaid(rw)
+	case `json`:
+		rw.Header().Set(`Content-Type`, `application/json`)
+		_ = json.NewEncoder(rw).Encode(g)
+	default:
+		http.Error(rw, "format: must be one of dot, mermaid or json", http.StatusBadRequest)
+	}
+
+	return true
+}
@@ -0,0 +1,370 @@
+package flowstate
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+var ForkParentAnnotation = `flowstate.fork.parent`
+var ForkChildrenAnnotation = `flowstate.fork.children`
+var JoinDoneAnnotation = `flowstate.join.done`
+var JoinResumeAnnotation = `flowstate.join.resume`
+var JoinChildAnnotation = `flowstate.join.child`
+var JoinCancelledAnnotation = `flowstate.join.cancelled`
+
+// forkReturnAttempts limits commits of a forked state return conflicting with concurrent changes of the parent.
+const forkReturnAttempts = 10
+
+// Fork parks the parent state and transits the child states to the given flow in a single commit.
+// The parent resumes with the flow it was parked in unless WithResume is set, once a child returns; see Return and Join.
+//
+// Join state is kept in annotations: the parent state keeps forked child IDs in ForkChildrenAnnotation
+// and returned child IDs, in the order they returned, in JoinDoneAnnotation; each child keeps the parent ID in ForkParentAnnotation.
+// Once committed, the first child is executed in the same session if Fork is returned by a flow, the rest in new sessions.
+func Fork(parent *StateCtx, to FlowID, children ...*StateCtx) *ForkCommand {
+	return &ForkCommand{
+		StateCtx: parent,
+		Children: children,
+		To:       to,
+	}
+}
+
+type ForkCommand struct {
+	command
+	StateCtx *StateCtx
+	Children []*StateCtx
+	To       FlowID
+	Resume   FlowID
+
+	sync bool
+}
+
+func (cmd *ForkCommand) sessID() int64 {
+	return cmd.StateCtx.sessID
+}
+
+func (cmd *ForkCommand) setSync() {
+	cmd.sync = true
+}
+
+func (cmd *ForkCommand) do(e *Engine) error {
+	return e.doFork(cmd)
+}
+
+func (cmd *ForkCommand) next() *StateCtx {
+	return cmd.Children[0]
+}
+
+// WithResume sets a flow the parent state transits to once a child returns.
+func (cmd *ForkCommand) WithResume(to FlowID) *ForkCommand {
+	cmd.Resume = to
+	return cmd
+}
+
+func (cmd *ForkCommand) Prepare() (*CommitCommand, error) {
+	if cmd.StateCtx == nil || cmd.StateCtx.Current.ID == `` {
+		return nil, fmt.Errorf("parent state id empty")
+	}
+	if len(cmd.Children) == 0 {
+		return nil, fmt.Errorf("no child states to fork")
+	}
+	if cmd.To == `` {
+		return nil, fmt.Errorf("child flow id empty")
+	}
+	if len(ForkChildren(cmd.StateCtx.Current)) > 0 {
+		return nil, fmt.Errorf("state %s has forked states not joined yet", cmd.StateCtx.Current.ID)
+	}
+
+	resume := cmd.Resume
+	if resume == `` {
+		resume = cmd.StateCtx.Current.Transition.To
+	}
+	if resume == `` {
+		return nil, fmt.Errorf("parent resume flow id empty")
+	}
+
+	ids := make([]string, 0, len(cmd.Children))
+	for _, child := range cmd.Children {
+		if child == nil || child.Current.ID == `` {
+			return nil, fmt.Errorf("child state id empty")
+		}
+		if child.Current.ID == cmd.StateCtx.Current.ID {
+			return nil, fmt.Errorf("state cannot fork itself")
+		}
+		if slices.Contains(ids, string(child.Current.ID)) {
+			return nil, fmt.Errorf("child state %s forked twice", child.Current.ID)
+		}
+
+		ids = append(ids, string(child.Current.ID))
+	}
+
+	cmd.StateCtx.Current.SetAnnotation(ForkChildrenAnnotation, strings.Join(ids, `,`))
+	delete(cmd.StateCtx.Current.Annotations, JoinDoneAnnotation)
+
+	cmds := []Command{
+		Park(cmd.StateCtx).WithAnnotation(JoinResumeAnnotation, string(resume)).skipStateMachineCheck(),
+	}
+	for _, child := range cmd.Children {
+		child.Current.SetAnnotation(ForkParentAnnotation, string(cmd.StateCtx.Current.ID))
+		cmds = append(cmds, Transit(child, cmd.To))
+	}
+
+	return Commit(cmds...), nil
+}
+
+// JoinPolicy reports whether a join is done given the number of returned and forked states.
+type JoinPolicy func(done, total int) bool
+
+// JoinAll waits for all forked states.
+func JoinAll() JoinPolicy {
+	return func(done, total int) bool {
+		return done >= total
+	}
+}
+
+// JoinFirst waits for the first forked state, it wins.
+func JoinFirst() JoinPolicy {
+	return JoinN(1)
+}
+
+// JoinN waits for n forked states.
+func JoinN(n int) JoinPolicy {
+	return func(done, total int) bool {
+		return done >= min(n, total)
+	}
+}
+
+// JoinQuorum waits for the majority of forked states.
+func JoinQuorum() JoinPolicy {
+	return func(done, total int) bool {
+		return done >= total/2+1
+	}
+}
+
+// Join transits the parent state to the given flow once the policy is satisfied by the returned forked states.
+// Forked states that have not returned yet lose, they are parked with JoinCancelledAnnotation in the same commit.
+// Otherwise, the parent is parked until the next forked state returns and resumes it with the current flow.
+func Join(parent *StateCtx, policy JoinPolicy, to FlowID) *JoinCommand {
+	return &JoinCommand{
+		StateCtx: parent,
+		Policy:   policy,
+		To:       to,
+	}
+}
+
+type JoinCommand struct {
+	command
+	StateCtx *StateCtx
+	Policy   JoinPolicy
+	To       FlowID
+
+	// Joined is set once the policy is satisfied and the parent state is transited.
+	Joined bool
+
+	sync bool
+}
+
+func (cmd *JoinCommand) sessID() int64 {
+	return cmd.StateCtx.sessID
+}
+
+func (cmd *JoinCommand) setSync() {
+	cmd.sync = true
+}
+
+func (cmd *JoinCommand) do(e *Engine) error {
+	return e.doJoin(cmd)
+}
+
+func (cmd *JoinCommand) next() *StateCtx {
+	if cmd.Joined {
+		return cmd.StateCtx
+	}
+	return nil
+}
+
+// ForkParent returns the ID of the state that forked the state or an empty string if the state was not forked.
+func ForkParent(state State) StateID {
+	return StateID(state.Annotations[ForkParentAnnotation])
+}
+
+// ForkChildren returns IDs of the states forked by the state and not joined yet.
+func ForkChildren(state State) []StateID {
+	return splitStateIDs(state.Annotations[ForkChildrenAnnotation])
+}
+
+// JoinDone returns IDs of the forked states returned to the state in the order they returned.
+func JoinDone(state State) []StateID {
+	return splitStateIDs(state.Annotations[JoinDoneAnnotation])
+}
+
+func splitStateIDs(idsStr string) []StateID {
+	if idsStr == `` {
+		return nil
+	}
+
+	var ids []StateID
+	for _, id := range strings.Split(idsStr, `,`) {
+		ids = append(ids, StateID(id))
+	}
+
+	return ids
+}
+
+func (e *Engine) doFork(cmd *ForkCommand) error {
+	commitCmd, err := cmd.Prepare()
+	if err != nil {
+		return err
+	}
+	if err := e.doCmd(commitCmd); err != nil {
+		return err
+	}
+
+	children := cmd.Children
+	if cmd.sync {
+		children = children[1:]
+	}
+	for _, child := range children {
+		e.goExecute(child)
+	}
+
+	return nil
+}
+
+func (e *Engine) doJoin(cmd *JoinCommand) error {
+	if cmd.Policy == nil {
+		return fmt.Errorf("join policy is nil")
+	}
+	if cmd.To == `` {
+		return fmt.Errorf("flow id empty")
+	}
+
+	parentID := cmd.StateCtx.Current.ID
+	children := ForkChildren(cmd.StateCtx.Current)
+	if len(children) == 0 {
+		return fmt.Errorf("state %s has no forked states to join", parentID)
+	}
+
+	done := JoinDone(cmd.StateCtx.Current)
+	if !cmd.Policy(len(done), len(children)) {
+		resume := cmd.StateCtx.Current.Transition.To
+		if resume == `` {
+			return fmt.Errorf("parent resume flow id empty")
+		}
+
+		return e.doCmd(Commit(Park(cmd.StateCtx).WithAnnotation(JoinResumeAnnotation, string(resume)).skipStateMachineCheck()))
+	}
+
+	cmds := []Command{Transit(cmd.StateCtx, cmd.To)}
+	for _, id := range children {
+		if slices.Contains(done, id) {
+			continue
+		}
+
+		loserStateCtx := &StateCtx{}
+		if err := e.doCmd(GetStateByID(loserStateCtx, id, 0)); err != nil {
+			return fmt.Errorf("get forked state: %w", err)
+		}
+		if Parked(loserStateCtx.Current) {
+			continue
+		}
+
+		delete(loserStateCtx.Current.Annotations, ForkParentAnnotation)
+		cmds = append(cmds, Park(loserStateCtx).WithAnnotation(JoinCancelledAnnotation, string(parentID)).skipStateMachineCheck())
+	}
+
+	delete(cmd.StateCtx.Current.Annotations, ForkChildrenAnnotation)
+	if err := e.doCmd(Commit(cmds...)); err != nil {
+		return err
+	}
+
+	cmd.Joined = true
+	if !cmd.sync {
+		e.goExecute(cmd.StateCtx)
+	}
+
+	return nil
+}
+
+// doForkReturn parks the forked state, adds it to the parent join state and resumes the parent in a single commit.
+// The commit is retried with the latest parent if it conflicts with concurrent changes of the parent, like other forked states returned.
+func (e *Engine) doForkReturn(cmd *ReturnCommand, parentID StateID) error {
+	childID := cmd.StateCtx.Current.ID
+
+	var err error
+	for i := 0; i < forkReturnAttempts; i++ {
+		parentStateCtx := &StateCtx{}
+		if err := e.doCmd(GetStateByID(parentStateCtx, parentID, 0)); err != nil {
+			return fmt.Errorf("get parent state: %w", err)
+		}
+
+		childStateCtx := cmd.StateCtx.CopyTo(&StateCtx{})
+		delete(childStateCtx.Current.Annotations, ForkParentAnnotation)
+
+		commitCmd := Commit(Park(childStateCtx).
+			WithAnnotations(cmd.Annotations).
+			WithAnnotation(CallReturnedAnnotation, string(parentID)),
+		)
+
+		resumeCmd := forkResumeCommand(parentStateCtx, childID)
+		if resumeCmd != nil {
+			commitCmd.Commands = append(commitCmd.Commands, resumeCmd)
+		}
+
+		if err = e.doCmd(commitCmd); IsErrRevMismatch(err) && !IsErrRevMismatchContains(err, childID) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		cmd.StateCtx.moveFrom(childStateCtx)
+		if resumeCmd == nil {
+			return nil
+		}
+
+		cmd.ParentStateCtx = parentStateCtx
+		if !cmd.sync {
+			e.goExecute(cmd.ParentStateCtx)
+		}
+
+		return nil
+	}
+
+	return err
+}
+
+// forkResumeCommand records the returned state in the parent join state and resumes the parent.
+// A parent that is not parked is re-transited to its current flow so that its ongoing join does not miss the returned state.
+// It returns nil if the parent has already joined the state.
+func forkResumeCommand(parentStateCtx *StateCtx, childID StateID) Command {
+	if !slices.Contains(ForkChildren(parentStateCtx.Current), childID) {
+		return nil
+	}
+
+	done := JoinDone(parentStateCtx.Current)
+	if !slices.Contains(done, childID) {
+		done = append(done, childID)
+	}
+
+	ids := make([]string, 0, len(done))
+	for _, id := range done {
+		ids = append(ids, string(id))
+	}
+	parentStateCtx.Current.SetAnnotation(JoinDoneAnnotation, strings.Join(ids, `,`))
+
+	currTs := parentStateCtx.Current.Transition
+	if !Parked(parentStateCtx.Current) {
+		return Transit(parentStateCtx, currTs.To).
+			WithAnnotations(currTs.Annotations).
+			WithAnnotation(JoinChildAnnotation, string(childID)).
+			skipStateMachineCheck()
+	}
+
+	resume := FlowID(currTs.Annotations[JoinResumeAnnotation])
+	if resume == `` {
+		return nil
+	}
+
+	return Transit(parentStateCtx, resume).WithAnnotation(JoinChildAnnotation, string(childID)).skipStateMachineCheck()
+}
@@ -0,0 +1,26 @@
+package flowstate_test
+
+import (
+	"testing"
+
+	"github.com/makasim/flowstate"
+)
+
+func TestJoinPolicies(t *testing.T) {
+	f := func(name string, policy flowstate.JoinPolicy, total int, exp []bool) {
+		t.Helper()
+
+		for done, expJoined := range exp {
+			if joined := policy(done, total); joined != expJoined {
+				t.Errorf("%s: done %d of %d: expected joined %v; got %v", name, done, total, expJoined, joined)
+			}
+		}
+	}
+
+	f(`all`, flowstate.JoinAll(), 3, []bool{false, false, false, true})
+	f(`first`, flowstate.JoinFirst(), 3, []bool{false, true, true, true})
+	f(`n`, flowstate.JoinN(2), 3, []bool{false, false, true, true})
+	f(`n more than total`, flowstate.JoinN(5), 3, []bool{false, false, false, true})
+	f(`quorum`, flowstate.JoinQuorum(), 3, []bool{false, false, true, true})
+	f(`quorum even`, flowstate.JoinQuorum(), 4, []bool{false, false, false, true, true})
+}
@@ -0,0 +1,67 @@
+package flowstate
+
+import (
+	"slices"
+)
+
+// FlowInterceptor wraps every flow execution done by Engine.Execute.
+// An interceptor may observe or modify the state, short-circuit the call by not calling next,
+// or fail it by returning an error.
+type FlowInterceptor func(stateCtx *StateCtx, e *Engine, next Flow) (Command, error)
+
+// CommandInterceptor wraps every command the engine does, including commands done by flows with Engine.Do.
+// An interceptor may observe or modify the command in place, short-circuit the call by not calling next,
+// or fail it by returning an error.
+type CommandInterceptor func(cmd Command, next func(cmd Command) error) error
+
+// InterceptFlow adds flow interceptors to the engine.
+// Interceptors are called in the order they are added, the first one is the outermost.
+func (e *Engine) InterceptFlow(interceptors ...FlowInterceptor) {
+	e.interceptorsMux.Lock()
+	defer e.interceptorsMux.Unlock()
+
+	e.flowInterceptors = append(slices.Clone(e.flowInterceptors), interceptors...)
+}
+
+// InterceptCommand adds command interceptors to the engine.
+// Interceptors are called in the order they are added, the first one is the outermost.
+func (e *Engine) InterceptCommand(interceptors ...CommandInterceptor) {
+	e.interceptorsMux.Lock()
+	defer e.interceptorsMux.Unlock()
+
+	e.commandInterceptors = append(slices.Clone(e.commandInterceptors), interceptors...)
+}
+
+func (e *Engine) executeFlow(f Flow, stateCtx *StateCtx) (Command, error) {
+	e.interceptorsMux.RLock()
+	interceptors := e.flowInterceptors
+	e.interceptorsMux.RUnlock()
+
+	if len(interceptors) == 0 {
+		return f.Execute(stateCtx, e)
+	}
+
+	return chainFlowInterceptors(interceptors, f).Execute(stateCtx, e)
+}
+
+func chainFlowInterceptors(interceptors []FlowInterceptor, f Flow) Flow {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], f
+		f = FlowFunc(func(stateCtx *StateCtx, e *Engine) (Command, error) {
+			return interceptor(stateCtx, e, next)
+		})
+	}
+
+	return f
+}
+
+func chainCommandInterceptors(interceptors []CommandInterceptor, do func(cmd Command) error) func(cmd Command) error {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], do
+		do = func(cmd Command) error {
+			return interceptor(cmd, next)
+		}
+	}
+
+	return do
+}
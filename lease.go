@@ -0,0 +1,43 @@
+package flowstate
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"time"
+)
+
+// LeaseHolderAnnotation is set on the meta state of Delayer or Recoverer to the process holding the lease, the leader.
+var LeaseHolderAnnotation = `flowstate.lease.holder`
+
+// LeaseExpiresAtAnnotation is set on the meta state of Delayer or Recoverer to the time the lease expires at unless renewed.
+var LeaseExpiresAtAnnotation = `flowstate.lease.expires_at`
+
+// LeaseDuration is how long a leader holds the lease without renewing it, a standby takes the lease over once it expires.
+var LeaseDuration = time.Second * 30
+
+// LeaseRenewInterval is how often a leader renews the lease and a standby checks whether the lease is expired.
+// It must be well below LeaseDuration.
+var LeaseRenewInterval = time.Second * 10
+
+func newLeaseHolder() string {
+	return fmt.Sprintf("%016x", rand.Uint64())
+}
+
+func leaseHolder(state State) string {
+	return state.Annotations[LeaseHolderAnnotation]
+}
+
+func leaseExpiresAt(state State) time.Time {
+	expiresAt, _ := time.Parse(time.RFC3339, state.Annotations[LeaseExpiresAtAnnotation])
+	return expiresAt
+}
+
+// leaseAvailable reports whether the lease stored on the meta state has never been taken, is released or expired.
+func leaseAvailable(state State, now time.Time) bool {
+	return leaseHolder(state) == `` || !leaseExpiresAt(state).After(now)
+}
+
+func setLease(stateCtx *StateCtx, holder string, expiresAt time.Time) {
+	stateCtx.Current.SetAnnotation(LeaseHolderAnnotation, holder)
+	stateCtx.Current.SetAnnotation(LeaseExpiresAtAnnotation, expiresAt.UTC().Format(time.RFC3339))
+}
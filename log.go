@@ -84,6 +84,15 @@ func logCommand(msg string, execSessID int64, cmd0 Command, l *slog.Logger) {
 		if len(cmd.StateCtx.Current.Annotations) > 0 {
 			args = append(args, "ann", cmd.StateCtx.Current.Annotations)
 		}
+	case *CancelDelayCommand:
+		args = append(args,
+			"cmd", "cancel_delay",
+			"id", cmd.StateCtx.Current.ID,
+			"rev", cmd.StateCtx.Current.Rev,
+		)
+		if !cmd.RescheduleAt.IsZero() {
+			args = append(args, "reschedule_at", cmd.RescheduleAt)
+		}
 	case *ExecuteCommand:
 		args = append(args,
 			"cmd", "execute",
@@ -96,6 +105,85 @@ func logCommand(msg string, execSessID int64, cmd0 Command, l *slog.Logger) {
 		if len(cmd.StateCtx.Current.Annotations) > 0 {
 			args = append(args, "ann", cmd.StateCtx.Current.Annotations)
 		}
+	case *CallCommand:
+		args = append(args,
+			"cmd", "call",
+			"id", cmd.StateCtx.Current.ID,
+			"rev", cmd.StateCtx.Current.Rev,
+			"child_id", cmd.ChildStateCtx.Current.ID,
+			"to", cmd.To,
+		)
+		if cmd.Resume != `` {
+			args = append(args, "resume", cmd.Resume)
+		}
+	case *ReturnCommand:
+		args = append(args,
+			"cmd", "return",
+			"id", cmd.StateCtx.Current.ID,
+			"rev", cmd.StateCtx.Current.Rev,
+		)
+		if len(cmd.Annotations) > 0 {
+			args = append(args, "ann", cmd.Annotations)
+		}
+	case *ForkCommand:
+		args = append(args,
+			"cmd", "fork",
+			"id", cmd.StateCtx.Current.ID,
+			"rev", cmd.StateCtx.Current.Rev,
+			"children", len(cmd.Children),
+			"to", cmd.To,
+		)
+		if cmd.Resume != `` {
+			args = append(args, "resume", cmd.Resume)
+		}
+	case *JoinCommand:
+		args = append(args,
+			"cmd", "join",
+			"id", cmd.StateCtx.Current.ID,
+			"rev", cmd.StateCtx.Current.Rev,
+			"to", cmd.To,
+		)
+	case *SignalCommand:
+		args = append(args,
+			"cmd", "signal",
+			"id", cmd.ID,
+			"name", cmd.Name,
+		)
+	case *WaitSignalCommand:
+		args = append(args,
+			"cmd", "wait_signal",
+			"id", cmd.StateCtx.Current.ID,
+			"rev", cmd.StateCtx.Current.Rev,
+			"name", cmd.Name,
+			"to", cmd.To,
+		)
+	case *AcquireCommand:
+		args = append(args,
+			"cmd", "acquire",
+			"id", cmd.StateCtx.Current.ID,
+			"rev", cmd.StateCtx.Current.Rev,
+			"name", cmd.Name,
+			"limit", cmd.Limit,
+			"to", cmd.To,
+		)
+	case *ReleaseCommand:
+		args = append(args,
+			"cmd", "release",
+			"id", cmd.StateCtx.Current.ID,
+			"rev", cmd.StateCtx.Current.Rev,
+			"name", cmd.Name,
+		)
+		if cmd.To != `` {
+			args = append(args, "to", cmd.To)
+		}
+	case *RateLimitCommand:
+		args = append(args,
+			"cmd", "rate_limit",
+			"id", cmd.StateCtx.Current.ID,
+			"rev", cmd.StateCtx.Current.Rev,
+			"name", cmd.Name,
+			"to", cmd.To,
+		)
 	case *NoopCommand:
 		args = append(args, "cmd", "noop")
 	case *StoreDataCommand:
@@ -148,6 +236,9 @@ func logCommand(msg string, execSessID int64, cmd0 Command, l *slog.Logger) {
 			"until", cmd.Until,
 			"offset", cmd.Offset,
 		)
+		if cmd.Shards > 1 {
+			args = append(args, "shard", cmd.Shard, "shards", cmd.Shards)
+		}
 	default:
 		args = append(args, "cmd", fmt.Sprintf("%T", cmd))
 	}
@@ -62,6 +62,13 @@ func (d *Driver) StoreData(cmd *flowstate.StoreDataCommand) error {
 }
 
 func (d *Driver) GetStateByID(cmd *flowstate.GetStateByIDCommand) error {
+	d.stateLog.Lock()
+	defer d.stateLog.Unlock()
+
+	return d.getStateByID(cmd)
+}
+
+func (d *Driver) getStateByID(cmd *flowstate.GetStateByIDCommand) error {
 	if cmd.Rev == 0 {
 		stateCtx, _ := d.stateLog.GetLatestByID(cmd.ID)
 		if stateCtx == nil {
@@ -81,6 +88,13 @@ func (d *Driver) GetStateByID(cmd *flowstate.GetStateByIDCommand) error {
 }
 
 func (d *Driver) GetStateByLabels(cmd *flowstate.GetStateByLabelsCommand) error {
+	d.stateLog.Lock()
+	defer d.stateLog.Unlock()
+
+	return d.getStateByLabels(cmd)
+}
+
+func (d *Driver) getStateByLabels(cmd *flowstate.GetStateByLabelsCommand) error {
 	stateCtx, _ := d.stateLog.GetLatestByLabels([]map[string]string{cmd.Labels})
 	if stateCtx == nil {
 		return fmt.Errorf("%w; labels=%v", flowstate.ErrNotFound, cmd.Labels)
@@ -159,8 +173,14 @@ func (d *Driver) Delay(cmd *flowstate.DelayCommand) error {
 	return nil
 }
 
+func (d *Driver) CancelDelay(cmd *flowstate.CancelDelayCommand) error {
+	cmd.Result = d.delayedStateLog.Cancel(cmd, time.Now())
+
+	return nil
+}
+
 func (d *Driver) GetDelayedStates(cmd *flowstate.GetDelayedStatesCommand) error {
-	delayedStates := d.delayedStateLog.Get(cmd.Since, cmd.Until, cmd.Offset, cmd.Limit+1)
+	delayedStates := d.delayedStateLog.Get(cmd.Since, cmd.Until, cmd.Offset, cmd.Limit+1, cmd.InShard)
 
 	more := false
 	if len(delayedStates) > cmd.Limit {
@@ -181,7 +201,7 @@ func (d *Driver) Commit(cmd *flowstate.CommitCommand) error {
 	defer d.stateLog.Rollback()
 
 	for _, subCmd0 := range cmd.Commands {
-		if err := flowstate.DoCommitSubCommand(d, subCmd0); err != nil {
+		if err := flowstate.DoCommitSubCommand(commitDriver{d}, subCmd0); err != nil {
 			return fmt.Errorf("%T: do: %w", subCmd0, err)
 		}
 
@@ -207,6 +227,19 @@ func (d *Driver) Commit(cmd *flowstate.CommitCommand) error {
 	return nil
 }
 
+// commitDriver reads states of sub commands while Commit holds the state log lock.
+type commitDriver struct {
+	*Driver
+}
+
+func (d commitDriver) GetStateByID(cmd *flowstate.GetStateByIDCommand) error {
+	return d.getStateByID(cmd)
+}
+
+func (d commitDriver) GetStateByLabels(cmd *flowstate.GetStateByLabelsCommand) error {
+	return d.getStateByLabels(cmd)
+}
+
 func filterStatesWithID(states []flowstate.State, id flowstate.StateID) []flowstate.State {
 	n := 0
 	for _, state := range states {
@@ -258,14 +291,10 @@ type stateLog struct {
 }
 
 func (l *stateLog) Append(stateCtx *flowstate.StateCtx) {
-	committedT, _ := l.GetLatestByID(stateCtx.Current.ID)
-	if committedT == nil {
-		committedT = &flowstate.StateCtx{}
-	}
-
-	stateCtx.CopyTo(committedT)
+	// CopyTo merges annotations and labels, copy into new states so removed ones do not survive in the next revision.
+	committedT := stateCtx.CopyTo(&flowstate.StateCtx{})
 	committedT.Current.CommittedAt = time.UnixMilli(time.Now().UnixMilli())
-	committedT.Current.CopyTo(&committedT.Committed)
+	committedT.Committed = committedT.Current.CopyTo(&flowstate.State{})
 	committedT.Transitions = committedT.Transitions[:0]
 
 	l.rev++
@@ -276,7 +305,7 @@ func (l *stateLog) Append(stateCtx *flowstate.StateCtx) {
 
 	// todo: find a better place for this
 	committedT.Committed.CopyTo(&stateCtx.Current)
-	committedT.Committed.CopyTo(&stateCtx.Committed)
+	stateCtx.Committed = committedT.Committed.CopyTo(&flowstate.State{})
 	stateCtx.Transitions = stateCtx.Transitions[:0]
 }
 
@@ -440,7 +469,51 @@ func (l *delayedStateLog) Append(delayedState flowstate.DelayedState) {
 	l.entries = append(l.entries, delayedState)
 }
 
-func (l *delayedStateLog) Get(since, until time.Time, offset int64, limit int) []flowstate.DelayedState {
+func (l *delayedStateLog) Cancel(cmd *flowstate.CancelDelayCommand, now time.Time) []flowstate.DelayedState {
+	l.Lock()
+	defer l.Unlock()
+
+	var cancelled []flowstate.DelayedState
+	entries := make([]flowstate.DelayedState, 0, len(l.entries))
+	for _, delayedState := range l.entries {
+		// delayed states already due are fired by the delayer, so they are neither cancelled nor reported
+		if _, tombstone := flowstate.DelayTombstone(delayedState); !tombstone && delayedState.State.ID == cmd.StateCtx.Current.ID && delayedState.ExecuteAt.After(now) {
+			cancelled = append(cancelled, delayedState)
+			continue
+		}
+
+		entries = append(entries, delayedState)
+	}
+	l.entries = entries
+
+	for _, delayedState := range cancelled {
+		l.offset++
+		tombstone := cmd.Tombstone(delayedState, now)
+		tombstone.Offset = l.offset
+		l.entries = append(l.entries, tombstone)
+	}
+
+	if cmd.RescheduleAt.IsZero() {
+		return cancelled
+	}
+
+	var rescheduled []flowstate.DelayedState
+	for _, delayedState := range cancelled {
+		nextDelayedState, ok := cmd.Rescheduled(delayedState, now)
+		if !ok {
+			continue
+		}
+
+		l.offset++
+		nextDelayedState.Offset = l.offset
+		l.entries = append(l.entries, nextDelayedState)
+		rescheduled = append(rescheduled, nextDelayedState)
+	}
+
+	return rescheduled
+}
+
+func (l *delayedStateLog) Get(since, until time.Time, offset int64, limit int, inShard func(id flowstate.StateID) bool) []flowstate.DelayedState {
 	l.Lock()
 	defer l.Unlock()
 
@@ -455,6 +528,9 @@ func (l *delayedStateLog) Get(since, until time.Time, offset int64, limit int) [
 		if delayedState.Offset <= offset {
 			continue
 		}
+		if !inShard(delayedState.State.ID) {
+			continue
+		}
 
 		result = append(result, delayedState)
 		if len(result) >= limit {
@@ -0,0 +1,293 @@
+package flowstate
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var DefaultDurationBuckets = []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+var DefaultLatenessBuckets = []float64{.1, .5, 1, 2.5, 5, 10, 30, 60, 300, 900}
+
+// Metrics is a minimal metrics registry exposed in the Prometheus text format.
+// It is created by NewEngine and shared by the engine, its cache driver, delayers and recoverers.
+type Metrics struct {
+	mux        sync.Mutex
+	vecs       map[string]*metricVec
+	collectors map[int64]func()
+	nextID     int64
+}
+
+func newMetrics() *Metrics {
+	return &Metrics{
+		vecs:       make(map[string]*metricVec),
+		collectors: make(map[int64]func()),
+	}
+}
+
+// ServeHTTP writes all metrics in the Prometheus text exposition format.
+func (m *Metrics) ServeHTTP(rw http.ResponseWriter, _ *http.Request) {
+	rw.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	rw.WriteHeader(http.StatusOK)
+	_ = m.Write(rw)
+}
+
+// Write writes all metrics in the Prometheus text exposition format.
+func (m *Metrics) Write(w io.Writer) error {
+	m.mux.Lock()
+	collectors := make([]func(), 0, len(m.collectors))
+	for _, collect := range m.collectors {
+		collectors = append(collectors, collect)
+	}
+	vecs := make([]*metricVec, 0, len(m.vecs))
+	for _, vec := range m.vecs {
+		vecs = append(vecs, vec)
+	}
+	m.mux.Unlock()
+
+	for _, collect := range collectors {
+		collect()
+	}
+
+	sort.Slice(vecs, func(i, j int) bool {
+		return vecs[i].name < vecs[j].name
+	})
+
+	bw := bufio.NewWriter(w)
+	for _, vec := range vecs {
+		vec.write(bw)
+	}
+
+	return bw.Flush()
+}
+
+func (m *Metrics) counter(name, help string, labelNames ...string) *metricVec {
+	return m.vec(name, help, `counter`, nil, labelNames)
+}
+
+func (m *Metrics) gauge(name, help string, labelNames ...string) *metricVec {
+	return m.vec(name, help, `gauge`, nil, labelNames)
+}
+
+func (m *Metrics) histogram(name, help string, buckets []float64, labelNames ...string) *metricVec {
+	return m.vec(name, help, `histogram`, buckets, labelNames)
+}
+
+func (m *Metrics) vec(name, help, kind string, buckets []float64, labelNames []string) *metricVec {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	if vec, ok := m.vecs[name]; ok {
+		return vec
+	}
+
+	vec := &metricVec{
+		name:       name,
+		help:       help,
+		kind:       kind,
+		buckets:    buckets,
+		labelNames: labelNames,
+		series:     make(map[string]*metricSeries),
+	}
+	m.vecs[name] = vec
+
+	return vec
+}
+
+// collect registers a function called before metrics are written.
+// It is used to refresh gauges computed from a component state.
+// The returned function unregisters the collector.
+func (m *Metrics) collect(fn func()) func() {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.nextID++
+	id := m.nextID
+	m.collectors[id] = fn
+
+	return func() {
+		m.mux.Lock()
+		defer m.mux.Unlock()
+
+		delete(m.collectors, id)
+	}
+}
+
+type metricVec struct {
+	name       string
+	help       string
+	kind       string
+	buckets    []float64
+	labelNames []string
+
+	mux    sync.Mutex
+	series map[string]*metricSeries
+}
+
+type metricSeries struct {
+	labelValues []string
+
+	value        float64
+	bucketCounts []uint64
+	sum          float64
+	count        uint64
+}
+
+// inc, add, set and observe are no-op on a nil vec so uninstrumented components can share the code.
+func (v *metricVec) inc(labelValues ...string) {
+	v.add(1, labelValues...)
+}
+
+func (v *metricVec) add(delta float64, labelValues ...string) {
+	if v == nil {
+		return
+	}
+
+	v.mux.Lock()
+	defer v.mux.Unlock()
+
+	v.seriesLocked(labelValues).value += delta
+}
+
+func (v *metricVec) set(value float64, labelValues ...string) {
+	if v == nil {
+		return
+	}
+
+	v.mux.Lock()
+	defer v.mux.Unlock()
+
+	v.seriesLocked(labelValues).value = value
+}
+
+// delete removes the series, it is used to drop gauges of a component once it is shut down.
+func (v *metricVec) delete(labelValues ...string) {
+	if v == nil {
+		return
+	}
+
+	v.mux.Lock()
+	defer v.mux.Unlock()
+
+	delete(v.series, strings.Join(labelValues, "\xff"))
+}
+
+func (v *metricVec) observe(value float64, labelValues ...string) {
+	if v == nil {
+		return
+	}
+
+	v.mux.Lock()
+	defer v.mux.Unlock()
+
+	s := v.seriesLocked(labelValues)
+	for i, bound := range v.buckets {
+		if value <= bound {
+			s.bucketCounts[i]++
+		}
+	}
+	s.sum += value
+	s.count++
+}
+
+func (v *metricVec) seriesLocked(labelValues []string) *metricSeries {
+	if len(labelValues) != len(v.labelNames) {
+		panic("BUG: metric " + v.name + " expects " + strconv.Itoa(len(v.labelNames)) + " label values")
+	}
+
+	key := strings.Join(labelValues, "\xff")
+	s, ok := v.series[key]
+	if !ok {
+		s = &metricSeries{
+			labelValues:  append([]string(nil), labelValues...),
+			bucketCounts: make([]uint64, len(v.buckets)),
+		}
+		v.series[key] = s
+	}
+
+	return s
+}
+
+func (v *metricVec) write(w *bufio.Writer) {
+	v.mux.Lock()
+	defer v.mux.Unlock()
+
+	if len(v.series) == 0 {
+		return
+	}
+
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	w.WriteString("# HELP " + v.name + " " + escapeMetricHelp(v.help) + "\n")
+	w.WriteString("# TYPE " + v.name + " " + v.kind + "\n")
+
+	for _, key := range keys {
+		s := v.series[key]
+
+		if v.kind != `histogram` {
+			w.WriteString(v.name + formatMetricLabels(v.labelNames, s.labelValues, ``, ``) + " " + formatMetricValue(s.value) + "\n")
+			continue
+		}
+
+		for i, bound := range v.buckets {
+			w.WriteString(v.name + "_bucket" + formatMetricLabels(v.labelNames, s.labelValues, `le`, formatMetricValue(bound)) + " " + strconv.FormatUint(s.bucketCounts[i], 10) + "\n")
+		}
+		w.WriteString(v.name + "_bucket" + formatMetricLabels(v.labelNames, s.labelValues, `le`, `+Inf`) + " " + strconv.FormatUint(s.count, 10) + "\n")
+		w.WriteString(v.name + "_sum" + formatMetricLabels(v.labelNames, s.labelValues, ``, ``) + " " + formatMetricValue(s.sum) + "\n")
+		w.WriteString(v.name + "_count" + formatMetricLabels(v.labelNames, s.labelValues, ``, ``) + " " + strconv.FormatUint(s.count, 10) + "\n")
+	}
+}
+
+func formatMetricLabels(names, values []string, extraName, extraValue string) string {
+	if len(names) == 0 && extraName == `` {
+		return ``
+	}
+
+	b := &strings.Builder{}
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name + `="` + escapeMetricLabelValue(values[i]) + `"`)
+	}
+	if extraName != `` {
+		if len(names) > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(extraName + `="` + extraValue + `"`)
+	}
+	b.WriteByte('}')
+
+	return b.String()
+}
+
+func formatMetricValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return `+Inf`
+	case math.IsInf(v, -1):
+		return `-Inf`
+	case math.IsNaN(v):
+		return `NaN`
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+func escapeMetricHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+func escapeMetricLabelValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(s)
+}
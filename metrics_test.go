@@ -0,0 +1,143 @@
+package flowstate
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+
+	"github.com/thejerf/slogassert"
+)
+
+func TestMetrics_Write(t *testing.T) {
+	f := func(setUp func(m *Metrics), exp string) {
+		t.Helper()
+
+		m := newMetrics()
+		setUp(m)
+
+		b := &bytes.Buffer{}
+		if err := m.Write(b); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if b.String() != exp {
+			t.Fatalf("expected metrics:\n%s\ngot:\n%s", exp, b.String())
+		}
+	}
+
+	// empty
+	f(func(m *Metrics) {}, ``)
+
+	// vec without series is not written
+	f(func(m *Metrics) {
+		m.counter(`a_total`, `A counter.`, `flow`)
+	}, ``)
+
+	// counter with labels
+	f(func(m *Metrics) {
+		c := m.counter(`a_total`, `A counter.`, `flow`, `result`)
+		c.inc(`foo`, `ok`)
+		c.inc(`foo`, `ok`)
+		c.add(3, `bar`, `error`)
+	}, `# HELP a_total A counter.
+# TYPE a_total counter
+a_total{flow="bar",result="error"} 3
+a_total{flow="foo",result="ok"} 2
+`)
+
+	// gauge without labels, escaped label values and sorted by name
+	f(func(m *Metrics) {
+		m.gauge(`b`, "A gauge\nwith two lines.").set(1.5)
+		m.gauge(`a`, `A gauge.`, `flow`).set(2, `fo"o\`)
+	}, `# HELP a A gauge.
+# TYPE a gauge
+a{flow="fo\"o\\"} 2
+# HELP b A gauge\nwith two lines.
+# TYPE b gauge
+b 1.5
+`)
+
+	// histogram
+	f(func(m *Metrics) {
+		h := m.histogram(`a_seconds`, `A histogram.`, []float64{.1, 1}, `flow`)
+		h.observe(.05, `foo`)
+		h.observe(.5, `foo`)
+		h.observe(5, `foo`)
+	}, `# HELP a_seconds A histogram.
+# TYPE a_seconds histogram
+a_seconds_bucket{flow="foo",le="0.1"} 1
+a_seconds_bucket{flow="foo",le="1"} 2
+a_seconds_bucket{flow="foo",le="+Inf"} 3
+a_seconds_sum{flow="foo"} 5.55
+a_seconds_count{flow="foo"} 3
+`)
+
+	// collector refreshes gauges before write
+	f(func(m *Metrics) {
+		g := m.gauge(`a`, `A gauge.`)
+		m.collect(func() {
+			g.set(42)
+		})
+	}, `# HELP a A gauge.
+# TYPE a gauge
+a 42
+`)
+
+	// unregistered collector is not called
+	f(func(m *Metrics) {
+		g := m.gauge(`a`, `A gauge.`)
+		unregister := m.collect(func() {
+			g.set(42)
+		})
+		unregister()
+	}, ``)
+
+	// deleted series is not written
+	f(func(m *Metrics) {
+		g := m.gauge(`a`, `A gauge.`, `queue`)
+		g.set(1, `foo`)
+		g.set(2, `bar`)
+		g.delete(`foo`)
+	}, `# HELP a A gauge.
+# TYPE a gauge
+a{queue="bar"} 2
+`)
+
+	// nil vec is no-op
+	f(func(m *Metrics) {
+		var c *metricVec
+		c.inc()
+		c.set(1)
+		c.observe(1)
+		c.delete()
+	}, ``)
+}
+
+func TestMetrics_CacheDriver(t *testing.T) {
+	l := slog.New(slogassert.New(t, slog.LevelDebug, nil))
+
+	d := newCacheDriver(nil, 10, l)
+	m := newMetrics()
+	d.instrument(m)
+
+	d.appendStateLocked(&State{ID: `s1`, Rev: 1})
+	if err := d.GetStateByID(&GetStateByIDCommand{ID: `s1`, Rev: 1, StateCtx: &StateCtx{}}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	b := &bytes.Buffer{}
+	if err := m.Write(b); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	exp := `# HELP flowstate_cache_head_rev The latest revision in the cache log.
+# TYPE flowstate_cache_head_rev gauge
+flowstate_cache_head_rev 1
+# HELP flowstate_cache_hits_total Number of reads served from the cache log.
+# TYPE flowstate_cache_hits_total counter
+flowstate_cache_hits_total{op="get_state_by_id"} 1
+`
+	if b.String() != exp {
+		t.Fatalf("expected metrics:\n%s\ngot:\n%s", exp, b.String())
+	}
+}
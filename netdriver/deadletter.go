@@ -0,0 +1,160 @@
+package netdriver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/makasim/flowstate"
+)
+
+// defaultDeadLettersLimit is used when a list request has no limit.
+const defaultDeadLettersLimit = 100
+
+type jsonDeadLettersRequest struct {
+	ID       string `json:"id,omitempty"`
+	SinceRev string `json:"sinceRev,omitempty"`
+	Limit    int    `json:"limit,omitempty"`
+}
+
+type jsonDeadLettersResponse struct {
+	State  json.RawMessage   `json:"state,omitempty"`
+	States []json.RawMessage `json:"states,omitempty"`
+	More   bool              `json:"more,omitempty"`
+}
+
+// HandleDeadLetters serves the dead letter operations for the UI, see flowstate.GetDeadLetters.
+// Requests and responses are JSON only.
+func HandleDeadLetters(rw http.ResponseWriter, r *http.Request, d flowstate.Driver, l *slog.Logger) bool {
+	var op string
+	switch r.URL.Path {
+	case "/flowstate.v1.DeadLetters/List":
+		op = "list"
+	case "/flowstate.v1.DeadLetters/Get":
+		op = "get"
+	case "/flowstate.v1.DeadLetters/Retry":
+		op = "retry"
+	case "/flowstate.v1.DeadLetters/Discard":
+		op = "discard"
+	default:
+		return false
+	}
+
+	req, err := readDeadLettersRequest(r)
+	if err != nil {
+		writeInvalidArgumentError(rw, err.Error(), false)
+		return true
+	}
+
+	if op == "list" {
+		sinceRev, err := parseSinceRev(req.SinceRev)
+		if err != nil {
+			writeInvalidArgumentError(rw, err.Error(), false)
+			return true
+		}
+		limit := req.Limit
+		if limit <= 0 {
+			limit = defaultDeadLettersLimit
+		}
+
+		states, more, err := flowstate.GetDeadLetters(d, sinceRev, limit)
+		if err != nil {
+			writeUnknownError(rw, err.Error(), false)
+			return true
+		}
+
+		res := jsonDeadLettersResponse{
+			States: make([]json.RawMessage, 0, len(states)),
+			More:   more,
+		}
+		for _, state := range states {
+			b, err := flowstate.MarshalJSONState(state)
+			if err != nil {
+				writeUnknownError(rw, err.Error(), false)
+				return true
+			}
+			res.States = append(res.States, b)
+		}
+
+		writeDeadLettersResponse(rw, res)
+		return true
+	}
+
+	if req.ID == "" {
+		writeInvalidArgumentError(rw, "id empty", false)
+		return true
+	}
+
+	var state flowstate.State
+	switch op {
+	case "get":
+		state, err = flowstate.GetDeadLetter(d, flowstate.StateID(req.ID))
+	case "retry":
+		l.Info("netdriver: retry dead letter", "id", req.ID)
+		state, err = flowstate.RetryDeadLetter(d, flowstate.StateID(req.ID))
+	case "discard":
+		l.Info("netdriver: discard dead letter", "id", req.ID)
+		state, err = flowstate.DiscardDeadLetter(d, flowstate.StateID(req.ID))
+	}
+	if errors.Is(err, flowstate.ErrNotFound) {
+		writeNotFoundError(rw, err.Error(), false)
+		return true
+	} else if flowstate.IsErrRevMismatch(err) {
+		writeAbortedError(rw, err.Error(), false)
+		return true
+	} else if err != nil {
+		writeUnknownError(rw, err.Error(), false)
+		return true
+	}
+
+	b, err := flowstate.MarshalJSONState(state)
+	if err != nil {
+		writeUnknownError(rw, err.Error(), false)
+		return true
+	}
+
+	writeDeadLettersResponse(rw, jsonDeadLettersResponse{State: b})
+	return true
+}
+
+func readDeadLettersRequest(r *http.Request) (jsonDeadLettersRequest, error) {
+	var req jsonDeadLettersRequest
+
+	reqBody, err := io.ReadAll(r.Body)
+	if err != nil {
+		return req, fmt.Errorf("failed to read request body: %w", err)
+	}
+	if len(reqBody) == 0 {
+		return req, nil
+	}
+	if err := json.Unmarshal(reqBody, &req); err != nil {
+		return req, fmt.Errorf("failed to unmarshal JSON request: %w", err)
+	}
+
+	return req, nil
+}
+
+func parseSinceRev(sinceRev string) (int64, error) {
+	if sinceRev == "" {
+		return 0, nil
+	}
+
+	rev, err := strconv.ParseInt(sinceRev, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse since rev: %w", err)
+	}
+
+	return rev, nil
+}
+
+func writeDeadLettersResponse(rw http.ResponseWriter, res jsonDeadLettersResponse) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusOK)
+
+	b, _ := json.Marshal(res)
+	_, _ = rw.Write(b)
+}
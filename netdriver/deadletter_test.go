@@ -0,0 +1,126 @@
+package netdriver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/makasim/flowstate"
+	"github.com/makasim/flowstate/memdriver"
+)
+
+func TestHandleDeadLetters(t *testing.T) {
+	l := slog.New(slog.NewTextHandler(io.Discard, nil))
+	d := memdriver.New(l)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if HandleAll(rw, r, d, l) {
+			return
+		}
+
+		writeNotFoundError(rw, "not found", false)
+	}))
+	defer srv.Close()
+
+	for _, id := range []flowstate.StateID{`aTID`, `anotherTID`} {
+		stateCtx := &flowstate.StateCtx{
+			Current: flowstate.State{
+				ID: id,
+			},
+		}
+		stateCtx.Current.SetLabel(flowstate.DeadLetterLabel, `true`)
+		if err := d.Commit(flowstate.Commit(flowstate.Park(stateCtx).
+			WithAnnotation(flowstate.DeadLetterReasonAnnotation, `max recovery attempts 3 reached`).
+			WithAnnotation(flowstate.DeadLetterFromAnnotation, `aFlow`),
+		)); err != nil {
+			t.Fatalf("failed to commit: %v", err)
+		}
+	}
+
+	do := func(path, body string, expStatus int) jsonDeadLettersResponse {
+		t.Helper()
+
+		resp, err := http.Post(srv.URL+path, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("failed to post: %v", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != expStatus {
+			b, _ := io.ReadAll(resp.Body)
+			t.Fatalf("expected status %d, got %d: %s", expStatus, resp.StatusCode, b)
+		}
+
+		var res jsonDeadLettersResponse
+		if expStatus == http.StatusOK {
+			if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+		}
+
+		return res
+	}
+
+	unmarshalState := func(b json.RawMessage) flowstate.State {
+		t.Helper()
+
+		var state flowstate.State
+		if err := flowstate.UnmarshalJSONState(b, &state); err != nil {
+			t.Fatalf("failed to unmarshal state: %v", err)
+		}
+		return state
+	}
+
+	res := do(`/flowstate.v1.DeadLetters/List`, `{"limit":1}`, http.StatusOK)
+	if len(res.States) != 1 || !res.More {
+		t.Fatalf("expected one state and more, got %d states, more %v", len(res.States), res.More)
+	}
+	firstState := unmarshalState(res.States[0])
+	if firstState.ID != `aTID` {
+		t.Fatalf("expected aTID, got %s", firstState.ID)
+	}
+
+	// the next page starts after the rev of the last listed state
+	res = do(`/flowstate.v1.DeadLetters/List`, fmt.Sprintf(`{"sinceRev":"%d","limit":1}`, firstState.Rev), http.StatusOK)
+	if len(res.States) != 1 || res.More {
+		t.Fatalf("expected one state and no more, got %d states, more %v", len(res.States), res.More)
+	}
+	if state := unmarshalState(res.States[0]); state.ID != `anotherTID` {
+		t.Fatalf("expected anotherTID, got %s", state.ID)
+	}
+	do(`/flowstate.v1.DeadLetters/List`, `{"sinceRev":"notARev"}`, http.StatusBadRequest)
+
+	res = do(`/flowstate.v1.DeadLetters/Get`, `{"id":"aTID"}`, http.StatusOK)
+	state := unmarshalState(res.State)
+	if reason := state.Transition.Annotations[flowstate.DeadLetterReasonAnnotation]; reason != `max recovery attempts 3 reached` {
+		t.Fatalf("unexpected reason: %s", reason)
+	}
+
+	res = do(`/flowstate.v1.DeadLetters/Discard`, `{"id":"aTID"}`, http.StatusOK)
+	if state := unmarshalState(res.State); flowstate.DeadLettered(state) || state.Labels[flowstate.DeadLetterLabel] != `` {
+		t.Fatalf("expected discarded state not dead-lettered and its label removed")
+	}
+	do(`/flowstate.v1.DeadLetters/Get`, `{"id":"aTID"}`, http.StatusNotFound)
+	do(`/flowstate.v1.DeadLetters/Discard`, `{"id":"aTID"}`, http.StatusNotFound)
+	do(`/flowstate.v1.DeadLetters/Retry`, `{"id":"unknownTID"}`, http.StatusNotFound)
+
+	res = do(`/flowstate.v1.DeadLetters/Retry`, `{"id":"anotherTID"}`, http.StatusOK)
+	if state := unmarshalState(res.State); state.Transition.To != `aFlow` {
+		t.Fatalf("expected retried state transited to aFlow, got %s", state.Transition.To)
+	}
+	if state := unmarshalState(res.State); state.Labels[flowstate.DeadLetterLabel] != `` {
+		t.Fatalf("expected retried state dead letter label removed")
+	}
+
+	res = do(`/flowstate.v1.DeadLetters/List`, ``, http.StatusOK)
+	if len(res.States) != 0 || res.More {
+		t.Fatalf("expected no dead letters, got %d", len(res.States))
+	}
+
+	do(`/flowstate.v1.DeadLetters/Retry`, `{}`, http.StatusBadRequest)
+}
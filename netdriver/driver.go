@@ -50,6 +50,10 @@ func (d *Driver) Delay(cmd *flowstate.DelayCommand) error {
 	return d.do(cmd, "/flowstate.v1.Driver/Delay")
 }
 
+func (d *Driver) CancelDelay(cmd *flowstate.CancelDelayCommand) error {
+	return d.do(cmd, "/flowstate.v1.Driver/CancelDelay")
+}
+
 func (d *Driver) Commit(cmd *flowstate.CommitCommand) error {
 	return d.do(cmd, "/flowstate.v1.Driver/Commit")
 }
@@ -120,6 +124,14 @@ func (d *Driver) do(cmd flowstate.Command, path string) error {
 	return nil
 }
 
+// syncStateCtx replaces the in states with the states returned by the server.
+// CopyTo merges annotations and labels, so the in states are reset first to drop the ones removed on the server.
+func syncStateCtx(resStateCtx, inStateCtx *flowstate.StateCtx) {
+	inStateCtx.Current = flowstate.State{}
+	inStateCtx.Committed = flowstate.State{}
+	resStateCtx.CopyTo(inStateCtx)
+}
+
 func syncResult(inCmd0, resCmd0 flowstate.Command) error {
 	switch inCmd := inCmd0.(type) {
 	case *flowstate.TransitCommand:
@@ -128,7 +140,7 @@ func syncResult(inCmd0, resCmd0 flowstate.Command) error {
 			return fmt.Errorf("resCmd is not a TransitCommand")
 		}
 
-		resCmd.StateCtx.CopyTo(inCmd.StateCtx)
+		syncStateCtx(resCmd.StateCtx, inCmd.StateCtx)
 		return nil
 	case *flowstate.ParkCommand:
 		resCmd, ok := resCmd0.(*flowstate.ParkCommand)
@@ -136,7 +148,7 @@ func syncResult(inCmd0, resCmd0 flowstate.Command) error {
 			return fmt.Errorf("resCmd is not a ParkCommand")
 		}
 
-		resCmd.StateCtx.CopyTo(inCmd.StateCtx)
+		syncStateCtx(resCmd.StateCtx, inCmd.StateCtx)
 		return nil
 	case *flowstate.ExecuteCommand:
 		resCmd, ok := resCmd0.(*flowstate.ExecuteCommand)
@@ -144,7 +156,7 @@ func syncResult(inCmd0, resCmd0 flowstate.Command) error {
 			return fmt.Errorf("resCmd is not a ExecuteCommand")
 		}
 
-		resCmd.StateCtx.CopyTo(inCmd.StateCtx)
+		syncStateCtx(resCmd.StateCtx, inCmd.StateCtx)
 		return nil
 	case *flowstate.DelayCommand:
 		resCmd, ok := resCmd0.(*flowstate.DelayCommand)
@@ -152,9 +164,17 @@ func syncResult(inCmd0, resCmd0 flowstate.Command) error {
 			return fmt.Errorf("resCmd is not a DelayCommand")
 		}
 
-		resCmd.StateCtx.CopyTo(inCmd.StateCtx)
+		syncStateCtx(resCmd.StateCtx, inCmd.StateCtx)
 		resCmd.Result = inCmd.Result
 		return nil
+	case *flowstate.CancelDelayCommand:
+		resCmd, ok := resCmd0.(*flowstate.CancelDelayCommand)
+		if !ok {
+			return fmt.Errorf("resCmd is not a CancelDelayCommand")
+		}
+
+		inCmd.Result = resCmd.Result
+		return nil
 	case *flowstate.CommitCommand:
 		resCmd, ok := resCmd0.(*flowstate.CommitCommand)
 		if !ok {
@@ -182,8 +202,8 @@ func syncResult(inCmd0, resCmd0 flowstate.Command) error {
 			return fmt.Errorf("resCmd is not a StackCommand")
 		}
 
-		resCmd.CarrierStateCtx.CopyTo(inCmd.CarrierStateCtx)
-		resCmd.StackedStateCtx.CopyTo(inCmd.StackedStateCtx)
+		syncStateCtx(resCmd.CarrierStateCtx, inCmd.CarrierStateCtx)
+		syncStateCtx(resCmd.StackedStateCtx, inCmd.StackedStateCtx)
 		return nil
 	case *flowstate.UnstackCommand:
 		resCmd, ok := resCmd0.(*flowstate.UnstackCommand)
@@ -191,8 +211,8 @@ func syncResult(inCmd0, resCmd0 flowstate.Command) error {
 			return fmt.Errorf("resCmd is not a UnstackCommand")
 		}
 
-		resCmd.CarrierStateCtx.CopyTo(inCmd.CarrierStateCtx)
-		resCmd.UnstackStateCtx.CopyTo(inCmd.UnstackStateCtx)
+		syncStateCtx(resCmd.CarrierStateCtx, inCmd.CarrierStateCtx)
+		syncStateCtx(resCmd.UnstackStateCtx, inCmd.UnstackStateCtx)
 		return nil
 	case *flowstate.GetDataCommand:
 		resCmd, ok := resCmd0.(*flowstate.GetDataCommand)
@@ -200,7 +220,7 @@ func syncResult(inCmd0, resCmd0 flowstate.Command) error {
 			return fmt.Errorf("resCmd is not a GetDataCommand")
 		}
 
-		resCmd.StateCtx.CopyTo(inCmd.StateCtx)
+		syncStateCtx(resCmd.StateCtx, inCmd.StateCtx)
 		resCmd.Alias = inCmd.Alias
 
 		for n, resD := range resCmd.StateCtx.Datas {
@@ -215,7 +235,7 @@ func syncResult(inCmd0, resCmd0 flowstate.Command) error {
 			return fmt.Errorf("resCmd is not a StoreDataCommand")
 		}
 
-		resCmd.StateCtx.CopyTo(inCmd.StateCtx)
+		syncStateCtx(resCmd.StateCtx, inCmd.StateCtx)
 		resCmd.Alias = inCmd.Alias
 
 		for n, resD := range resCmd.StateCtx.Datas {
@@ -230,7 +250,7 @@ func syncResult(inCmd0, resCmd0 flowstate.Command) error {
 			return fmt.Errorf("resCmd is not a GetStateByIDCommand")
 		}
 
-		resCmd.StateCtx.CopyTo(inCmd.StateCtx)
+		syncStateCtx(resCmd.StateCtx, inCmd.StateCtx)
 		return nil
 	case *flowstate.GetStateByLabelsCommand:
 		resCmd, ok := resCmd0.(*flowstate.GetStateByLabelsCommand)
@@ -238,7 +258,7 @@ func syncResult(inCmd0, resCmd0 flowstate.Command) error {
 			return fmt.Errorf("resCmd is not a GetStateByLabelsCommand")
 		}
 
-		resCmd.StateCtx.CopyTo(inCmd.StateCtx)
+		syncStateCtx(resCmd.StateCtx, inCmd.StateCtx)
 		return nil
 	case *flowstate.GetStatesCommand:
 		resCmd, ok := resCmd0.(*flowstate.GetStatesCommand)
@@ -32,12 +32,18 @@ func HandleAll(rw http.ResponseWriter, r *http.Request, d flowstate.Driver, l *s
 	if HandleDelay(rw, r, d, l) {
 		return true
 	}
+	if HandleCancelDelay(rw, r, d, l) {
+		return true
+	}
 	if HandleGetData(rw, r, d, l) {
 		return true
 	}
 	if HandleStoreData(rw, r, d, l) {
 		return true
 	}
+	if HandleDeadLetters(rw, r, d, l) {
+		return true
+	}
 
 	return false
 }
@@ -177,6 +183,34 @@ func HandleDelay(rw http.ResponseWriter, r *http.Request, d flowstate.Driver, l
 	return true
 }
 
+func HandleCancelDelay(rw http.ResponseWriter, r *http.Request, d flowstate.Driver, l *slog.Logger) bool {
+	if r.URL.Path != "/flowstate.v1.Driver/CancelDelay" {
+		return false
+	}
+
+	proto := r.Header.Get("Content-Type") != "application/json"
+
+	cmd, err := readCmd[*flowstate.CancelDelayCommand](r)
+	if err != nil {
+		writeInvalidArgumentError(rw, err.Error(), proto)
+		return true
+	}
+
+	if err := cmd.Prepare(); err != nil {
+		writeInvalidArgumentError(rw, err.Error(), proto)
+		return true
+	}
+
+	flowstate.LogCommand("netdriver", cmd, l)
+	if err := d.CancelDelay(cmd); err != nil {
+		writeUnknownError(rw, err.Error(), proto)
+		return true
+	}
+
+	writeCmd(rw, cmd, proto)
+	return true
+}
+
 func HandleCommit(rw http.ResponseWriter, r *http.Request, d flowstate.Driver, l *slog.Logger) bool {
 	if r.URL.Path != "/flowstate.v1.Driver/Commit" {
 		return false
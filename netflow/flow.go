@@ -30,7 +30,7 @@ func New(httpHost string) *Flow {
 
 func (f *Flow) Execute(stateCtx *flowstate.StateCtx, _ *flowstate.Engine) (flowstate.Command, error) {
 	b := flowstate.MarshalStateCtx(stateCtx, nil)
-	req, err := http.NewRequest(`POST`, strings.TrimRight(f.httpHost, `/`)+`/flowstate.v1.Flow/Execute`, bytes.NewBuffer(b))
+	req, err := http.NewRequestWithContext(stateCtx, `POST`, strings.TrimRight(f.httpHost, `/`)+`/flowstate.v1.Flow/Execute`, bytes.NewBuffer(b))
 	if err != nil {
 		return nil, fmt.Errorf("new request: %w", err)
 	}
@@ -0,0 +1,45 @@
+package pgdriver
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/makasim/flowstate"
+)
+
+// DeleteDelayedStates deletes delayed states of the state which are not due at now yet, tombstones are never deleted.
+func (*queries) DeleteDelayedStates(ctx context.Context, tx conntx, id flowstate.StateID, now time.Time) ([]flowstate.DelayedState, error) {
+	if id == "" {
+		return nil, fmt.Errorf("id is empty")
+	}
+
+	rows, err := tx.Query(
+		ctx,
+		`DELETE FROM flowstate_delayed_states WHERE state->>'id' = $1 AND NOT coalesce(state->'transition'->'annotations' ? $2, false) AND execute_at > $3 RETURNING execute_at, state, pos`,
+		string(id),
+		flowstate.DelayCancelledAnnotation,
+		now.Unix(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []flowstate.DelayedState
+	for rows.Next() {
+		var ds flowstate.DelayedState
+		var executeAt int64
+		if err := rows.Scan(&executeAt, &ds.State, &ds.Offset); err != nil {
+			return nil, err
+		}
+		ds.ExecuteAt = time.Unix(executeAt, 0)
+
+		res = append(res, ds)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	return res, nil
+}
@@ -110,15 +110,68 @@ func (d *Driver) GetStates(cmd *flowstate.GetStatesCommand) error {
 }
 
 func (d *Driver) Delay(cmd *flowstate.DelayCommand) error {
-	if err := d.q.InsertDelayedState(context.Background(), d.conn, cmd.Result.State, cmd.ExecuteAt); err != nil {
+	if _, err := d.q.InsertDelayedState(context.Background(), d.conn, cmd.Result.State, cmd.ExecuteAt); err != nil {
 		return fmt.Errorf("insert delayed state query: %w", err)
 	}
 
 	return nil
 }
 
+func (d *Driver) CancelDelay(cmd *flowstate.CancelDelayCommand) error {
+	tx, err := d.conn.BeginTx(context.Background(), pgx.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("conn: begin: %w", err)
+	}
+	defer tx.Rollback(context.Background())
+
+	now := time.Now()
+	cancelled, err := d.q.DeleteDelayedStates(context.Background(), tx, cmd.StateCtx.Current.ID, now)
+	if err != nil {
+		return fmt.Errorf("delete delayed states query: %w", err)
+	}
+
+	for _, ds := range cancelled {
+		tombstone := cmd.Tombstone(ds, now)
+		if _, err := d.q.InsertDelayedState(context.Background(), tx, tombstone.State, tombstone.ExecuteAt); err != nil {
+			return fmt.Errorf("insert delayed state tombstone query: %w", err)
+		}
+	}
+
+	if cmd.RescheduleAt.IsZero() {
+		if err := tx.Commit(context.Background()); err != nil {
+			return fmt.Errorf("tx: commit: %w", err)
+		}
+
+		cmd.Result = cancelled
+		return nil
+	}
+
+	var rescheduled []flowstate.DelayedState
+	for _, ds := range cancelled {
+		nextDS, ok := cmd.Rescheduled(ds, now)
+		if !ok {
+			continue
+		}
+
+		offset, err := d.q.InsertDelayedState(context.Background(), tx, nextDS.State, nextDS.ExecuteAt)
+		if err != nil {
+			return fmt.Errorf("insert delayed state query: %w", err)
+		}
+		nextDS.Offset = offset
+
+		rescheduled = append(rescheduled, nextDS)
+	}
+
+	if err := tx.Commit(context.Background()); err != nil {
+		return fmt.Errorf("tx: commit: %w", err)
+	}
+
+	cmd.Result = rescheduled
+	return nil
+}
+
 func (d *Driver) GetDelayedStates(cmd *flowstate.GetDelayedStatesCommand) error {
-	ds, err := d.q.GetDelayedStates(context.Background(), d.conn, cmd.Since.Unix(), cmd.Until.Unix(), cmd.Offset, cmd.Limit+1)
+	ds, err := d.q.GetDelayedStates(context.Background(), d.conn, cmd.Since.Unix(), cmd.Until.Unix(), cmd.Offset, cmd.Shard, cmd.Shards, cmd.Limit+1)
 	if err != nil {
 		return fmt.Errorf("get delayed states query: %w", err)
 	}
@@ -175,7 +228,7 @@ func (d *Driver) Commit(cmd *flowstate.CommitCommand) error {
 			}
 		}
 
-		nextState.CopyTo(&committableStateCtx.Committed)
+		committableStateCtx.Committed = nextState.CopyTo(&flowstate.State{})
 		nextState.CopyTo(&committableStateCtx.Current)
 		committableStateCtx.Transitions = committableStateCtx.Transitions[:0]
 	}
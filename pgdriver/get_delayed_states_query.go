@@ -8,7 +8,7 @@ import (
 	"github.com/makasim/flowstate"
 )
 
-func (*queries) GetDelayedStates(ctx context.Context, tx conntx, since, until, offset int64, limit int) ([]flowstate.DelayedState, error) {
+func (*queries) GetDelayedStates(ctx context.Context, tx conntx, since, until, offset int64, shard, shards, limit int) ([]flowstate.DelayedState, error) {
 	if since == 0 {
 		return nil, fmt.Errorf("since is empty")
 	}
@@ -28,6 +28,7 @@ FROM
 		SELECT xmin::text::bigint, execute_at, state, pos 
 		FROM flowstate_delayed_states 
 		WHERE execute_at > $1 AND execute_at <= $2 AND pos > $3
+			AND ($5::bigint <= 1 OR id_hash IS NULL OR mod(id_hash::numeric + CASE WHEN id_hash < 0 THEN 18446744073709551616 ELSE 0 END, $5::bigint) = $6::bigint)
 		ORDER BY execute_at, pos ASC 
 		LIMIT $4
 	) AS subquery
@@ -41,6 +42,8 @@ WHERE subquery.xmin < snapshot.xmin OR subquery.xmin > snapshot.xmax`,
 		until,
 		offset,
 		limit,
+		shards,
+		shard,
 	)
 	if err != nil {
 		return nil, err
@@ -5,29 +5,29 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/cespare/xxhash/v2"
 	"github.com/makasim/flowstate"
 )
 
-func (*queries) InsertDelayedState(ctx context.Context, tx conntx, s flowstate.State, executeAt time.Time) error {
+// InsertDelayedState appends the delayed state to the delayed log and returns its offset.
+func (*queries) InsertDelayedState(ctx context.Context, tx conntx, s flowstate.State, executeAt time.Time) (int64, error) {
 	if s.ID == "" {
-		return fmt.Errorf("id is empty")
+		return 0, fmt.Errorf("id is empty")
 	}
 	if executeAt.IsZero() {
-		return fmt.Errorf("execute at is zero")
+		return 0, fmt.Errorf("execute at is zero")
 	}
 
-	res, err := tx.Exec(
+	var offset int64
+	if err := tx.QueryRow(
 		ctx,
-		`INSERT INTO flowstate_delayed_states(execute_at, state, pos) VALUES($1, $2, nextval('flowstate_delayed_states_pos'))`,
+		`INSERT INTO flowstate_delayed_states(execute_at, state, pos, id_hash) VALUES($1, $2, nextval('flowstate_delayed_states_pos'), $3) RETURNING pos`,
 		executeAt.Unix(),
 		s,
-	)
-	if err != nil {
-		return fmt.Errorf("db: insert delay log: %w", err)
-	}
-	if res.RowsAffected() == 0 {
-		return fmt.Errorf("no rows affected")
+		int64(xxhash.Sum64String(string(s.ID))),
+	).Scan(&offset); err != nil {
+		return 0, fmt.Errorf("db: insert delay log: %w", err)
 	}
 
-	return nil
+	return offset, nil
 }
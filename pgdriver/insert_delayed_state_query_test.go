@@ -30,7 +30,7 @@ func TestQuery_InsertDelayedState(main *testing.T) {
 		q := &queries{}
 
 		s := flowstate.State{ID: ``}
-		err := q.InsertDelayedState(context.Background(), conn, s, time.Now())
+		_, err := q.InsertDelayedState(context.Background(), conn, s, time.Now())
 		require.EqualError(t, err, `id is empty`)
 	})
 
@@ -40,7 +40,7 @@ func TestQuery_InsertDelayedState(main *testing.T) {
 		q := &queries{}
 
 		s := flowstate.State{ID: ``}
-		err := q.InsertDelayedState(context.Background(), conn, s, time.Time{})
+		_, err := q.InsertDelayedState(context.Background(), conn, s, time.Time{})
 		require.EqualError(t, err, `id is empty`)
 	})
 
@@ -52,8 +52,9 @@ func TestQuery_InsertDelayedState(main *testing.T) {
 		execAt := time.Unix(1234567, 0)
 
 		s := flowstate.State{ID: `anID`}
-		err := q.InsertDelayedState(context.Background(), conn, s, execAt)
+		offset, err := q.InsertDelayedState(context.Background(), conn, s, execAt)
 		require.NoError(t, err)
+		require.Equal(t, int64(1), offset)
 
 		require.Equal(t, []testpgdriver.DelayedStateRow{
 			{
@@ -78,8 +79,9 @@ func TestQuery_InsertDelayedState(main *testing.T) {
 		execAt := time.Unix(1234567, 0)
 
 		s := flowstate.State{ID: `anID`}
-		err = q.InsertDelayedState(context.Background(), tx, s, execAt)
+		offset, err := q.InsertDelayedState(context.Background(), tx, s, execAt)
 		require.NoError(t, err)
+		require.Equal(t, int64(1), offset)
 
 		require.NoError(t, tx.Commit(context.Background()))
 
@@ -102,14 +104,16 @@ func TestQuery_InsertDelayedState(main *testing.T) {
 		execAt0 := time.Unix(12345, 0)
 
 		s0 := flowstate.State{ID: `aFooID`}
-		err := q.InsertDelayedState(context.Background(), conn, s0, execAt0)
+		offset, err := q.InsertDelayedState(context.Background(), conn, s0, execAt0)
 		require.NoError(t, err)
+		require.Equal(t, int64(1), offset)
 
 		execAt1 := time.Unix(23456, 0)
 
 		s1 := flowstate.State{ID: `aBarID`}
-		err = q.InsertDelayedState(context.Background(), conn, s1, execAt1)
+		offset, err = q.InsertDelayedState(context.Background(), conn, s1, execAt1)
 		require.NoError(t, err)
+		require.Equal(t, int64(2), offset)
 
 		require.Equal(t, []testpgdriver.DelayedStateRow{
 			{
@@ -129,3 +133,12 @@ func TestQuery_InsertDelayedState(main *testing.T) {
 		}, testpgdriver.FindAllDelayedStates(t, conn))
 	})
 }
+
+func insertTestDelayedState(t *testing.T, tx conntx, s flowstate.State, executeAt time.Time) int64 {
+	t.Helper()
+
+	offset, err := (&queries{}).InsertDelayedState(context.Background(), tx, s, executeAt)
+	require.NoError(t, err)
+
+	return offset
+}
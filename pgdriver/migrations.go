@@ -66,6 +66,18 @@ UPDATE flowstate_delayed_states SET pos = nextval('flowstate_delayed_states_pos'
 DROP INDEX IF EXISTS flowstate_delayed_states_execute_at;
 
 CREATE UNIQUE INDEX IF NOT EXISTS flowstate_delayed_states_execute_at_pos ON flowstate_delayed_states(execute_at,pos);
+`,
+	},
+	{
+		Desc: "add state id index to flowstate_delayed_states table",
+		SQL: `
+CREATE INDEX IF NOT EXISTS flowstate_delayed_states_state_id ON flowstate_delayed_states((state->>'id'));
+`,
+	},
+	{
+		Desc: "add state id hash to flowstate_delayed_states table, used to filter delayed states by shard",
+		SQL: `
+ALTER TABLE flowstate_delayed_states ADD COLUMN IF NOT EXISTS id_hash BIGINT;
 `,
 	},
 }
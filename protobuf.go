@@ -491,6 +491,8 @@ func MarshalCommand(cmd Command, dst []byte) []byte {
 //
 //	 StoreDataCommand store_data = 21;
 //	 GetDataCommand get_data = 22;
+//
+//	 CancelDelayCommand cancel_delay = 23;
 //	}
 func marshalCommand(cmd0 Command, stateCtxs stateCtxs, mm *easyproto.MessageMarshaler) {
 	switch cmd := cmd0.(type) {
@@ -565,6 +567,26 @@ func marshalCommand(cmd0 Command, stateCtxs stateCtxs, mm *easyproto.MessageMars
 		if cmd.Annotations != nil {
 			marshalStringMap(cmd.Annotations, 6, cmdMM)
 		}
+	case *CancelDelayCommand:
+		// message CancelDelayCommand {
+		//  StateCtxRef state_ref = 1;
+		//  // Reschedule delayed states to the time instead of cancelling, optional
+		//  int64 reschedule_at_sec = 2;
+		//
+		//  // Cancelled or rescheduled delayed states
+		//  repeated DelayedState result = 3;
+		// }
+
+		cmdMM := mm.AppendMessage(23)
+		if cmd.StateCtx != nil {
+			marshalStateCtxRef(cmd.StateCtx, stateCtxs, cmdMM.AppendMessage(1))
+		}
+		if !cmd.RescheduleAt.IsZero() {
+			cmdMM.AppendInt64(2, cmd.RescheduleAt.Unix())
+		}
+		for _, delayedState := range cmd.Result {
+			marshalDelayedState(delayedState, cmdMM.AppendMessage(3))
+		}
 	case *CommitCommand:
 		// message CommitCommand {
 		//  repeated Command commands = 1;
@@ -722,6 +744,9 @@ func marshalCommand(cmd0 Command, stateCtxs stateCtxs, mm *easyproto.MessageMars
 		//  int64 limit = 4;
 		//
 		//  Result result = 5;
+		//
+		//  int64 shard = 6;
+		//  int64 shards = 7;
 		// }
 		cmdMM := mm.AppendMessage(20)
 		if !cmd.Since.IsZero() {
@@ -746,6 +771,13 @@ func marshalCommand(cmd0 Command, stateCtxs stateCtxs, mm *easyproto.MessageMars
 				resultMM.AppendBool(2, true)
 			}
 		}
+
+		if cmd.Shard != 0 {
+			cmdMM.AppendInt64(6, int64(cmd.Shard))
+		}
+		if cmd.Shards != 0 {
+			cmdMM.AppendInt64(7, int64(cmd.Shards))
+		}
 	default:
 		// TODO: return an error on unknown command ??
 		// TODO: return an error if no command specified ??
@@ -946,6 +978,18 @@ func unmarshalCommand(src []byte, stateCtxs stateCtxs) (Command, error) {
 				return nil, fmt.Errorf("cannot read 'GetDataCommand get_data = 22;' field: %w", err)
 			}
 
+			return cmd, nil
+		case 23: // CancelDelayCommand cancel_delay = 23;
+			data, ok := fc.MessageData()
+			if !ok {
+				return nil, fmt.Errorf("cannot read 'CancelDelayCommand cancel_delay = 23;' field")
+			}
+
+			cmd := &CancelDelayCommand{}
+			if err := unmarshalCancelDelayCommand(data, cmd, stateCtxs); err != nil {
+				return nil, fmt.Errorf("cannot read 'CancelDelayCommand cancel_delay = 23;' field: %w", err)
+			}
+
 			return cmd, nil
 		}
 	}
@@ -1064,6 +1108,51 @@ func unmarshalExecuteCommand(src []byte, cmd *ExecuteCommand, stateCtxs stateCtx
 	return nil
 }
 
+func unmarshalCancelDelayCommand(src []byte, cmd *CancelDelayCommand, stateCtxs stateCtxs) (err error) {
+	fc := easyproto.FieldContext{}
+	for len(src) > 0 {
+		src, err = fc.NextField(src)
+		if err != nil {
+			return fmt.Errorf("cannot read next field")
+		}
+
+		switch fc.FieldNum {
+		case 1:
+			data, ok := fc.MessageData()
+			if !ok {
+				return fmt.Errorf("cannot read 'StateCtxRef state_ref = 1;' field")
+			}
+
+			stateCtx, err := unmarshalStateCtxRef(data, stateCtxs)
+			if err != nil {
+				return fmt.Errorf("cannot read 'StateCtxRef state_ref = 1;' field: %w", err)
+			}
+			cmd.StateCtx = stateCtx
+		case 2:
+			v, ok := fc.Int64()
+			if !ok {
+				return fmt.Errorf("cannot read 'int64 reschedule_at_sec = 2;' field")
+			}
+
+			cmd.RescheduleAt = time.Unix(v, 0)
+		case 3:
+			data, ok := fc.MessageData()
+			if !ok {
+				return fmt.Errorf("cannot read 'repeated DelayedState result = 3;' field")
+			}
+
+			ds := DelayedState{}
+			if err := UnmarshalDelayedState(data, &ds); err != nil {
+				return fmt.Errorf("cannot read 'repeated DelayedState result = 3;' field: %w", err)
+			}
+
+			cmd.Result = append(cmd.Result, ds)
+		}
+	}
+
+	return nil
+}
+
 func unmarshalDelayCommand(src []byte, cmd *DelayCommand, stateCtxs stateCtxs) (err error) {
 	fc := easyproto.FieldContext{}
 	for len(src) > 0 {
@@ -1568,6 +1657,9 @@ func unmarshalGetDelayedStatesCommand(src []byte, cmd *GetDelayedStatesCommand,
 		//  int64 limit = 4;
 		//
 		//  Result result = 5;
+		//
+		//  int64 shard = 6;
+		//  int64 shards = 7;
 		// }
 
 		switch fc.FieldNum {
@@ -1631,6 +1723,18 @@ func unmarshalGetDelayedStatesCommand(src []byte, cmd *GetDelayedStatesCommand,
 			}
 
 			cmd.Result = result
+		case 6:
+			v, ok := fc.Int64()
+			if !ok {
+				return fmt.Errorf("cannot read 'int64 shard = 6;' field")
+			}
+			cmd.Shard = int(v)
+		case 7:
+			v, ok := fc.Int64()
+			if !ok {
+				return fmt.Errorf("cannot read 'int64 shards = 7;' field")
+			}
+			cmd.Shards = int(v)
 		}
 	}
 
@@ -1688,6 +1792,10 @@ func commandStateCtxs(cmd0 Command) []*StateCtx {
 		if cmd.StateCtx != nil {
 			stateCtxs = append(stateCtxs, cmd.StateCtx)
 		}
+	case *CancelDelayCommand:
+		if cmd.StateCtx != nil {
+			stateCtxs = append(stateCtxs, cmd.StateCtx)
+		}
 	case *StackCommand:
 		if cmd.CarrierStateCtx != nil {
 			stateCtxs = append(stateCtxs, cmd.CarrierStateCtx)
@@ -338,6 +338,36 @@ func TestMarshalUnmarshalCommand(t *testing.T) {
 		},
 	})
 
+	f(&flowstate.CancelDelayCommand{})
+
+	f(&flowstate.CancelDelayCommand{
+		StateCtx: &flowstate.StateCtx{
+			Current: flowstate.State{
+				ID:  "theID",
+				Rev: 123,
+			},
+		},
+		RescheduleAt: time.Unix(456, 0),
+		Result: []flowstate.DelayedState{
+			{
+				State: flowstate.State{
+					ID:  "theID",
+					Rev: 123,
+				},
+				Offset:    678,
+				ExecuteAt: time.Unix(456, 0),
+			},
+			{
+				State: flowstate.State{
+					ID:  "theID",
+					Rev: 124,
+				},
+				Offset:    679,
+				ExecuteAt: time.Unix(456, 0),
+			},
+		},
+	})
+
 	f(&flowstate.CommitCommand{})
 
 	stateCtx := &flowstate.StateCtx{
@@ -582,6 +612,15 @@ func TestMarshalUnmarshalCommand(t *testing.T) {
 		Limit:  567,
 	})
 
+	f(&flowstate.GetDelayedStatesCommand{
+		Since:  time.Unix(123, 0),
+		Until:  time.Unix(234, 0),
+		Offset: 345,
+		Limit:  567,
+		Shard:  2,
+		Shards: 4,
+	})
+
 	f(&flowstate.GetDelayedStatesCommand{
 		Since:  time.Unix(123, 0),
 		Until:  time.Unix(234, 0),
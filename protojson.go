@@ -127,6 +127,22 @@ func toJSONCommand(cmd0 Command, stateCtxs stateCtxs) (*jsonRootCommand, error)
 		}
 
 		jsonRootCmd.Delay = jsonCmd
+	case *CancelDelayCommand:
+		jsonCmd := &jsonCancelDelayCommand{}
+		if cmd.StateCtx != nil {
+			jsonCmd.StateRef = &jsonStateCtxRef{
+				Idx: stateCtxs.strIdx(cmd.StateCtx),
+			}
+		}
+		if !cmd.RescheduleAt.IsZero() {
+			sec := strconv.FormatInt(cmd.RescheduleAt.Unix(), 10)
+			jsonCmd.RescheduleAtSec = &sec
+		}
+		if cmd.Result != nil {
+			jsonCmd.Result = &cmd.Result
+		}
+
+		jsonRootCmd.CancelDelay = jsonCmd
 	case *CommitCommand:
 		commitJsonCmd := &jsonGenericCommand{}
 		for _, cmd := range cmd.Commands {
@@ -278,6 +294,14 @@ func toJSONCommand(cmd0 Command, stateCtxs stateCtxs) (*jsonRootCommand, error)
 			limit := strconv.Itoa(cmd.Limit)
 			jsonCmd.Limit = &limit
 		}
+		if cmd.Shard != 0 {
+			shard := strconv.Itoa(cmd.Shard)
+			jsonCmd.Shard = &shard
+		}
+		if cmd.Shards != 0 {
+			shards := strconv.Itoa(cmd.Shards)
+			jsonCmd.Shards = &shards
+		}
 
 		if cmd.Result != nil {
 			res := &jsonGetDelayedStatesResult{}
@@ -375,6 +399,25 @@ func unmarshalJSONCommand(jsonRootCmd *jsonRootCommand, stateCtxs stateCtxs) (Co
 			cmd.Annotations = *jsonRootCmd.Delay.Annotations
 		}
 
+		return cmd, nil
+	case jsonRootCmd.CancelDelay != nil:
+		cmd := &CancelDelayCommand{}
+
+		if jsonRootCmd.CancelDelay.StateRef != nil {
+			cmd.StateCtx = stateCtxs.findStrIdx(jsonRootCmd.CancelDelay.StateRef.Idx)
+		}
+		if jsonRootCmd.CancelDelay.RescheduleAtSec != nil {
+			rescheduleAt, err := strconv.ParseInt(*jsonRootCmd.CancelDelay.RescheduleAtSec, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("cannot parse 'RescheduleAtSec reschedule_at_sec = 2;' field: %w", err)
+			}
+
+			cmd.RescheduleAt = time.Unix(rescheduleAt, 0)
+		}
+		if jsonRootCmd.CancelDelay.Result != nil {
+			cmd.Result = *jsonRootCmd.CancelDelay.Result
+		}
+
 		return cmd, nil
 	case jsonRootCmd.Commit != nil:
 		cmd := &CommitCommand{}
@@ -549,6 +592,22 @@ func unmarshalJSONCommand(jsonRootCmd *jsonRootCommand, stateCtxs stateCtxs) (Co
 
 			cmd.Limit = limit
 		}
+		if jsonRootCmd.GetDelayedStates.Shard != nil {
+			shard, err := strconv.Atoi(*jsonRootCmd.GetDelayedStates.Shard)
+			if err != nil {
+				return nil, fmt.Errorf("cannot parse 'Shard shard = 6;' field: %w", err)
+			}
+
+			cmd.Shard = shard
+		}
+		if jsonRootCmd.GetDelayedStates.Shards != nil {
+			shards, err := strconv.Atoi(*jsonRootCmd.GetDelayedStates.Shards)
+			if err != nil {
+				return nil, fmt.Errorf("cannot parse 'Shards shards = 7;' field: %w", err)
+			}
+
+			cmd.Shards = shards
+		}
 
 		if jsonRootCmd.GetDelayedStates.Result != nil {
 			jsonRes := jsonRootCmd.GetDelayedStates.Result
@@ -580,6 +639,7 @@ type jsonRootCommand struct {
 	Park             *jsonGenericCommand          `json:"park,omitempty"`
 	Execute          *jsonGenericCommand          `json:"execute,omitempty"`
 	Delay            *jsonDelayCommand            `json:"delay,omitempty"`
+	CancelDelay      *jsonCancelDelayCommand      `json:"cancelDelay,omitempty"`
 	Commit           *jsonGenericCommand          `json:"commit,omitempty"`
 	Noop             *jsonGenericCommand          `json:"noop,omitempty"`
 	Stack            *jsonGenericCommand          `json:"stack,omitempty"`
@@ -628,6 +688,13 @@ type jsonDelayCommand struct {
 	Result *jsonDelayedState `json:"result,omitempty"`
 }
 
+type jsonCancelDelayCommand struct {
+	StateRef        *jsonStateCtxRef `json:"stateRef,omitempty"`
+	RescheduleAtSec *string          `json:"rescheduleAtSec,omitempty"`
+
+	Result *[]DelayedState `json:"result,omitempty"`
+}
+
 type jsonGetStatesCommand struct {
 	SinceRev      *string              `json:"sinceRev,omitempty"`
 	SinceTimeUsec *string              `json:"sinceTime_usec,omitempty"`
@@ -650,6 +717,9 @@ type jsonGetDelayedStatesCommand struct {
 	Limit        *string `json:"limit,omitempty"`
 
 	Result *jsonGetDelayedStatesResult
+
+	Shard  *string `json:"shard,omitempty"`
+	Shards *string `json:"shards,omitempty"`
 }
 
 type jsonGetDelayedStatesResult struct {
@@ -0,0 +1,365 @@
+package flowstate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+var QueueLabel = `flowstate.queue`
+var QueueStatusAnnotation = `flowstate.queue.status`
+var QueueVisibleAtAnnotation = `flowstate.queue.visible_at`
+var QueueDeliveriesAnnotation = `flowstate.queue.deliveries`
+
+// QueueStatus is the status of a queue item kept in QueueStatusAnnotation.
+type QueueStatus string
+
+const (
+	// QueueReady items are claimed by consumers once visible.
+	QueueReady QueueStatus = `ready`
+	// QueueClaimed items are executed by a consumer, they are redelivered once the visibility timeout passes.
+	QueueClaimed QueueStatus = `claimed`
+	// QueueAcked items are done.
+	QueueAcked QueueStatus = `acked`
+	// QueueDead items have reached the max deliveries and are not delivered anymore.
+	QueueDead QueueStatus = `dead`
+)
+
+var DefaultQueueVisibilityTimeout = time.Minute
+
+// Queue is a named work queue, its items are states labeled with QueueLabel.
+//
+// Items are claimed by QueueConsumer, several consumers in several processes compete for items:
+// an item is claimed by committing it from the revision the consumer has seen, so only one claim succeeds.
+// The claiming consumer transits the item to its flow and executes it, the flow must Ack or Nack the item.
+// An item neither acked nor nacked within the visibility timeout is redelivered,
+// commits of the previous delivery then fail with ErrRevMismatch.
+type Queue struct {
+	Name string
+	// VisibilityTimeout is how long a claimed item is not delivered again, DefaultQueueVisibilityTimeout if zero.
+	VisibilityTimeout time.Duration
+	// MaxDeliveries moves an item to QueueDead instead of delivering it once more, unlimited if zero.
+	MaxDeliveries int
+	// Concurrency limits items executed by a consumer at the same time, one if zero.
+	Concurrency int
+}
+
+func (q Queue) Enqueue(stateCtx *StateCtx) *ParkCommand {
+	return Enqueue(stateCtx, q.Name)
+}
+
+// Enqueue sets the state ready in the named queue, commit the returned command to enqueue the state.
+func Enqueue(stateCtx *StateCtx, queue string) *ParkCommand {
+	stateCtx.Current.SetLabel(QueueLabel, queue)
+	stateCtx.Current.SetAnnotation(QueueStatusAnnotation, string(QueueReady))
+	delete(stateCtx.Current.Annotations, QueueVisibleAtAnnotation)
+	delete(stateCtx.Current.Annotations, QueueDeliveriesAnnotation)
+
+	return Park(stateCtx)
+}
+
+// Ack marks the claimed item done, commit the returned command to ack the item.
+func Ack(stateCtx *StateCtx) *ParkCommand {
+	stateCtx.Current.SetAnnotation(QueueStatusAnnotation, string(QueueAcked))
+	delete(stateCtx.Current.Annotations, QueueVisibleAtAnnotation)
+	delete(stateCtx.Current.Annotations, RecoveryEnabledAnnotation)
+
+	return Park(stateCtx)
+}
+
+// Nack returns the claimed item to the queue, it is delivered again once retryAfter passes.
+// Commit the returned command to nack the item.
+func Nack(stateCtx *StateCtx, retryAfter time.Duration) *ParkCommand {
+	stateCtx.Current.SetAnnotation(QueueStatusAnnotation, string(QueueReady))
+	stateCtx.Current.SetAnnotation(QueueVisibleAtAnnotation, time.Now().Add(retryAfter).Format(time.RFC3339))
+	delete(stateCtx.Current.Annotations, RecoveryEnabledAnnotation)
+
+	return Park(stateCtx)
+}
+
+func QueueItemStatus(state State) QueueStatus {
+	return QueueStatus(state.Annotations[QueueStatusAnnotation])
+}
+
+// QueueDeliveries returns how many times the item has been claimed.
+func QueueDeliveries(state State) int {
+	deliveries, _ := strconv.Atoi(state.Annotations[QueueDeliveriesAnnotation])
+	return deliveries
+}
+
+func queueItemVisible(state State, now time.Time) bool {
+	switch QueueItemStatus(state) {
+	case QueueReady, QueueClaimed:
+	default:
+		return false
+	}
+
+	visibleAt, _ := time.Parse(time.RFC3339, state.Annotations[QueueVisibleAtAnnotation])
+	return !now.Before(visibleAt)
+}
+
+type QueueDepth struct {
+	Ready   int
+	Claimed int
+	Dead    int
+}
+
+func (qd *QueueDepth) add(state State) {
+	switch QueueItemStatus(state) {
+	case QueueReady:
+		qd.Ready++
+	case QueueClaimed:
+		qd.Claimed++
+	case QueueDead:
+		qd.Dead++
+	}
+}
+
+// GetQueueDepth counts items of the named queue by status, acked items are not counted.
+func GetQueueDepth(e *Engine, name string) (QueueDepth, error) {
+	var depth QueueDepth
+
+	it := e.Iter(GetStatesByLabels(map[string]string{
+		QueueLabel: name,
+	}).WithLatestOnly())
+	for it.Next() {
+		depth.add(it.State())
+	}
+	if err := it.Err(); err != nil {
+		return QueueDepth{}, fmt.Errorf("get queue items: %w", err)
+	}
+
+	return depth, nil
+}
+
+// QueueConsumer claims items of the queue and executes them in the given flow, see Queue.
+type QueueConsumer struct {
+	e  *Engine
+	q  Queue
+	to FlowID
+	id string
+
+	items    map[StateID]State
+	deadIDs  map[StateID]struct{}
+	inflight atomic.Int64
+
+	claimed *metricVec
+	dead    *metricVec
+	depth   *metricVec
+
+	stopCh    chan struct{}
+	stoppedCh chan struct{}
+	ctx       context.Context
+	cancel    context.CancelFunc
+	l         *slog.Logger
+}
+
+func NewQueueConsumer(e *Engine, q Queue, to FlowID, l *slog.Logger) (*QueueConsumer, error) {
+	if q.Name == `` {
+		return nil, fmt.Errorf("queue name empty")
+	}
+	if to == `` {
+		return nil, fmt.Errorf("flow id empty")
+	}
+	if q.VisibilityTimeout <= 0 {
+		q.VisibilityTimeout = DefaultQueueVisibilityTimeout
+	}
+	if q.Concurrency <= 0 {
+		q.Concurrency = 1
+	}
+
+	c := &QueueConsumer{
+		e:  e,
+		q:  q,
+		to: to,
+		id: fmt.Sprintf("%016x", rand.Uint64()),
+		l:  l,
+
+		items:   make(map[StateID]State),
+		deadIDs: make(map[StateID]struct{}),
+
+		claimed: e.m.counter(`flowstate_queue_claimed_total`, `Number of queue items claimed by consumers.`, `queue`),
+		dead:    e.m.counter(`flowstate_queue_dead_total`, `Number of queue items that have reached max deliveries.`, `queue`),
+		depth:   e.m.gauge(`flowstate_queue_depth`, `Number of queue items seen by a consumer; status is one of ready, claimed or dead.`, `queue`, `consumer`, `status`),
+
+		stopCh:    make(chan struct{}),
+		stoppedCh: make(chan struct{}),
+	}
+
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+
+	go func() {
+		defer close(c.stoppedCh)
+
+		it := e.Iter(GetStatesByLabels(map[string]string{
+			QueueLabel: q.Name,
+		}).WithLatestOnly())
+		for {
+			for it.Next() {
+				c.update(it.State())
+			}
+
+			if err := it.Err(); err != nil {
+				c.l.Error(fmt.Sprintf("queue consumer: get items; queue=%s: %s; retrying", q.Name, err))
+				it = e.Iter(it.Cmd)
+
+				select {
+				case <-time.After(time.Second):
+				case <-c.stopCh:
+					return
+				}
+				continue
+			}
+
+			if err := c.claim(time.Now()); err != nil {
+				c.l.Error(fmt.Sprintf("queue consumer: claim; queue=%s: %s", q.Name, err))
+			}
+
+			waitCtx, waitCancel := context.WithTimeout(c.ctx, time.Second)
+			it.Wait(waitCtx)
+			waitCancel()
+
+			select {
+			case <-c.stopCh:
+				return
+			default:
+			}
+		}
+	}()
+
+	return c, nil
+}
+
+func (c *QueueConsumer) Shutdown(ctx context.Context) error {
+	select {
+	case <-c.stopCh:
+		return fmt.Errorf(`already shutdown`)
+	default:
+		close(c.stopCh)
+		c.cancel()
+
+		select {
+		case <-c.stoppedCh:
+			for _, status := range []QueueStatus{QueueReady, QueueClaimed, QueueDead} {
+				c.depth.delete(c.q.Name, c.id, string(status))
+			}
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (c *QueueConsumer) update(state State) {
+	if state.Labels[QueueLabel] != c.q.Name || QueueItemStatus(state) == QueueAcked {
+		delete(c.items, state.ID)
+		delete(c.deadIDs, state.ID)
+		return
+	}
+	if curr, ok := c.items[state.ID]; ok && curr.Rev > state.Rev {
+		return
+	}
+
+	// dead items are not delivered anymore, only their IDs are kept for the depth metric until they are enqueued again
+	if QueueItemStatus(state) == QueueDead {
+		delete(c.items, state.ID)
+		c.deadIDs[state.ID] = struct{}{}
+		return
+	}
+
+	delete(c.deadIDs, state.ID)
+	c.items[state.ID] = state
+}
+
+func (c *QueueConsumer) claim(now time.Time) error {
+	depth := QueueDepth{
+		Dead: len(c.deadIDs),
+	}
+	var visible []State
+	for _, state := range c.items {
+		depth.add(state)
+		if queueItemVisible(state, now) {
+			visible = append(visible, state)
+		}
+	}
+	c.depth.set(float64(depth.Ready), c.q.Name, c.id, string(QueueReady))
+	c.depth.set(float64(depth.Claimed), c.q.Name, c.id, string(QueueClaimed))
+	c.depth.set(float64(depth.Dead), c.q.Name, c.id, string(QueueDead))
+
+	sort.Slice(visible, func(i, j int) bool {
+		return visible[i].Rev < visible[j].Rev
+	})
+
+	for _, state := range visible {
+		if c.inflight.Load() >= int64(c.q.Concurrency) {
+			return nil
+		}
+
+		if err := c.claimItem(state, now); IsErrRevMismatch(err) {
+			// claimed by another consumer or changed concurrently
+			continue
+		} else if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *QueueConsumer) claimItem(state State, now time.Time) error {
+	stateCtx := state.CopyToCtx(&StateCtx{})
+
+	deliveries := QueueDeliveries(state) + 1
+	if c.q.MaxDeliveries > 0 && deliveries > c.q.MaxDeliveries {
+		stateCtx.Current.SetAnnotation(QueueStatusAnnotation, string(QueueDead))
+		delete(stateCtx.Current.Annotations, QueueVisibleAtAnnotation)
+		delete(stateCtx.Current.Annotations, RecoveryEnabledAnnotation)
+
+		// parking the item fences off the previous delivery if it has not finished yet
+		if err := c.e.Do(Commit(Park(stateCtx))); err != nil {
+			return err
+		}
+
+		c.dead.inc(c.q.Name)
+		return nil
+	}
+
+	stateCtx.Current.SetAnnotation(QueueStatusAnnotation, string(QueueClaimed))
+	stateCtx.Current.SetAnnotation(QueueDeliveriesAnnotation, strconv.Itoa(deliveries))
+	stateCtx.Current.SetAnnotation(QueueVisibleAtAnnotation, now.Add(c.q.VisibilityTimeout).Format(time.RFC3339))
+	// redelivery is done by consumers
+	DisableRecovery(stateCtx)
+
+	if err := c.e.Do(Commit(Transit(stateCtx, c.to))); err != nil {
+		return err
+	}
+
+	c.claimed.inc(c.q.Name)
+
+	// blocks while the engine has too many submitted executions, see ConcurrencyLimits.MaxSubmitted;
+	// an item not submitted is redelivered once the visibility timeout passes
+	ex, err := c.e.Submit(c.ctx, stateCtx)
+	if errors.Is(err, context.Canceled) {
+		return nil
+	} else if err != nil {
+		c.l.Warn(fmt.Sprintf("queue item execution has not been submitted; queue=%s id=%s: %s", c.q.Name, stateCtx.Current.ID, err))
+		return nil
+	}
+
+	c.inflight.Add(1)
+	go func() {
+		defer c.inflight.Add(-1)
+
+		if err := ex.Wait(context.Background()); err != nil && !errors.Is(err, context.Canceled) {
+			c.l.Warn(fmt.Sprintf("queue item execution has failed; queue=%s id=%s: %s", c.q.Name, stateCtx.Current.ID, err))
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,163 @@
+//go:build goexperiment.synctest
+
+package flowstate_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"regexp"
+	"sort"
+	"sync"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/makasim/flowstate"
+	"github.com/makasim/flowstate/memdriver"
+	"github.com/thejerf/slogassert"
+)
+
+func TestQueueConsumer(t *testing.T) {
+	f := func(q flowstate.Queue, consumers, items int, handle string, exp []string, expDepth flowstate.QueueDepth) {
+		t.Helper()
+
+		synctest.Test(t, func(t *testing.T) {
+			lh := slogassert.New(t, slog.LevelDebug, nil)
+			l := slog.New(slogassert.New(t, slog.LevelDebug, lh))
+
+			start := time.Now()
+			actMux := &sync.Mutex{}
+			act := make([]string, 0)
+
+			d := memdriver.New(l)
+			fr := &flowstate.DefaultFlowRegistry{}
+			mustSetFlow(fr, `consume`, flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+				deliveries := flowstate.QueueDeliveries(stateCtx.Current)
+
+				actMux.Lock()
+				act = append(act, fmt.Sprintf("%s:%d@%s", stateCtx.Current.ID, deliveries, time.Since(start).Truncate(time.Second)))
+				actMux.Unlock()
+
+				switch {
+				case handle == `nack`:
+					return flowstate.Commit(flowstate.Nack(stateCtx, time.Second*30)), nil
+				case handle == `stale` && deliveries == 1:
+					// the item is redelivered meanwhile, so the ack is fenced off
+					time.Sleep(time.Minute * 2)
+					return flowstate.Commit(flowstate.Ack(stateCtx)), nil
+				default:
+					return flowstate.Commit(flowstate.Ack(stateCtx)), nil
+				}
+			}))
+
+			e, err := flowstate.NewEngine(d, fr, l)
+			if err != nil {
+				t.Fatalf("failed to create engine: %v", err)
+			}
+			defer func() {
+				if err := e.Shutdown(context.Background()); err != nil {
+					t.Fatalf("failed to shutdown engine: %v", err)
+				}
+			}()
+
+			for i := 0; i < items; i++ {
+				stateCtx := &flowstate.StateCtx{
+					Current: flowstate.State{
+						ID: flowstate.StateID(fmt.Sprintf("i%d", i)),
+					},
+				}
+				if err := e.Do(flowstate.Commit(q.Enqueue(stateCtx))); err != nil {
+					t.Fatalf("failed to enqueue: %v", err)
+				}
+			}
+
+			cs := make([]*flowstate.QueueConsumer, 0, consumers)
+			for i := 0; i < consumers; i++ {
+				c, err := flowstate.NewQueueConsumer(e, q, `consume`, l)
+				if err != nil {
+					t.Fatalf("failed to create queue consumer: %v", err)
+				}
+				cs = append(cs, c)
+			}
+			defer func() {
+				for _, c := range cs[1:] {
+					if err := c.Shutdown(context.Background()); err != nil {
+						t.Fatalf("failed to shutdown queue consumer: %v", err)
+					}
+				}
+			}()
+
+			time.Sleep(time.Minute * 5)
+			synctest.Wait()
+
+			actMux.Lock()
+			sort.Strings(act)
+			if !reflect.DeepEqual(exp, act) {
+				t.Errorf("expected %v, got %v", exp, act)
+			}
+			actMux.Unlock()
+
+			depth, err := flowstate.GetQueueDepth(e, q.Name)
+			if err != nil {
+				t.Fatalf("failed to get queue depth: %v", err)
+			}
+			if depth != expDepth {
+				t.Errorf("expected depth %+v, got %+v", expDepth, depth)
+			}
+
+			// consumers count dead items without keeping them, each consumer reports its own depth
+			deadMetric := regexp.MustCompile(fmt.Sprintf(`flowstate_queue_depth\{queue="%s",consumer="[0-9a-f]+",status="dead"\} %d\n`, q.Name, expDepth.Dead))
+			countDeadMetrics := func() int {
+				buf := &bytes.Buffer{}
+				if err := e.Metrics().Write(buf); err != nil {
+					t.Fatalf("failed to write metrics: %v", err)
+				}
+				return len(deadMetric.FindAllString(buf.String(), -1))
+			}
+			if act := countDeadMetrics(); act != consumers {
+				t.Errorf("expected %d dead depth metrics, got %d", consumers, act)
+			}
+
+			// a consumer shutdown drops its own depth only
+			if err := cs[0].Shutdown(context.Background()); err != nil {
+				t.Fatalf("failed to shutdown queue consumer: %v", err)
+			}
+			if act := countDeadMetrics(); act != consumers-1 {
+				t.Errorf("expected %d dead depth metrics, got %d", consumers-1, act)
+			}
+		})
+	}
+
+	// competing consumers
+	f(
+		flowstate.Queue{Name: `aQueue`},
+		3,
+		5,
+		`ack`,
+		[]string{`i0:1@0s`, `i1:1@0s`, `i2:1@0s`, `i3:1@0s`, `i4:1@0s`},
+		flowstate.QueueDepth{},
+	)
+
+	// redelivered after visibility timeout
+	f(
+		flowstate.Queue{Name: `aQueue`, VisibilityTimeout: time.Minute},
+		2,
+		1,
+		`stale`,
+		[]string{`i0:1@0s`, `i0:2@1m0s`},
+		flowstate.QueueDepth{},
+	)
+
+	// nacked until dead
+	f(
+		flowstate.Queue{Name: `aQueue`, MaxDeliveries: 2},
+		2,
+		1,
+		`nack`,
+		[]string{`i0:1@0s`, `i0:2@30s`},
+		flowstate.QueueDepth{Dead: 1},
+	)
+}
@@ -0,0 +1,186 @@
+package flowstate
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+var RateLimitLabel = `flowstate.rate_limit`
+var RateLimitNameAnnotation = `flowstate.rate_limit.name`
+var RateLimitEveryAnnotation = `flowstate.rate_limit.every`
+var RateLimitBurstAnnotation = `flowstate.rate_limit.burst`
+var RateLimitTATAnnotation = `flowstate.rate_limit.tat`
+
+// RateLimitAnnotation is set to the transition of the state that has passed the rate limiter.
+var RateLimitAnnotation = `flowstate.rate_limit`
+
+// rateLimitCommitAttempts limits commits conflicting with concurrent reservations of the same rate limiter.
+const rateLimitCommitAttempts = 10
+
+// RateLimiter is a named rate limiter shared by all engines on the same driver,
+// it allows a state to pass every Every duration with bursts of up to Burst states.
+//
+// The limiter implements GCRA, the theoretical arrival time is stored in a parked state labeled with RateLimitLabel.
+// Every state passing the limiter reserves a slot: if the slot is now the state is transited right away,
+// otherwise it is delayed until the slot, see Delay. The Delayer must be running for delayed states to proceed.
+type RateLimiter struct {
+	Name  string
+	Every time.Duration
+	Burst int
+}
+
+func NewRateLimiter(name string, every time.Duration, burst int) RateLimiter {
+	return RateLimiter{
+		Name:  name,
+		Every: every,
+		Burst: burst,
+	}
+}
+
+func (l RateLimiter) Acquire(stateCtx *StateCtx, to FlowID) *RateLimitCommand {
+	return RateLimit(stateCtx, l.Name, l.Every, l.Burst, to)
+}
+
+// RateLimit transits the state to the given flow once the named rate limiter allows it.
+// All states passing the rate limiter must use the same every and burst.
+func RateLimit(stateCtx *StateCtx, name string, every time.Duration, burst int, to FlowID) *RateLimitCommand {
+	return &RateLimitCommand{
+		StateCtx: stateCtx,
+		Name:     name,
+		Every:    every,
+		Burst:    burst,
+		To:       to,
+	}
+}
+
+type RateLimitCommand struct {
+	command
+	StateCtx *StateCtx
+	Name     string
+	Every    time.Duration
+	Burst    int
+	To       FlowID
+
+	// Allowed is set if the state is transited right away, otherwise the state is delayed until ExecuteAt.
+	Allowed   bool
+	ExecuteAt time.Time
+
+	sync bool
+}
+
+func (cmd *RateLimitCommand) sessID() int64 {
+	return cmd.StateCtx.sessID
+}
+
+func (cmd *RateLimitCommand) setSync() {
+	cmd.sync = true
+}
+
+func (cmd *RateLimitCommand) do(e *Engine) error {
+	return e.doRateLimit(cmd)
+}
+
+func (cmd *RateLimitCommand) next() *StateCtx {
+	if cmd.Allowed {
+		return cmd.StateCtx
+	}
+	return nil
+}
+
+func rateLimitStateID(name string) StateID {
+	return StateID(`flowstate.rate_limit.` + name)
+}
+
+func (e *Engine) getRateLimiter(cmd *RateLimitCommand) (*StateCtx, error) {
+	limiterStateCtx := &StateCtx{}
+	if err := e.doCmd(GetStateByID(limiterStateCtx, rateLimitStateID(cmd.Name), 0)); errors.Is(err, ErrNotFound) {
+		limiterStateCtx.Current = State{
+			ID: rateLimitStateID(cmd.Name),
+			Labels: map[string]string{
+				RateLimitLabel: `true`,
+			},
+		}
+		limiterStateCtx.Current.SetAnnotation(RateLimitNameAnnotation, cmd.Name)
+		limiterStateCtx.Current.SetAnnotation(RateLimitEveryAnnotation, cmd.Every.String())
+		limiterStateCtx.Current.SetAnnotation(RateLimitBurstAnnotation, strconv.Itoa(cmd.Burst))
+
+		return limiterStateCtx, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("get rate limiter state: %w", err)
+	}
+
+	every, _ := time.ParseDuration(limiterStateCtx.Current.Annotations[RateLimitEveryAnnotation])
+	burst, _ := strconv.Atoi(limiterStateCtx.Current.Annotations[RateLimitBurstAnnotation])
+	if every != cmd.Every || burst != cmd.Burst {
+		return nil, fmt.Errorf("rate limiter %s is every %s with burst %d, got every %s with burst %d", cmd.Name, every, burst, cmd.Every, cmd.Burst)
+	}
+
+	return limiterStateCtx, nil
+}
+
+func (e *Engine) doRateLimit(cmd *RateLimitCommand) error {
+	if cmd.Name == `` {
+		return fmt.Errorf("rate limiter name empty")
+	}
+	if cmd.Every <= 0 {
+		return fmt.Errorf("rate limiter every must be greater than zero")
+	}
+	if cmd.Burst <= 0 {
+		return fmt.Errorf("rate limiter burst must be greater than zero")
+	}
+	if cmd.To == `` {
+		return fmt.Errorf("flow id empty")
+	}
+
+	var err error
+	for i := 0; i < rateLimitCommitAttempts; i++ {
+		limiterStateCtx, getErr := e.getRateLimiter(cmd)
+		if getErr != nil {
+			return getErr
+		}
+
+		now := time.Now()
+		tat, _ := time.Parse(time.RFC3339Nano, limiterStateCtx.Current.Annotations[RateLimitTATAnnotation])
+		if tat.Before(now) {
+			tat = now
+		}
+
+		executeAt := tat.Add(-cmd.Every * time.Duration(cmd.Burst-1))
+		allowed := !executeAt.After(now)
+		if allowed {
+			executeAt = now
+		}
+		limiterStateCtx.Current.SetAnnotation(RateLimitTATAnnotation, tat.Add(cmd.Every).UTC().Format(time.RFC3339Nano))
+
+		stateCtx := cmd.StateCtx.CopyTo(&StateCtx{})
+		stateCtx.sessID = cmd.StateCtx.sessID
+
+		var stateCmd Command
+		if allowed {
+			stateCmd = Transit(stateCtx, cmd.To).WithAnnotation(RateLimitAnnotation, cmd.Name)
+		} else {
+			stateCmd = DelayUntil(stateCtx, cmd.To, executeAt).WithAnnotation(RateLimitAnnotation, cmd.Name)
+		}
+
+		err = e.doCmd(Commit(Park(limiterStateCtx), stateCmd))
+		if IsErrRevMismatchContains(err, limiterStateCtx.Current.ID) {
+			// reserved concurrently
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		cmd.StateCtx.moveFrom(stateCtx)
+		cmd.Allowed = allowed
+		cmd.ExecuteAt = executeAt
+		if allowed && !cmd.sync {
+			e.goExecute(cmd.StateCtx)
+		}
+
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,115 @@
+//go:build goexperiment.synctest
+
+package flowstate_test
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/makasim/flowstate"
+	"github.com/makasim/flowstate/memdriver"
+	"github.com/thejerf/slogassert"
+)
+
+func TestRateLimiter(t *testing.T) {
+	f := func(limiter flowstate.RateLimiter, engines, states int, exp []string) {
+		t.Helper()
+
+		synctest.Test(t, func(t *testing.T) {
+			lh := slogassert.New(t, slog.LevelDebug, nil)
+			l := slog.New(slogassert.New(t, slog.LevelDebug, lh))
+
+			start := time.Now()
+			actMux := &sync.Mutex{}
+			act := make([]string, 0)
+
+			d := memdriver.New(l)
+			fr := &flowstate.DefaultFlowRegistry{}
+			mustSetFlow(fr, `limit`, flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+				return limiter.Acquire(stateCtx, `limited`), nil
+			}))
+			mustSetFlow(fr, `limited`, flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+				if stateCtx.Current.Transition.Annotations[flowstate.RateLimitAnnotation] != limiter.Name {
+					t.Errorf("state %s has not passed the rate limiter", stateCtx.Current.ID)
+				}
+
+				actMux.Lock()
+				act = append(act, time.Since(start).Truncate(time.Second).String())
+				actMux.Unlock()
+
+				return flowstate.Commit(flowstate.Park(stateCtx)), nil
+			}))
+
+			// engines act as processes sharing the driver
+			var es []*flowstate.Engine
+			for i := 0; i < engines; i++ {
+				e, err := flowstate.NewEngine(d, fr, l)
+				if err != nil {
+					t.Fatalf("failed to create engine: %v", err)
+				}
+				defer func() {
+					if err := e.Shutdown(context.Background()); err != nil {
+						t.Fatalf("failed to shutdown engine: %v", err)
+					}
+				}()
+
+				es = append(es, e)
+			}
+
+			dlr, err := flowstate.NewDelayer(es[0], l)
+			if err != nil {
+				t.Fatalf("failed to create delayer: %v", err)
+			}
+			defer func() {
+				if err := dlr.Shutdown(context.Background()); err != nil {
+					t.Fatalf("failed to shutdown delayer: %v", err)
+				}
+			}()
+
+			for i := 0; i < states; i++ {
+				e := es[i%len(es)]
+				stateCtx := &flowstate.StateCtx{
+					Current: flowstate.State{
+						ID: flowstate.StateID(fmt.Sprintf("s%d", i)),
+					},
+				}
+				if err := e.Do(
+					flowstate.Commit(flowstate.Transit(stateCtx, `limit`)),
+					flowstate.Execute(stateCtx),
+				); err != nil {
+					t.Fatalf("failed to execute state: %v", err)
+				}
+			}
+
+			time.Sleep(time.Minute * 10)
+			synctest.Wait()
+
+			actMux.Lock()
+			defer actMux.Unlock()
+			sort.Slice(act, func(i, j int) bool {
+				di, _ := time.ParseDuration(act[i])
+				dj, _ := time.ParseDuration(act[j])
+				return di < dj
+			})
+			if !reflect.DeepEqual(exp, act) {
+				t.Fatalf("expected %v, got %v", exp, act)
+			}
+		})
+	}
+
+	// one state per minute
+	f(flowstate.NewRateLimiter(`aLimiter`, time.Minute, 1), 1, 3, []string{`0s`, `1m0s`, `2m0s`})
+
+	// burst
+	f(flowstate.NewRateLimiter(`aLimiter`, time.Minute, 3), 1, 5, []string{`0s`, `0s`, `0s`, `1m0s`, `2m0s`})
+
+	// shared by engines
+	f(flowstate.NewRateLimiter(`aLimiter`, time.Minute*2, 1), 3, 4, []string{`0s`, `2m0s`, `4m0s`, `6m0s`})
+}
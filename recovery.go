@@ -67,33 +67,24 @@ func SetRetryAfter(stateCtx *StateCtx, retryAfter time.Duration) {
 	stateCtx.Current.SetAnnotation(RetryAfterAnnotation, retryAfter.String())
 }
 
-func retryAt(state State) time.Time {
-	retryAfterStr := state.Annotations[RetryAfterAnnotation]
-	if retryAfterStr == "" {
-		retryAfterStr = DefaultRetryAfter.String()
-	}
-
-	retryAfter, err := time.ParseDuration(retryAfterStr)
-	if err != nil {
-		return state.CommittedAt.Add(MinRetryAfter)
-	}
-
-	if retryAfter < MinRetryAfter {
-		retryAfter = MinRetryAfter
-	}
-	if retryAfter > MaxRetryAfter {
-		retryAfter = MaxRetryAfter
-	}
-
-	return state.CommittedAt.Add(retryAfter)
-}
-
 var recoveryStateID = StateID(`flowstate.recovery.meta`)
 
+// defaultRecovererInterval is how often Recoverer reads new states and retries due ones, it bounds the precision of retry intervals.
+// Recoverer ticks at a tenth of the smallest RetryPolicy.InitialInterval it has seen if that is shorter, but not more often than minRecovererInterval.
+const defaultRecovererInterval = time.Second * 10
+const minRecovererInterval = time.Second
+
+// Recoverer retries states which have not been completed in time, see RetryPolicy.
+//
+// Several recoverers could run at the same time, only the leader, the one holding the lease stored on the recovery meta state, retries states.
+// Others stand by and take the lease over once the leader shuts down or stops renewing it, see LeaseDuration.
+// A leader that has lost the lease cannot retry a state twice, since retries are committed against the state revision.
 type Recoverer struct {
 	mux sync.Mutex
 
-	recoveryStateCtx *StateCtx
+	holder             string
+	recoveryStateCtx   *StateCtx
+	sinceRevCommitedAt time.Time
 
 	active   bool
 	sinceRev int64
@@ -104,6 +95,7 @@ type Recoverer struct {
 
 	states               map[StateID]retryableState
 	statesMaxSize        int
+	interval             time.Duration
 	statesMaxTailHeadDur time.Duration
 
 	added     int64
@@ -111,11 +103,19 @@ type Recoverer struct {
 	retried   int64
 	dropped   int64
 	commited  int64
-
-	e         *Engine
-	stopCh    chan struct{}
-	stoppedCh chan struct{}
-	l         *slog.Logger
+	renewed   int64
+
+	eventsTotal   *metricVec
+	commitsTotal  *metricVec
+	renewalsTotal *metricVec
+
+	e                *Engine
+	ctx              context.Context
+	cancel           context.CancelFunc
+	stopCh           chan struct{}
+	stoppedCh        chan struct{}
+	l                *slog.Logger
+	unregisterMetric func()
 }
 
 func NewRecoverer(e *Engine, l *slog.Logger) (*Recoverer, error) {
@@ -123,15 +123,23 @@ func NewRecoverer(e *Engine, l *slog.Logger) (*Recoverer, error) {
 		e: e,
 		l: l,
 
+		holder: newLeaseHolder(),
+
 		statesMaxSize:        100000,
 		statesMaxTailHeadDur: MaxRetryAfter * 2,
+		interval:             defaultRecovererInterval,
+
+		eventsTotal:   e.m.counter(`flowstate_recoverer_states_total`, `Number of states processed by the recoverer; event is one of added, completed, retried, dropped.`, `event`),
+		commitsTotal:  e.m.counter(`flowstate_recoverer_commits_total`, `Number of recoverer meta state commits.`),
+		renewalsTotal: e.m.counter(`flowstate_recoverer_lease_renewals_total`, `Number of recoverer meta state commits which only took or renewed the lease.`),
 
 		stopCh:    make(chan struct{}),
 		stoppedCh: make(chan struct{}),
 	}
+	r.ctx, r.cancel = context.WithCancel(context.Background())
+	r.shortenInterval(e.minRetryInterval())
 
 	recoveryStateCtx := &StateCtx{}
-	active := true
 	if err := r.e.Do(GetStateByID(recoveryStateCtx, recoveryStateID, 0)); errors.Is(err, ErrNotFound) {
 		recoveryStateCtx = &StateCtx{
 			Current: State{
@@ -140,23 +148,26 @@ func NewRecoverer(e *Engine, l *slog.Logger) (*Recoverer, error) {
 			},
 		}
 		setRecoverySinceRev(recoveryStateCtx, 0)
-
-		if err := r.e.Do(Commit(
-			Park(recoveryStateCtx).WithAnnotation(`state`, `active`),
-		)); IsErrRevMismatch(err) {
-			// another process is already doing recovery, we can continue in standby mode
-			active = false
-		} else if err != nil {
-			return nil, fmt.Errorf("commit recovery state: %w", err)
-		}
-		r.commited++
 	} else if err != nil {
 		return nil, fmt.Errorf("get recovery state: %w", err)
-	} else {
-		active = recoveryStateCtx.Current.Annotation(`state`) != `active`
+	}
+
+	created := recoveryStateCtx.Committed.Rev == 0
+	// another process may hold the lease, we continue in standby mode then
+	active, err := r.acquireLease(recoveryStateCtx, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if active && created {
+		r.commited++
+		r.commitsTotal.inc()
+	} else if active {
+		r.renewed++
+		r.renewalsTotal.inc()
 	}
 
 	r.reset(recoveryStateCtx, active)
+	r.unregisterMetric = r.instrument(e.m)
 
 	var wg sync.WaitGroup
 	wg.Add(1)
@@ -180,16 +191,22 @@ func NewRecoverer(e *Engine, l *slog.Logger) (*Recoverer, error) {
 
 func (r *Recoverer) Shutdown(ctx context.Context) error {
 	close(r.stopCh)
+	r.cancel()
+	r.unregisterMetric()
 
 	select {
 	case <-r.stoppedCh:
+		if !r.active {
+			return nil
+		}
+
+		// the lease expires right away, so a standby takes it over on its next check
 		setRecoverySinceRev(r.recoveryStateCtx, r.nextSinceRev())
-		if err := r.e.Do(Commit(
-			Park(r.recoveryStateCtx).WithAnnotation(`state`, `inactive`)),
-		); IsErrRevMismatch(err) {
+		setLease(r.recoveryStateCtx, r.holder, time.Now())
+		if err := r.e.Do(Commit(Park(r.recoveryStateCtx))); IsErrRevMismatch(err) {
 			return nil
 		} else if err != nil {
-			return fmt.Errorf("commit: pause recovery state: %w", err)
+			return fmt.Errorf("commit: release recovery lease: %w", err)
 		}
 
 		r.reset(r.recoveryStateCtx, false)
@@ -211,6 +228,8 @@ type RecovererStats struct {
 	Completed int64
 	Retried   int64
 	Dropped   int64
+	// Renewed is the number of recovery state commits which only took or renewed the lease.
+	Renewed int64
 
 	Active bool
 }
@@ -230,13 +249,49 @@ func (r *Recoverer) Stats() RecovererStats {
 		Retried:   r.retried,
 		Dropped:   r.dropped,
 		Commited:  r.commited,
+		Renewed:   r.renewed,
 
 		Active: r.active,
 	}
 }
 
+// instrument registers gauges computed from the recoverer state, counters are incremented where events happen.
+// The returned function unregisters the gauges.
+func (r *Recoverer) instrument(m *Metrics) func() {
+	active := m.gauge(`flowstate_recoverer_active`, `Whether the recoverer is active (1) or in standby (0).`)
+	states := m.gauge(`flowstate_recoverer_states`, `Number of states tracked for recovery.`)
+	headRev := m.gauge(`flowstate_recoverer_head_rev`, `The latest revision seen by the recoverer.`)
+	tailRev := m.gauge(`flowstate_recoverer_tail_rev`, `The oldest revision tracked by the recoverer.`)
+
+	unregister := m.collect(func() {
+		stats := r.Stats()
+
+		r.mux.Lock()
+		statesLen := len(r.states)
+		r.mux.Unlock()
+
+		if stats.Active {
+			active.set(1)
+		} else {
+			active.set(0)
+		}
+		states.set(float64(statesLen))
+		headRev.set(float64(stats.HeadRev))
+		tailRev.set(float64(stats.TailRev))
+	})
+
+	return func() {
+		unregister()
+		active.delete()
+		states.delete()
+		headRev.delete()
+		tailRev.delete()
+	}
+}
+
 func (r *Recoverer) updateHead() {
-	t := time.NewTicker(time.Second * 10)
+	interval := r.tickInterval()
+	t := time.NewTicker(interval)
 	defer t.Stop()
 
 	prevAt := time.Now()
@@ -246,6 +301,10 @@ func (r *Recoverer) updateHead() {
 			r.l.Error(fmt.Sprintf("update head: %s; retrying", err))
 			continue
 		}
+		if nextInterval := r.tickInterval(); nextInterval != interval {
+			interval = nextInterval
+			t.Reset(interval)
+		}
 
 		select {
 		case <-r.stopCh:
@@ -274,10 +333,15 @@ func (r *Recoverer) doUpdateHead(dur time.Duration) error {
 			r.sinceRev = state.Rev
 
 			if state.ID == recoveryStateID {
+				if state.Rev <= r.recoveryStateCtx.Committed.Rev {
+					continue
+				}
+
 				r.recoveryStateCtx = state.CopyToCtx(r.recoveryStateCtx)
-				if state.Rev > r.recoveryStateCtx.Committed.Rev {
-					active := state.Annotation(`state`) != `active`
-					r.reset(r.recoveryStateCtx, active)
+				if r.active && leaseHolder(state) != r.holder {
+					r.l.Warn("recoverer: lease taken over by another recoverer; standing by", "holder", r.holder)
+					r.reset(r.recoveryStateCtx, false)
+					return nil
 				}
 				continue
 			}
@@ -299,15 +363,24 @@ func (r *Recoverer) doUpdateHead(dur time.Duration) error {
 			if Parked(state) {
 				delete(r.states, state.ID)
 				r.completed++
+				r.eventsTotal.inc(`completed`)
 
 				continue
 			}
 
+			policy := r.e.retryPolicy(state)
+			retryAt := policy.retryAt(state)
+			if _, ok := policy.nonRetryable(state); ok {
+				retryAt = state.CommittedAt
+			}
+			r.shortenInterval(time.Duration(policy.InitialInterval))
+
 			r.states[state.ID] = retryableState{
 				State:   state.CopyTo(&State{}),
-				retryAt: retryAt(state),
+				retryAt: retryAt,
 			}
 			r.added++
+			r.eventsTotal.inc(`added`)
 		}
 
 		if first && r.completed == completed && r.added == added {
@@ -335,7 +408,8 @@ func (r *Recoverer) doUpdateHead(dur time.Duration) error {
 }
 
 func (r *Recoverer) updateTail() {
-	t := time.NewTicker(time.Second * 10)
+	interval := r.tickInterval()
+	t := time.NewTicker(interval)
 	defer t.Stop()
 
 	for {
@@ -347,36 +421,50 @@ func (r *Recoverer) updateTail() {
 				r.l.Error(fmt.Sprintf("update tail: %s; retrying", err))
 				continue
 			}
+			if nextInterval := r.tickInterval(); nextInterval != interval {
+				interval = nextInterval
+				t.Reset(interval)
+			}
 		}
 	}
 }
 
+func (r *Recoverer) tickInterval() time.Duration {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	return r.interval
+}
+
+// shortenInterval makes the recoverer tick often enough to retry states with the retry interval in time, see defaultRecovererInterval.
+func (r *Recoverer) shortenInterval(retryInterval time.Duration) {
+	if retryInterval <= 0 {
+		return
+	}
+
+	r.interval = max(min(r.interval, retryInterval/10), minRecovererInterval)
+}
+
 func (r *Recoverer) doUpdateTail() error {
 	r.mux.Lock()
 	defer r.mux.Unlock()
 
-	if !r.active {
-		commitedAt := r.recoveryStateCtx.Committed.CommittedAt
-		if (commitedAt.Add(MaxRetryAfter+time.Minute).Before(time.Now()) && r.nextSinceRev() > getRecoverySinceRev(r.recoveryStateCtx)) ||
-			r.recoveryStateCtx.Current.Annotation(`state`) == `inactive` {
-			nextRecoveryStateCtx := r.recoveryStateCtx.CopyTo(&StateCtx{})
-			if err := r.e.Do(Commit(Park(r.recoveryStateCtx).WithAnnotation(`state`, `active`))); IsErrRevMismatch(err) {
-				r.reset(r.recoveryStateCtx, false)
-				return nil
-			} else if err != nil {
-				return fmt.Errorf("commit recovery state: %w", err)
-			}
-			r.commited++
-			r.recoveryStateCtx = nextRecoveryStateCtx.CopyTo(r.recoveryStateCtx)
+	now := time.Now()
 
+	if !r.active {
+		active, err := r.acquireLease(r.recoveryStateCtx, now)
+		if err != nil {
+			return err
+		} else if active {
+			r.l.Info("recoverer: lease acquired", "holder", r.holder)
+			r.renewed++
+			r.renewalsTotal.inc()
 			r.reset(r.recoveryStateCtx, true)
 		}
 
 		return nil
 	}
 
-	now := time.Now()
-
 	if err := r.doRetry(); err != nil {
 		return fmt.Errorf("do retry: %w", err)
 	}
@@ -392,26 +480,58 @@ func (r *Recoverer) doUpdateTail() error {
 	r.tailRev = tailRev
 	r.tailTime = tailTime
 
-	commitedAt := r.recoveryStateCtx.Committed.CommittedAt
-	if r.tailRev > getRecoverySinceRev(r.recoveryStateCtx)+1000 ||
-		(commitedAt.Add(MaxRetryAfter).Before(now) && r.nextSinceRev() > getRecoverySinceRev(r.recoveryStateCtx)) {
-		nextRecoveryStateCtx := r.recoveryStateCtx.CopyTo(&StateCtx{})
+	progress := r.tailRev > getRecoverySinceRev(r.recoveryStateCtx)+1000 ||
+		(r.sinceRevCommitedAt.Add(MaxRetryAfter).Before(now) && r.nextSinceRev() > getRecoverySinceRev(r.recoveryStateCtx))
+	renew := !r.recoveryStateCtx.Committed.CommittedAt.Add(LeaseRenewInterval).After(now)
+	if !progress && !renew {
+		return nil
+	}
 
+	nextRecoveryStateCtx := r.recoveryStateCtx.CopyTo(&StateCtx{})
+	if progress {
 		setRecoverySinceRev(nextRecoveryStateCtx, r.nextSinceRev())
-		if err := r.e.Do(Commit(Park(nextRecoveryStateCtx).WithAnnotation(`state`, `active`))); IsErrRevMismatch(err) {
-			r.reset(r.recoveryStateCtx, false)
-			return nil
-		} else if err != nil {
-			return fmt.Errorf("commit recovery state: %w", err)
-		}
+	}
+	setLease(nextRecoveryStateCtx, r.holder, now.Add(LeaseDuration))
+	if err := r.e.Do(Commit(Park(nextRecoveryStateCtx))); IsErrRevMismatch(err) {
+		r.l.Warn("recoverer: lease taken over by another recoverer; standing by", "holder", r.holder)
+		r.reset(r.recoveryStateCtx, false)
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("commit recovery state: %w", err)
+	}
 
+	r.recoveryStateCtx = nextRecoveryStateCtx.CopyTo(r.recoveryStateCtx)
+	if progress {
 		r.commited++
-		r.recoveryStateCtx = nextRecoveryStateCtx.CopyTo(r.recoveryStateCtx)
+		r.commitsTotal.inc()
+		r.sinceRevCommitedAt = r.recoveryStateCtx.Committed.CommittedAt
+	} else {
+		r.renewed++
+		r.renewalsTotal.inc()
 	}
 
 	return nil
 }
 
+// acquireLease commits the recovery state with the lease taken by the recoverer, it returns false if another recoverer holds the lease.
+func (r *Recoverer) acquireLease(recoveryStateCtx *StateCtx, now time.Time) (bool, error) {
+	if !leaseAvailable(recoveryStateCtx.Current, now) {
+		return false, nil
+	}
+
+	nextRecoveryStateCtx := recoveryStateCtx.CopyTo(&StateCtx{})
+	setLease(nextRecoveryStateCtx, r.holder, now.Add(LeaseDuration))
+	if err := r.e.Do(Commit(Park(nextRecoveryStateCtx))); IsErrRevMismatch(err) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("commit recovery state: %w", err)
+	}
+
+	nextRecoveryStateCtx.CopyTo(recoveryStateCtx)
+
+	return true, nil
+}
+
 func (r *Recoverer) doRetry() error {
 	if len(r.states) == 0 {
 		return nil
@@ -419,53 +539,108 @@ func (r *Recoverer) doRetry() error {
 
 	states := make([]State, 0)
 
-	for id, retState := range r.states {
+	for _, retState := range r.states {
 		if retState.retryAt.After(r.headTime) {
 			continue
 		}
 
 		states = append(states, retState.State.CopyTo(&State{}))
-		delete(r.states, id)
 	}
 
 	for _, state := range states {
-		maxAttempts := MaxRecoveryAttempts(state)
-		attempt := RecoveryAttempt(state) + 1
-		stateCtx := state.CopyToCtx(&StateCtx{})
+		// the execution is admitted before the commit, so the loop never blocks with the lease renewal waiting behind it;
+		// states left once the engine has too many submitted executions are retried on the next tick, see ConcurrencyLimits.MaxSubmitted
+		if !r.e.limiter.tryAdmit() {
+			return nil
+		}
+		delete(r.states, state.ID)
 
-		setRecoveryAttempt(stateCtx, attempt)
-		if attempt > maxAttempts {
-			if err := r.e.Do(Commit(Park(stateCtx))); IsErrRevMismatch(err) {
-				continue
+		stateCtx, err := r.retry(state)
+		if stateCtx == nil {
+			r.e.limiter.unadmit()
+		} else {
+			r.e.submitAdmitted(r.ctx, stateCtx)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// retry commits the next recovery attempt of the state, or drops the state once attempts are exhausted.
+// It returns the state to execute, nil if there is nothing to execute.
+func (r *Recoverer) retry(state State) (*StateCtx, error) {
+	policy := r.e.retryPolicy(state)
+	attempt := RecoveryAttempt(state) + 1
+	stateCtx := state.CopyToCtx(&StateCtx{})
+
+	var reason string
+	if class, ok := policy.nonRetryable(state); ok {
+		reason = fmt.Sprintf("non-retryable error class %s", class)
+	} else if attempt > policy.MaxAttempts {
+		reason = fmt.Sprintf("max recovery attempts %d reached", policy.MaxAttempts)
+	}
+
+	setRecoveryAttempt(stateCtx, attempt)
+	if reason != `` {
+		if compensateCmd := sagaRecoveryExhaustedCommand(stateCtx); compensateCmd != nil {
+			if err := r.e.Do(Commit(compensateCmd)); IsErrRevMismatch(err) {
+				return nil, nil
 			} else if err != nil {
-				return fmt.Errorf("commit state %s:%d reached max retry attempts %d and forcfully ended: %s", state.ID, state.Rev, maxAttempts, err)
+				return nil, fmt.Errorf("commit state %s:%d %s and saga compensation: %s", state.ID, state.Rev, reason, err)
 			}
 
 			r.dropped++
-			continue
+			r.eventsTotal.inc(`dropped`)
+			return stateCtx, nil
 		}
 
-		transitCmd := Transit(stateCtx, stateCtx.Current.Transition.To).
-			WithAnnotations(stateCtx.Current.Transition.Annotations)
+		if receiveCmd := actorRecoveryExhaustedCommand(stateCtx); receiveCmd != nil {
+			if err := r.e.Do(receiveCmd); IsErrRevMismatch(err) {
+				return nil, nil
+			} else if err != nil {
+				return nil, fmt.Errorf("commit actor state %s:%d %s and receive next message: %s", state.ID, state.Rev, reason, err)
+			}
 
-		if err := r.e.Do(
-			Commit(transitCmd),
-			Execute(stateCtx),
-		); IsErrRevMismatch(err) {
-			continue
+			r.dropped++
+			r.eventsTotal.inc(`dropped`)
+			return nil, nil
+		}
+
+		if err := r.e.Do(deadLetterCommand(stateCtx, reason)); IsErrRevMismatch(err) {
+			return nil, nil
 		} else if err != nil {
-			return fmt.Errorf("commit state %s:%d recovery attempt %d: %s", state.ID, state.Rev, attempt, err)
+			return nil, fmt.Errorf("commit state %s:%d %s and dead-lettered: %s", state.ID, state.Rev, reason, err)
 		}
 
-		r.retried++
+		r.dropped++
+		r.eventsTotal.inc(`dropped`)
+		if Parked(stateCtx.Current) {
+			return nil, nil
+		}
+		return stateCtx, nil
 	}
 
-	return nil
+	transitCmd := Transit(stateCtx, stateCtx.Current.Transition.To).
+		WithAnnotations(stateCtx.Current.Transition.Annotations)
+
+	if err := r.e.Do(Commit(transitCmd)); IsErrRevMismatch(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("commit state %s:%d recovery attempt %d: %s", state.ID, state.Rev, attempt, err)
+	}
+
+	r.retried++
+	r.eventsTotal.inc(`retried`)
+	return stateCtx, nil
 }
 
 func (r *Recoverer) reset(recoveryStateCtx *StateCtx, active bool) {
 	r.active = active
 	r.recoveryStateCtx = recoveryStateCtx.CopyTo(&StateCtx{})
+	r.sinceRevCommitedAt = r.recoveryStateCtx.Committed.CommittedAt
 
 	r.sinceRev = getRecoverySinceRev(r.recoveryStateCtx)
 	r.headRev = r.sinceRev
@@ -583,15 +583,17 @@ func TestRecovererCrashStandbyBecomeActive(t *testing.T) {
 		}
 
 		// simulate a crash of the active recoverer
-		// by commit state that suggest there a running recoverer
+		// by commit state that suggest there a running recoverer holding the lease
 		recoverStateCtx := &flowstate.StateCtx{
 			Current: flowstate.State{
 				ID: `flowstate.recovery.meta`,
 			},
 		}
 		flowstate.DisableRecovery(recoverStateCtx)
+		recoverStateCtx.Current.SetAnnotation(flowstate.LeaseHolderAnnotation, `crashed`)
+		recoverStateCtx.Current.SetAnnotation(flowstate.LeaseExpiresAtAnnotation, time.Now().Add(flowstate.LeaseDuration).UTC().Format(time.RFC3339))
 		if err := e.Do(flowstate.Commit(
-			flowstate.Park(recoverStateCtx).WithAnnotation(`state`, `active`),
+			flowstate.Park(recoverStateCtx),
 		)); err != nil {
 			t.Fatalf("failed to commit recovery state: %v", err)
 		}
@@ -0,0 +1,205 @@
+package flowstate
+
+import (
+	"errors"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var RetryInitialIntervalAnnotation = `flowstate.recovery.initial_interval`
+var RetryMultiplierAnnotation = `flowstate.recovery.multiplier`
+var RetryMaxIntervalAnnotation = `flowstate.recovery.max_interval`
+var RetryJitterAnnotation = `flowstate.recovery.jitter`
+var RetryNonRetryableAnnotation = `flowstate.recovery.non_retryable`
+
+// PanicErrorClass is the class of errors caused by flow panics, see ErrorClass.
+const PanicErrorClass = `panic`
+
+// maxRetryInterval caps the backoff interval grown by RetryPolicy.Multiplier, so it never overflows time.Duration.
+const maxRetryInterval = time.Hour * 24 * 365
+
+// RetryPolicy tells Recoverer when and how many times to retry a state, see SetRetryPolicy and Engine.SetFlowRetryPolicy.
+//
+// With InitialInterval set the state is retried after InitialInterval*Multiplier^attempt, capped by MaxInterval
+// and randomized by ±Jitter fraction of it; the interval is not bounded by MinRetryAfter and MaxRetryAfter.
+// Otherwise, the state is retried after RetryAfter bounded by MinRetryAfter and MaxRetryAfter, DefaultRetryAfter if not set.
+type RetryPolicy struct {
+	// MaxAttempts limits recovery attempts, DefaultMaxRecoveryAttempts if not set.
+	MaxAttempts int      `json:"max_attempts,omitempty" yaml:"max_attempts,omitempty"`
+	RetryAfter  Duration `json:"retry_after,omitempty" yaml:"retry_after,omitempty"`
+
+	InitialInterval Duration `json:"initial_interval,omitempty" yaml:"initial_interval,omitempty"`
+	// Multiplier grows the interval with every attempt, values below 1 keep the interval constant.
+	Multiplier  float64  `json:"multiplier,omitempty" yaml:"multiplier,omitempty"`
+	MaxInterval Duration `json:"max_interval,omitempty" yaml:"max_interval,omitempty"`
+	// Jitter is a fraction of the interval from 0 to 1.
+	Jitter float64 `json:"jitter,omitempty" yaml:"jitter,omitempty"`
+
+	// NonRetryable lists error classes, see ErrorClass, of failures the state is dead-lettered right away on.
+	NonRetryable []string `json:"non_retryable,omitempty" yaml:"non_retryable,omitempty"`
+}
+
+// SetRetryPolicy stores the policy on the state, set fields take precedence over the flow retry policy.
+func SetRetryPolicy(stateCtx *StateCtx, policy RetryPolicy) {
+	if policy.MaxAttempts > 0 {
+		SetMaxRecoveryAttempts(stateCtx, policy.MaxAttempts)
+	}
+	if policy.RetryAfter > 0 {
+		SetRetryAfter(stateCtx, time.Duration(policy.RetryAfter))
+	}
+	if policy.InitialInterval > 0 {
+		stateCtx.Current.SetAnnotation(RetryInitialIntervalAnnotation, time.Duration(policy.InitialInterval).String())
+	}
+	if policy.Multiplier > 0 {
+		stateCtx.Current.SetAnnotation(RetryMultiplierAnnotation, strconv.FormatFloat(policy.Multiplier, 'f', -1, 64))
+	}
+	if policy.MaxInterval > 0 {
+		stateCtx.Current.SetAnnotation(RetryMaxIntervalAnnotation, time.Duration(policy.MaxInterval).String())
+	}
+	if policy.Jitter > 0 {
+		stateCtx.Current.SetAnnotation(RetryJitterAnnotation, strconv.FormatFloat(policy.Jitter, 'f', -1, 64))
+	}
+	if len(policy.NonRetryable) > 0 {
+		stateCtx.Current.SetAnnotation(RetryNonRetryableAnnotation, strings.Join(policy.NonRetryable, `,`))
+	}
+}
+
+// SetFlowRetryPolicy sets the retry policy for states failed in the flow.
+func (e *Engine) SetFlowRetryPolicy(flowID FlowID, policy RetryPolicy) {
+	e.retryPoliciesMux.Lock()
+	defer e.retryPoliciesMux.Unlock()
+
+	if e.retryPolicies == nil {
+		e.retryPolicies = make(map[FlowID]RetryPolicy)
+	}
+	e.retryPolicies[flowID] = policy
+}
+
+// minRetryInterval returns the smallest initial interval of flow retry policies, zero if none is set.
+func (e *Engine) minRetryInterval() time.Duration {
+	e.retryPoliciesMux.RLock()
+	defer e.retryPoliciesMux.RUnlock()
+
+	var interval time.Duration
+	for _, policy := range e.retryPolicies {
+		if policy.InitialInterval > 0 && (interval == 0 || time.Duration(policy.InitialInterval) < interval) {
+			interval = time.Duration(policy.InitialInterval)
+		}
+	}
+
+	return interval
+}
+
+// retryPolicy returns the policy of the state merged over the policy of the flow the state failed in.
+func (e *Engine) retryPolicy(state State) RetryPolicy {
+	e.retryPoliciesMux.RLock()
+	policy := e.retryPolicies[state.Transition.To]
+	e.retryPoliciesMux.RUnlock()
+
+	if v, ok := state.Annotations[MaxRecoveryAttemptsAnnotation]; ok {
+		policy.MaxAttempts, _ = strconv.Atoi(v)
+	}
+	if v, ok := state.Annotations[RetryAfterAnnotation]; ok {
+		d, _ := time.ParseDuration(v)
+		policy.RetryAfter = Duration(d)
+	}
+	if v, ok := state.Annotations[RetryInitialIntervalAnnotation]; ok {
+		d, _ := time.ParseDuration(v)
+		policy.InitialInterval = Duration(d)
+	}
+	if v, ok := state.Annotations[RetryMultiplierAnnotation]; ok {
+		policy.Multiplier, _ = strconv.ParseFloat(v, 64)
+	}
+	if v, ok := state.Annotations[RetryMaxIntervalAnnotation]; ok {
+		d, _ := time.ParseDuration(v)
+		policy.MaxInterval = Duration(d)
+	}
+	if v, ok := state.Annotations[RetryJitterAnnotation]; ok {
+		policy.Jitter, _ = strconv.ParseFloat(v, 64)
+	}
+	if v, ok := state.Annotations[RetryNonRetryableAnnotation]; ok {
+		policy.NonRetryable = strings.Split(v, `,`)
+	}
+
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = DefaultMaxRecoveryAttempts
+	}
+
+	return policy
+}
+
+// retryAt returns the time the state is retried at according to the policy.
+func (policy RetryPolicy) retryAt(state State) time.Time {
+	if policy.InitialInterval <= 0 {
+		retryAfter := time.Duration(policy.RetryAfter)
+		if retryAfter <= 0 {
+			retryAfter = DefaultRetryAfter
+		}
+
+		return state.CommittedAt.Add(min(max(retryAfter, MinRetryAfter), MaxRetryAfter))
+	}
+
+	interval := float64(policy.InitialInterval)
+	if policy.Multiplier > 1 {
+		interval *= math.Pow(policy.Multiplier, float64(RecoveryAttempt(state)))
+	}
+	if policy.MaxInterval > 0 {
+		interval = min(interval, float64(policy.MaxInterval))
+	}
+	interval = min(interval, float64(maxRetryInterval))
+	if jitter := min(policy.Jitter, 1); jitter > 0 {
+		interval += interval * jitter * (rand.Float64()*2 - 1)
+	}
+
+	return state.CommittedAt.Add(time.Duration(interval))
+}
+
+// nonRetryable returns the class of the state failure if the policy does not retry it.
+func (policy RetryPolicy) nonRetryable(state State) (string, bool) {
+	class := state.Transition.Annotations[FailureClassAnnotation]
+	if class == `` || !slices.Contains(policy.NonRetryable, class) {
+		return ``, false
+	}
+
+	return class, true
+}
+
+// WithErrorClass tags the error returned by a flow with the class, see RetryPolicy.NonRetryable.
+func WithErrorClass(err error, class string) error {
+	return &classError{
+		err:   err,
+		class: class,
+	}
+}
+
+// ErrorClass returns the class of the error, PanicErrorClass for flow panics, or an empty string if the error is not tagged with WithErrorClass.
+func ErrorClass(err error) string {
+	var classErr *classError
+	if errors.As(err, &classErr) {
+		return classErr.class
+	}
+
+	var panicErr *PanicError
+	if errors.As(err, &panicErr) {
+		return PanicErrorClass
+	}
+
+	return ``
+}
+
+type classError struct {
+	err   error
+	class string
+}
+
+func (err *classError) Error() string {
+	return err.err.Error()
+}
+
+func (err *classError) Unwrap() error {
+	return err.err
+}
@@ -0,0 +1,155 @@
+//go:build goexperiment.synctest
+
+package flowstate_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/makasim/flowstate"
+	"github.com/makasim/flowstate/memdriver"
+	"github.com/thejerf/slogassert"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	// expIntervals are intervals between runs, Recoverer may retry up to a couple of ticks late.
+	f := func(flowPolicy, statePolicy flowstate.RetryPolicy, flowErr error, expIntervals []time.Duration, expReason string) {
+		t.Helper()
+
+		synctest.Test(t, func(t *testing.T) {
+			lh := slogassert.New(t, slog.LevelDebug, nil)
+			l := slog.New(slogassert.New(t, slog.LevelDebug, lh))
+
+			actMux := &sync.Mutex{}
+			actRuns := make([]time.Time, 0)
+
+			d := memdriver.New(l)
+			fr := &flowstate.DefaultFlowRegistry{}
+			mustSetFlow(fr, `work`, flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+				actMux.Lock()
+				actRuns = append(actRuns, time.Now())
+				actMux.Unlock()
+
+				return nil, flowErr
+			}))
+
+			e, err := flowstate.NewEngine(d, fr, l)
+			if err != nil {
+				t.Fatalf("failed to create engine: %v", err)
+			}
+			defer func() {
+				if err := e.Shutdown(context.Background()); err != nil {
+					t.Fatalf("failed to shutdown engine: %v", err)
+				}
+			}()
+			e.SetFlowRetryPolicy(`work`, flowPolicy)
+
+			r, err := flowstate.NewRecoverer(e, l)
+			if err != nil {
+				t.Fatalf("failed to create recoverer: %v", err)
+			}
+			defer func() {
+				if err := r.Shutdown(context.Background()); err != nil {
+					t.Fatalf("failed to shutdown recoverer: %v", err)
+				}
+			}()
+
+			stateCtx := &flowstate.StateCtx{
+				Current: flowstate.State{
+					ID: `aTID`,
+				},
+			}
+			flowstate.SetRetryPolicy(stateCtx, statePolicy)
+			if err := e.Do(flowstate.Commit(flowstate.Transit(stateCtx, `work`))); err != nil {
+				t.Fatalf("failed to commit: %v", err)
+			}
+			if err := e.Execute(stateCtx); err == nil {
+				t.Fatalf("expected execution error")
+			}
+
+			time.Sleep(time.Minute * 5)
+			synctest.Wait()
+
+			deadLetter, err := flowstate.GetDeadLetter(d, `aTID`)
+			if expReason == `` && !errors.Is(err, flowstate.ErrNotFound) {
+				t.Errorf("expected state not dead-lettered, got %v", err)
+			} else if expReason != `` && err != nil {
+				t.Fatalf("failed to get dead letter: %v", err)
+			}
+			if actReason := deadLetter.Transition.Annotations[flowstate.DeadLetterReasonAnnotation]; actReason != expReason {
+				t.Errorf("expected reason %q, got %q", expReason, actReason)
+			}
+
+			actMux.Lock()
+			defer actMux.Unlock()
+			actIntervals := make([]time.Duration, 0, len(actRuns))
+			for i := 1; i < len(actRuns); i++ {
+				actIntervals = append(actIntervals, actRuns[i].Sub(actRuns[i-1]).Truncate(time.Second))
+			}
+			if len(expIntervals) != len(actIntervals) {
+				t.Fatalf("expected intervals %v, got %v", expIntervals, actIntervals)
+			}
+			for i := range expIntervals {
+				if actIntervals[i] < expIntervals[i] || actIntervals[i] > expIntervals[i]+time.Second*2 {
+					t.Errorf("expected intervals %v, got %v", expIntervals, actIntervals)
+					break
+				}
+			}
+		})
+	}
+
+	// flow policy, exponential backoff
+	f(flowstate.RetryPolicy{
+		MaxAttempts:     3,
+		InitialInterval: flowstate.Duration(time.Second * 5),
+		Multiplier:      2,
+	}, flowstate.RetryPolicy{}, fmt.Errorf("service unavailable"), []time.Duration{
+		time.Second * 5,
+		time.Second * 10,
+		time.Second * 20,
+	}, `max recovery attempts 3 reached`)
+
+	// flow policy, backoff capped by max interval
+	f(flowstate.RetryPolicy{
+		MaxAttempts:     3,
+		InitialInterval: flowstate.Duration(time.Second * 5),
+		Multiplier:      3,
+		MaxInterval:     flowstate.Duration(time.Second * 10),
+	}, flowstate.RetryPolicy{}, fmt.Errorf("service unavailable"), []time.Duration{
+		time.Second * 5,
+		time.Second * 10,
+		time.Second * 10,
+	}, `max recovery attempts 3 reached`)
+
+	// flow policy, backoff grown past time.Duration is capped instead of overflowing
+	f(flowstate.RetryPolicy{
+		MaxAttempts:     3,
+		InitialInterval: flowstate.Duration(time.Second * 5),
+		Multiplier:      1e300,
+	}, flowstate.RetryPolicy{}, fmt.Errorf("service unavailable"), []time.Duration{
+		time.Second * 5,
+	}, ``)
+
+	// state policy overrides flow policy
+	f(flowstate.RetryPolicy{
+		MaxAttempts:     3,
+		InitialInterval: flowstate.Duration(time.Second * 5),
+	}, flowstate.RetryPolicy{
+		MaxAttempts:     1,
+		InitialInterval: flowstate.Duration(time.Second * 2),
+	}, fmt.Errorf("service unavailable"), []time.Duration{
+		time.Second * 2,
+	}, `max recovery attempts 1 reached`)
+
+	// non-retryable error class
+	f(flowstate.RetryPolicy{
+		InitialInterval: flowstate.Duration(time.Second * 5),
+		NonRetryable:    []string{`validation`},
+	}, flowstate.RetryPolicy{}, flowstate.WithErrorClass(fmt.Errorf("invalid input"), `validation`), []time.Duration{}, `non-retryable error class validation`)
+}
@@ -0,0 +1,177 @@
+package flowstate
+
+import (
+	"fmt"
+	"strings"
+)
+
+var SagaAnnotation = `flowstate.saga`
+var SagaStatusAnnotation = `flowstate.saga.status`
+var SagaCompletedAnnotation = `flowstate.saga.completed`
+var SagaErrorAnnotation = `flowstate.saga.error`
+
+const (
+	SagaRunning      = `running`
+	SagaCompensating = `compensating`
+	SagaCompleted    = `completed`
+	SagaCompensated  = `compensated`
+)
+
+// Saga is a flow that executes steps one by one and, once a step fails, executes compensations of completed steps in reverse order.
+//
+// The saga is registered in a flow registry under its name, a state starts the saga by transiting to it.
+// Step and compensation flows are regular flows; they must return SagaNext to hand the state back to the saga or SagaFail to start compensation.
+// A step that keeps failing until MaxRecoveryAttempts is exhausted is compensated by the Recoverer.
+//
+// Progress is recorded in the state annotations so the saga survives crashes; see SagaStatusAnnotation and SagaCompletedAnnotation.
+type Saga struct {
+	name  FlowID
+	steps []SagaStep
+
+	onCompleted   FlowID
+	onCompensated FlowID
+}
+
+type SagaStep struct {
+	Flow       FlowID
+	Compensate FlowID
+}
+
+func NewSaga(name FlowID) *Saga {
+	return &Saga{
+		name: name,
+	}
+}
+
+// Step adds a step with an optional compensation flow.
+func (s *Saga) Step(flow, compensate FlowID) *Saga {
+	s.steps = append(s.steps, SagaStep{
+		Flow:       flow,
+		Compensate: compensate,
+	})
+	return s
+}
+
+// OnCompleted sets a flow the state transits to once all steps are completed, the state is parked otherwise.
+func (s *Saga) OnCompleted(to FlowID) *Saga {
+	s.onCompleted = to
+	return s
+}
+
+// OnCompensated sets a flow the state transits to once compensation is finished, the state is parked otherwise.
+func (s *Saga) OnCompensated(to FlowID) *Saga {
+	s.onCompensated = to
+	return s
+}
+
+func (s *Saga) Name() FlowID {
+	return s.name
+}
+
+func (s *Saga) Execute(stateCtx *StateCtx, _ *Engine) (Command, error) {
+	if stateCtx.Current.Annotations[SagaAnnotation] != string(s.name) {
+		stateCtx.Current.SetAnnotation(SagaAnnotation, string(s.name))
+		stateCtx.Current.SetAnnotation(SagaStatusAnnotation, SagaRunning)
+		stateCtx.Current.SetAnnotation(SagaCompletedAnnotation, ``)
+		delete(stateCtx.Current.Annotations, SagaErrorAnnotation)
+	}
+
+	completed := SagaCompletedSteps(stateCtx.Current)
+	if len(completed) > len(s.steps) {
+		return nil, fmt.Errorf("saga %s: %d steps completed but only %d defined", s.name, len(completed), len(s.steps))
+	}
+	for i, step := range completed {
+		if s.steps[i].Flow != step {
+			return nil, fmt.Errorf("saga %s: completed step %d is %s but %s defined", s.name, i, step, s.steps[i].Flow)
+		}
+	}
+
+	switch status := SagaStatus(stateCtx.Current); status {
+	case SagaRunning:
+		if len(completed) < len(s.steps) {
+			return Commit(Transit(stateCtx, s.steps[len(completed)].Flow)), nil
+		}
+
+		stateCtx.Current.SetAnnotation(SagaStatusAnnotation, SagaCompleted)
+		return s.end(stateCtx, s.onCompleted), nil
+	case SagaCompensating:
+		for len(completed) > 0 {
+			completed = completed[:len(completed)-1]
+			setSagaCompletedSteps(stateCtx, completed)
+
+			if compensate := s.steps[len(completed)].Compensate; compensate != `` {
+				return Commit(Transit(stateCtx, compensate)), nil
+			}
+		}
+
+		stateCtx.Current.SetAnnotation(SagaStatusAnnotation, SagaCompensated)
+		return s.end(stateCtx, s.onCompensated), nil
+	default:
+		return nil, fmt.Errorf("saga %s: unexpected status %q", s.name, status)
+	}
+}
+
+func (s *Saga) end(stateCtx *StateCtx, to FlowID) Command {
+	if to == `` {
+		return Commit(Park(stateCtx))
+	}
+
+	return Commit(Transit(stateCtx, to))
+}
+
+// SagaNext hands the state back to the saga once a step or a compensation has succeeded.
+func SagaNext(stateCtx *StateCtx) *TransitCommand {
+	if SagaStatus(stateCtx.Current) == SagaRunning {
+		setSagaCompletedSteps(stateCtx, append(SagaCompletedSteps(stateCtx.Current), stateCtx.Current.Transition.To))
+	}
+
+	return Transit(stateCtx, FlowID(stateCtx.Current.Annotations[SagaAnnotation]))
+}
+
+// SagaFail hands the state back to the saga to compensate completed steps.
+func SagaFail(stateCtx *StateCtx, reason string) *TransitCommand {
+	stateCtx.Current.SetAnnotation(SagaStatusAnnotation, SagaCompensating)
+	stateCtx.Current.SetAnnotation(SagaErrorAnnotation, reason)
+
+	return Transit(stateCtx, FlowID(stateCtx.Current.Annotations[SagaAnnotation]))
+}
+
+// SagaStatus returns the saga status of the state or an empty string if the state is not in a saga.
+func SagaStatus(state State) string {
+	return state.Annotations[SagaStatusAnnotation]
+}
+
+// SagaCompletedSteps returns flows of the saga steps completed and not yet compensated.
+func SagaCompletedSteps(state State) []FlowID {
+	completedStr := state.Annotations[SagaCompletedAnnotation]
+	if completedStr == `` {
+		return nil
+	}
+
+	var completed []FlowID
+	for _, step := range strings.Split(completedStr, `,`) {
+		completed = append(completed, FlowID(step))
+	}
+
+	return completed
+}
+
+func setSagaCompletedSteps(stateCtx *StateCtx, completed []FlowID) {
+	steps := make([]string, 0, len(completed))
+	for _, step := range completed {
+		steps = append(steps, string(step))
+	}
+
+	stateCtx.Current.SetAnnotation(SagaCompletedAnnotation, strings.Join(steps, `,`))
+}
+
+// sagaRecoveryExhaustedCommand returns a command that starts compensation of a saga step that exhausted recovery attempts.
+// It returns nil if the state is not executing a saga step.
+func sagaRecoveryExhaustedCommand(stateCtx *StateCtx) Command {
+	saga := FlowID(stateCtx.Current.Annotations[SagaAnnotation])
+	if saga == `` || SagaStatus(stateCtx.Current) != SagaRunning || stateCtx.Current.Transition.To == saga {
+		return nil
+	}
+
+	return SagaFail(stateCtx, fmt.Sprintf("flow %s exhausted recovery attempts", stateCtx.Current.Transition.To))
+}
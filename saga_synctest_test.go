@@ -0,0 +1,88 @@
+//go:build goexperiment.synctest
+
+package flowstate_test
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/makasim/flowstate"
+	"github.com/makasim/flowstate/memdriver"
+)
+
+func TestSaga_CompensateOnRecoveryExhausted(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		l := slog.New(slog.DiscardHandler)
+
+		d := memdriver.New(l)
+		fr := &flowstate.DefaultFlowRegistry{}
+
+		var compensated bool
+		mustSetFlow(fr, `order`, flowstate.NewSaga(`order`).
+			Step(`reserve`, `release`).
+			Step(`charge`, ``),
+		)
+		mustSetFlow(fr, `reserve`, flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+			return flowstate.Commit(flowstate.SagaNext(stateCtx)), nil
+		}))
+		mustSetFlow(fr, `charge`, flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+			return nil, fmt.Errorf("payment service unavailable")
+		}))
+		mustSetFlow(fr, `release`, flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+			compensated = true
+			return flowstate.Commit(flowstate.SagaNext(stateCtx)), nil
+		}))
+
+		e, err := flowstate.NewEngine(d, fr, l)
+		if err != nil {
+			t.Fatalf("failed to create engine: %v", err)
+		}
+
+		r, err := flowstate.NewRecoverer(e, l)
+		if err != nil {
+			t.Fatalf("failed to create recoverer: %v", err)
+		}
+
+		stateCtx := &flowstate.StateCtx{
+			Current: flowstate.State{
+				ID: `anOrderID`,
+			},
+		}
+		if err := e.Do(flowstate.Commit(flowstate.Transit(stateCtx, `order`))); err != nil {
+			t.Fatalf("failed to commit: %v", err)
+		}
+		go func() {
+			_ = e.Execute(stateCtx)
+		}()
+		synctest.Wait()
+
+		time.Sleep(time.Hour)
+		synctest.Wait()
+
+		if err := r.Shutdown(context.Background()); err != nil {
+			t.Fatalf("failed to shutdown recoverer: %v", err)
+		}
+		if err := e.Shutdown(context.Background()); err != nil {
+			t.Fatalf("failed to shutdown engine: %v", err)
+		}
+
+		foundStateCtx := &flowstate.StateCtx{}
+		if err := d.GetStateByID(flowstate.GetStateByID(foundStateCtx, `anOrderID`, 0)); err != nil {
+			t.Fatalf("failed to get state: %v", err)
+		}
+
+		if !compensated {
+			t.Errorf("expected reserve step compensated")
+		}
+		if !flowstate.Parked(foundStateCtx.Current) {
+			t.Errorf("expected state parked")
+		}
+		if status := flowstate.SagaStatus(foundStateCtx.Current); status != flowstate.SagaCompensated {
+			t.Errorf("expected saga status %s; got %s", flowstate.SagaCompensated, status)
+		}
+	})
+}
@@ -0,0 +1,504 @@
+package flowstate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gorhill/cronexpr"
+)
+
+var ScheduleLabel = `flowstate.schedule`
+var ScheduleCronAnnotation = `flowstate.schedule.cron`
+var ScheduleTimezoneAnnotation = `flowstate.schedule.timezone`
+var ScheduleFlowAnnotation = `flowstate.schedule.flow`
+var SchedulePayloadAnnotation = `flowstate.schedule.payload`
+var ScheduleOverlapAnnotation = `flowstate.schedule.overlap`
+var ScheduleCatchUpAnnotation = `flowstate.schedule.catch_up`
+var SchedulePausedAnnotation = `flowstate.schedule.paused`
+var ScheduleDeletedAnnotation = `flowstate.schedule.deleted`
+var ScheduleNextAnnotation = `flowstate.schedule.next`
+var ScheduleLastTaskAnnotation = `flowstate.schedule.last_task`
+
+// ScheduleIDAnnotation and ScheduledAtAnnotation are set to task states along with SchedulePayloadAnnotation.
+var ScheduleIDAnnotation = `flowstate.schedule.id`
+var ScheduledAtAnnotation = `flowstate.schedule.at`
+
+// OverlapPolicy defines what happens to an occurrence if the task of the previous one is still running.
+type OverlapPolicy string
+
+const (
+	// OverlapAllow starts a task regardless of the previous one.
+	OverlapAllow OverlapPolicy = `allow`
+	// OverlapSkip skips the occurrence if the previous task is not parked yet.
+	OverlapSkip OverlapPolicy = `skip`
+)
+
+// CatchUpPolicy defines what happens to occurrences missed while no scheduler was running.
+type CatchUpPolicy string
+
+const (
+	// CatchUpLatest starts a single task for the latest missed occurrence.
+	CatchUpLatest CatchUpPolicy = `latest`
+	// CatchUpAll starts a task for every missed occurrence.
+	CatchUpAll CatchUpPolicy = `all`
+	// CatchUpSkip starts no tasks for missed occurrences.
+	CatchUpSkip CatchUpPolicy = `skip`
+)
+
+// scheduleMisfireThreshold is how late an occurrence could be started and not be considered missed.
+const scheduleMisfireThreshold = time.Minute
+
+// scheduleCatchUpLimit limits occurrences handled by a single scheduler tick.
+const scheduleCatchUpLimit = 100
+
+// Schedule starts tasks in the given flow according to a cron expression.
+// It is stored as a parked state with ScheduleLabel, see CreateSchedule.
+type Schedule struct {
+	ID StateID
+	// Cron expression, seconds and years fields are optional; see github.com/gorhill/cronexpr.
+	Cron string
+	// Timezone the cron expression is evaluated in, UTC if empty.
+	Timezone string
+	Flow     FlowID
+	// Payload is set to task states in SchedulePayloadAnnotation.
+	Payload string
+	Overlap OverlapPolicy
+	CatchUp CatchUpPolicy
+
+	Paused   bool
+	Next     time.Time
+	LastTask StateID
+}
+
+// Scheduled returns the schedule ID, the occurrence time and the payload of a task state started by the Scheduler.
+func Scheduled(state State) (id StateID, at time.Time, payload string, ok bool) {
+	id = StateID(state.Annotations[ScheduleIDAnnotation])
+	if id == `` {
+		return ``, time.Time{}, ``, false
+	}
+
+	at, _ = time.Parse(time.RFC3339, state.Annotations[ScheduledAtAnnotation])
+	return id, at, state.Annotations[SchedulePayloadAnnotation], true
+}
+
+// CreateSchedule stores the schedule, the first task is started at the next occurrence after now.
+// It fails if a schedule with the same ID exists, a deleted schedule is replaced.
+func CreateSchedule(e *Engine, s Schedule) error {
+	if s.ID == `` {
+		return fmt.Errorf("schedule id empty")
+	}
+	if s.Flow == `` {
+		return fmt.Errorf("flow id empty")
+	}
+	if s.Overlap == `` {
+		s.Overlap = OverlapAllow
+	}
+	if s.Overlap != OverlapAllow && s.Overlap != OverlapSkip {
+		return fmt.Errorf("overlap policy %q not supported", s.Overlap)
+	}
+	if s.CatchUp == `` {
+		s.CatchUp = CatchUpLatest
+	}
+	if s.CatchUp != CatchUpLatest && s.CatchUp != CatchUpAll && s.CatchUp != CatchUpSkip {
+		return fmt.Errorf("catch up policy %q not supported", s.CatchUp)
+	}
+
+	expr, loc, err := parseSchedule(s.Cron, s.Timezone)
+	if err != nil {
+		return err
+	}
+
+	s.Next = expr.Next(time.Now().In(loc))
+	if s.Next.IsZero() {
+		return fmt.Errorf("cron expression %q has no next occurrence", s.Cron)
+	}
+
+	stateCtx := &StateCtx{}
+	if err := e.Do(GetStateByID(stateCtx, scheduleStateID(s.ID), 0)); errors.Is(err, ErrNotFound) {
+		stateCtx.Current = State{
+			ID: scheduleStateID(s.ID),
+		}
+	} else if err != nil {
+		return fmt.Errorf("get schedule state: %w", err)
+	} else if stateCtx.Current.Annotations[ScheduleDeletedAnnotation] == `` {
+		return fmt.Errorf("schedule %s already exists", s.ID)
+	}
+
+	stateCtx.Current.Labels = map[string]string{
+		ScheduleLabel: `true`,
+	}
+	stateCtx.Current.Annotations = nil
+	stateCtx.Current.SetAnnotation(ScheduleCronAnnotation, s.Cron)
+	stateCtx.Current.SetAnnotation(ScheduleTimezoneAnnotation, s.Timezone)
+	stateCtx.Current.SetAnnotation(ScheduleFlowAnnotation, string(s.Flow))
+	stateCtx.Current.SetAnnotation(SchedulePayloadAnnotation, s.Payload)
+	stateCtx.Current.SetAnnotation(ScheduleOverlapAnnotation, string(s.Overlap))
+	stateCtx.Current.SetAnnotation(ScheduleCatchUpAnnotation, string(s.CatchUp))
+	stateCtx.Current.SetAnnotation(ScheduleNextAnnotation, s.Next.Format(time.RFC3339))
+
+	return e.Do(Commit(Park(stateCtx)))
+}
+
+// GetSchedule returns the schedule, it returns ErrNotFound if the schedule does not exist or was deleted.
+func GetSchedule(e *Engine, id StateID) (Schedule, error) {
+	stateCtx, err := getScheduleStateCtx(e, id)
+	if err != nil {
+		return Schedule{}, err
+	}
+
+	return scheduleFromState(stateCtx.Current), nil
+}
+
+// PauseSchedule stops starting tasks until the schedule is resumed.
+func PauseSchedule(e *Engine, id StateID) error {
+	stateCtx, err := getScheduleStateCtx(e, id)
+	if err != nil {
+		return err
+	}
+	if stateCtx.Current.Annotations[SchedulePausedAnnotation] != `` {
+		return nil
+	}
+
+	stateCtx.Current.SetAnnotation(SchedulePausedAnnotation, `true`)
+	return e.Do(Commit(Park(stateCtx)))
+}
+
+// ResumeSchedule continues starting tasks from the next occurrence after now, occurrences passed while paused are skipped.
+func ResumeSchedule(e *Engine, id StateID) error {
+	stateCtx, err := getScheduleStateCtx(e, id)
+	if err != nil {
+		return err
+	}
+	if stateCtx.Current.Annotations[SchedulePausedAnnotation] == `` {
+		return nil
+	}
+
+	s := scheduleFromState(stateCtx.Current)
+	expr, loc, err := parseSchedule(s.Cron, s.Timezone)
+	if err != nil {
+		return err
+	}
+
+	delete(stateCtx.Current.Annotations, SchedulePausedAnnotation)
+	setScheduleNext(stateCtx, expr.Next(time.Now().In(loc)))
+	return e.Do(Commit(Park(stateCtx)))
+}
+
+// DeleteSchedule stops starting tasks, the schedule ID could be used by CreateSchedule again.
+// Already started tasks are not affected.
+func DeleteSchedule(e *Engine, id StateID) error {
+	stateCtx, err := getScheduleStateCtx(e, id)
+	if err != nil {
+		return err
+	}
+
+	stateCtx.Current.SetAnnotation(ScheduleDeletedAnnotation, `true`)
+	return e.Do(Commit(Park(stateCtx)))
+}
+
+func scheduleStateID(id StateID) StateID {
+	return `flowstate.schedule.` + id
+}
+
+func scheduleTaskID(id StateID, at time.Time) StateID {
+	return StateID(string(id) + `.` + strconv.FormatInt(at.Unix(), 10))
+}
+
+func getScheduleStateCtx(e *Engine, id StateID) (*StateCtx, error) {
+	stateCtx := &StateCtx{}
+	if err := e.Do(GetStateByID(stateCtx, scheduleStateID(id), 0)); err != nil {
+		return nil, err
+	}
+	if stateCtx.Current.Annotations[ScheduleDeletedAnnotation] != `` {
+		return nil, ErrNotFound
+	}
+
+	return stateCtx, nil
+}
+
+func scheduleFromState(state State) Schedule {
+	next, _ := time.Parse(time.RFC3339, state.Annotations[ScheduleNextAnnotation])
+
+	return Schedule{
+		ID:       state.ID[len(scheduleStateID(``)):],
+		Cron:     state.Annotations[ScheduleCronAnnotation],
+		Timezone: state.Annotations[ScheduleTimezoneAnnotation],
+		Flow:     FlowID(state.Annotations[ScheduleFlowAnnotation]),
+		Payload:  state.Annotations[SchedulePayloadAnnotation],
+		Overlap:  OverlapPolicy(state.Annotations[ScheduleOverlapAnnotation]),
+		CatchUp:  CatchUpPolicy(state.Annotations[ScheduleCatchUpAnnotation]),
+		Paused:   state.Annotations[SchedulePausedAnnotation] != ``,
+		Next:     next,
+		LastTask: StateID(state.Annotations[ScheduleLastTaskAnnotation]),
+	}
+}
+
+func setScheduleNext(stateCtx *StateCtx, next time.Time) {
+	if next.IsZero() {
+		// no more occurrences
+		delete(stateCtx.Current.Annotations, ScheduleNextAnnotation)
+		return
+	}
+
+	stateCtx.Current.SetAnnotation(ScheduleNextAnnotation, next.Format(time.RFC3339))
+}
+
+func parseSchedule(cron, timezone string) (*cronexpr.Expression, *time.Location, error) {
+	expr, err := cronexpr.Parse(cron)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parse cron expression %q: %w", cron, err)
+	}
+
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, nil, fmt.Errorf("load timezone %q: %w", timezone, err)
+	}
+
+	return expr, loc, nil
+}
+
+// Scheduler starts task states of schedules, see CreateSchedule.
+//
+// Several schedulers could run at the same time, each occurrence produces exactly one task state:
+// the task state is committed along with the schedule state advanced to the next occurrence,
+// so only one of concurrent commits succeeds. The task state ID is the schedule ID followed by the occurrence unix time.
+//
+// The scheduler keeps schedules in memory and reads only schedule states committed since the last tick,
+// so a tick checks next occurrence times without querying schedules that are not due.
+type Scheduler struct {
+	e *Engine
+
+	sinceRev  int64
+	schedules map[StateID]State
+
+	fired *metricVec
+
+	ctx       context.Context
+	cancel    context.CancelFunc
+	stopCh    chan struct{}
+	stoppedCh chan struct{}
+	l         *slog.Logger
+}
+
+func NewScheduler(e *Engine, l *slog.Logger) (*Scheduler, error) {
+	s := &Scheduler{
+		e: e,
+		l: l,
+
+		schedules: make(map[StateID]State),
+
+		fired: e.m.counter(`flowstate_scheduler_fired_total`, `Number of task states started by the scheduler.`),
+
+		stopCh:    make(chan struct{}),
+		stoppedCh: make(chan struct{}),
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+
+	go func() {
+		defer close(s.stoppedCh)
+
+		t := time.NewTicker(time.Second)
+		defer t.Stop()
+
+		for {
+			select {
+			case now := <-t.C:
+				if err := s.tick(now); err != nil {
+					s.l.Error(fmt.Sprintf("scheduler tick: %s; retrying", err))
+				}
+			case <-s.stopCh:
+				return
+			}
+		}
+	}()
+
+	return s, nil
+}
+
+func (s *Scheduler) Shutdown(ctx context.Context) error {
+	select {
+	case <-s.stopCh:
+		return fmt.Errorf(`already shutdown`)
+	default:
+		close(s.stopCh)
+		s.cancel()
+
+		select {
+		case <-s.stoppedCh:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (s *Scheduler) tick(now time.Time) error {
+	if err := s.updateSchedules(); err != nil {
+		return err
+	}
+
+	for _, state := range s.schedules {
+		if !scheduleDue(state, now) {
+			continue
+		}
+
+		if err := s.fire(state, now); IsErrRevMismatchContains(err, state.ID) {
+			// fired by another scheduler or changed concurrently, the next tick sees the latest state
+			continue
+		} else if err != nil {
+			s.l.Error(fmt.Sprintf("fire schedule; id=%s: %s", state.ID, err))
+		}
+	}
+
+	return nil
+}
+
+// updateSchedules reads schedule states committed since the last read, deleted schedules are forgotten.
+func (s *Scheduler) updateSchedules() error {
+	it := s.e.Iter(GetStatesByLabels(map[string]string{
+		ScheduleLabel: `true`,
+	}).WithSinceRev(s.sinceRev).WithLatestOnly())
+	for it.Next() {
+		state := it.State()
+		s.sinceRev = max(s.sinceRev, state.Rev)
+
+		if state.Annotations[ScheduleDeletedAnnotation] != `` {
+			delete(s.schedules, state.ID)
+			continue
+		}
+		s.schedules[state.ID] = state
+	}
+	if err := it.Err(); err != nil {
+		return fmt.Errorf("get schedules: %w", err)
+	}
+
+	return nil
+}
+
+func scheduleDue(state State, now time.Time) bool {
+	sch := scheduleFromState(state)
+	return !sch.Paused && !sch.Next.IsZero() && !sch.Next.After(now) && state.Annotations[ScheduleDeletedAnnotation] == ``
+}
+
+func (s *Scheduler) fire(state State, now time.Time) error {
+	if !scheduleDue(state, now) {
+		return nil
+	}
+
+	sch := scheduleFromState(state)
+
+	expr, loc, err := parseSchedule(sch.Cron, sch.Timezone)
+	if err != nil {
+		return err
+	}
+
+	var due []time.Time
+	next := sch.Next
+	for !next.IsZero() && !next.After(now) && len(due) < scheduleCatchUpLimit {
+		due = append(due, next)
+		next = expr.Next(next.In(loc))
+	}
+
+	switch sch.CatchUp {
+	case CatchUpAll:
+	case CatchUpSkip:
+		if now.Sub(due[len(due)-1]) > scheduleMisfireThreshold {
+			due = nil
+		} else {
+			due = due[len(due)-1:]
+		}
+	default:
+		due = due[len(due)-1:]
+	}
+
+	if sch.Overlap == OverlapSkip && len(due) > 0 {
+		due = due[len(due)-1:]
+
+		running, err := s.taskRunning(sch.LastTask)
+		if err != nil {
+			return err
+		}
+		if running {
+			due = nil
+		}
+	}
+
+	var skipped []StateID
+	for {
+		stateCtx := state.CopyToCtx(&StateCtx{})
+		setScheduleNext(stateCtx, next)
+
+		commitCmd := Commit(Park(stateCtx))
+		var taskStateCtxs []*StateCtx
+		for _, at := range due {
+			taskID := scheduleTaskID(sch.ID, at)
+			if slices.Contains(skipped, taskID) {
+				continue
+			}
+
+			taskStateCtx := &StateCtx{
+				Current: State{
+					ID: taskID,
+					Annotations: map[string]string{
+						ScheduleIDAnnotation:      string(sch.ID),
+						ScheduledAtAnnotation:     at.Format(time.RFC3339),
+						SchedulePayloadAnnotation: sch.Payload,
+					},
+				},
+			}
+
+			stateCtx.Current.SetAnnotation(ScheduleLastTaskAnnotation, string(taskID))
+			commitCmd.Commands = append(commitCmd.Commands, Transit(taskStateCtx, sch.Flow))
+			taskStateCtxs = append(taskStateCtxs, taskStateCtx)
+		}
+
+		err := s.e.Do(commitCmd)
+		if revErr := asErrRevMismatch(err); revErr != nil && !revErr.Contains(state.ID) && !slices.Contains(skipped, revErr.All()[0]) {
+			// states with IDs of these tasks already exist, the occurrences are considered done
+			skipped = append(skipped, revErr.All()...)
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		for _, taskStateCtx := range taskStateCtxs {
+			s.fired.inc()
+
+			// blocks while the engine has too many submitted executions, see ConcurrencyLimits.MaxSubmitted
+			ex, err := s.e.Submit(s.ctx, taskStateCtx)
+			if errors.Is(err, context.Canceled) {
+				continue
+			} else if err != nil {
+				s.l.Warn(fmt.Sprintf("scheduled task execution has not been submitted; id=%s: %s", taskStateCtx.Current.ID, err))
+				continue
+			}
+			go func() {
+				if err := ex.Wait(context.Background()); err != nil {
+					s.l.Warn(fmt.Sprintf("scheduled task execution has failed; id=%s: %s", taskStateCtx.Current.ID, err))
+				}
+			}()
+		}
+
+		return nil
+	}
+}
+
+func (s *Scheduler) taskRunning(id StateID) (bool, error) {
+	if id == `` {
+		return false, nil
+	}
+
+	taskStateCtx := &StateCtx{}
+	if err := s.e.Do(GetStateByID(taskStateCtx, id, 0)); errors.Is(err, ErrNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("get last task state: %w", err)
+	}
+
+	return !Parked(taskStateCtx.Current), nil
+}
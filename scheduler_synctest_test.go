@@ -0,0 +1,283 @@
+//go:build goexperiment.synctest
+
+package flowstate_test
+
+import (
+	"context"
+	"log/slog"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/makasim/flowstate"
+	"github.com/makasim/flowstate/memdriver"
+	"github.com/thejerf/slogassert"
+)
+
+func TestScheduler(t *testing.T) {
+	f := func(s flowstate.Schedule, startAfter time.Duration, schedulers int, exp []string) {
+		t.Helper()
+
+		synctest.Test(t, func(t *testing.T) {
+			lh := slogassert.New(t, slog.LevelDebug, nil)
+			l := slog.New(slogassert.New(t, slog.LevelDebug, lh))
+
+			actMux := &sync.Mutex{}
+			act := make([]string, 0)
+			d := memdriver.New(l)
+			fr := &flowstate.DefaultFlowRegistry{}
+			mustSetFlow(fr, `task`, flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+				id, at, payload, ok := flowstate.Scheduled(stateCtx.Current)
+				if !ok {
+					t.Errorf("state %s is not scheduled", stateCtx.Current.ID)
+				}
+				if id != s.ID || payload != s.Payload {
+					t.Errorf("unexpected schedule id %s or payload %s", id, payload)
+				}
+
+				actMux.Lock()
+				act = append(act, at.UTC().Format(`15:04:05`))
+				actMux.Unlock()
+
+				if payload == `hang` {
+					return flowstate.Noop(), nil
+				}
+
+				return flowstate.Commit(flowstate.Park(stateCtx)), nil
+			}))
+
+			e, err := flowstate.NewEngine(d, fr, l)
+			if err != nil {
+				t.Fatalf("failed to create engine: %v", err)
+			}
+			defer func() {
+				if err := e.Shutdown(context.Background()); err != nil {
+					t.Fatalf("failed to shutdown engine: %v", err)
+				}
+			}()
+
+			if err := flowstate.CreateSchedule(e, s); err != nil {
+				t.Fatalf("failed to create schedule: %v", err)
+			}
+
+			time.Sleep(startAfter)
+			synctest.Wait()
+
+			for i := 0; i < schedulers; i++ {
+				sch, err := flowstate.NewScheduler(e, l)
+				if err != nil {
+					t.Fatalf("failed to create scheduler: %v", err)
+				}
+				defer func() {
+					if err := sch.Shutdown(context.Background()); err != nil {
+						t.Fatalf("failed to shutdown scheduler: %v", err)
+					}
+				}()
+			}
+
+			time.Sleep(time.Minute*17 - startAfter)
+			synctest.Wait()
+
+			actMux.Lock()
+			defer actMux.Unlock()
+			sort.Strings(act)
+			if !reflect.DeepEqual(exp, act) {
+				t.Fatalf("expected tasks %v, got %v", exp, act)
+			}
+		})
+	}
+
+	// missed occurrences started
+	f(
+		flowstate.Schedule{ID: `s1`, Cron: `0 */5 * * * * *`, Flow: `task`, CatchUp: flowstate.CatchUpAll},
+		time.Minute*12,
+		1,
+		[]string{`00:05:00`, `00:10:00`, `00:15:00`},
+	)
+
+	// latest missed occurrence started
+	f(
+		flowstate.Schedule{ID: `s1`, Cron: `0 */5 * * * * *`, Flow: `task`},
+		time.Minute*12,
+		1,
+		[]string{`00:10:00`, `00:15:00`},
+	)
+
+	// missed occurrences skipped
+	f(
+		flowstate.Schedule{ID: `s1`, Cron: `0 */5 * * * * *`, Flow: `task`, CatchUp: flowstate.CatchUpSkip},
+		time.Minute*12,
+		1,
+		[]string{`00:15:00`},
+	)
+
+	// the previous task is running
+	f(
+		flowstate.Schedule{ID: `s1`, Cron: `0 */5 * * * * *`, Flow: `task`, Payload: `hang`, Overlap: flowstate.OverlapSkip},
+		0,
+		1,
+		[]string{`00:05:00`},
+	)
+
+	// timezone
+	f(
+		flowstate.Schedule{ID: `s1`, Cron: `0 45 5 * * * *`, Timezone: `Asia/Kolkata`, Flow: `task`, Payload: `aPayload`},
+		0,
+		1,
+		[]string{`00:15:00`},
+	)
+
+	// exactly one task per occurrence
+	f(
+		flowstate.Schedule{ID: `s1`, Cron: `0 */5 * * * * *`, Flow: `task`},
+		0,
+		3,
+		[]string{`00:05:00`, `00:10:00`, `00:15:00`},
+	)
+}
+
+func TestScheduler_PauseResumeDelete(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		lh := slogassert.New(t, slog.LevelDebug, nil)
+		l := slog.New(slogassert.New(t, slog.LevelDebug, lh))
+
+		actMux := &sync.Mutex{}
+		act := make([]string, 0)
+		d := memdriver.New(l)
+		fr := &flowstate.DefaultFlowRegistry{}
+		mustSetFlow(fr, `task`, flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+			actMux.Lock()
+			act = append(act, string(stateCtx.Current.ID))
+			actMux.Unlock()
+
+			return flowstate.Commit(flowstate.Park(stateCtx)), nil
+		}))
+
+		e, err := flowstate.NewEngine(d, fr, l)
+		if err != nil {
+			t.Fatalf("failed to create engine: %v", err)
+		}
+		defer e.Shutdown(context.Background())
+
+		sch, err := flowstate.NewScheduler(e, l)
+		if err != nil {
+			t.Fatalf("failed to create scheduler: %v", err)
+		}
+		defer sch.Shutdown(context.Background())
+
+		s := flowstate.Schedule{ID: `s1`, Cron: `0 * * * * * *`, Flow: `task`}
+		if err := flowstate.CreateSchedule(e, s); err != nil {
+			t.Fatalf("failed to create schedule: %v", err)
+		}
+		if err := flowstate.CreateSchedule(e, s); err == nil {
+			t.Fatalf("expected schedule already exists error")
+		}
+
+		time.Sleep(time.Minute*2 + time.Second*30)
+		synctest.Wait()
+
+		if err := flowstate.PauseSchedule(e, `s1`); err != nil {
+			t.Fatalf("failed to pause schedule: %v", err)
+		}
+		if s, err := flowstate.GetSchedule(e, `s1`); err != nil {
+			t.Fatalf("failed to get schedule: %v", err)
+		} else if !s.Paused || s.LastTask != `s1.946684920` {
+			t.Fatalf("unexpected schedule %+v", s)
+		}
+
+		time.Sleep(time.Minute * 2)
+		synctest.Wait()
+
+		if err := flowstate.ResumeSchedule(e, `s1`); err != nil {
+			t.Fatalf("failed to resume schedule: %v", err)
+		}
+
+		time.Sleep(time.Minute)
+		synctest.Wait()
+
+		if err := flowstate.DeleteSchedule(e, `s1`); err != nil {
+			t.Fatalf("failed to delete schedule: %v", err)
+		}
+		if _, err := flowstate.GetSchedule(e, `s1`); err != flowstate.ErrNotFound {
+			t.Fatalf("expected not found error, got %v", err)
+		}
+
+		time.Sleep(time.Minute * 2)
+		synctest.Wait()
+
+		if err := flowstate.CreateSchedule(e, s); err != nil {
+			t.Fatalf("failed to create schedule again: %v", err)
+		}
+
+		time.Sleep(time.Minute)
+		synctest.Wait()
+
+		actMux.Lock()
+		defer actMux.Unlock()
+		exp := []string{`s1.946684860`, `s1.946684920`, `s1.946685100`, `s1.946685280`}
+		if !reflect.DeepEqual(exp, act) {
+			t.Fatalf("expected tasks %v, got %v", exp, act)
+		}
+	})
+}
+
+func TestScheduler_ReadsChangedSchedulesOnly(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		lh := slogassert.New(t, slog.LevelDebug, nil)
+		l := slog.New(slogassert.New(t, slog.LevelDebug, lh))
+
+		d := &scheduleReadsDriver{Driver: memdriver.New(l)}
+		fr := &flowstate.DefaultFlowRegistry{}
+		mustSetFlow(fr, `task`, flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+			return flowstate.Commit(flowstate.Park(stateCtx)), nil
+		}))
+
+		e, err := flowstate.NewEngine(d, fr, l)
+		if err != nil {
+			t.Fatalf("failed to create engine: %v", err)
+		}
+		defer e.Shutdown(context.Background())
+
+		sch, err := flowstate.NewScheduler(e, l)
+		if err != nil {
+			t.Fatalf("failed to create scheduler: %v", err)
+		}
+		defer sch.Shutdown(context.Background())
+
+		if err := flowstate.CreateSchedule(e, flowstate.Schedule{ID: `s1`, Cron: `0 * * * * * *`, Flow: `task`}); err != nil {
+			t.Fatalf("failed to create schedule: %v", err)
+		}
+
+		time.Sleep(time.Minute*3 + time.Second*30)
+		synctest.Wait()
+
+		// the created schedule state and a schedule state per fired occurrence, unchanged schedules are not read every tick
+		if reads := d.reads.Load(); reads != 4 {
+			t.Fatalf("expected 4 schedule states read, got %d", reads)
+		}
+	})
+}
+
+type scheduleReadsDriver struct {
+	*memdriver.Driver
+
+	reads atomic.Int64
+}
+
+func (d *scheduleReadsDriver) GetStates(cmd *flowstate.GetStatesCommand) error {
+	if err := d.Driver.GetStates(cmd); err != nil {
+		return err
+	}
+
+	for _, state := range cmd.MustResult().States {
+		if state.Labels[flowstate.ScheduleLabel] != `` {
+			d.reads.Add(1)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,595 @@
+package flowstate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var SemaphoreLabel = `flowstate.semaphore`
+var SemaphoreNameAnnotation = `flowstate.semaphore.name`
+var SemaphoreLimitAnnotation = `flowstate.semaphore.limit`
+var SemaphoreHoldersAnnotation = `flowstate.semaphore.holders`
+var SemaphoreWaitersAnnotation = `flowstate.semaphore.waiters`
+
+// SemaphoreAcquiredAnnotation and SemaphoreTimedOutAnnotation are set to the transition of the acquiring state
+// once it holds a permit or has given up waiting for it.
+var SemaphoreAcquiredAnnotation = `flowstate.semaphore.acquired`
+var SemaphoreTimedOutAnnotation = `flowstate.semaphore.timed_out`
+
+var SemaphoreWaitAnnotation = `flowstate.semaphore.wait`
+var SemaphoreResumeAnnotation = `flowstate.semaphore.resume`
+var SemaphoreTimeoutAtAnnotation = `flowstate.semaphore.timeout_at`
+var SemaphoreTimeoutToAnnotation = `flowstate.semaphore.timeout_to`
+
+// semaphoreCommitAttempts limits commits conflicting with concurrent changes of the semaphore state.
+const semaphoreCommitAttempts = 10
+
+// Semaphore is a named counting semaphore shared by states, up to Limit states hold a permit at the same time.
+//
+// The semaphore is stored as a parked state labeled with SemaphoreLabel, it keeps holder and waiter IDs in annotations.
+// Waiters are queued in FIFO order and parked, a released permit is handed over to the oldest waiter
+// in the same commit the holder releases it in, so waiters do not poll.
+// Permits of holders that are deleted, dead-lettered or parked at the end of their flow without releasing are released by SemaphoreKeeper.
+// A holder parked to wait for a call, a signal, a join or another semaphore keeps its permit.
+type Semaphore struct {
+	Name  string
+	Limit int
+}
+
+func NewSemaphore(name string, limit int) Semaphore {
+	return Semaphore{
+		Name:  name,
+		Limit: limit,
+	}
+}
+
+func (s Semaphore) Acquire(stateCtx *StateCtx, to FlowID) *AcquireCommand {
+	return Acquire(stateCtx, s.Name, s.Limit, to)
+}
+
+func (s Semaphore) Release(stateCtx *StateCtx) *ReleaseCommand {
+	return Release(stateCtx, s.Name)
+}
+
+// Mutex is a Semaphore with a single permit.
+type Mutex struct {
+	Name string
+}
+
+func NewMutex(name string) Mutex {
+	return Mutex{
+		Name: name,
+	}
+}
+
+func (m Mutex) Lock(stateCtx *StateCtx, to FlowID) *AcquireCommand {
+	return Acquire(stateCtx, m.Name, 1, to)
+}
+
+func (m Mutex) Unlock(stateCtx *StateCtx) *ReleaseCommand {
+	return Release(stateCtx, m.Name)
+}
+
+// Acquire transits the state to the given flow once it holds a permit of the named semaphore.
+// If no permits are free, or other states wait for them, the state is queued and parked until a permit is handed over to it.
+// All states acquiring the semaphore must use the same limit.
+func Acquire(stateCtx *StateCtx, name string, limit int, to FlowID) *AcquireCommand {
+	return &AcquireCommand{
+		StateCtx: stateCtx,
+		Name:     name,
+		Limit:    limit,
+		To:       to,
+	}
+}
+
+type AcquireCommand struct {
+	command
+	StateCtx  *StateCtx
+	Name      string
+	Limit     int
+	To        FlowID
+	Timeout   time.Duration
+	TimeoutTo FlowID
+
+	// Acquired is set once the state holds a permit and is transited.
+	Acquired bool
+
+	sync bool
+}
+
+func (cmd *AcquireCommand) sessID() int64 {
+	return cmd.StateCtx.sessID
+}
+
+func (cmd *AcquireCommand) setSync() {
+	cmd.sync = true
+}
+
+func (cmd *AcquireCommand) do(e *Engine) error {
+	return e.doAcquire(cmd)
+}
+
+func (cmd *AcquireCommand) next() *StateCtx {
+	if cmd.Acquired {
+		return cmd.StateCtx
+	}
+	return nil
+}
+
+// WithTimeout transits the state to the given flow if it has not acquired a permit within the timeout.
+// Timeouts are handled by SemaphoreKeeper.
+func (cmd *AcquireCommand) WithTimeout(timeout time.Duration, to FlowID) *AcquireCommand {
+	cmd.Timeout = timeout
+	cmd.TimeoutTo = to
+	return cmd
+}
+
+// Release gives the permit of the named semaphore back and hands it over to the oldest waiter.
+// The releasing state is parked in the same commit, or transited if WithTransit is used.
+// Releasing a permit the state does not hold only parks or transits the state.
+func Release(stateCtx *StateCtx, name string) *ReleaseCommand {
+	return &ReleaseCommand{
+		StateCtx: stateCtx,
+		Name:     name,
+	}
+}
+
+type ReleaseCommand struct {
+	command
+	StateCtx *StateCtx
+	Name     string
+	To       FlowID
+
+	sync bool
+}
+
+func (cmd *ReleaseCommand) sessID() int64 {
+	return cmd.StateCtx.sessID
+}
+
+func (cmd *ReleaseCommand) setSync() {
+	cmd.sync = true
+}
+
+func (cmd *ReleaseCommand) do(e *Engine) error {
+	return e.doRelease(cmd)
+}
+
+func (cmd *ReleaseCommand) next() *StateCtx {
+	if cmd.To != `` {
+		return cmd.StateCtx
+	}
+	return nil
+}
+
+func (cmd *ReleaseCommand) WithTransit(to FlowID) *ReleaseCommand {
+	cmd.To = to
+	return cmd
+}
+
+// SemaphoreHolders returns IDs of states holding permits of the semaphore state.
+func SemaphoreHolders(state State) []StateID {
+	return splitStateIDs(state.Annotations[SemaphoreHoldersAnnotation])
+}
+
+// SemaphoreWaiters returns IDs of states waiting for permits of the semaphore state in the order they are served.
+func SemaphoreWaiters(state State) []StateID {
+	return splitStateIDs(state.Annotations[SemaphoreWaitersAnnotation])
+}
+
+func semaphoreStateID(name string) StateID {
+	return StateID(`flowstate.semaphore.` + name)
+}
+
+func semaphoreLimit(state State) int {
+	limit, _ := strconv.Atoi(state.Annotations[SemaphoreLimitAnnotation])
+	return limit
+}
+
+func setSemaphoreStateIDs(stateCtx *StateCtx, annotation string, ids []StateID) {
+	if len(ids) == 0 {
+		delete(stateCtx.Current.Annotations, annotation)
+		return
+	}
+
+	idsStr := make([]string, 0, len(ids))
+	for _, id := range ids {
+		idsStr = append(idsStr, string(id))
+	}
+	stateCtx.Current.SetAnnotation(annotation, strings.Join(idsStr, `,`))
+}
+
+func (e *Engine) getSemaphore(name string, limit int) (*StateCtx, error) {
+	semStateCtx := &StateCtx{}
+	if err := e.doCmd(GetStateByID(semStateCtx, semaphoreStateID(name), 0)); errors.Is(err, ErrNotFound) {
+		semStateCtx.Current = State{
+			ID: semaphoreStateID(name),
+			Labels: map[string]string{
+				SemaphoreLabel: `true`,
+			},
+		}
+		semStateCtx.Current.SetAnnotation(SemaphoreNameAnnotation, name)
+		semStateCtx.Current.SetAnnotation(SemaphoreLimitAnnotation, strconv.Itoa(limit))
+
+		return semStateCtx, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("get semaphore state: %w", err)
+	}
+
+	if currLimit := semaphoreLimit(semStateCtx.Current); currLimit != limit {
+		return nil, fmt.Errorf("semaphore %s limit is %d, got %d", name, currLimit, limit)
+	}
+
+	return semStateCtx, nil
+}
+
+func (e *Engine) doAcquire(cmd *AcquireCommand) error {
+	if cmd.Name == `` {
+		return fmt.Errorf("semaphore name empty")
+	}
+	if cmd.Limit <= 0 {
+		return fmt.Errorf("semaphore limit must be greater than zero")
+	}
+	if cmd.To == `` {
+		return fmt.Errorf("flow id empty")
+	}
+	if cmd.Timeout > 0 && cmd.TimeoutTo == `` {
+		return fmt.Errorf("timeout flow id empty")
+	}
+
+	id := cmd.StateCtx.Current.ID
+
+	var err error
+	for i := 0; i < semaphoreCommitAttempts; i++ {
+		semStateCtx, getErr := e.getSemaphore(cmd.Name, cmd.Limit)
+		if getErr != nil {
+			return getErr
+		}
+
+		holders := SemaphoreHolders(semStateCtx.Current)
+		waiters := SemaphoreWaiters(semStateCtx.Current)
+
+		stateCtx := cmd.StateCtx.CopyTo(&StateCtx{})
+		stateCtx.sessID = cmd.StateCtx.sessID
+
+		// a state already queued keeps its position, it acquires a free permit only at the head of the queue
+		pos := slices.Index(waiters, id)
+
+		var stateCmd Command
+		acquired := slices.Contains(holders, id) || (len(holders) < cmd.Limit && (len(waiters) == 0 || pos == 0))
+		if acquired {
+			if pos >= 0 {
+				waiters = slices.Delete(waiters, pos, pos+1)
+			}
+			if !slices.Contains(holders, id) {
+				holders = append(holders, id)
+			}
+
+			stateCmd = Transit(stateCtx, cmd.To).WithAnnotation(SemaphoreAcquiredAnnotation, cmd.Name)
+		} else {
+			if pos < 0 {
+				waiters = append(waiters, id)
+			}
+
+			parkCmd := Park(stateCtx).
+				WithAnnotation(SemaphoreWaitAnnotation, cmd.Name).
+				WithAnnotation(SemaphoreResumeAnnotation, string(cmd.To))
+			if cmd.Timeout > 0 {
+				parkCmd.WithAnnotation(SemaphoreTimeoutAtAnnotation, time.Now().Add(cmd.Timeout).Format(time.RFC3339)).
+					WithAnnotation(SemaphoreTimeoutToAnnotation, string(cmd.TimeoutTo))
+			}
+			stateCmd = parkCmd
+		}
+
+		setSemaphoreStateIDs(semStateCtx, SemaphoreHoldersAnnotation, holders)
+		setSemaphoreStateIDs(semStateCtx, SemaphoreWaitersAnnotation, waiters)
+
+		err = e.doCmd(Commit(Park(semStateCtx), stateCmd))
+		if revErr := asErrRevMismatch(err); revErr != nil && !revErr.Contains(id) {
+			// the semaphore changed concurrently
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		cmd.StateCtx.moveFrom(stateCtx)
+		cmd.Acquired = acquired
+		if acquired && !cmd.sync {
+			e.goExecute(cmd.StateCtx)
+		}
+
+		return nil
+	}
+
+	return err
+}
+
+func (e *Engine) doRelease(cmd *ReleaseCommand) error {
+	if cmd.Name == `` {
+		return fmt.Errorf("semaphore name empty")
+	}
+
+	id := cmd.StateCtx.Current.ID
+
+	var err error
+	for i := 0; i < semaphoreCommitAttempts; i++ {
+		stateCtx := cmd.StateCtx.CopyTo(&StateCtx{})
+		stateCtx.sessID = cmd.StateCtx.sessID
+
+		commitCmd := Commit()
+		if cmd.To == `` {
+			commitCmd.Commands = append(commitCmd.Commands, Park(stateCtx))
+		} else {
+			commitCmd.Commands = append(commitCmd.Commands, Transit(stateCtx, cmd.To))
+		}
+
+		var settled semaphoreSettlement
+		semStateCtx := &StateCtx{}
+		if getErr := e.doCmd(GetStateByID(semStateCtx, semaphoreStateID(cmd.Name), 0)); getErr != nil && !errors.Is(getErr, ErrNotFound) {
+			return fmt.Errorf("get semaphore state: %w", getErr)
+		} else if getErr == nil && slices.Contains(SemaphoreHolders(semStateCtx.Current), id) {
+			setSemaphoreStateIDs(semStateCtx, SemaphoreHoldersAnnotation, slices.DeleteFunc(SemaphoreHolders(semStateCtx.Current), func(holderID StateID) bool {
+				return holderID == id
+			}))
+
+			settled, getErr = e.settleSemaphore(semStateCtx, false, time.Now())
+			if getErr != nil {
+				return getErr
+			}
+
+			commitCmd.Commands = append(commitCmd.Commands, Park(semStateCtx))
+			commitCmd.Commands = append(commitCmd.Commands, settled.cmds...)
+		}
+
+		err = e.doCmd(commitCmd)
+		if revErr := asErrRevMismatch(err); revErr != nil && !revErr.Contains(id) {
+			// the semaphore or its waiters changed concurrently
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		cmd.StateCtx.moveFrom(stateCtx)
+		for _, execStateCtx := range settled.execs {
+			e.goExecute(execStateCtx)
+		}
+		if cmd.To != `` && !cmd.sync {
+			e.goExecute(cmd.StateCtx)
+		}
+
+		return nil
+	}
+
+	return err
+}
+
+type semaphoreSettlement struct {
+	cmds  []Command
+	execs []*StateCtx
+
+	changed  bool
+	released int
+	timedOut int
+}
+
+// settleSemaphore drops waiters that no longer wait, times out waiters and hands free permits over to waiters in FIFO order.
+// If reap is set, permits of holders that are gone are released first, see semaphoreHolderGone.
+// The semaphore state is updated in place, returned commands must be committed along with it.
+func (e *Engine) settleSemaphore(semStateCtx *StateCtx, reap bool, now time.Time) (semaphoreSettlement, error) {
+	res := semaphoreSettlement{}
+
+	name := semStateCtx.Current.Annotations[SemaphoreNameAnnotation]
+	limit := semaphoreLimit(semStateCtx.Current)
+
+	holders := SemaphoreHolders(semStateCtx.Current)
+	if reap {
+		alive := make([]StateID, 0, len(holders))
+		for _, id := range holders {
+			gone, err := e.semaphoreHolderGone(id)
+			if err != nil {
+				return semaphoreSettlement{}, err
+			}
+			if gone {
+				res.released++
+				continue
+			}
+
+			alive = append(alive, id)
+		}
+		holders = alive
+	}
+
+	var waiters []StateID
+	for _, id := range SemaphoreWaiters(semStateCtx.Current) {
+		stateCtx := &StateCtx{}
+		if err := e.doCmd(GetStateByID(stateCtx, id, 0)); errors.Is(err, ErrNotFound) {
+			res.changed = true
+			continue
+		} else if err != nil {
+			return semaphoreSettlement{}, fmt.Errorf("get semaphore waiter state: %w", err)
+		}
+
+		currTs := stateCtx.Current.Transition
+		if !Parked(stateCtx.Current) || currTs.Annotations[SemaphoreWaitAnnotation] != name {
+			res.changed = true
+			continue
+		}
+
+		if timeoutAt, _ := time.Parse(time.RFC3339, currTs.Annotations[SemaphoreTimeoutAtAnnotation]); !timeoutAt.IsZero() && !now.Before(timeoutAt) {
+			res.changed = true
+			res.timedOut++
+			res.cmds = append(res.cmds, Transit(stateCtx, FlowID(currTs.Annotations[SemaphoreTimeoutToAnnotation])).
+				WithAnnotation(SemaphoreTimedOutAnnotation, name))
+			res.execs = append(res.execs, stateCtx)
+			continue
+		}
+
+		if len(holders) < limit && len(waiters) == 0 {
+			res.changed = true
+			holders = append(holders, id)
+			res.cmds = append(res.cmds, Transit(stateCtx, FlowID(currTs.Annotations[SemaphoreResumeAnnotation])).
+				WithAnnotation(SemaphoreAcquiredAnnotation, name))
+			res.execs = append(res.execs, stateCtx)
+			continue
+		}
+
+		waiters = append(waiters, id)
+	}
+
+	if res.released > 0 {
+		res.changed = true
+	}
+
+	setSemaphoreStateIDs(semStateCtx, SemaphoreHoldersAnnotation, holders)
+	setSemaphoreStateIDs(semStateCtx, SemaphoreWaitersAnnotation, waiters)
+
+	return res, nil
+}
+
+// semaphoreHolderGone reports whether the holder state has finished without releasing the permit:
+// it is deleted, dead-lettered or parked at the end of its flow.
+// A holder being recovered by Recoverer keeps the permit, the retried flow is expected to release it.
+func (e *Engine) semaphoreHolderGone(id StateID) (bool, error) {
+	stateCtx := &StateCtx{}
+	if err := e.doCmd(GetStateByID(stateCtx, id, 0)); errors.Is(err, ErrNotFound) {
+		return true, nil
+	} else if err != nil {
+		return false, fmt.Errorf("get semaphore holder state: %w", err)
+	}
+
+	if DeadLettered(stateCtx.Current) {
+		return true, nil
+	}
+
+	return Parked(stateCtx.Current) && !parkedToResume(stateCtx.Current), nil
+}
+
+// parkedToResume reports whether the state is parked by the engine to be resumed later:
+// by a called state returning, a signal, joined states or a semaphore permit.
+func parkedToResume(state State) bool {
+	for _, annotation := range []string{
+		CallResumeAnnotation,
+		SignalResumeAnnotation,
+		JoinResumeAnnotation,
+		SemaphoreResumeAnnotation,
+	} {
+		if state.Transition.Annotations[annotation] != `` {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SemaphoreKeeper releases permits of holders that are deleted, dead-lettered or parked at the end of their flow without releasing them,
+// and transits waiters whose acquire timeout has passed. Freed permits are handed over to waiters.
+//
+// Several keepers could run at the same time, a semaphore state changed concurrently is settled on the next tick.
+type SemaphoreKeeper struct {
+	e *Engine
+
+	released *metricVec
+	timedOut *metricVec
+
+	stopCh    chan struct{}
+	stoppedCh chan struct{}
+	l         *slog.Logger
+}
+
+func NewSemaphoreKeeper(e *Engine, l *slog.Logger) (*SemaphoreKeeper, error) {
+	k := &SemaphoreKeeper{
+		e: e,
+		l: l,
+
+		released: e.m.counter(`flowstate_semaphore_keeper_released_total`, `Number of semaphore permits released because the holder state was deleted, dead-lettered or parked at the end of its flow.`),
+		timedOut: e.m.counter(`flowstate_semaphore_keeper_timed_out_total`, `Number of semaphore waiters that have not acquired a permit in time.`),
+
+		stopCh:    make(chan struct{}),
+		stoppedCh: make(chan struct{}),
+	}
+
+	go func() {
+		defer close(k.stoppedCh)
+
+		t := time.NewTicker(time.Second)
+		defer t.Stop()
+
+		for {
+			select {
+			case now := <-t.C:
+				if err := k.tick(now); err != nil {
+					k.l.Error(fmt.Sprintf("semaphore keeper tick: %s; retrying", err))
+				}
+			case <-k.stopCh:
+				return
+			}
+		}
+	}()
+
+	return k, nil
+}
+
+func (k *SemaphoreKeeper) Shutdown(ctx context.Context) error {
+	select {
+	case <-k.stopCh:
+		return fmt.Errorf(`already shutdown`)
+	default:
+		close(k.stopCh)
+
+		select {
+		case <-k.stoppedCh:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (k *SemaphoreKeeper) tick(now time.Time) error {
+	it := k.e.Iter(GetStatesByLabels(map[string]string{
+		SemaphoreLabel: `true`,
+	}).WithLatestOnly())
+	for it.Next() {
+		state := it.State()
+		if err := k.keep(state, now); IsErrRevMismatch(err) {
+			// changed concurrently, the next tick sees the latest state
+			continue
+		} else if err != nil {
+			k.l.Error(fmt.Sprintf("keep semaphore; id=%s: %s", state.ID, err))
+		}
+	}
+	if err := it.Err(); err != nil {
+		return fmt.Errorf("get semaphores: %w", err)
+	}
+
+	return nil
+}
+
+func (k *SemaphoreKeeper) keep(state State, now time.Time) error {
+	semStateCtx := state.CopyToCtx(&StateCtx{})
+	settled, err := k.e.settleSemaphore(semStateCtx, true, now)
+	if err != nil {
+		return err
+	}
+	if !settled.changed {
+		return nil
+	}
+
+	if err := k.e.Do(Commit(append([]Command{Park(semStateCtx)}, settled.cmds...)...)); err != nil {
+		return err
+	}
+
+	k.released.add(float64(settled.released))
+	k.timedOut.add(float64(settled.timedOut))
+	for _, stateCtx := range settled.execs {
+		k.e.goExecute(stateCtx)
+	}
+
+	return nil
+}
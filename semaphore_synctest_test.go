@@ -0,0 +1,252 @@
+//go:build goexperiment.synctest
+
+package flowstate_test
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"sync"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/makasim/flowstate"
+	"github.com/makasim/flowstate/memdriver"
+	"github.com/thejerf/slogassert"
+)
+
+func TestSemaphore(t *testing.T) {
+	f := func(limit, states int, hold string, timeout time.Duration, exp []string) {
+		t.Helper()
+
+		synctest.Test(t, func(t *testing.T) {
+			lh := slogassert.New(t, slog.LevelDebug, nil)
+			l := slog.New(slogassert.New(t, slog.LevelDebug, lh))
+
+			start := time.Now()
+			actMux := &sync.Mutex{}
+			act := make([]string, 0)
+			track := func(stateCtx *flowstate.StateCtx, event string) {
+				actMux.Lock()
+				defer actMux.Unlock()
+
+				act = append(act, fmt.Sprintf("%s:%s@%s", stateCtx.Current.ID, event, time.Since(start).Truncate(time.Second)))
+			}
+
+			sem := flowstate.NewSemaphore(`aSem`, limit)
+
+			d := memdriver.New(l)
+			fr := &flowstate.DefaultFlowRegistry{}
+			mustSetFlow(fr, `acquire`, flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+				var acquireCmd *flowstate.AcquireCommand
+				if limit == 1 {
+					acquireCmd = flowstate.NewMutex(`aSem`).Lock(stateCtx, `protected`)
+				} else {
+					acquireCmd = sem.Acquire(stateCtx, `protected`)
+				}
+				if timeout > 0 {
+					acquireCmd.WithTimeout(timeout, `timedOut`)
+				}
+
+				return acquireCmd, nil
+			}))
+			mustSetFlow(fr, `protected`, flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+				if stateCtx.Current.Transition.Annotations[flowstate.SemaphoreAcquiredAnnotation] != `aSem` {
+					t.Errorf("state %s has not acquired the semaphore", stateCtx.Current.ID)
+				}
+				track(stateCtx, `acquired`)
+
+				switch hold {
+				case `release`:
+					time.Sleep(time.Minute)
+					return sem.Release(stateCtx), nil
+				case `park`:
+					time.Sleep(time.Minute + time.Millisecond*500)
+					return flowstate.Commit(flowstate.Park(stateCtx)), nil
+				case `recover`:
+					// mimics a retry committed by the recoverer
+					time.Sleep(time.Minute + time.Millisecond*500)
+					return flowstate.Commit(flowstate.Transit(stateCtx, `recovered`).
+						WithAnnotation(flowstate.RecoveryAttemptAnnotation, `1`)), nil
+				case `call`:
+					return flowstate.Call(stateCtx, &flowstate.StateCtx{
+						Current: flowstate.State{
+							ID: stateCtx.Current.ID + `.child`,
+						},
+					}, `callee`).WithResume(`called`), nil
+				default:
+					return flowstate.Noop(), nil
+				}
+			}))
+			mustSetFlow(fr, `callee`, flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+				parentID := flowstate.StateID(stateCtx.Current.Annotations[flowstate.CallParentAnnotation])
+				go func() {
+					time.Sleep(time.Minute * 2)
+					if err := e.Do(flowstate.Signal(parentID, `continue`, ``)); err != nil {
+						t.Errorf("failed to signal state %s: %v", parentID, err)
+					}
+				}()
+
+				time.Sleep(time.Minute)
+				return flowstate.Commit(flowstate.Park(stateCtx)), nil
+			}))
+			mustSetFlow(fr, `called`, flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+				track(stateCtx, `called`)
+				return flowstate.WaitSignal(stateCtx, `continue`, `signalled`), nil
+			}))
+			mustSetFlow(fr, `signalled`, flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+				track(stateCtx, `signalled`)
+				return sem.Release(stateCtx), nil
+			}))
+			mustSetFlow(fr, `timedOut`, flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+				if stateCtx.Current.Transition.Annotations[flowstate.SemaphoreTimedOutAnnotation] != `aSem` {
+					t.Errorf("state %s has not timed out", stateCtx.Current.ID)
+				}
+				track(stateCtx, `timed_out`)
+
+				return flowstate.Commit(flowstate.Park(stateCtx)), nil
+			}))
+			mustSetFlow(fr, `recovered`, flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+				return flowstate.Noop(), nil
+			}))
+
+			e, err := flowstate.NewEngine(d, fr, l)
+			if err != nil {
+				t.Fatalf("failed to create engine: %v", err)
+			}
+			defer func() {
+				if err := e.Shutdown(context.Background()); err != nil {
+					t.Fatalf("failed to shutdown engine: %v", err)
+				}
+			}()
+
+			k, err := flowstate.NewSemaphoreKeeper(e, l)
+			if err != nil {
+				t.Fatalf("failed to create semaphore keeper: %v", err)
+			}
+			defer func() {
+				if err := k.Shutdown(context.Background()); err != nil {
+					t.Fatalf("failed to shutdown semaphore keeper: %v", err)
+				}
+			}()
+
+			for i := 0; i < states; i++ {
+				stateCtx := &flowstate.StateCtx{
+					Current: flowstate.State{
+						ID: flowstate.StateID(fmt.Sprintf("s%d", i)),
+					},
+				}
+				if err := e.Do(
+					flowstate.Commit(flowstate.Transit(stateCtx, `acquire`)),
+					flowstate.Execute(stateCtx),
+				); err != nil {
+					t.Fatalf("failed to execute state: %v", err)
+				}
+				// waiters are queued in the order they start
+				synctest.Wait()
+			}
+
+			time.Sleep(time.Minute * 10)
+			synctest.Wait()
+
+			actMux.Lock()
+			defer actMux.Unlock()
+			if !reflect.DeepEqual(exp, act) {
+				t.Fatalf("expected %v, got %v", exp, act)
+			}
+		})
+	}
+
+	// permits handed over on release
+	f(2, 4, `release`, 0, []string{
+		`s0:acquired@0s`,
+		`s1:acquired@0s`,
+		`s2:acquired@1m0s`,
+		`s3:acquired@1m0s`,
+	})
+
+	// waiters served in fifo order
+	f(1, 3, `release`, 0, []string{
+		`s0:acquired@0s`,
+		`s1:acquired@1m0s`,
+		`s2:acquired@2m0s`,
+	})
+
+	// holder parked without release
+	f(1, 2, `park`, 0, []string{
+		`s0:acquired@0s`,
+		`s1:acquired@1m1s`,
+	})
+
+	// holder recovered keeps the permit
+	f(1, 2, `recover`, 0, []string{
+		`s0:acquired@0s`,
+	})
+
+	// holder parked by a call and waiting for a signal keeps the permit
+	f(1, 2, `call`, 0, []string{
+		`s0:acquired@0s`,
+		`s0:called@1m0s`,
+		`s0:signalled@2m0s`,
+		`s1:acquired@2m0s`,
+		`s1:called@3m0s`,
+		`s1:signalled@4m0s`,
+	})
+
+	// waiter timed out
+	f(1, 2, `hang`, time.Minute, []string{
+		`s0:acquired@0s`,
+		`s1:timed_out@1m0s`,
+	})
+}
+
+func TestSemaphore_WaiterKeepsPosition(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		lh := slogassert.New(t, slog.LevelDebug, nil)
+		l := slog.New(slogassert.New(t, slog.LevelDebug, lh))
+
+		d := memdriver.New(l)
+		fr := &flowstate.DefaultFlowRegistry{}
+		mustSetFlow(fr, `protected`, flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+			return flowstate.Noop(), nil
+		}))
+
+		e, err := flowstate.NewEngine(d, fr, l)
+		if err != nil {
+			t.Fatalf("failed to create engine: %v", err)
+		}
+		defer e.Shutdown(context.Background())
+
+		stateCtxs := make([]*flowstate.StateCtx, 0, 3)
+		for i := 0; i < 3; i++ {
+			stateCtx := &flowstate.StateCtx{
+				Current: flowstate.State{
+					ID: flowstate.StateID(fmt.Sprintf("s%d", i)),
+				},
+			}
+			if err := e.Do(flowstate.Acquire(stateCtx, `aSem`, 1, `protected`)); err != nil {
+				t.Fatalf("failed to acquire: %v", err)
+			}
+			stateCtxs = append(stateCtxs, stateCtx)
+		}
+		synctest.Wait()
+
+		// acquiring again, for example by a re-executed flow, does not move the waiter to the back of the queue
+		if err := e.Do(flowstate.Acquire(stateCtxs[1], `aSem`, 1, `protected`)); err != nil {
+			t.Fatalf("failed to acquire again: %v", err)
+		}
+
+		semStateCtx := &flowstate.StateCtx{}
+		if err := e.Do(flowstate.GetStateByID(semStateCtx, `flowstate.semaphore.aSem`, 0)); err != nil {
+			t.Fatalf("failed to get semaphore state: %v", err)
+		}
+		if holders := flowstate.SemaphoreHolders(semStateCtx.Current); !reflect.DeepEqual([]flowstate.StateID{`s0`}, holders) {
+			t.Fatalf("expected holders [s0], got %v", holders)
+		}
+		if waiters := flowstate.SemaphoreWaiters(semStateCtx.Current); !reflect.DeepEqual([]flowstate.StateID{`s1`, `s2`}, waiters) {
+			t.Fatalf("expected waiters [s1 s2], got %v", waiters)
+		}
+	})
+}
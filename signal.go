@@ -0,0 +1,291 @@
+package flowstate
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+)
+
+var SignalTargetLabel = `flowstate.signal.target`
+var SignalNameLabel = `flowstate.signal.name`
+var SignalAnnotation = `flowstate.signal`
+var SignalIDAnnotation = `flowstate.signal.id`
+var SignalPayloadAnnotation = `flowstate.signal.payload`
+var SignalConsumedAnnotation = `flowstate.signal.consumed`
+var WaitSignalAnnotation = `flowstate.signal.wait`
+var SignalResumeAnnotation = `flowstate.signal.resume`
+
+// SignalCursorAnnotation prefixes an annotation set on the target state to the revision of the last consumed signal with the name.
+// Signals are consumed in order, so the next pending signal is searched only among signals committed after it.
+var SignalCursorAnnotation = `flowstate.signal.cursor.`
+
+// signalDeliverAttempts limits commits of a signal delivery conflicting with concurrent changes of the target state.
+const signalDeliverAttempts = 3
+
+// Signal sends a named signal with a payload to the state with the given ID.
+//
+// The signal is committed as a separate parked state labeled with SignalTargetLabel and SignalNameLabel,
+// so sending it never conflicts with the target state. If the target state waits for the signal, see WaitSignal,
+// it is resumed in the same commit the oldest pending signal with the name is consumed in, so signals are received in the order they are sent.
+// Otherwise, the signal stays pending until the target waits for it.
+func Signal(id StateID, name, payload string) *SignalCommand {
+	return &SignalCommand{
+		ID:      id,
+		Name:    name,
+		Payload: payload,
+	}
+}
+
+type SignalCommand struct {
+	command
+	ID      StateID
+	Name    string
+	Payload string
+
+	// SignalStateCtx is set to the committed signal state once the command is done.
+	SignalStateCtx *StateCtx
+	// ResumedStateCtx is set to the target state if it waited for the signal and was resumed.
+	ResumedStateCtx *StateCtx
+}
+
+// signals are delivered to other states, so the command has no session of its own and is always done in place.
+func (cmd *SignalCommand) sessID() int64 {
+	return 0
+}
+
+func (cmd *SignalCommand) setSync() {}
+
+func (cmd *SignalCommand) do(e *Engine) error {
+	return e.doSignal(cmd)
+}
+
+func (cmd *SignalCommand) next() *StateCtx {
+	return nil
+}
+
+func (cmd *SignalCommand) Prepare() error {
+	if cmd.ID == `` {
+		return fmt.Errorf("state id empty")
+	}
+	if cmd.Name == `` {
+		return fmt.Errorf("signal name empty")
+	}
+
+	cmd.SignalStateCtx = &StateCtx{
+		Current: State{
+			ID: newSignalID(),
+			Labels: map[string]string{
+				SignalTargetLabel: string(cmd.ID),
+				SignalNameLabel:   cmd.Name,
+			},
+			Annotations: map[string]string{
+				SignalPayloadAnnotation: cmd.Payload,
+			},
+		},
+	}
+
+	return nil
+}
+
+// WaitSignal resumes the state with the given flow once the named signal is received.
+// A pending signal is consumed right away, otherwise the state is parked until the signal is sent.
+// The resumed state transition has the signal name in SignalAnnotation and the payload in SignalPayloadAnnotation.
+func WaitSignal(stateCtx *StateCtx, name string, to FlowID) *WaitSignalCommand {
+	return &WaitSignalCommand{
+		StateCtx: stateCtx,
+		Name:     name,
+		To:       to,
+	}
+}
+
+type WaitSignalCommand struct {
+	command
+	StateCtx *StateCtx
+	Name     string
+	To       FlowID
+
+	// Received is set once the signal is consumed and the state is transited.
+	Received bool
+
+	sync bool
+}
+
+func (cmd *WaitSignalCommand) sessID() int64 {
+	return cmd.StateCtx.sessID
+}
+
+func (cmd *WaitSignalCommand) setSync() {
+	cmd.sync = true
+}
+
+func (cmd *WaitSignalCommand) do(e *Engine) error {
+	return e.doWaitSignal(cmd)
+}
+
+func (cmd *WaitSignalCommand) next() *StateCtx {
+	if cmd.Received {
+		return cmd.StateCtx
+	}
+	return nil
+}
+
+// ReceivedSignal returns the name and the payload of the signal the state was resumed by.
+func ReceivedSignal(state State) (name, payload string, ok bool) {
+	name = state.Transition.Annotations[SignalAnnotation]
+	if name == `` {
+		return ``, ``, false
+	}
+
+	return name, state.Transition.Annotations[SignalPayloadAnnotation], true
+}
+
+func newSignalID() StateID {
+	return StateID(fmt.Sprintf("flowstate.signal.%016x%016x", rand.Uint64(), rand.Uint64()))
+}
+
+func (e *Engine) doSignal(cmd *SignalCommand) error {
+	if err := cmd.Prepare(); err != nil {
+		return err
+	}
+	if err := e.doCmd(Commit(Park(cmd.SignalStateCtx))); err != nil {
+		return err
+	}
+
+	var err error
+	for i := 0; i < signalDeliverAttempts; i++ {
+		targetStateCtx := &StateCtx{}
+		if err := e.doCmd(GetStateByID(targetStateCtx, cmd.ID, 0)); errors.Is(err, ErrNotFound) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("get target state: %w", err)
+		}
+
+		currTs := targetStateCtx.Current.Transition
+		if !Parked(targetStateCtx.Current) || currTs.Annotations[WaitSignalAnnotation] != cmd.Name {
+			return nil
+		}
+
+		signalStateCtx, pendingErr := e.pendingSignal(targetStateCtx.Current, cmd.Name)
+		if pendingErr != nil {
+			return pendingErr
+		} else if signalStateCtx == nil {
+			// consumed by the target state itself
+			return nil
+		}
+
+		err = e.consumeSignal(signalStateCtx, targetStateCtx, FlowID(currTs.Annotations[SignalResumeAnnotation]))
+		if IsErrRevMismatch(err) {
+			// consumed concurrently or the target state changed
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		cmd.ResumedStateCtx = targetStateCtx
+		e.goExecute(targetStateCtx)
+		return nil
+	}
+
+	return err
+}
+
+func (e *Engine) doWaitSignal(cmd *WaitSignalCommand) error {
+	if cmd.Name == `` {
+		return fmt.Errorf("signal name empty")
+	}
+	if cmd.To == `` {
+		return fmt.Errorf("flow id empty")
+	}
+
+	if received, err := e.receiveSignal(cmd); err != nil || received {
+		return err
+	}
+
+	if err := e.doCmd(Commit(Park(cmd.StateCtx).
+		WithAnnotation(WaitSignalAnnotation, cmd.Name).
+		WithAnnotation(SignalResumeAnnotation, string(cmd.To)).
+		skipStateMachineCheck(),
+	)); err != nil {
+		return err
+	}
+
+	// a signal sent while the state was parking has not found it waiting
+	if received, err := e.receiveSignal(cmd); IsErrRevMismatch(err) {
+		// the state is resumed by the signal sender
+		return nil
+	} else if err != nil || received {
+		return err
+	}
+
+	return nil
+}
+
+// receiveSignal consumes the oldest pending signal and transits the state, it returns false if there are no pending signals.
+func (e *Engine) receiveSignal(cmd *WaitSignalCommand) (bool, error) {
+	for {
+		signalStateCtx, err := e.pendingSignal(cmd.StateCtx.Current, cmd.Name)
+		if err != nil {
+			return false, err
+		} else if signalStateCtx == nil {
+			return false, nil
+		}
+
+		stateCtx := cmd.StateCtx.CopyTo(&StateCtx{})
+		stateCtx.sessID = cmd.StateCtx.sessID
+		if err := e.consumeSignal(signalStateCtx, stateCtx, cmd.To); IsErrRevMismatchContains(err, signalStateCtx.Current.ID) {
+			// consumed concurrently, try the next one
+			continue
+		} else if err != nil {
+			return false, err
+		}
+
+		cmd.StateCtx.moveFrom(stateCtx)
+		cmd.Received = true
+		if !cmd.sync {
+			e.goExecute(cmd.StateCtx)
+		}
+
+		return true, nil
+	}
+}
+
+func (e *Engine) pendingSignal(target State, name string) (*StateCtx, error) {
+	cursor, _ := strconv.ParseInt(target.Annotations[SignalCursorAnnotation+name], 10, 64)
+
+	it := e.Iter(GetStatesByLabels(map[string]string{
+		SignalTargetLabel: string(target.ID),
+		SignalNameLabel:   name,
+	}).WithSinceRev(cursor).WithLatestOnly())
+	for it.Next() {
+		state := it.State()
+		if state.Transition.Annotations[SignalConsumedAnnotation] != `` {
+			continue
+		}
+
+		return state.CopyToCtx(&StateCtx{}), nil
+	}
+	if err := it.Err(); err != nil {
+		return nil, fmt.Errorf("get pending signals: %w", err)
+	}
+
+	return nil, nil
+}
+
+func (e *Engine) consumeSignal(signalStateCtx, stateCtx *StateCtx, to FlowID) error {
+	if to == `` {
+		return fmt.Errorf("signal resume flow id empty")
+	}
+
+	name := signalStateCtx.Current.Labels[SignalNameLabel]
+	stateCtx.Current.SetAnnotation(SignalCursorAnnotation+name, strconv.FormatInt(signalStateCtx.Current.Rev, 10))
+
+	return e.doCmd(Commit(
+		Park(signalStateCtx).WithAnnotation(SignalConsumedAnnotation, string(stateCtx.Current.ID)),
+		Transit(stateCtx, to).
+			WithAnnotation(SignalAnnotation, name).
+			WithAnnotation(SignalIDAnnotation, string(signalStateCtx.Current.ID)).
+			WithAnnotation(SignalPayloadAnnotation, signalStateCtx.Current.Annotations[SignalPayloadAnnotation]).
+			skipStateMachineCheck(),
+	))
+}
@@ -94,9 +94,9 @@ type StateCtx struct {
 	// Transitions between committed and current states
 	Transitions []Transition
 
-	sessID int64
-	e      *Engine
-	doneCh chan struct{}
+	sessID    int64
+	ctx       context.Context
+	conflicts int
 }
 
 func (s *StateCtx) SetData(name string, d *Data) {
@@ -143,6 +143,14 @@ func (s *StateCtx) CopyTo(to *StateCtx) *StateCtx {
 	return to
 }
 
+// moveFrom replaces the states and transitions with the ones of the from state ctx.
+// Unlike CopyTo it drops annotations and labels missing in the from state ctx, the from state ctx must not be used afterwards.
+func (s *StateCtx) moveFrom(from *StateCtx) {
+	s.Current = from.Current
+	s.Committed = from.Committed
+	s.Transitions = from.Transitions
+}
+
 func (s *StateCtx) NewTo(id StateID, to *StateCtx) *StateCtx {
 	s.CopyTo(to)
 	to.Current.ID = id
@@ -153,37 +161,40 @@ func (s *StateCtx) NewTo(id StateID, to *StateCtx) *StateCtx {
 }
 
 func (s *StateCtx) Deadline() (time.Time, bool) {
-	return time.Time{}, false
+	if s.ctx == nil {
+		return time.Time{}, false
+	}
+
+	return s.ctx.Deadline()
 }
 
 func (s *StateCtx) Done() <-chan struct{} {
-	if s.e == nil {
+	if s.ctx == nil {
 		return nil
 	}
 
-	return s.doneCh
+	return s.ctx.Done()
 }
 
 func (s *StateCtx) Err() error {
-	if s.e == nil {
+	if s.ctx == nil {
 		return nil
 	}
 
-	select {
-	case <-s.doneCh:
-		return context.Canceled
-	default:
-		return nil
-	}
+	return s.ctx.Err()
 }
 
 func (s *StateCtx) Value(key any) any {
-	key1, ok := key.(string)
-	if !ok {
+	if key1, ok := key.(string); ok {
+		if v, ok := s.Current.Annotations[key1]; ok {
+			return v
+		}
+	}
+	if s.ctx == nil {
 		return nil
 	}
 
-	return s.Current.Annotations[key1]
+	return s.ctx.Value(key)
 }
 
 func (s *StateCtx) MarshalJSON() ([]byte, error) {
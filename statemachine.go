@@ -0,0 +1,250 @@
+package flowstate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+var ErrIllegalTransition = errors.New("illegal transition")
+
+// StateMachine is a declarative definition of a workflow, written in JSON or YAML.
+// It lists flows, allowed transit and delay targets, terminal flows and retry policies.
+//
+//	{
+//	  "name": "transfer",
+//	  "start": "withdraw",
+//	  "flows": {
+//	    "withdraw": {"transit": ["deposit", "failed"], "delay": ["withdraw"], "retry": {"max_attempts": 5, "retry_after": "1m"}},
+//	    "deposit":  {"transit": ["completed"]},
+//	    "completed": {"terminal": true},
+//	    "failed":    {"terminal": true}
+//	  }
+//	}
+//
+// Once loaded with LoadStateMachine the engine rejects commands that move a state executed by a machine flow off the graph with ErrIllegalTransition.
+// A state that is not executed by a machine flow may enter the machine only through the start flow.
+type StateMachine struct {
+	Name  string                      `json:"name" yaml:"name"`
+	Start FlowID                      `json:"start" yaml:"start"`
+	Flows map[FlowID]StateMachineFlow `json:"flows" yaml:"flows"`
+}
+
+type StateMachineFlow struct {
+	// Transit lists flows the state can transit to.
+	Transit []FlowID `json:"transit,omitempty" yaml:"transit,omitempty"`
+	// Delay lists flows the state can be delayed to.
+	Delay []FlowID `json:"delay,omitempty" yaml:"delay,omitempty"`
+	// Terminal allows the state to be parked.
+	Terminal bool `json:"terminal,omitempty" yaml:"terminal,omitempty"`
+	// Retry sets a recovery policy for states entering the flow.
+	Retry *RetryPolicy `json:"retry,omitempty" yaml:"retry,omitempty"`
+}
+
+// Duration is a time.Duration encoded as a string in JSON and YAML, for example "1m30s".
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	dur, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(dur)
+	return nil
+}
+
+func (d Duration) MarshalYAML() (any, error) {
+	return time.Duration(d).String(), nil
+}
+
+func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
+	var s string
+	if err := value.Decode(&s); err != nil {
+		return err
+	}
+
+	dur, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(dur)
+	return nil
+}
+
+// ParseStateMachine parses and validates a JSON state machine definition.
+func ParseStateMachine(data []byte) (*StateMachine, error) {
+	sm := &StateMachine{}
+	if err := json.Unmarshal(data, sm); err != nil {
+		return nil, fmt.Errorf("unmarshal state machine: %w", err)
+	}
+	if err := sm.Validate(); err != nil {
+		return nil, err
+	}
+
+	return sm, nil
+}
+
+// ParseStateMachineYAML parses and validates a YAML state machine definition.
+// It uses the same field names as the JSON definition, see StateMachine.
+func ParseStateMachineYAML(data []byte) (*StateMachine, error) {
+	sm := &StateMachine{}
+	if err := yaml.Unmarshal(data, sm); err != nil {
+		return nil, fmt.Errorf("unmarshal state machine: %w", err)
+	}
+	if err := sm.Validate(); err != nil {
+		return nil, err
+	}
+
+	return sm, nil
+}
+
+// Validate checks that the start flow and all transit and delay targets are defined.
+func (sm *StateMachine) Validate() error {
+	if sm.Name == `` {
+		return fmt.Errorf("state machine name empty")
+	}
+	if _, ok := sm.Flows[sm.Start]; !ok {
+		return fmt.Errorf("state machine %s: start flow %q not defined", sm.Name, sm.Start)
+	}
+
+	for id, f := range sm.Flows {
+		for _, to := range f.Transit {
+			if _, ok := sm.Flows[to]; !ok {
+				return fmt.Errorf("state machine %s: flow %s: transit flow %q not defined", sm.Name, id, to)
+			}
+		}
+		for _, to := range f.Delay {
+			if _, ok := sm.Flows[to]; !ok {
+				return fmt.Errorf("state machine %s: flow %s: delay flow %q not defined", sm.Name, id, to)
+			}
+		}
+	}
+
+	return nil
+}
+
+// LoadStateMachine registers the state machine flows in the registry.
+// The flows must contain an implementation for every flow of the state machine.
+func LoadStateMachine(fr FlowRegistry, sm *StateMachine, flows map[FlowID]Flow) error {
+	if err := sm.Validate(); err != nil {
+		return err
+	}
+
+	for id := range sm.Flows {
+		if flows[id] == nil {
+			return fmt.Errorf("state machine %s: flow %s implementation not found", sm.Name, id)
+		}
+	}
+
+	for id := range sm.Flows {
+		if err := fr.SetFlow(id, &stateMachineFlow{
+			Flow: flows[id],
+			sm:   sm,
+			id:   id,
+		}); err != nil {
+			return fmt.Errorf("state machine %s: set flow %s: %w", sm.Name, id, err)
+		}
+	}
+
+	return nil
+}
+
+type stateMachineFlow struct {
+	Flow
+	sm *StateMachine
+	id FlowID
+}
+
+// checkStateMachines validates commands against state machine definitions and applies retry policies of entered flows.
+func (e *Engine) checkStateMachines(cmd0 Command) error {
+	switch cmd := cmd0.(type) {
+	case *CommitCommand:
+		for _, subCmd := range cmd.Commands {
+			if err := e.checkStateMachines(subCmd); err != nil {
+				return err
+			}
+		}
+		return nil
+	case *TransitCommand:
+		// a state resumed by the engine after a call, a fork, a signal or an exceeded deadline continues where it was parked
+		if cmd.skipStateMachine {
+			return nil
+		}
+		return e.checkStateMachineMove(cmd.StateCtx, `transit`, cmd.To)
+	case *DelayCommand:
+		return e.checkStateMachineMove(cmd.StateCtx, `delay`, cmd.To)
+	case *ParkCommand:
+		// a state waiting for called or forked states or for a signal is not done yet, a losing forked state is cancelled
+		if cmd.skipStateMachine {
+			return nil
+		}
+		return e.checkStateMachineMove(cmd.StateCtx, `park`, ``)
+	default:
+		return nil
+	}
+}
+
+func (e *Engine) checkStateMachineMove(stateCtx *StateCtx, move string, to FlowID) error {
+	from := e.stateMachineFlow(stateCtx.Current.Transition)
+
+	var target *stateMachineFlow
+	if to != `` {
+		f, _ := e.fr.Flow(to)
+		target, _ = f.(*stateMachineFlow)
+	}
+
+	// the state is executed by a machine flow, it can move only along the graph
+	if from != nil && stateCtx.sessID != 0 {
+		def := from.sm.Flows[from.id]
+
+		switch {
+		case move == `park` && !def.Terminal:
+			return fmt.Errorf("%w: state machine %s: flow %s is not terminal", ErrIllegalTransition, from.sm.Name, from.id)
+		case move == `transit` && !slices.Contains(def.Transit, to):
+			return fmt.Errorf("%w: state machine %s: transit from %s to %s", ErrIllegalTransition, from.sm.Name, from.id, to)
+		case move == `delay` && !slices.Contains(def.Delay, to):
+			return fmt.Errorf("%w: state machine %s: delay from %s to %s", ErrIllegalTransition, from.sm.Name, from.id, to)
+		}
+	} else if target != nil && stateCtx.Current.Transition.To != to && to != target.sm.Start {
+		// a state outside the machine enters it only through the start flow;
+		// re-transits to the same flow done by Delayer or Recoverer are allowed
+		return fmt.Errorf("%w: state machine %s: %s must start with %s", ErrIllegalTransition, target.sm.Name, to, target.sm.Start)
+	}
+
+	if target != nil && stateCtx.Current.Transition.To != to {
+		if retry := target.sm.Flows[target.id].Retry; retry != nil {
+			SetRetryPolicy(stateCtx, *retry)
+		}
+	}
+
+	return nil
+}
+
+func (e *Engine) stateMachineFlow(ts Transition) *stateMachineFlow {
+	if ts.To == `` {
+		return nil
+	}
+
+	f, err := e.flow(ts)
+	if err != nil {
+		return nil
+	}
+
+	smf, _ := f.(*stateMachineFlow)
+	return smf
+}
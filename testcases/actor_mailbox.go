@@ -0,0 +1,52 @@
+package testcases
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/makasim/flowstate"
+	"github.com/stretchr/testify/require"
+)
+
+func ActorMailbox(t *testing.T, e *flowstate.Engine, fr flowstate.FlowRegistry, d flowstate.Driver) {
+	var mux sync.Mutex
+	var received []string
+
+	mustSetFlow(fr, "actor", flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+		payload, ok := flowstate.ActorMessage(stateCtx.Current)
+		if !ok {
+			return nil, fmt.Errorf("actor has no message")
+		}
+
+		mux.Lock()
+		received = append(received, payload)
+		mux.Unlock()
+
+		return flowstate.Receive(stateCtx), nil
+	}))
+
+	require.NoError(t, e.Do(flowstate.Send(`actorTID`, `msg0`)))
+
+	actorStateCtx := &flowstate.StateCtx{
+		Current: flowstate.State{
+			ID: "actorTID",
+		},
+	}
+	require.NoError(t, e.Do(flowstate.Spawn(actorStateCtx, `actor`)))
+
+	for i := 1; i < 5; i++ {
+		require.NoError(t, e.Do(flowstate.Send(`actorTID`, fmt.Sprintf("msg%d", i))))
+	}
+
+	require.Eventually(t, func() bool {
+		mux.Lock()
+		defer mux.Unlock()
+		return len(received) >= 5
+	}, time.Second*5, time.Millisecond*50)
+
+	mux.Lock()
+	defer mux.Unlock()
+	require.Equal(t, []string{`msg0`, `msg1`, `msg2`, `msg3`, `msg4`}, received)
+}
@@ -0,0 +1,93 @@
+package testcases
+
+import (
+	"testing"
+
+	"github.com/makasim/flowstate"
+	"github.com/stretchr/testify/require"
+)
+
+func CallReturn(t *testing.T, e *flowstate.Engine, fr flowstate.FlowRegistry, d flowstate.Driver) {
+	trkr := &Tracker{IncludeTaskID: true}
+
+	var returned flowstate.StateID
+	var result string
+
+	mustSetFlow(fr, "parent", flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+		Track(stateCtx, trkr)
+
+		if flowstate.Returned(stateCtx.Current) == `aChildTID` {
+			require.Equal(t, `ok`, stateCtx.Current.Transition.Annotations[`result`])
+
+			anotherChildStateCtx := &flowstate.StateCtx{
+				Current: flowstate.State{
+					ID: "anotherChildTID",
+				},
+			}
+			return flowstate.Call(stateCtx, anotherChildStateCtx, `anotherChild`).WithResume(`parentEnd`), nil
+		}
+
+		childStateCtx := &flowstate.StateCtx{
+			Current: flowstate.State{
+				ID: "aChildTID",
+			},
+		}
+		return flowstate.Call(stateCtx, childStateCtx, `child`), nil
+	}))
+	mustSetFlow(fr, "child", flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+		Track(stateCtx, trkr)
+		return flowstate.Commit(flowstate.Transit(stateCtx, `childEnd`)), nil
+	}))
+	mustSetFlow(fr, "childEnd", flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+		Track(stateCtx, trkr)
+		return flowstate.Return(stateCtx).WithAnnotation(`result`, `ok`), nil
+	}))
+	mustSetFlow(fr, "anotherChild", flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+		Track(stateCtx, trkr)
+		// a called state that parks returns to the parent
+		return flowstate.Commit(flowstate.Park(stateCtx).WithAnnotation(`result`, `parked`)), nil
+	}))
+	mustSetFlow(fr, "parentEnd", flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+		Track(stateCtx, trkr)
+
+		returned = flowstate.Returned(stateCtx.Current)
+		result = stateCtx.Current.Transition.Annotations[`result`]
+
+		return flowstate.Commit(flowstate.Park(stateCtx)), nil
+	}))
+
+	stateCtx := &flowstate.StateCtx{
+		Current: flowstate.State{
+			ID: "aTID",
+		},
+	}
+
+	require.NoError(t, e.Do(flowstate.Commit(flowstate.Transit(stateCtx, `parent`))))
+	require.NoError(t, e.Execute(stateCtx))
+
+	require.Equal(t, []string{
+		`parent:aTID`,
+		`child:aChildTID`,
+		`childEnd:aChildTID`,
+		`parent:aTID`,
+		`anotherChild:anotherChildTID`,
+		`parentEnd:aTID`,
+	}, trkr.Visited())
+
+	foundStateCtx := &flowstate.StateCtx{}
+	require.NoError(t, e.Do(flowstate.GetStateByID(foundStateCtx, `aTID`, 0)))
+	require.True(t, flowstate.Parked(foundStateCtx.Current))
+	require.Equal(t, flowstate.StateID(`anotherChildTID`), returned)
+	require.Equal(t, `parked`, result)
+
+	for _, id := range []flowstate.StateID{`aChildTID`, `anotherChildTID`} {
+		childStateCtx := &flowstate.StateCtx{}
+		require.NoError(t, e.Do(flowstate.GetStateByID(childStateCtx, id, 0)))
+		require.True(t, flowstate.Parked(childStateCtx.Current))
+		require.Empty(t, flowstate.CallParent(childStateCtx.Current))
+		require.Equal(t, `aTID`, childStateCtx.Current.Transition.Annotations[flowstate.CallReturnedAnnotation])
+	}
+
+	// a state that was not called cannot return
+	require.Error(t, e.Do(flowstate.Return(stateCtx)))
+}
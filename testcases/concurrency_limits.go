@@ -0,0 +1,60 @@
+package testcases
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/makasim/flowstate"
+	"github.com/stretchr/testify/require"
+)
+
+func ConcurrencyLimits(t *testing.T, e *flowstate.Engine, fr flowstate.FlowRegistry, d flowstate.Driver) {
+	var curr, maxCurr atomic.Int64
+
+	mustSetFlow(fr, "limited", flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+		n := curr.Add(1)
+		defer curr.Add(-1)
+		for {
+			m := maxCurr.Load()
+			if n <= m || maxCurr.CompareAndSwap(m, n) {
+				break
+			}
+		}
+
+		time.Sleep(time.Millisecond * 50)
+		return flowstate.Commit(flowstate.Park(stateCtx)), nil
+	}))
+
+	e.SetConcurrencyLimits(flowstate.ConcurrencyLimits{
+		Flows: map[flowstate.FlowID]int{
+			"limited": 2,
+		},
+		MaxSubmitted: 3,
+	})
+
+	exs := make([]*flowstate.Execution, 0, 6)
+	for i := 0; i < 6; i++ {
+		stateCtx := &flowstate.StateCtx{
+			Current: flowstate.State{
+				ID: flowstate.StateID(fmt.Sprintf("aTID%d", i)),
+			},
+		}
+		require.NoError(t, e.Do(flowstate.Transit(stateCtx, `limited`)))
+
+		ex, err := e.Submit(context.Background(), stateCtx)
+		require.NoError(t, err)
+		exs = append(exs, ex)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	for _, ex := range exs {
+		require.NoError(t, ex.Wait(ctx))
+		require.True(t, flowstate.Parked(ex.StateCtx.Current))
+	}
+
+	require.Equal(t, int64(2), maxCurr.Load())
+}
@@ -0,0 +1,86 @@
+package testcases
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/makasim/flowstate"
+	"github.com/stretchr/testify/require"
+)
+
+func ConflictPolicy(t *testing.T, e *flowstate.Engine, fr flowstate.FlowRegistry, d flowstate.Driver) {
+	arrivedCh := make(chan flowstate.StateID, 10)
+	releaseCh := make(chan struct{})
+
+	mustSetFlow(fr, "inc", flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+		counter, _ := strconv.Atoi(stateCtx.Current.Annotations["counter"])
+
+		// the flow read the state, wait for the conflicting commit before committing
+		arrivedCh <- stateCtx.Current.ID
+		<-releaseCh
+
+		stateCtx.Current.SetAnnotation("counter", strconv.Itoa(counter+1))
+		return flowstate.Commit(flowstate.Park(stateCtx)), nil
+	}))
+	require.NoError(t, e.SetConflictPolicy("inc", flowstate.RetryOnConflict(3, time.Millisecond*10)))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	execute := func(id flowstate.StateID, conflictingCmd func(stateCtx *flowstate.StateCtx) flowstate.Command) *flowstate.Execution {
+		stateCtx := &flowstate.StateCtx{
+			Current: flowstate.State{
+				ID: id,
+			},
+		}
+		require.NoError(t, e.Do(flowstate.Commit(flowstate.Transit(stateCtx, "inc"))))
+
+		ex, err := e.Submit(context.Background(), stateCtx.CopyTo(&flowstate.StateCtx{}))
+		require.NoError(t, err)
+
+		select {
+		case arrivedID := <-arrivedCh:
+			require.Equal(t, id, arrivedID)
+		case <-ctx.Done():
+			t.Fatalf("flow not executed")
+		}
+
+		require.NoError(t, e.Do(conflictingCmd(stateCtx)))
+
+		return ex
+	}
+
+	// the conflicting commit keeps the state in the flow, the flow is re-run on the latest revision
+	ex := execute("aTID", func(stateCtx *flowstate.StateCtx) flowstate.Command {
+		stateCtx.Current.SetAnnotation("counter", "1")
+		return flowstate.Commit(flowstate.Transit(stateCtx, "inc"))
+	})
+	close(releaseCh)
+	require.NoError(t, ex.Wait(ctx))
+	require.Equal(t, 1, ex.StateCtx.Conflicts())
+
+	latestStateCtx := &flowstate.StateCtx{}
+	require.NoError(t, e.Do(flowstate.GetStateByID(latestStateCtx, "aTID", 0)))
+	require.True(t, flowstate.Parked(latestStateCtx.Current))
+	require.Equal(t, "2", latestStateCtx.Current.Annotations["counter"])
+	require.Len(t, arrivedCh, 1)
+	<-arrivedCh
+
+	// the conflicting commit parks the state, the retry is dropped
+	releaseCh = make(chan struct{})
+	ex = execute("anotherTID", func(stateCtx *flowstate.StateCtx) flowstate.Command {
+		stateCtx.Current.SetAnnotation("counter", "10")
+		return flowstate.Commit(flowstate.Park(stateCtx))
+	})
+	close(releaseCh)
+	require.NoError(t, ex.Wait(ctx))
+	require.Equal(t, 1, ex.StateCtx.Conflicts())
+
+	latestStateCtx = &flowstate.StateCtx{}
+	require.NoError(t, e.Do(flowstate.GetStateByID(latestStateCtx, "anotherTID", 0)))
+	require.True(t, flowstate.Parked(latestStateCtx.Current))
+	require.Equal(t, "10", latestStateCtx.Current.Annotations["counter"])
+	require.Len(t, arrivedCh, 0)
+}
@@ -0,0 +1,72 @@
+package testcases
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/makasim/flowstate"
+	"github.com/stretchr/testify/require"
+)
+
+func Deadline(t *testing.T, e *flowstate.Engine, fr flowstate.FlowRegistry, d flowstate.Driver) {
+	trkr := &Tracker{IncludeTaskID: true}
+
+	mustSetFlow(fr, "start", flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+		Track(stateCtx, trkr)
+		return flowstate.Commit(
+			flowstate.Transit(stateCtx, `slow`).WithTimeout(time.Millisecond * 100),
+		), nil
+	}))
+	mustSetFlow(fr, "slow", flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+		Track(stateCtx, trkr)
+
+		<-stateCtx.Done()
+		return flowstate.Commit(flowstate.Transit(stateCtx, `completed`)), nil
+	}))
+	mustSetFlow(fr, "completed", flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+		Track(stateCtx, trkr)
+		return flowstate.Commit(flowstate.Park(stateCtx)), nil
+	}))
+	var timedOutReason string
+	mustSetFlow(fr, "timedOut", flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+		Track(stateCtx, trkr)
+		timedOutReason = stateCtx.Current.Transition.Annotations[flowstate.DeadlineExceededAnnotation]
+		return flowstate.Commit(flowstate.Park(stateCtx)), nil
+	}))
+
+	// transition deadline with a deadline flow
+	stateCtx := &flowstate.StateCtx{
+		Current: flowstate.State{
+			ID: "aTID",
+		},
+	}
+	flowstate.SetDeadlineFlow(stateCtx, `timedOut`)
+
+	require.NoError(t, e.Do(flowstate.Transit(stateCtx, `start`)))
+	require.NoError(t, e.Execute(stateCtx))
+	require.NoError(t, stateCtx.Err())
+
+	trkr.WaitVisitedEqual(t, []string{`start:aTID`, `slow:aTID`, `timedOut:aTID`}, time.Second)
+	require.Equal(t, `transition`, timedOutReason)
+
+	// caller context deadline aborts the execution
+	anotherStateCtx := &flowstate.StateCtx{
+		Current: flowstate.State{
+			ID: "anotherTID",
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+
+	require.NoError(t, e.Do(flowstate.Commit(flowstate.Transit(anotherStateCtx, `slow`))))
+	require.ErrorIs(t, e.ExecuteContext(ctx, anotherStateCtx), context.DeadlineExceeded)
+
+	foundStateCtx := &flowstate.StateCtx{}
+	require.NoError(t, e.Do(flowstate.GetStateByID(foundStateCtx, `anotherTID`, 0)))
+	require.Equal(t, anotherStateCtx.Current.Rev, foundStateCtx.Current.Rev)
+	require.Equal(t, flowstate.FlowID(`slow`), foundStateCtx.Current.Transition.To)
+	require.False(t, flowstate.Parked(foundStateCtx.Current))
+	require.False(t, flowstate.DeadlineExceeded(foundStateCtx.Current))
+}
@@ -0,0 +1,80 @@
+package testcases
+
+import (
+	"testing"
+	"time"
+
+	"github.com/makasim/flowstate"
+	"github.com/stretchr/testify/require"
+)
+
+func DelayCancel(t *testing.T, e *flowstate.Engine, fr flowstate.FlowRegistry, d flowstate.Driver) {
+	trkr := &Tracker{
+		IncludeTaskID: true,
+	}
+
+	mustSetFlow(fr, "first", flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+		dur, err := time.ParseDuration(stateCtx.Current.Annotation(`delay`))
+		if err != nil {
+			return nil, err
+		}
+
+		return flowstate.Delay(stateCtx, `delayed`, dur), nil
+	}))
+	mustSetFlow(fr, "delayed", flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+		Track(stateCtx, trkr)
+		return flowstate.Park(stateCtx), nil
+	}))
+
+	newStateCtx := func(id flowstate.StateID, delay time.Duration) *flowstate.StateCtx {
+		stateCtx := &flowstate.StateCtx{
+			Current: flowstate.State{
+				ID: id,
+			},
+		}
+		stateCtx.Current.SetAnnotation(`delay`, delay.String())
+
+		require.NoError(t, e.Do(flowstate.Transit(stateCtx, `first`)))
+		require.NoError(t, e.Execute(stateCtx))
+
+		return stateCtx
+	}
+
+	cancelStateCtx := newStateCtx(`aCancelTID`, time.Second*2)
+	delayStateCtx := newStateCtx(`aDelayTID`, time.Millisecond*200)
+	rescheduleStateCtx := newStateCtx(`aRescheduleTID`, time.Hour)
+
+	cancelCmd := flowstate.CancelDelay(cancelStateCtx)
+	require.NoError(t, e.Do(cancelCmd))
+	require.Len(t, cancelCmd.Result, 1)
+	require.Equal(t, cancelStateCtx.Current.ID, cancelCmd.Result[0].State.ID)
+
+	rescheduleAt := time.Now().Add(time.Millisecond * 200)
+	rescheduleCmd := flowstate.Reschedule(rescheduleStateCtx, rescheduleAt)
+	require.NoError(t, e.Do(rescheduleCmd))
+	require.Len(t, rescheduleCmd.Result, 1)
+	require.Equal(t, rescheduleStateCtx.Current.ID, rescheduleCmd.Result[0].State.ID)
+	require.Equal(t, rescheduleAt.Unix(), rescheduleCmd.Result[0].ExecuteAt.Unix())
+
+	// nothing left to cancel
+	cancelCmd = flowstate.CancelDelay(cancelStateCtx)
+	require.NoError(t, e.Do(cancelCmd))
+	require.Len(t, cancelCmd.Result, 0)
+
+	trkr.WaitSortedVisitedEqual(t, []string{
+		`delayed:aDelayTID`,
+		`delayed:aRescheduleTID`,
+	}, time.Second*20)
+
+	// already due delayed states are not pending anymore
+	cancelCmd = flowstate.CancelDelay(delayStateCtx)
+	require.NoError(t, e.Do(cancelCmd))
+	require.Len(t, cancelCmd.Result, 0)
+
+	// give the cancelled delayed state a chance to fire
+	time.Sleep(time.Second * 2)
+	require.Equal(t, []string{
+		`delayed:aDelayTID`,
+		`delayed:aRescheduleTID`,
+	}, trkr.VisitedSorted())
+}
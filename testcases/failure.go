@@ -0,0 +1,55 @@
+package testcases
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/makasim/flowstate"
+	"github.com/stretchr/testify/require"
+)
+
+func Failure(t *testing.T, e *flowstate.Engine, fr flowstate.FlowRegistry, d flowstate.Driver) {
+	mustSetFlow(fr, "panic", flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+		panic("boom")
+	}))
+	mustSetFlow(fr, "permanent", flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+		return nil, flowstate.Permanent(fmt.Errorf("invalid input"))
+	}))
+
+	panicStateCtx := &flowstate.StateCtx{
+		Current: flowstate.State{
+			ID: "aPanicTID",
+		},
+	}
+	require.NoError(t, e.Do(flowstate.Commit(flowstate.Transit(panicStateCtx, "panic"))))
+
+	var panicErr *flowstate.PanicError
+	require.True(t, errors.As(e.Execute(panicStateCtx), &panicErr))
+	require.Equal(t, "boom", panicErr.Value)
+
+	failure, ok := flowstate.StateFailure(panicStateCtx.Current)
+	require.True(t, ok)
+	require.Equal(t, "flow panic: boom", failure.Error)
+	require.Equal(t, flowstate.FlowID("panic"), failure.Flow)
+	require.False(t, failure.Permanent)
+	require.NotEmpty(t, failure.Stack)
+	require.False(t, flowstate.Parked(panicStateCtx.Current))
+
+	permanentStateCtx := &flowstate.StateCtx{
+		Current: flowstate.State{
+			ID: "aPermanentTID",
+		},
+	}
+	require.NoError(t, e.Do(flowstate.Commit(flowstate.Transit(permanentStateCtx, "permanent"))))
+	require.True(t, flowstate.IsPermanent(e.Execute(permanentStateCtx)))
+
+	latestStateCtx := &flowstate.StateCtx{}
+	require.NoError(t, e.Do(flowstate.GetStateByID(latestStateCtx, "aPermanentTID", 0)))
+
+	failure, ok = flowstate.StateFailure(latestStateCtx.Current)
+	require.True(t, ok)
+	require.Equal(t, "invalid input", failure.Error)
+	require.True(t, failure.Permanent)
+	require.True(t, flowstate.Parked(latestStateCtx.Current))
+}
@@ -0,0 +1,109 @@
+package testcases
+
+import (
+	"testing"
+	"time"
+
+	"github.com/makasim/flowstate"
+	"github.com/stretchr/testify/require"
+)
+
+func FlowVersion(t *testing.T, e *flowstate.Engine, fr0 flowstate.FlowRegistry, d flowstate.Driver) {
+	fr, ok := fr0.(*flowstate.DefaultFlowRegistry)
+	if !ok {
+		t.Skip("flow registry does not support versions")
+	}
+
+	v1Trkr := &Tracker{IncludeTaskID: true}
+	v2Trkr := &Tracker{IncludeTaskID: true}
+
+	versionedFlow := func(trkr *Tracker) flowstate.Flow {
+		return flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+			Track(stateCtx, trkr)
+
+			if stateCtx.Current.Annotations[`looped`] == `` {
+				stateCtx.Current.SetAnnotation(`looped`, `true`)
+				return flowstate.Commit(flowstate.Transit(stateCtx, `process`)), nil
+			}
+
+			return flowstate.Commit(flowstate.Park(stateCtx)), nil
+		})
+	}
+
+	require.NoError(t, fr.SetFlowVersion(`process`, `v1`, versionedFlow(v1Trkr)))
+
+	stateCtx := &flowstate.StateCtx{
+		Current: flowstate.State{
+			ID:     "aTID",
+			Labels: map[string]string{`app`: `versioned`},
+		},
+	}
+	require.NoError(t, e.Do(flowstate.Commit(flowstate.Transit(stateCtx, `process`))))
+	require.Equal(t, `v1`, flowstate.FlowVersion(stateCtx.Current))
+
+	migrateStateCtx := &flowstate.StateCtx{
+		Current: flowstate.State{
+			ID:     "migrateTID",
+			Labels: map[string]string{`app`: `versioned`},
+		},
+	}
+	require.NoError(t, e.Do(flowstate.Commit(flowstate.Transit(migrateStateCtx, `process`))))
+
+	delayedStateCtx := &flowstate.StateCtx{
+		Current: flowstate.State{
+			ID:     "delayedTID",
+			Labels: map[string]string{`app`: `versioned`},
+		},
+	}
+	require.NoError(t, e.Do(flowstate.Commit(flowstate.Transit(delayedStateCtx, `process`))))
+
+	require.NoError(t, fr.SetFlowVersion(`process`, `v2`, versionedFlow(v2Trkr)))
+
+	anotherStateCtx := &flowstate.StateCtx{
+		Current: flowstate.State{
+			ID:     "anotherTID",
+			Labels: map[string]string{`app`: `versioned`},
+		},
+	}
+	require.NoError(t, e.Do(flowstate.Commit(flowstate.Transit(anotherStateCtx, `process`))))
+	require.Equal(t, `v2`, flowstate.FlowVersion(anotherStateCtx.Current))
+
+	// in-flight state keeps its version, a new one gets the latest
+	require.NoError(t, e.Execute(stateCtx))
+	require.NoError(t, e.Execute(anotherStateCtx))
+
+	v1Trkr.WaitVisitedEqual(t, []string{`process:aTID`, `process:aTID`}, time.Second)
+	v2Trkr.WaitVisitedEqual(t, []string{`process:anotherTID`, `process:anotherTID`}, time.Second)
+
+	// the pending delay of an in-flight state is delayed again at the migrated revision
+	require.NoError(t, e.Do(flowstate.Delay(delayedStateCtx, `process`, time.Second*2)))
+
+	_, err := flowstate.MigrateFlowVersion(e, `process`, `v1`, `v2`, nil, nil)
+	require.EqualError(t, err, `labels empty`)
+
+	// migrate the remaining in-flight states
+	migrated, err := flowstate.MigrateFlowVersion(e, `process`, `v1`, `v2`, map[string]string{`app`: `versioned`}, func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (bool, error) {
+		stateCtx.Current.SetAnnotation(`migrated`, `true`)
+		return true, nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 2, migrated)
+
+	foundStateCtx := &flowstate.StateCtx{}
+	require.NoError(t, e.Do(flowstate.GetStateByID(foundStateCtx, `migrateTID`, 0)))
+	require.Equal(t, `v2`, flowstate.FlowVersion(foundStateCtx.Current))
+	require.Equal(t, `true`, foundStateCtx.Current.Annotations[`migrated`])
+
+	require.NoError(t, fr.UnsetFlowVersion(`process`, `v1`))
+
+	require.NoError(t, e.Execute(foundStateCtx))
+	v2Trkr.WaitSortedVisitedEqual(t, []string{
+		`process:anotherTID`,
+		`process:anotherTID`,
+		`process:delayedTID`,
+		`process:delayedTID`,
+		`process:migrateTID`,
+		`process:migrateTID`,
+	}, time.Second*20)
+	require.Len(t, v1Trkr.Visited(), 2)
+}
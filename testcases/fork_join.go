@@ -0,0 +1,107 @@
+package testcases
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/makasim/flowstate"
+	"github.com/stretchr/testify/require"
+)
+
+func ForkJoin(t *testing.T, e *flowstate.Engine, fr flowstate.FlowRegistry, d flowstate.Driver) {
+	trkr := &Tracker{IncludeTaskID: true}
+
+	releaseCh := make(chan struct{})
+	t.Cleanup(func() {
+		close(releaseCh)
+	})
+
+	policies := map[flowstate.StateID]flowstate.JoinPolicy{
+		`allTID`:   flowstate.JoinAll(),
+		`firstTID`: flowstate.JoinFirst(),
+		`twoTID`:   flowstate.JoinN(2),
+	}
+
+	mustSetFlow(fr, "fork", flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+		Track(stateCtx, trkr)
+
+		var children []*flowstate.StateCtx
+		for _, postfix := range []string{`-1`, `-2`, `-3`} {
+			children = append(children, &flowstate.StateCtx{
+				Current: flowstate.State{
+					ID: stateCtx.Current.ID + flowstate.StateID(postfix),
+				},
+			})
+		}
+
+		return flowstate.Fork(stateCtx, `branch`, children...).WithResume(`join`), nil
+	}))
+	mustSetFlow(fr, "branch", flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+		id := string(stateCtx.Current.ID)
+
+		// slow branches return after the join is done, they lose
+		slow := (strings.HasPrefix(id, `firstTID`) && !strings.HasSuffix(id, `-1`)) ||
+			(strings.HasPrefix(id, `twoTID`) && strings.HasSuffix(id, `-3`))
+		if slow {
+			select {
+			case <-releaseCh:
+			case <-stateCtx.Done():
+			}
+			return flowstate.Return(stateCtx), nil
+		}
+
+		return flowstate.Commit(flowstate.Park(stateCtx)), nil
+	}))
+	mustSetFlow(fr, "join", flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+		return flowstate.Join(stateCtx, policies[stateCtx.Current.ID], `joined`), nil
+	}))
+	mustSetFlow(fr, "joined", flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+		Track(stateCtx, trkr)
+		return flowstate.Commit(flowstate.Park(stateCtx)), nil
+	}))
+
+	for id := range policies {
+		stateCtx := &flowstate.StateCtx{
+			Current: flowstate.State{
+				ID: id,
+			},
+		}
+		require.NoError(t, e.Do(flowstate.Commit(flowstate.Transit(stateCtx, `fork`))))
+		require.NoError(t, e.Execute(stateCtx))
+	}
+
+	trkr.WaitSortedVisitedEqual(t, []string{
+		`fork:allTID`,
+		`fork:firstTID`,
+		`fork:twoTID`,
+		`joined:allTID`,
+		`joined:firstTID`,
+		`joined:twoTID`,
+	}, time.Second*5)
+
+	assertJoined := func(id flowstate.StateID, done int, cancelled []flowstate.StateID) {
+		t.Helper()
+
+		foundStateCtx := &flowstate.StateCtx{}
+		require.NoError(t, e.Do(flowstate.GetStateByID(foundStateCtx, id, 0)))
+		require.True(t, flowstate.Parked(foundStateCtx.Current))
+		require.Empty(t, flowstate.ForkChildren(foundStateCtx.Current))
+		require.Len(t, flowstate.JoinDone(foundStateCtx.Current), done)
+
+		for _, childID := range cancelled {
+			childStateCtx := &flowstate.StateCtx{}
+			require.NoError(t, e.Do(flowstate.GetStateByID(childStateCtx, childID, 0)))
+			require.True(t, flowstate.Parked(childStateCtx.Current))
+			require.Equal(t, string(id), childStateCtx.Current.Transition.Annotations[flowstate.JoinCancelledAnnotation])
+		}
+	}
+
+	assertJoined(`allTID`, 3, nil)
+	assertJoined(`firstTID`, 1, []flowstate.StateID{`firstTID-2`, `firstTID-3`})
+	assertJoined(`twoTID`, 2, []flowstate.StateID{`twoTID-3`})
+
+	firstStateCtx := &flowstate.StateCtx{}
+	require.NoError(t, e.Do(flowstate.GetStateByID(firstStateCtx, `firstTID`, 0)))
+	require.Equal(t, []flowstate.StateID{`firstTID-1`}, flowstate.JoinDone(firstStateCtx.Current))
+}
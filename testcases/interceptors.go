@@ -0,0 +1,137 @@
+package testcases
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/makasim/flowstate"
+	"github.com/stretchr/testify/require"
+)
+
+func Interceptors(t *testing.T, e *flowstate.Engine, fr flowstate.FlowRegistry, d flowstate.Driver) {
+	trkr := &Tracker{}
+
+	var committedMux sync.Mutex
+	var committed []flowstate.FlowID
+
+	e.InterceptFlow(
+		func(stateCtx *flowstate.StateCtx, e *flowstate.Engine, next flowstate.Flow) (flowstate.Command, error) {
+			stateCtx.Current.SetAnnotation(`tenant`, `acme`)
+			return next.Execute(stateCtx, e)
+		},
+		func(stateCtx *flowstate.StateCtx, e *flowstate.Engine, next flowstate.Flow) (flowstate.Command, error) {
+			if stateCtx.Current.Transition.To == `forbidden` {
+				return flowstate.Commit(flowstate.Park(stateCtx).WithAnnotation(`denied`, `true`)), nil
+			}
+
+			return next.Execute(stateCtx, e)
+		},
+	)
+	e.InterceptCommand(func(cmd0 flowstate.Command, next func(cmd flowstate.Command) error) error {
+		switch cmd := cmd0.(type) {
+		case *flowstate.DelayCommand:
+			return fmt.Errorf("delay not allowed")
+		case *flowstate.CommitCommand:
+			if err := next(cmd); err != nil {
+				return err
+			}
+
+			committedMux.Lock()
+			defer committedMux.Unlock()
+			for _, subCmd := range cmd.Commands {
+				if transitCmd, ok := subCmd.(*flowstate.TransitCommand); ok {
+					committed = append(committed, transitCmd.To)
+				}
+			}
+
+			return nil
+		default:
+			return next(cmd)
+		}
+	})
+
+	mustSetFlow(fr, "first", flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+		Track(stateCtx, trkr)
+		return flowstate.Commit(flowstate.Transit(stateCtx, `second`)), nil
+	}))
+	mustSetFlow(fr, "second", flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+		Track(stateCtx, trkr)
+		return flowstate.Commit(flowstate.Transit(stateCtx, `forbidden`)), nil
+	}))
+	mustSetFlow(fr, "forbidden", flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+		Track(stateCtx, trkr)
+		return flowstate.Commit(flowstate.Park(stateCtx)), nil
+	}))
+	mustSetFlow(fr, "caller", flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+		Track(stateCtx, trkr)
+		return flowstate.Commit(flowstate.Park(stateCtx)), nil
+	}))
+	mustSetFlow(fr, "callee", flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+		Track(stateCtx, trkr)
+		return flowstate.Commit(flowstate.Park(stateCtx)), nil
+	}))
+
+	mustSetFlow(fr, "limited", flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+		Track(stateCtx, trkr)
+		return flowstate.Commit(flowstate.Park(stateCtx)), nil
+	}))
+
+	stateCtx := &flowstate.StateCtx{
+		Current: flowstate.State{
+			ID: "aTID",
+		},
+	}
+
+	require.NoError(t, e.Do(flowstate.Transit(stateCtx, `first`)))
+	require.NoError(t, e.Execute(stateCtx))
+
+	trkr.WaitVisitedEqual(t, []string{`first`, `second`}, time.Second)
+
+	foundStateCtx := &flowstate.StateCtx{}
+	require.NoError(t, e.Do(flowstate.GetStateByID(foundStateCtx, `aTID`, 0)))
+	require.True(t, flowstate.Parked(foundStateCtx.Current))
+	require.Equal(t, `acme`, foundStateCtx.Current.Annotations[`tenant`])
+	require.Equal(t, `true`, foundStateCtx.Current.Transition.Annotations[`denied`])
+
+	committedMux.Lock()
+	require.Equal(t, []flowstate.FlowID{`second`, `forbidden`}, committed)
+	committedMux.Unlock()
+
+	require.EqualError(t, e.Do(flowstate.Delay(stateCtx, `first`, time.Minute)), `delay not allowed`)
+
+	// commits done by the engine on behalf of a call and its return are intercepted too
+	parentStateCtx := &flowstate.StateCtx{
+		Current: flowstate.State{
+			ID: "aParentTID",
+		},
+	}
+	childStateCtx := &flowstate.StateCtx{
+		Current: flowstate.State{
+			ID: "aChildTID",
+		},
+	}
+	require.NoError(t, e.Do(flowstate.Commit(flowstate.Transit(parentStateCtx, `caller`))))
+	require.NoError(t, e.Do(flowstate.Call(parentStateCtx, childStateCtx, `callee`)))
+
+	trkr.WaitVisitedEqual(t, []string{`first`, `second`, `callee`, `caller`}, time.Second)
+
+	committedMux.Lock()
+	require.Equal(t, []flowstate.FlowID{`second`, `forbidden`, `caller`, `callee`, `caller`}, committed)
+	committedMux.Unlock()
+
+	// so are commits of a rate limited state
+	limitedStateCtx := &flowstate.StateCtx{
+		Current: flowstate.State{
+			ID: "aLimitedTID",
+		},
+	}
+	require.NoError(t, e.Do(flowstate.NewRateLimiter(`aLimiter`, time.Minute, 1).Acquire(limitedStateCtx, `limited`)))
+
+	trkr.WaitVisitedEqual(t, []string{`first`, `second`, `callee`, `caller`, `limited`}, time.Second)
+
+	committedMux.Lock()
+	require.Equal(t, []flowstate.FlowID{`second`, `forbidden`, `caller`, `callee`, `caller`, `limited`}, committed)
+	committedMux.Unlock()
+}
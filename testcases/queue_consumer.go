@@ -0,0 +1,64 @@
+package testcases
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/makasim/flowstate"
+	"github.com/stretchr/testify/require"
+)
+
+func QueueConsumer(t *testing.T, e *flowstate.Engine, fr flowstate.FlowRegistry, d flowstate.Driver) {
+	trkr := &Tracker{
+		IncludeTaskID: true,
+	}
+
+	q := flowstate.Queue{
+		Name:        `theName`,
+		Concurrency: 2,
+	}
+
+	mustSetFlow(fr, "consume", flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+		Track(stateCtx, trkr)
+		return flowstate.Commit(flowstate.Ack(stateCtx)), nil
+	}))
+
+	for i := 0; i < 5; i++ {
+		stateCtx := &flowstate.StateCtx{
+			Current: flowstate.State{
+				ID: flowstate.StateID(fmt.Sprintf("aTID%d", i)),
+			},
+		}
+		require.NoError(t, e.Do(flowstate.Commit(q.Enqueue(stateCtx))))
+	}
+
+	l, _ := NewTestLogger(t)
+
+	// two consumers act as two processes
+	for i := 0; i < 2; i++ {
+		c, err := flowstate.NewQueueConsumer(e, q, `consume`, l)
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+			defer cancel()
+
+			require.NoError(t, c.Shutdown(ctx))
+		})
+	}
+
+	trkr.WaitSortedVisitedEqual(t, []string{
+		"consume:aTID0",
+		"consume:aTID1",
+		"consume:aTID2",
+		"consume:aTID3",
+		"consume:aTID4",
+	}, time.Second*5)
+
+	require.Eventually(t, func() bool {
+		depth, err := flowstate.GetQueueDepth(e, q.Name)
+		require.NoError(t, err)
+		return depth == flowstate.QueueDepth{}
+	}, time.Second*5, time.Millisecond*50)
+}
@@ -0,0 +1,55 @@
+package testcases
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/makasim/flowstate"
+	"github.com/stretchr/testify/require"
+)
+
+func RateLimiter(t *testing.T, e *flowstate.Engine, fr flowstate.FlowRegistry, d flowstate.Driver) {
+	trkr := &Tracker{
+		IncludeState: true,
+	}
+
+	limiter := flowstate.NewRateLimiter(`theName`, time.Second, 2)
+
+	mustSetFlow(fr, "limit", flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+		Track(stateCtx, trkr)
+		return limiter.Acquire(stateCtx, `limited`), nil
+	}))
+	mustSetFlow(fr, "limited", flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+		if flowstate.Delayed(stateCtx.Current) {
+			stateCtx.Current.SetAnnotation(`state`, `resumed`)
+		}
+		Track(stateCtx, trkr)
+
+		return flowstate.Commit(flowstate.Park(stateCtx)), nil
+	}))
+
+	for i := 0; i < 3; i++ {
+		stateCtx := &flowstate.StateCtx{
+			Current: flowstate.State{
+				ID: flowstate.StateID(fmt.Sprintf("aTID%d", i)),
+			},
+		}
+
+		require.NoError(t, e.Do(
+			flowstate.Commit(flowstate.Transit(stateCtx, `limit`)),
+			flowstate.Execute(stateCtx),
+		))
+	}
+
+	trkr.WaitSortedVisitedEqual(t, []string{
+		`limit`,
+		`limit`,
+		`limit`,
+		`limited`,
+		`limited`,
+
+		// rate limited
+		`limited:resumed`,
+	}, time.Second*10)
+}
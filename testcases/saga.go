@@ -0,0 +1,87 @@
+package testcases
+
+import (
+	"testing"
+	"time"
+
+	"github.com/makasim/flowstate"
+	"github.com/stretchr/testify/require"
+)
+
+func Saga(t *testing.T, e *flowstate.Engine, fr flowstate.FlowRegistry, d flowstate.Driver) {
+	trkr := &Tracker{IncludeTaskID: true}
+
+	step := flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+		Track(stateCtx, trkr)
+		return flowstate.Commit(flowstate.SagaNext(stateCtx)), nil
+	})
+
+	mustSetFlow(fr, "transfer", flowstate.NewSaga(`transfer`).
+		Step(`reserve`, `release`).
+		Step(`notify`, ``).
+		Step(`charge`, `refund`).
+		Step(`ship`, ``),
+	)
+	mustSetFlow(fr, "reserve", step)
+	mustSetFlow(fr, "release", step)
+	mustSetFlow(fr, "notify", step)
+	mustSetFlow(fr, "charge", step)
+	mustSetFlow(fr, "refund", step)
+	mustSetFlow(fr, "ship", flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+		Track(stateCtx, trkr)
+
+		if stateCtx.Current.ID == `failTID` {
+			return flowstate.Commit(flowstate.SagaFail(stateCtx, `out of stock`)), nil
+		}
+
+		return flowstate.Commit(flowstate.SagaNext(stateCtx)), nil
+	}))
+
+	// all steps completed
+	stateCtx := &flowstate.StateCtx{
+		Current: flowstate.State{
+			ID: "aTID",
+		},
+	}
+	require.NoError(t, e.Do(flowstate.Commit(flowstate.Transit(stateCtx, `transfer`))))
+	require.NoError(t, e.Execute(stateCtx))
+
+	trkr.WaitVisitedEqual(t, []string{
+		`reserve:aTID`,
+		`notify:aTID`,
+		`charge:aTID`,
+		`ship:aTID`,
+	}, time.Second)
+
+	foundStateCtx := &flowstate.StateCtx{}
+	require.NoError(t, e.Do(flowstate.GetStateByID(foundStateCtx, `aTID`, 0)))
+	require.True(t, flowstate.Parked(foundStateCtx.Current))
+	require.Equal(t, flowstate.SagaCompleted, flowstate.SagaStatus(foundStateCtx.Current))
+	require.Equal(t, []flowstate.FlowID{`reserve`, `notify`, `charge`, `ship`}, flowstate.SagaCompletedSteps(foundStateCtx.Current))
+
+	// the last step fails, completed steps are compensated in reverse order
+	trkr = &Tracker{IncludeTaskID: true}
+	failStateCtx := &flowstate.StateCtx{
+		Current: flowstate.State{
+			ID: "failTID",
+		},
+	}
+	require.NoError(t, e.Do(flowstate.Commit(flowstate.Transit(failStateCtx, `transfer`))))
+	require.NoError(t, e.Execute(failStateCtx))
+
+	trkr.WaitVisitedEqual(t, []string{
+		`reserve:failTID`,
+		`notify:failTID`,
+		`charge:failTID`,
+		`ship:failTID`,
+		`refund:failTID`,
+		`release:failTID`,
+	}, time.Second)
+
+	foundStateCtx = &flowstate.StateCtx{}
+	require.NoError(t, e.Do(flowstate.GetStateByID(foundStateCtx, `failTID`, 0)))
+	require.True(t, flowstate.Parked(foundStateCtx.Current))
+	require.Equal(t, flowstate.SagaCompensated, flowstate.SagaStatus(foundStateCtx.Current))
+	require.Equal(t, `out of stock`, foundStateCtx.Current.Annotations[flowstate.SagaErrorAnnotation])
+	require.Empty(t, flowstate.SagaCompletedSteps(foundStateCtx.Current))
+}
@@ -0,0 +1,66 @@
+package testcases
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/makasim/flowstate"
+	"github.com/stretchr/testify/require"
+)
+
+func Scheduler(t *testing.T, e *flowstate.Engine, fr flowstate.FlowRegistry, d flowstate.Driver) {
+	trkr := &Tracker{
+		IncludeTaskID: true,
+	}
+
+	mustSetFlow(fr, "task", flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+		Track(stateCtx, trkr)
+		return flowstate.Commit(
+			flowstate.Park(stateCtx),
+		), nil
+	}))
+
+	l, _ := NewTestLogger(t)
+
+	// two schedulers act as two processes
+	for i := 0; i < 2; i++ {
+		s, err := flowstate.NewScheduler(e, l)
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+			defer cancel()
+
+			require.NoError(t, s.Shutdown(ctx))
+		})
+	}
+
+	require.NoError(t, flowstate.CreateSchedule(e, flowstate.Schedule{
+		ID:      `aScheduleID`,
+		Cron:    `* * * * * * *`,
+		Flow:    `task`,
+		Payload: `aPayload`,
+	}))
+
+	require.Eventually(t, func() bool {
+		return len(trkr.Visited()) >= 3
+	}, time.Second*10, time.Millisecond*50)
+
+	require.NoError(t, flowstate.DeleteSchedule(e, `aScheduleID`))
+	// a tick in progress could start one more task
+	time.Sleep(time.Second * 2)
+
+	visited := trkr.Visited()
+	seen := make(map[string]struct{})
+	for _, v := range visited {
+		_, ok := seen[v]
+		require.False(t, ok, "task %s started twice", v)
+		seen[v] = struct{}{}
+	}
+
+	time.Sleep(time.Second * 2)
+	require.Equal(t, visited, trkr.Visited())
+
+	_, err := flowstate.GetSchedule(e, `aScheduleID`)
+	require.ErrorIs(t, err, flowstate.ErrNotFound)
+}
@@ -0,0 +1,75 @@
+package testcases
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/makasim/flowstate"
+	"github.com/stretchr/testify/require"
+)
+
+func Semaphore(t *testing.T, e *flowstate.Engine, fr flowstate.FlowRegistry, d flowstate.Driver) {
+	trkr := &Tracker{}
+
+	var active, maxActive atomic.Int64
+	sem := flowstate.NewSemaphore(`theName`, 2)
+
+	mustSetFlow(fr, "acquire", flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+		Track(stateCtx, trkr)
+		return sem.Acquire(stateCtx, `protected`), nil
+	}))
+	mustSetFlow(fr, "protected", flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+		Track(stateCtx, trkr)
+
+		n := active.Add(1)
+		for {
+			curr := maxActive.Load()
+			if n <= curr || maxActive.CompareAndSwap(curr, n) {
+				break
+			}
+		}
+
+		time.Sleep(time.Millisecond * 50)
+		active.Add(-1)
+
+		return sem.Release(stateCtx).WithTransit(`released`), nil
+	}))
+	mustSetFlow(fr, "released", flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+		Track(stateCtx, trkr)
+		return flowstate.Commit(flowstate.Park(stateCtx)), nil
+	}))
+
+	for i := 0; i < 5; i++ {
+		stateCtx := &flowstate.StateCtx{
+			Current: flowstate.State{
+				ID: flowstate.StateID(fmt.Sprintf("aTID%d", i)),
+			},
+		}
+
+		require.NoError(t, e.Do(
+			flowstate.Commit(flowstate.Transit(stateCtx, `acquire`)),
+			flowstate.Execute(stateCtx),
+		))
+	}
+
+	visited := trkr.WaitVisitedCountGreaterOrEqual(t, 15, time.Second*5)
+	var protectedCnt, releasedCnt int
+	for _, v := range visited {
+		switch v {
+		case "protected":
+			protectedCnt++
+		case "released":
+			releasedCnt++
+		}
+	}
+	require.Equal(t, 5, protectedCnt)
+	require.Equal(t, 5, releasedCnt)
+	require.LessOrEqual(t, maxActive.Load(), int64(2))
+
+	semStateCtx := &flowstate.StateCtx{}
+	require.NoError(t, e.Do(flowstate.GetStateByLabels(semStateCtx, map[string]string{flowstate.SemaphoreLabel: `true`})))
+	require.Empty(t, flowstate.SemaphoreHolders(semStateCtx.Current))
+	require.Empty(t, flowstate.SemaphoreWaiters(semStateCtx.Current))
+}
@@ -0,0 +1,110 @@
+package testcases
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/makasim/flowstate"
+	"github.com/stretchr/testify/require"
+)
+
+func Signal(t *testing.T, e *flowstate.Engine, fr flowstate.FlowRegistry, d flowstate.Driver) {
+	trkr := &Tracker{IncludeTaskID: true}
+
+	mustSetFlow(fr, "wait", flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+		Track(stateCtx, trkr)
+		return flowstate.WaitSignal(stateCtx, `approve`, `approved`), nil
+	}))
+	mustSetFlow(fr, "approved", flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+		Track(stateCtx, trkr)
+
+		name, payload, ok := flowstate.ReceivedSignal(stateCtx.Current)
+		require.True(t, ok)
+		require.Equal(t, `approve`, name)
+
+		return flowstate.Commit(flowstate.Park(stateCtx).WithAnnotation(`payload`, payload)), nil
+	}))
+
+	// the state waits for the signal
+	stateCtx := &flowstate.StateCtx{
+		Current: flowstate.State{
+			ID: "aTID",
+		},
+	}
+	require.NoError(t, e.Do(flowstate.Commit(flowstate.Transit(stateCtx, `wait`))))
+	require.NoError(t, e.Execute(stateCtx))
+
+	foundStateCtx := &flowstate.StateCtx{}
+	require.NoError(t, e.Do(flowstate.GetStateByID(foundStateCtx, `aTID`, 0)))
+	require.True(t, flowstate.Parked(foundStateCtx.Current))
+	require.Equal(t, `approve`, foundStateCtx.Current.Transition.Annotations[flowstate.WaitSignalAnnotation])
+
+	signalCmd := flowstate.Signal(`aTID`, `approve`, `aPayload`)
+	require.NoError(t, e.Do(signalCmd))
+	require.NotNil(t, signalCmd.ResumedStateCtx)
+
+	// the signal is pending until the state waits for it
+	require.NoError(t, e.Do(flowstate.Signal(`anotherTID`, `approve`, `anotherPayload`)))
+
+	anotherStateCtx := &flowstate.StateCtx{
+		Current: flowstate.State{
+			ID: "anotherTID",
+		},
+	}
+	require.NoError(t, e.Do(flowstate.Commit(flowstate.Transit(anotherStateCtx, `wait`))))
+	require.NoError(t, e.Execute(anotherStateCtx))
+
+	trkr.WaitSortedVisitedEqual(t, []string{
+		`approved:aTID`,
+		`approved:anotherTID`,
+		`wait:aTID`,
+		`wait:anotherTID`,
+	}, time.Second)
+
+	require.Eventually(t, func() bool {
+		for id, expPayload := range map[flowstate.StateID]string{
+			`aTID`:       `aPayload`,
+			`anotherTID`: `anotherPayload`,
+		} {
+			foundStateCtx := &flowstate.StateCtx{}
+			require.NoError(t, e.Do(flowstate.GetStateByID(foundStateCtx, id, 0)))
+			if !flowstate.Parked(foundStateCtx.Current) || foundStateCtx.Current.Transition.Annotations[`payload`] != expPayload {
+				return false
+			}
+		}
+		return true
+	}, time.Second, time.Millisecond*50)
+
+	// signals are consumed
+	getCmd := flowstate.GetStatesByLabels(map[string]string{
+		flowstate.SignalNameLabel: `approve`,
+	}).WithLatestOnly()
+	require.NoError(t, e.Do(getCmd))
+
+	res := getCmd.MustResult()
+	require.Len(t, res.States, 2)
+	for _, state := range res.States {
+		require.NotEmpty(t, state.Transition.Annotations[flowstate.SignalConsumedAnnotation])
+	}
+
+	// the target state remembers the last consumed signal, older signals are not scanned again
+	allGetCmd := flowstate.GetStatesByLabels(map[string]string{
+		flowstate.SignalNameLabel: `approve`,
+	})
+	require.NoError(t, e.Do(allGetCmd))
+
+	sentRevs := make(map[flowstate.StateID]int64)
+	for _, state := range allGetCmd.MustResult().States {
+		target := flowstate.StateID(state.Labels[flowstate.SignalTargetLabel])
+		if _, ok := sentRevs[target]; !ok {
+			sentRevs[target] = state.Rev
+		}
+	}
+	require.Len(t, sentRevs, 2)
+	for id, sentRev := range sentRevs {
+		foundStateCtx := &flowstate.StateCtx{}
+		require.NoError(t, e.Do(flowstate.GetStateByID(foundStateCtx, id, 0)))
+		require.Equal(t, strconv.FormatInt(sentRev, 10), foundStateCtx.Current.Annotations[flowstate.SignalCursorAnnotation+`approve`])
+	}
+}
@@ -0,0 +1,97 @@
+package testcases
+
+import (
+	"testing"
+	"time"
+
+	"github.com/makasim/flowstate"
+	"github.com/stretchr/testify/require"
+)
+
+func StateMachine(t *testing.T, e *flowstate.Engine, fr flowstate.FlowRegistry, d flowstate.Driver) {
+	sm, err := flowstate.ParseStateMachine([]byte(`{
+  "name": "transfer",
+  "start": "withdraw",
+  "flows": {
+    "withdraw": {"transit": ["deposit", "failed"], "retry": {"max_attempts": 5}},
+    "deposit": {"transit": ["completed"]},
+    "completed": {"terminal": true},
+    "failed": {"terminal": true}
+  }
+}`))
+	require.NoError(t, err)
+
+	// the same definition in YAML
+	yamlSM, err := flowstate.ParseStateMachineYAML([]byte(`
+name: transfer
+start: withdraw
+flows:
+  withdraw:
+    transit: [deposit, failed]
+    retry:
+      max_attempts: 5
+  deposit:
+    transit: [completed]
+  completed:
+    terminal: true
+  failed:
+    terminal: true
+`))
+	require.NoError(t, err)
+	require.Equal(t, sm, yamlSM)
+
+	trkr := &Tracker{}
+
+	var illegalTransitErr, illegalParkErr, annotatedTransitErr error
+	require.NoError(t, flowstate.LoadStateMachine(fr, sm, map[flowstate.FlowID]flowstate.Flow{
+		`withdraw`: flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+			Track(stateCtx, trkr)
+			return flowstate.Commit(flowstate.Transit(stateCtx, `deposit`)), nil
+		}),
+		`deposit`: flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+			Track(stateCtx, trkr)
+
+			illegalTransitErr = e.Do(flowstate.Commit(flowstate.Transit(stateCtx, `withdraw`)))
+			illegalParkErr = e.Do(flowstate.Commit(flowstate.Park(stateCtx)))
+			// annotations set by the engine on resumed states do not bypass the check
+			annotatedTransitErr = e.Do(flowstate.Commit(flowstate.Transit(stateCtx, `withdraw`).
+				WithAnnotation(flowstate.DeadlineExceededAnnotation, `state`)))
+
+			return flowstate.Commit(flowstate.Transit(stateCtx, `completed`)), nil
+		}),
+		`completed`: flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+			Track(stateCtx, trkr)
+			return flowstate.Commit(flowstate.Park(stateCtx)), nil
+		}),
+		`failed`: flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+			Track(stateCtx, trkr)
+			return flowstate.Commit(flowstate.Park(stateCtx)), nil
+		}),
+	}))
+
+	// a state enters the machine only through the start flow
+	anotherStateCtx := &flowstate.StateCtx{
+		Current: flowstate.State{
+			ID: "anotherTID",
+		},
+	}
+	require.ErrorIs(t, e.Do(flowstate.Commit(flowstate.Transit(anotherStateCtx, `deposit`))), flowstate.ErrIllegalTransition)
+
+	stateCtx := &flowstate.StateCtx{
+		Current: flowstate.State{
+			ID: "aTID",
+		},
+	}
+	require.NoError(t, e.Do(flowstate.Commit(flowstate.Transit(stateCtx, `withdraw`))))
+	require.Equal(t, 5, flowstate.MaxRecoveryAttempts(stateCtx.Current))
+	require.NoError(t, e.Execute(stateCtx))
+
+	trkr.WaitVisitedEqual(t, []string{`withdraw`, `deposit`, `completed`}, time.Second)
+	require.ErrorIs(t, illegalTransitErr, flowstate.ErrIllegalTransition)
+	require.ErrorIs(t, illegalParkErr, flowstate.ErrIllegalTransition)
+	require.ErrorIs(t, annotatedTransitErr, flowstate.ErrIllegalTransition)
+
+	foundStateCtx := &flowstate.StateCtx{}
+	require.NoError(t, e.Do(flowstate.GetStateByID(foundStateCtx, `aTID`, 0)))
+	require.True(t, flowstate.Parked(foundStateCtx.Current))
+}
@@ -92,21 +92,31 @@ func Get(setUp func(t *testing.T) flowstate.Driver) *Suite {
 		SetUpDelayer: true,
 
 		cases: map[string]func(t *testing.T, e *flowstate.Engine, fr flowstate.FlowRegistry, d flowstate.Driver){
-			"Actor": Actor,
+			"Actor":        Actor,
+			"ActorMailbox": ActorMailbox,
 
 			"CallFlow":           CallFlow,
 			"CallFlowWithCommit": CallFlowWithCommit,
 			"CallFlowWithWatch":  CallFlowWithWatch,
+			"CallReturn":         CallReturn,
 
-			"Condition": Condition,
+			"ConcurrencyLimits": ConcurrencyLimits,
+			"Condition":         Condition,
+			"ConflictPolicy":    ConflictPolicy,
 
 			"DataFlowConfig":         DataFlowConfig,
 			"DataStoreGet":           DataStoreGet,
 			"DataStoreGetWithCommit": DataStoreGetWithCommit,
 
-			"Delay": Delay,
+			"Deadline":    Deadline,
+			"Delay":       Delay,
+			"DelayCancel": DelayCancel,
+
+			"Failure":     Failure,
+			"FlowVersion": FlowVersion,
 
 			"Fork":              Fork,
+			"ForkJoin":          ForkJoin,
 			"ForkJoinFirstWins": ForkJoin_FirstWins,
 			"ForkJoinLastWins":  ForkJoin_LastWins,
 			"ForkWithCommit":    Fork_WithCommit,
@@ -123,9 +133,13 @@ func Get(setUp func(t *testing.T) flowstate.Driver) *Suite {
 			"GetManySinceTime":   GetManySinceTime,
 			"GetManyLatestOnly":  GetManyLatestOnly,
 
-			"Mutex":     Mutex,
-			"Queue":     Queue,
-			"RateLimit": RateLimit,
+			"Interceptors": Interceptors,
+
+			"Mutex":         Mutex,
+			"Queue":         Queue,
+			"QueueConsumer": QueueConsumer,
+			"RateLimit":     RateLimit,
+			"RateLimiter":   RateLimiter,
 
 			"SingleNode":                   SingleNode,
 			"ThreeConsequentNodes":         ThreeConsequentNodes,
@@ -140,8 +154,17 @@ func Get(setUp func(t *testing.T) flowstate.Driver) *Suite {
 
 			"Cron": Cron,
 
-			"StoreData": StoreData,
-			"GetData":   GetData,
+			"Saga":      Saga,
+			"Scheduler": Scheduler,
+			"Semaphore": Semaphore,
+			"Signal":    Signal,
+
+			"StateMachine": StateMachine,
+			"StoreData":    StoreData,
+			"GetData":      GetData,
+
+			"Tracing":   Tracing,
+			"TypedFlow": TypedFlow,
 		},
 	}
 }
@@ -0,0 +1,99 @@
+package testcases
+
+import (
+	"testing"
+	"time"
+
+	"github.com/makasim/flowstate"
+	"github.com/stretchr/testify/require"
+)
+
+func Tracing(t *testing.T, e *flowstate.Engine, fr flowstate.FlowRegistry, d flowstate.Driver) {
+	exp := &flowstate.MemorySpanExporter{}
+	e.SetSpanExporter(exp)
+	defer e.SetSpanExporter(nil)
+
+	trkr := &Tracker{IncludeTaskID: true}
+
+	mustSetFlow(fr, "parent", flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+		Track(stateCtx, trkr)
+
+		childStateCtx := &flowstate.StateCtx{
+			Current: flowstate.State{
+				ID: "childTID",
+			},
+		}
+
+		if err := e.Do(flowstate.Commit(
+			flowstate.Transit(stateCtx, `parked`),
+			flowstate.Transit(childStateCtx, `child`),
+		)); err != nil {
+			return nil, err
+		}
+
+		if err := e.Do(flowstate.Execute(childStateCtx)); err != nil {
+			return nil, err
+		}
+
+		return flowstate.Noop(), nil
+	}))
+	mustSetFlow(fr, "child", flowstate.FlowFunc(func(stateCtx *flowstate.StateCtx, e *flowstate.Engine) (flowstate.Command, error) {
+		Track(stateCtx, trkr)
+		return flowstate.Commit(flowstate.Park(stateCtx)), nil
+	}))
+
+	stateCtx := &flowstate.StateCtx{
+		Current: flowstate.State{
+			ID: "aTID",
+		},
+	}
+
+	require.NoError(t, e.Do(flowstate.Commit(flowstate.Transit(stateCtx, `parent`))))
+	require.NoError(t, e.Execute(stateCtx))
+
+	trkr.WaitVisitedEqual(t, []string{`parent:aTID`, `child:childTID`}, time.Second)
+
+	// wait for the child session to finish
+	require.Eventually(t, func() bool {
+		var sessions int
+		for _, span := range exp.Spans() {
+			if span.Name == `engine.execute` {
+				sessions++
+			}
+		}
+		return sessions == 2
+	}, time.Second, time.Millisecond*50)
+
+	spans := exp.Spans()
+	traceID := spans[0].TraceID
+	require.NotEmpty(t, traceID)
+
+	names := make(map[string]int)
+	spanIDs := make(map[string]bool)
+	for _, span := range spans {
+		require.Equal(t, traceID, span.TraceID)
+		require.NotEmpty(t, span.SpanID)
+		names[span.Name]++
+		spanIDs[span.SpanID] = true
+	}
+	require.Equal(t, 2, names[`engine.execute`])
+	require.Equal(t, 2, names[`flow.execute`])
+	require.Equal(t, 2, names[`driver.commit`])
+
+	// every span except the root one has a parent within the trace
+	var roots int
+	for _, span := range spans {
+		if span.ParentID == `` {
+			roots++
+			continue
+		}
+		require.True(t, spanIDs[span.ParentID], "parent span %s not found", span.ParentID)
+	}
+	require.Equal(t, 1, roots)
+
+	// the trace context is stored with the states
+	childStateCtx := &flowstate.StateCtx{}
+	require.NoError(t, e.Do(flowstate.GetStateByID(childStateCtx, `childTID`, 0)))
+	require.Equal(t, traceID, childStateCtx.Current.Annotations[flowstate.TraceIDAnnotation])
+	require.NotEmpty(t, childStateCtx.Current.Annotations[flowstate.TraceSpanIDAnnotation])
+}
@@ -0,0 +1,66 @@
+package testcases
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/makasim/flowstate"
+	"github.com/stretchr/testify/require"
+)
+
+type typedCounter struct {
+	Count int `json:"count"`
+}
+
+func TypedFlow(t *testing.T, e *flowstate.Engine, fr flowstate.FlowRegistry, d flowstate.Driver) {
+	stateCtx := &flowstate.StateCtx{
+		Current: flowstate.State{
+			ID: "aTID",
+		},
+	}
+
+	trkr := &Tracker{}
+
+	var incDataRef, readDataRef string
+	mustSetFlow(fr, "inc", flowstate.Typed(`counter`, func(stateCtx *flowstate.StateCtx, v typedCounter, e *flowstate.Engine) (flowstate.Command, typedCounter, error) {
+		Track(stateCtx, trkr)
+
+		v.Count++
+		if v.Count < 3 {
+			return flowstate.Commit(flowstate.Transit(stateCtx, `inc`)), v, nil
+		}
+
+		return flowstate.Commit(flowstate.Transit(stateCtx, `read`)), v, nil
+	}))
+	mustSetFlow(fr, "read", flowstate.Typed(`counter`, func(stateCtx *flowstate.StateCtx, v typedCounter, e *flowstate.Engine) (flowstate.Command, typedCounter, error) {
+		Track(stateCtx, trkr)
+
+		incDataRef = stateCtx.Current.Annotations[`flowstate.data.counter`]
+		if v.Count != 3 {
+			return nil, v, nil
+		}
+
+		return flowstate.Commit(flowstate.Park(stateCtx)), v, nil
+	}))
+
+	require.NoError(t, e.Do(flowstate.Commit(flowstate.Transit(stateCtx, `inc`))))
+	require.NoError(t, e.Execute(stateCtx))
+
+	trkr.WaitVisitedEqual(t, []string{`inc`, `inc`, `inc`, `read`}, time.Second)
+
+	foundStateCtx := &flowstate.StateCtx{}
+	require.NoError(t, e.Do(flowstate.GetStateByID(foundStateCtx, `aTID`, 0)))
+	require.True(t, flowstate.Parked(foundStateCtx.Current))
+
+	// the unchanged value is not stored again
+	readDataRef = foundStateCtx.Current.Annotations[`flowstate.data.counter`]
+	require.NotEmpty(t, readDataRef)
+	require.Equal(t, incDataRef, readDataRef)
+
+	require.NoError(t, e.Do(flowstate.GetData(foundStateCtx, `counter`)))
+
+	actCounter := typedCounter{}
+	require.NoError(t, json.Unmarshal(foundStateCtx.MustData(`counter`).Blob, &actCounter))
+	require.Equal(t, typedCounter{Count: 3}, actCounter)
+}
@@ -0,0 +1,270 @@
+package flowstate
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"math/rand/v2"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var TraceIDAnnotation = `flowstate.trace.id`
+var TraceSpanIDAnnotation = `flowstate.trace.span_id`
+
+// Span describes a finished unit of work: an Engine.Execute session, a flow step or a driver call.
+type Span struct {
+	TraceID   string            `json:"trace_id"`
+	SpanID    string            `json:"span_id"`
+	ParentID  string            `json:"parent_id,omitempty"`
+	Name      string            `json:"name"`
+	StartedAt time.Time         `json:"started_at"`
+	EndedAt   time.Time         `json:"ended_at"`
+	Attrs     map[string]string `json:"attrs,omitempty"`
+	Error     string            `json:"error,omitempty"`
+}
+
+// SpanExporter receives finished spans.
+// ExportSpan is called synchronously from the engine so it must not block for long.
+type SpanExporter interface {
+	ExportSpan(span Span)
+}
+
+// SetSpanExporter enables tracing of the engine; pass nil to disable it.
+//
+// The engine starts a span for each Engine.Execute session, each flow step and each driver call done on behalf of an executed state.
+// The trace context is stored in the state annotations, so a state resumed by Delayer, Recoverer or executed by a remote netflow continues the same trace.
+func (e *Engine) SetSpanExporter(exp SpanExporter) {
+	if exp == nil {
+		e.tracer.Store(nil)
+		return
+	}
+
+	e.tracer.Store(&tracer{exp: exp})
+}
+
+// MemorySpanExporter keeps finished spans in memory.
+type MemorySpanExporter struct {
+	mux   sync.Mutex
+	spans []Span
+}
+
+func (exp *MemorySpanExporter) ExportSpan(span Span) {
+	exp.mux.Lock()
+	defer exp.mux.Unlock()
+
+	exp.spans = append(exp.spans, span)
+}
+
+// Spans returns a copy of the exported spans in the order they finished.
+func (exp *MemorySpanExporter) Spans() []Span {
+	exp.mux.Lock()
+	defer exp.mux.Unlock()
+
+	return append([]Span(nil), exp.spans...)
+}
+
+// JSONSpanExporter writes finished spans to w as JSON lines, one span per line.
+type JSONSpanExporter struct {
+	mux sync.Mutex
+	enc *json.Encoder
+}
+
+func NewJSONSpanExporter(w io.Writer) *JSONSpanExporter {
+	return &JSONSpanExporter{
+		enc: json.NewEncoder(w),
+	}
+}
+
+func (exp *JSONSpanExporter) ExportSpan(span Span) {
+	exp.mux.Lock()
+	defer exp.mux.Unlock()
+
+	_ = exp.enc.Encode(span)
+}
+
+type tracer struct {
+	exp SpanExporter
+}
+
+type activeSpan struct {
+	t    *tracer
+	span Span
+}
+
+type spanCtxKey struct{}
+
+func (t *tracer) start(name string, traceID, parentID string) *activeSpan {
+	if traceID == `` {
+		traceID = newTraceID()
+		parentID = ``
+	}
+
+	return &activeSpan{
+		t: t,
+		span: Span{
+			TraceID:   traceID,
+			SpanID:    newSpanID(),
+			ParentID:  parentID,
+			Name:      name,
+			StartedAt: time.Now(),
+			Attrs:     make(map[string]string),
+		},
+	}
+}
+
+// startChild starts a span that is a child of the span found in ctx or a new root span.
+// It returns nil if tracing is disabled.
+func (t *tracer) startChild(ctx context.Context, name string) *activeSpan {
+	if t == nil {
+		return nil
+	}
+
+	if parent := spanFromContext(ctx); parent != nil {
+		return t.start(name, parent.span.TraceID, parent.span.SpanID)
+	}
+
+	return t.start(name, ``, ``)
+}
+
+// startSession starts a session span that continues the trace stored in the state annotations or found in ctx.
+func (t *tracer) startSession(ctx context.Context, stateCtx *StateCtx) *activeSpan {
+	if t == nil {
+		return nil
+	}
+
+	var s *activeSpan
+	if traceID := stateCtx.Current.Annotations[TraceIDAnnotation]; traceID != `` {
+		s = t.start(`engine.execute`, traceID, stateCtx.Current.Annotations[TraceSpanIDAnnotation])
+	} else {
+		s = t.startChild(ctx, `engine.execute`)
+	}
+
+	s.setAttr(`sess`, strconv.FormatInt(stateCtx.sessID, 10))
+	s.setAttr(`id`, string(stateCtx.Current.ID))
+
+	return s
+}
+
+func (s *activeSpan) setAttr(key, value string) {
+	if s == nil {
+		return
+	}
+
+	s.span.Attrs[key] = value
+}
+
+// inject stores the span trace context in the state annotations.
+func (s *activeSpan) inject(stateCtx *StateCtx) {
+	if s == nil {
+		return
+	}
+
+	stateCtx.Current.SetAnnotation(TraceIDAnnotation, s.span.TraceID)
+	stateCtx.Current.SetAnnotation(TraceSpanIDAnnotation, s.span.SpanID)
+}
+
+func (s *activeSpan) end(err error) {
+	if s == nil {
+		return
+	}
+
+	s.span.EndedAt = time.Now()
+	if err != nil {
+		s.span.Error = err.Error()
+	}
+
+	s.t.exp.ExportSpan(s.span)
+}
+
+func contextWithSpan(ctx context.Context, s *activeSpan) context.Context {
+	if s == nil {
+		return ctx
+	}
+
+	return context.WithValue(ctx, spanCtxKey{}, s)
+}
+
+func spanFromContext(ctx context.Context) *activeSpan {
+	if ctx == nil {
+		return nil
+	}
+
+	s, _ := ctx.Value(spanCtxKey{}).(*activeSpan)
+	return s
+}
+
+// traceDispatch wraps command dispatching with driver call spans.
+func (t *tracer) traceDispatch(next func(cmd Command) error) func(cmd Command) error {
+	return func(cmd Command) error {
+		s := t.startCmdSpan(cmd)
+		err := next(cmd)
+		s.end(err)
+		return err
+	}
+}
+
+// startCmdSpan starts a driver call span if any of the command states is executed in a traced session.
+// States committed without a trace context, for example states created by a flow, inherit the driver call span.
+func (t *tracer) startCmdSpan(cmd0 Command) *activeSpan {
+	var name string
+	switch cmd0.(type) {
+	case *CommitCommand:
+		name = `driver.commit`
+	case *DelayCommand:
+		name = `driver.delay`
+	case *StoreDataCommand:
+		name = `driver.store_data`
+	case *GetDataCommand:
+		name = `driver.get_data`
+	default:
+		return nil
+	}
+
+	stateCtxs := commandStateCtxs(cmd0)
+
+	var parent *activeSpan
+	for _, stateCtx := range stateCtxs {
+		if parent = spanFromContext(stateCtx.ctx); parent != nil {
+			break
+		}
+	}
+	if parent == nil {
+		return nil
+	}
+
+	s := t.start(name, parent.span.TraceID, parent.span.SpanID)
+	s.setAttr(`sess`, strconv.FormatInt(cmdsSessID(cmd0), 10))
+
+	if _, ok := cmd0.(*CommitCommand); ok {
+		for _, stateCtx := range stateCtxs {
+			if stateCtx.Current.Annotations[TraceIDAnnotation] == `` {
+				s.inject(stateCtx)
+			}
+		}
+	}
+
+	return s
+}
+
+func newTraceID() string {
+	b := make([]byte, 16)
+	for i := 0; i < 16; i += 8 {
+		putUint64(b[i:], rand.Uint64())
+	}
+	return hex.EncodeToString(b)
+}
+
+func newSpanID() string {
+	b := make([]byte, 8)
+	putUint64(b, rand.Uint64())
+	return hex.EncodeToString(b)
+}
+
+func putUint64(b []byte, v uint64) {
+	for i := 0; i < 8; i++ {
+		b[i] = byte(v >> (56 - 8*i))
+	}
+}
@@ -0,0 +1,196 @@
+package flowstate
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// Codec encodes and decodes typed flow values to and from Data blobs.
+type Codec interface {
+	Marshal(v any) ([]byte, error)
+	Unmarshal(b []byte, v any) error
+	// Binary reports whether encoded values are binary, see Data.SetBinary.
+	Binary() bool
+}
+
+// JSONCodec encodes values with encoding/json.
+var JSONCodec Codec = jsonCodec{}
+
+// GobCodec encodes values with encoding/gob.
+var GobCodec Codec = gobCodec{}
+
+// ProtoCodec encodes protobuf messages.
+// A value must implement MarshalProtobuf(dst []byte) []byte and UnmarshalProtobuf(src []byte) error, as easyproto based messages do,
+// or Marshal() ([]byte, error) and Unmarshal([]byte) error, as gogo and vtprotobuf generated messages do.
+var ProtoCodec Codec = protoCodec{}
+
+// TypedFlowFunc is a flow that receives a decoded value and returns a command together with the updated value.
+type TypedFlowFunc[T any] func(stateCtx *StateCtx, v T, e *Engine) (Command, T, error)
+
+// TypedFlow is a Flow that keeps a value of type T in the state data under the alias.
+//
+// Before the function is called the data is fetched with GetData, if the state references it, and decoded.
+// A state without the data gets the zero value.
+// After the function returns the value is encoded and stored with StoreData.
+// The data is written only if the encoded value has changed, so the state keeps referencing the same data revision otherwise.
+type TypedFlow[T any] struct {
+	alias string
+	codec Codec
+	fn    TypedFlowFunc[T]
+}
+
+// Typed creates a typed flow that stores its value under the alias using JSONCodec.
+func Typed[T any](alias string, fn TypedFlowFunc[T]) *TypedFlow[T] {
+	return &TypedFlow[T]{
+		alias: alias,
+		codec: JSONCodec,
+		fn:    fn,
+	}
+}
+
+func (f *TypedFlow[T]) WithCodec(codec Codec) *TypedFlow[T] {
+	f.codec = codec
+	return f
+}
+
+func (f *TypedFlow[T]) Execute(stateCtx *StateCtx, e *Engine) (Command, error) {
+	v, err := GetTyped[T](stateCtx, e, f.alias, f.codec)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd, v, err := f.fn(stateCtx, v, e)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := StoreTyped[T](stateCtx, e, f.alias, f.codec, v); err != nil {
+		return nil, err
+	}
+
+	return cmd, nil
+}
+
+// GetTyped fetches the data referenced by the state under the alias and decodes it.
+// The zero value is returned if the state references no data under the alias and has no such data set.
+func GetTyped[T any](stateCtx *StateCtx, e *Engine, alias string, codec Codec) (T, error) {
+	var v T
+
+	if stateCtx.Current.Annotations[attachDataAnnotation(alias)] != `` {
+		if err := e.Do(GetData(stateCtx, alias)); err != nil {
+			return v, fmt.Errorf("get data %q: %w", alias, err)
+		}
+	}
+
+	d, ok := stateCtx.Datas[alias]
+	if !ok || len(d.Blob) == 0 {
+		return v, nil
+	}
+
+	if err := codec.Unmarshal(d.Blob, &v); err != nil {
+		return v, fmt.Errorf("unmarshal data %q: %w", alias, err)
+	}
+
+	return v, nil
+}
+
+// StoreTyped encodes the value and stores it as the state data under the alias.
+// The driver is not called if the encoded value equals to the stored one.
+func StoreTyped[T any](stateCtx *StateCtx, e *Engine, alias string, codec Codec, v T) error {
+	b, err := codec.Marshal(&v)
+	if err != nil {
+		return fmt.Errorf("marshal data %q: %w", alias, err)
+	}
+
+	d, ok := stateCtx.Datas[alias]
+	if !ok {
+		d = &Data{}
+		stateCtx.SetData(alias, d)
+	}
+	d.Blob = append(d.Blob[:0], b...)
+	d.SetBinary(codec.Binary())
+
+	if err := e.Do(StoreData(stateCtx, alias)); err != nil {
+		return fmt.Errorf("store data %q: %w", alias, err)
+	}
+
+	return nil
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(b []byte, v any) error {
+	return json.Unmarshal(b, v)
+}
+
+func (jsonCodec) Binary() bool {
+	return false
+}
+
+type gobCodec struct{}
+
+func (gobCodec) Marshal(v any) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := gob.NewEncoder(buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(b []byte, v any) error {
+	return gob.NewDecoder(bytes.NewReader(b)).Decode(v)
+}
+
+func (gobCodec) Binary() bool {
+	return true
+}
+
+type protoCodec struct{}
+
+func (protoCodec) Marshal(v any) ([]byte, error) {
+	switch m := protoMessage(v).(type) {
+	case interface{ MarshalProtobuf(dst []byte) []byte }:
+		return m.MarshalProtobuf(nil), nil
+	case interface{ Marshal() ([]byte, error) }:
+		return m.Marshal()
+	default:
+		return nil, fmt.Errorf("%T is not a protobuf message", v)
+	}
+}
+
+func (protoCodec) Unmarshal(b []byte, v any) error {
+	switch m := protoMessage(v).(type) {
+	case interface{ UnmarshalProtobuf(src []byte) error }:
+		return m.UnmarshalProtobuf(b)
+	case interface{ Unmarshal([]byte) error }:
+		return m.Unmarshal(b)
+	default:
+		return fmt.Errorf("%T is not a protobuf message", v)
+	}
+}
+
+func (protoCodec) Binary() bool {
+	return true
+}
+
+// protoMessage returns the message behind v.
+// Typed flows pass a pointer to the value, so a value of a message pointer type, for example **Msg, is dereferenced and allocated if nil.
+func protoMessage(v any) any {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Ptr {
+		return v
+	}
+
+	if rv.Elem().IsNil() {
+		rv.Elem().Set(reflect.New(rv.Elem().Type().Elem()))
+	}
+
+	return rv.Elem().Interface()
+}
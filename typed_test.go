@@ -0,0 +1,58 @@
+package flowstate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testProtoMsg struct {
+	Blob []byte
+}
+
+func (m *testProtoMsg) MarshalProtobuf(dst []byte) []byte {
+	return append(dst, m.Blob...)
+}
+
+func (m *testProtoMsg) UnmarshalProtobuf(src []byte) error {
+	m.Blob = append(m.Blob[:0], src...)
+	return nil
+}
+
+func TestCodecs(t *testing.T) {
+	type value struct {
+		Name  string
+		Count int
+	}
+
+	for name, codec := range map[string]Codec{
+		`json`: JSONCodec,
+		`gob`:  GobCodec,
+	} {
+		t.Run(name, func(t *testing.T) {
+			exp := value{Name: `foo`, Count: 3}
+
+			b, err := codec.Marshal(&exp)
+			require.NoError(t, err)
+
+			act := value{}
+			require.NoError(t, codec.Unmarshal(b, &act))
+			require.Equal(t, exp, act)
+		})
+	}
+
+	t.Run(`proto`, func(t *testing.T) {
+		exp := &testProtoMsg{Blob: []byte(`foo`)}
+
+		b, err := ProtoCodec.Marshal(&exp)
+		require.NoError(t, err)
+		require.Equal(t, []byte(`foo`), b)
+
+		var act *testProtoMsg
+		require.NoError(t, ProtoCodec.Unmarshal(b, &act))
+		require.Equal(t, exp, act)
+
+		_, err = ProtoCodec.Marshal(&struct{}{})
+		require.Error(t, err)
+	})
+}
@@ -391,6 +391,11 @@ export class Command extends Message<Command> {
    */
   getData?: GetDataCommand;
 
+  /**
+   * @generated from field: flowstate.v1.CancelDelayCommand cancel_delay = 23;
+   */
+  cancelDelay?: CancelDelayCommand;
+
   constructor(data?: PartialMessage<Command>) {
     super();
     proto3.util.initPartial(data, this);
@@ -414,6 +419,7 @@ export class Command extends Message<Command> {
     { no: 20, name: "get_delayed_states", kind: "message", T: GetDelayedStatesCommand },
     { no: 21, name: "store_data", kind: "message", T: StoreDataCommand },
     { no: 22, name: "get_data", kind: "message", T: GetDataCommand },
+    { no: 23, name: "cancel_delay", kind: "message", T: CancelDelayCommand },
   ]);
 
   static fromBinary(bytes: Uint8Array, options?: Partial<BinaryReadOptions>): Command {
@@ -641,6 +647,59 @@ export class DelayCommand extends Message<DelayCommand> {
   }
 }
 
+/**
+ * @generated from message flowstate.v1.CancelDelayCommand
+ */
+export class CancelDelayCommand extends Message<CancelDelayCommand> {
+  /**
+   * @generated from field: flowstate.v1.StateCtxRef state_ref = 1;
+   */
+  stateRef?: StateCtxRef;
+
+  /**
+   * Reschedule delayed states to the time instead of cancelling, optional
+   *
+   * @generated from field: int64 reschedule_at_sec = 2;
+   */
+  rescheduleAtSec = protoInt64.zero;
+
+  /**
+   * Cancelled or rescheduled delayed states
+   *
+   * @generated from field: repeated flowstate.v1.DelayedState result = 3;
+   */
+  result: DelayedState[] = [];
+
+  constructor(data?: PartialMessage<CancelDelayCommand>) {
+    super();
+    proto3.util.initPartial(data, this);
+  }
+
+  static readonly runtime: typeof proto3 = proto3;
+  static readonly typeName = "flowstate.v1.CancelDelayCommand";
+  static readonly fields: FieldList = proto3.util.newFieldList(() => [
+    { no: 1, name: "state_ref", kind: "message", T: StateCtxRef },
+    { no: 2, name: "reschedule_at_sec", kind: "scalar", T: 3 /* ScalarType.INT64 */ },
+    { no: 3, name: "result", kind: "message", T: DelayedState, repeated: true },
+  ]);
+
+  static fromBinary(bytes: Uint8Array, options?: Partial<BinaryReadOptions>): CancelDelayCommand {
+    return new CancelDelayCommand().fromBinary(bytes, options);
+  }
+
+  static fromJson(jsonValue: JsonValue, options?: Partial<JsonReadOptions>): CancelDelayCommand {
+    return new CancelDelayCommand().fromJson(jsonValue, options);
+  }
+
+  static fromJsonString(jsonString: string, options?: Partial<JsonReadOptions>): CancelDelayCommand {
+    return new CancelDelayCommand().fromJsonString(jsonString, options);
+  }
+
+  static equals(a: CancelDelayCommand | PlainMessage<CancelDelayCommand> | undefined, b: CancelDelayCommand | PlainMessage<CancelDelayCommand> | undefined): boolean {
+    return proto3.util.equals(CancelDelayCommand, a, b);
+  }
+}
+
 /**
  * @generated from message flowstate.v1.CommitCommand
  */
@@ -1161,6 +1220,16 @@ export class GetDelayedStatesCommand extends Message<GetDelayedStatesCommand> {
    */
   result?: GetDelayedStatesResult;
 
+  /**
+   * @generated from field: int64 shard = 6;
+   */
+  shard = protoInt64.zero;
+
+  /**
+   * @generated from field: int64 shards = 7;
+   */
+  shards = protoInt64.zero;
+
   constructor(data?: PartialMessage<GetDelayedStatesCommand>) {
     super();
     proto3.util.initPartial(data, this);
@@ -1174,6 +1243,8 @@ export class GetDelayedStatesCommand extends Message<GetDelayedStatesCommand> {
     { no: 3, name: "offset", kind: "scalar", T: 3 /* ScalarType.INT64 */ },
     { no: 4, name: "limit", kind: "scalar", T: 3 /* ScalarType.INT64 */ },
     { no: 5, name: "result", kind: "message", T: GetDelayedStatesResult },
+    { no: 6, name: "shard", kind: "scalar", T: 3 /* ScalarType.INT64 */ },
+    { no: 7, name: "shards", kind: "scalar", T: 3 /* ScalarType.INT64 */ },
   ]);
 
   static fromBinary(bytes: Uint8Array, options?: Partial<BinaryReadOptions>): GetDelayedStatesCommand {
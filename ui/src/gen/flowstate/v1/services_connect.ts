@@ -57,6 +57,15 @@ export const Driver = {
       O: Command,
       kind: MethodKind.Unary,
     },
+    /**
+     * @generated from rpc flowstate.v1.Driver.CancelDelay
+     */
+    cancelDelay: {
+      name: "CancelDelay",
+      I: Command,
+      O: Command,
+      kind: MethodKind.Unary,
+    },
     /**
      * @generated from rpc flowstate.v1.Driver.Commit
      */
@@ -0,0 +1,149 @@
+package flowstate
+
+import (
+	"fmt"
+)
+
+// FlowVersionAnnotation is a transition annotation that pins the transition to a flow version.
+// The engine sets it on transit and delay commands if the flow registry is a VersionedFlowRegistry.
+// A state transiting to the flow it is already executing stays on the same version, other transitions are pinned to the latest version.
+var FlowVersionAnnotation = `flowstate.flow.version`
+
+// FlowVersion returns the flow version the state transition is pinned to.
+func FlowVersion(state State) string {
+	return state.Transition.Annotations[FlowVersionAnnotation]
+}
+
+// MigrateFunc upgrades an in-flight state before it is pinned to a new flow version.
+// It may change the state annotations, labels and data.
+// Return false to leave the state on the old version.
+type MigrateFunc func(stateCtx *StateCtx, e *Engine) (bool, error)
+
+// MigrateFlowVersion pins in-flight states matching the labels with a transition to the flow version from to the flow version to.
+// The labels are required, so the driver returns only states of the flow rather than every state in the store.
+// The fn is called for each such state, it can be nil.
+// States changed concurrently are skipped, the function can be called again to migrate them.
+//
+// The migration commits the state at a new revision, while a delayed state is fired only at the revision it was delayed at.
+// Pending delayed states of a migrated state are cancelled in the migration commit and delayed again at the new revision,
+// delayed transitions to the flow version from are pinned to the flow version to.
+// Delayed states already due are not delayed again, the Delayer drops them if it has not fired them before the migration.
+func MigrateFlowVersion(e *Engine, id FlowID, from, to string, labels map[string]string, fn MigrateFunc) (int, error) {
+	if from == to {
+		return 0, fmt.Errorf("from and to versions are equal")
+	}
+	if len(labels) == 0 {
+		return 0, fmt.Errorf("labels empty")
+	}
+
+	var migrated int
+
+	iter := e.Iter(GetStatesByLabels(labels).WithLatestOnly())
+	for iter.Next() {
+		state := iter.State()
+		if state.Transition.To != id || FlowVersion(state) != from {
+			continue
+		}
+
+		stateCtx := state.CopyToCtx(&StateCtx{})
+		if fn != nil {
+			if ok, err := fn(stateCtx, e); err != nil {
+				return migrated, fmt.Errorf("migrate state %s:%d: %w", state.ID, state.Rev, err)
+			} else if !ok {
+				continue
+			}
+		}
+
+		cancelCmd := CancelDelay(stateCtx)
+		if err := e.Do(Commit(
+			Transit(stateCtx, id).
+				WithAnnotations(stateCtx.Current.Transition.Annotations).
+				WithAnnotation(FlowVersionAnnotation, to),
+			cancelCmd,
+		)); IsErrRevMismatch(err) {
+			continue
+		} else if err != nil {
+			return migrated, fmt.Errorf("commit state %s:%d: %w", state.ID, state.Rev, err)
+		}
+
+		for _, delayedState := range cancelCmd.Result {
+			if err := e.Do(migrateDelay(stateCtx, delayedState, id, from, to)); err != nil {
+				return migrated, fmt.Errorf("delay state %s:%d: %w", stateCtx.Current.ID, stateCtx.Current.Rev, err)
+			}
+		}
+
+		migrated++
+	}
+	if err := iter.Err(); err != nil {
+		return migrated, err
+	}
+
+	return migrated, nil
+}
+
+// migrateDelay delays the migrated state again the way the cancelled delayed state was delayed.
+func migrateDelay(stateCtx *StateCtx, delayedState DelayedState, id FlowID, from, to string) *DelayCommand {
+	ts := delayedState.State.Transition
+	cmd := DelayUntil(stateCtx, ts.To, delayedState.ExecuteAt).
+		WithCommit(ts.Annotations[DelayCommitAnnotation] != `false`)
+	for name, value := range ts.Annotations {
+		if name == DelayUntilAnnotation || name == DelayCommitAnnotation {
+			continue
+		}
+		cmd.WithAnnotation(name, value)
+	}
+	if ts.To == id && FlowVersion(delayedState.State) == from {
+		cmd.WithAnnotation(FlowVersionAnnotation, to)
+	}
+
+	return cmd
+}
+
+// flow returns the flow for the transition taking the pinned flow version into account.
+func (e *Engine) flow(ts Transition) (Flow, error) {
+	version := ts.Annotations[FlowVersionAnnotation]
+	if vfr, ok := e.fr.(VersionedFlowRegistry); ok && version != `` {
+		return vfr.FlowVersion(ts.To, version)
+	}
+
+	return e.fr.Flow(ts.To)
+}
+
+// pinFlowVersions pins transitions of the command to flow versions.
+func (e *Engine) pinFlowVersions(cmd0 Command) {
+	vfr, ok := e.fr.(VersionedFlowRegistry)
+	if !ok {
+		return
+	}
+
+	switch cmd := cmd0.(type) {
+	case *CommitCommand:
+		for _, subCmd := range cmd.Commands {
+			e.pinFlowVersions(subCmd)
+		}
+	case *TransitCommand:
+		if cmd.Annotations[FlowVersionAnnotation] != `` {
+			return
+		}
+		if version := pinnedFlowVersion(vfr, cmd.StateCtx, cmd.To); version != `` {
+			cmd.WithAnnotation(FlowVersionAnnotation, version)
+		}
+	case *DelayCommand:
+		if cmd.Annotations[FlowVersionAnnotation] != `` {
+			return
+		}
+		if version := pinnedFlowVersion(vfr, cmd.StateCtx, cmd.To); version != `` {
+			cmd.WithAnnotation(FlowVersionAnnotation, version)
+		}
+	}
+}
+
+func pinnedFlowVersion(vfr VersionedFlowRegistry, stateCtx *StateCtx, to FlowID) string {
+	if stateCtx.Current.Transition.To == to {
+		if version := FlowVersion(stateCtx.Current); version != `` {
+			return version
+		}
+	}
+
+	return vfr.LatestFlowVersion(to)
+}